@@ -36,13 +36,14 @@ var BuildCmd = &cobra.Command{
 		}
 		return nil
 	},
-	Run: func(cmd *cobra.Command, args []string) {
-		info := gdc.NewComposeInfo(ComposeFile, Services)
-		gdc.Build(args[0], info, NoCache)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		info := newComposeInfo()
+		return gdc.Build(cmd.Context(), args[0], info, NoCache)
 	},
 }
 
 func init() {
 	BuildCmd.Flags().BoolVarP(&NoCache, "no-cache", "n", false, "Build the image without using the cache")
+	BuildCmd.Flags().BoolVar(&Relogin, "relogin", false, "Log in to registries again even if a cached login hasn't expired")
 	rootCmd.AddCommand(BuildCmd)
 }
@@ -0,0 +1,81 @@
+/*
+Package commands Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/wishabi/global-docker-compose/gdc"
+)
+
+// ClaimsFormat format to print the claims in (table or json)
+var ClaimsFormat string
+
+// ClaimsCmd represents the claims command
+var ClaimsCmd = &cobra.Command{
+	Use:   "claims",
+	Short: "Show which projects are using which services",
+	Long: `
+	Show the services each project has brought up with up. down and stop leave
+	services running while another project still claims them, unless given --force.
+
+	Claims are kept in ~/.gdc/state and dropped when the project brings the
+	services down, or when its directory no longer exists.
+
+	Usage: global_docker_compose claims
+	       global_docker_compose claims --format json
+	`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if ClaimsFormat != "table" && ClaimsFormat != "json" {
+			return fmt.Errorf("invalid --format %s - expected table or json", ClaimsFormat)
+		}
+		claims, err := gdc.Claims()
+		if err != nil {
+			return err
+		}
+		if ClaimsFormat == "json" {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(claims)
+		}
+		if len(claims) == 0 {
+			fmt.Println("No services are claimed by any project.")
+			return nil
+		}
+		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, "PROJECT\tSERVICES\tSINCE")
+		for _, claim := range claims {
+			fmt.Fprintf(writer, "%s\t%s\t%s\n",
+				claim.Project,
+				strings.Join(claim.Services, ", "),
+				claim.Updated.Local().Format(time.RFC822),
+			)
+		}
+		return writer.Flush()
+	},
+}
+
+func init() {
+	ClaimsCmd.Flags().StringVar(&ClaimsFormat, "format", "table", "Output format (table or json)")
+	rootCmd.AddCommand(ClaimsCmd)
+}
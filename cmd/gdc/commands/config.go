@@ -16,22 +16,102 @@ limitations under the License.
 package commands
 
 import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
 	"github.com/spf13/cobra"
 	"github.com/wishabi/global-docker-compose/gdc"
+	"gopkg.in/yaml.v3"
 )
 
+// ShowOrigin print where each configuration value came from
+var ShowOrigin bool
+
 // ConfigCmd represents the config command
 var ConfigCmd = &cobra.Command{
 	Use:    "config",
 	Short:  "Show information that would be generated by the Docker Compose command",
 	Args: cobra.NoArgs,
-	Run: func(cmd *cobra.Command, args []string) {
-		info := gdc.NewComposeInfo(ComposeFile, Services)
-		gdc.Config(info)
-		gdc.Cleanup()
+	RunE: func(cmd *cobra.Command, args []string) error {
+		info := newComposeInfo()
+		return gdc.Config(cmd.Context(), info)
+	},
+}
+
+// ConfigShowCmd represents the config show command
+var ConfigShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the effective gdc configuration",
+	Long: `
+	Show the configuration gdc uses after merging ~/.gdc.yml, the project's .gdc.yml,
+	GDC_* environment variables and command line flags.
+
+	Usage: global_docker_compose config show --origin
+	`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		shown := config
+		shown.Registries = map[string]gdc.RegistryAuth{}
+		for host, auth := range config.Registries {
+			if auth.Token != "" {
+				auth.Token = "********"
+			}
+			shown.Registries[host] = auth
+		}
+		if !ShowOrigin {
+			encoder := yaml.NewEncoder(os.Stdout)
+			encoder.SetIndent(2)
+			if err := encoder.Encode(shown); err != nil {
+				return err
+			}
+			return encoder.Close()
+		}
+		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, "KEY\tVALUE\tORIGIN")
+		fmt.Fprintf(writer, "services\t%s\t%s\n", strings.Join(config.Services, ","), config.origins["services"])
+		fmt.Fprintf(writer, "compose_files\t%s\t%s\n", strings.Join(config.ComposeFiles, ","), config.origins["compose_files"])
+		rows := []string{}
+		if config.KafkaTopics != "" {
+			rows = append(rows, fmt.Sprintf("kafka_topics\t%s\t%s", config.KafkaTopics, config.origins["kafka_topics"]))
+		}
+		if config.DynamodbTables != "" {
+			rows = append(rows, fmt.Sprintf("dynamodb_tables\t%s\t%s", config.DynamodbTables, config.origins["dynamodb_tables"]))
+		}
+		for service, ports := range config.Ports {
+			for target, published := range ports {
+				key := fmt.Sprintf("ports.%s.%d", service, target)
+				rows = append(rows, fmt.Sprintf("%s\t%d\t%s", key, published, config.origins[key]))
+			}
+		}
+		for name, value := range config.Environment {
+			key := "environment." + name
+			rows = append(rows, fmt.Sprintf("%s\t%s\t%s", key, value, config.origins[key]))
+		}
+		for name, projectName := range config.EnvNames {
+			key := "env_names." + name
+			rows = append(rows, fmt.Sprintf("%s\t%s\t%s", key, projectName, config.origins[key]))
+		}
+		for name, query := range config.OpensearchQueries {
+			key := "opensearch_queries." + name
+			rows = append(rows, fmt.Sprintf("%s\t%s\t%s", key, describeQuery(query), config.origins[key]))
+		}
+		for host, auth := range shown.Registries {
+			key := "registries." + host
+			rows = append(rows, fmt.Sprintf("%s\t%s\t%s", key, auth.Type, config.origins[key]))
+		}
+		sort.Strings(rows)
+		for _, row := range rows {
+			fmt.Fprintln(writer, row)
+		}
+		return writer.Flush()
 	},
 }
 
 func init() {
+	ConfigShowCmd.Flags().BoolVar(&ShowOrigin, "origin", false, "Show where each value came from")
+	ConfigCmd.AddCommand(ConfigShowCmd)
 	rootCmd.AddCommand(ConfigCmd)
 }
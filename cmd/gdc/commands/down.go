@@ -20,6 +20,9 @@ import (
 	"github.com/wishabi/global-docker-compose/gdc"
 )
 
+// Force act on services even if other projects still use them
+var Force bool
+
 // DownCmd represents the down command
 var DownCmd = &cobra.Command{
 	Use:    "down",
@@ -27,21 +30,24 @@ var DownCmd = &cobra.Command{
 	Long:   `
 	Bring down either specified or all Docker containers.
 
+	Services another project brought up and still uses are left running, unless
+	--force is given. See the claims command.
+
 	Usage: global_docker_compose down {service}
 				 global_docker_compose down
 	`,
 	Args: cobra.MaximumNArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		info := gdc.NewComposeInfo(ComposeFile, Services)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		info := newComposeInfo()
 		if len(args) > 0 {
-			gdc.Down(info, args[0])
-		} else {
-			gdc.Down(info, "")
+			return gdc.Down(cmd.Context(), info, args[0], Force)
 		}
-		gdc.Cleanup()
+		return gdc.Down(cmd.Context(), info, "", Force)
 	},
 }
 
 func init() {
+	DownCmd.Flags().BoolVar(&Force, "force", false, "Bring down services even if other projects still use them")
+	addCompanionFlags(DownCmd)
 	rootCmd.AddCommand(DownCmd)
 }
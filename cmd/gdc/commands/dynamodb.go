@@ -0,0 +1,176 @@
+/*
+Package commands Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/wishabi/global-docker-compose/gdc"
+)
+
+// TablesFile tables file to apply
+var TablesFile string
+
+// DynamodbExportOutput file to write the export to
+var DynamodbExportOutput string
+
+// DynamodbExportSegments number of segments to scan in parallel
+var DynamodbExportSegments int
+
+// DynamodbImportWorkers number of batches to write in parallel
+var DynamodbImportWorkers int
+
+// DynamodbImportResume carry on from where an interrupted import stopped
+var DynamodbImportResume bool
+
+// DynamodbCmd represents the dynamodb command
+var DynamodbCmd = &cobra.Command{
+	Use:   "dynamodb",
+	Short: "Work with the dynamodb service's tables",
+}
+
+// DynamodbApplyCmd represents the dynamodb apply command
+var DynamodbApplyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Create and update tables to match a tables file",
+	Long: `
+	Create and update tables in DynamoDB Local from a tables file, in YAML or
+	JSON. Each table is given as the AWS CLI's create-table takes it, with an
+	optional TimeToLiveSpecification and Items to seed it with:
+
+	tables:
+	  - TableName: orders
+	    AttributeDefinitions:
+	      - {AttributeName: id, AttributeType: S}
+	      - {AttributeName: customer, AttributeType: S}
+	    KeySchema:
+	      - {AttributeName: id, KeyType: HASH}
+	    GlobalSecondaryIndexes:
+	      - IndexName: by-customer
+	        KeySchema:
+	          - {AttributeName: customer, KeyType: HASH}
+	        Projection: {ProjectionType: ALL}
+	    TimeToLiveSpecification: {AttributeName: expires_at, Enabled: true}
+	    Items:
+	      - {id: order-1, customer: c-1, total: 5}
+
+	A file holding a single table, such as the JSON given to create-table with
+	--cli-input-json, works too. Items are plain values or DynamoDB JSON.
+
+	apply creates missing tables, adds missing global secondary indexes, sets
+	TTL and puts the seed items that aren't there yet, printing the plan first.
+	With --dry-run only the plan is printed. Set dynamodb_tables in .gdc.yml to
+	apply the file whenever up brings up dynamodb.
+
+	Usage: global_docker_compose dynamodb apply -f tables.yml
+	`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if TablesFile == "" {
+			TablesFile = config.DynamodbTables
+		}
+		if TablesFile == "" {
+			return errors.New("no tables file given - use -f or set dynamodb_tables in .gdc.yml")
+		}
+		info := newComposeInfo()
+		return gdc.ApplyTablesFile(cmd.Context(), info, TablesFile, os.Stdout)
+	},
+}
+
+// DynamodbExportCmd represents the dynamodb export command
+var DynamodbExportCmd = &cobra.Command{
+	Use:   "export <table>",
+	Short: "Export a table's items as DynamoDB JSON",
+	Long: `
+	Export every item in a table in DynamoDB Local as newline-delimited DynamoDB
+	JSON, one {"Item": {...}} per line as DynamoDB's exports to S3 write them.
+	Segments of the table are scanned in parallel. Output files ending in .gz or
+	.zst are compressed. Without --output the items are written to stdout.
+
+	Usage: global_docker_compose dynamodb export orders -o orders.json.gz
+	`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		info := newComposeInfo()
+		count, err := gdc.DynamodbExport(cmd.Context(), info, args[0], gdc.DynamodbExportOptions{
+			Output:   DynamodbExportOutput,
+			Segments: DynamodbExportSegments,
+			Progress: os.Stderr,
+		})
+		if err != nil {
+			return err
+		}
+		if !DryRun {
+			fmt.Fprintf(os.Stderr, "Exported %d items from %s\n", count, args[0])
+		}
+		return nil
+	},
+}
+
+// DynamodbImportCmd represents the dynamodb import command
+var DynamodbImportCmd = &cobra.Command{
+	Use:   "import <table> <file>",
+	Short: "Import items into a table from DynamoDB JSON",
+	Long: `
+	Import items into a table in DynamoDB Local from a file, or stdin if it is
+	-, written by dynamodb export. Each line is an item in DynamoDB JSON, on its
+	own or under "Item", or with plain values. Files ending in .gz or .zst are
+	decompressed.
+
+	Items are written in batches of 25, several at a time, and items DynamoDB
+	throttles are retried with backoff. Existing items with the same keys are
+	replaced. If an import fails part way through, run it again with --resume
+	to carry on from where it stopped.
+
+	Usage: global_docker_compose dynamodb import orders orders.json.gz
+	`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		info := newComposeInfo()
+		count, err := gdc.DynamodbImport(cmd.Context(), info, args[0], args[1], gdc.DynamodbImportOptions{
+			Workers:  DynamodbImportWorkers,
+			Resume:   DynamodbImportResume,
+			Progress: os.Stderr,
+		})
+		var importErr *gdc.DynamodbImportError
+		if errors.As(err, &importErr) && cmd.Context().Err() != nil {
+			// Execute only reports the interruption, so say how to resume
+			fmt.Fprintln(os.Stderr, importErr)
+		}
+		if err != nil {
+			return err
+		}
+		if !DryRun {
+			fmt.Fprintf(os.Stderr, "Imported %d items into %s\n", count, args[0])
+		}
+		return nil
+	},
+}
+
+func init() {
+	DynamodbExportCmd.Flags().StringVarP(&DynamodbExportOutput, "output", "o", "", "File to write the items to, compressed if it ends in .gz or .zst")
+	DynamodbExportCmd.Flags().IntVar(&DynamodbExportSegments, "segments", 4, "Number of segments of the table to scan in parallel")
+	DynamodbImportCmd.Flags().IntVar(&DynamodbImportWorkers, "workers", 4, "Number of batches to write in parallel")
+	DynamodbImportCmd.Flags().BoolVar(&DynamodbImportResume, "resume", false, "Carry on from where an interrupted import of the file stopped")
+	DynamodbCmd.AddCommand(DynamodbExportCmd)
+	DynamodbCmd.AddCommand(DynamodbImportCmd)
+	DynamodbApplyCmd.Flags().StringVarP(&TablesFile, "file", "f", "", "Tables file to apply (default is dynamodb_tables from .gdc.yml)")
+	DynamodbCmd.AddCommand(DynamodbApplyCmd)
+	rootCmd.AddCommand(DynamodbCmd)
+}
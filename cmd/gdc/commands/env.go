@@ -0,0 +1,72 @@
+/*
+Package commands Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/wishabi/global-docker-compose/gdc"
+)
+
+// EnvFormat format to print the variables in
+var EnvFormat string
+
+// EnvFrom perspective to build the connection settings from (host or container)
+var EnvFrom string
+
+// EnvCmd represents the env command
+var EnvCmd = &cobra.Command{
+	Use:   "env",
+	Short: "Print connection settings for the requested services",
+	Long: `
+	Print environment variables apps can use to connect to the requested services
+	and their companions, e.g. DATABASE_URL, REDIS_URL and KAFKA_BROKERS.
+
+	--from host (the default) gives addresses for apps running on your machine,
+	taking port overrides into account. --from container gives addresses for apps
+	running in containers on the same Docker network, e.g. broker:29092 for Kafka.
+
+	Variables can be renamed, or left out by renaming them to "", with env_names
+	in .gdc.yml.
+
+	Usage: global_docker_compose env > .env
+	       eval "$(global_docker_compose env --format shell)"
+	       global_docker_compose env --format json --from container
+	`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		info := newComposeInfo()
+		vars, err := gdc.Env(info, EnvFrom)
+		if err != nil {
+			return err
+		}
+		vars = gdc.RenameEnv(vars, config.EnvNames)
+		if EnvFormat == "direnv" && config.ProjectDir != "" {
+			// have direnv reload when the project's services change
+			fmt.Printf("watch_file %s\n", gdc.ShellQuote(config.ProjectDir+"/"+projectConfigName))
+		}
+		return gdc.PrintEnv(os.Stdout, vars, EnvFormat)
+	},
+}
+
+func init() {
+	EnvCmd.Flags().StringVar(&EnvFormat, "format", "dotenv", "Output format (dotenv, shell, json or direnv)")
+	EnvCmd.Flags().StringVar(&EnvFrom, "from", gdc.FromHost, "Where the services are connected to from (host or container)")
+	addCompanionFlags(EnvCmd)
+	rootCmd.AddCommand(EnvCmd)
+}
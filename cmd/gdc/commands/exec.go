@@ -32,15 +32,20 @@ var ExecCmd = &cobra.Command{
 	Example: Start a Bash terminal on the redis container
 	
 	global_docker_compose exec redis bash
+
+	Flags after the service are passed on to the command, e.g.
+
+	global_docker_compose exec redis sh -c "echo a b"
 	`,
 	Args: cobra.MinimumNArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		info := gdc.NewComposeInfo(ComposeFile, Services)
-		gdc.Exec(info, args[0], args[1:])
-		gdc.Cleanup()
+	RunE: func(cmd *cobra.Command, args []string) error {
+		info := newComposeInfo()
+		return gdc.Exec(cmd.Context(), info, args[0], args[1:])
 	},
 }
 
 func init() {
+	// everything after the service is the command, including its flags
+	ExecCmd.Flags().SetInterspersed(false)
 	rootCmd.AddCommand(ExecCmd)
 }
@@ -0,0 +1,494 @@
+/*
+Package commands Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/wishabi/global-docker-compose/gdc"
+)
+
+// TopicsFile topics file to apply
+var TopicsFile string
+
+// TopicsFormat format to print topics in (table or json)
+var TopicsFormat string
+
+// TopicsInternal include internal topics when listing
+var TopicsInternal bool
+
+// TopicsYes don't ask for confirmation before deleting
+var TopicsYes bool
+
+// MessagesFile file to produce messages from or consume them to
+var MessagesFile string
+
+// ProduceOptions options for kafka produce
+var ProduceOptions gdc.ProduceOptions
+
+// ConsumeOptions options for kafka consume
+var ConsumeOptions gdc.ConsumeOptions
+
+// GroupsFormat format to print consumer groups in (table or json)
+var GroupsFormat string
+
+// GroupsResetTo position to reset a consumer group's offsets to
+var GroupsResetTo string
+
+// GroupsResetTopics topics to reset a consumer group's offsets in
+var GroupsResetTopics []string
+
+// KafkaCmd represents the kafka command
+var KafkaCmd = &cobra.Command{
+	Use:   "kafka",
+	Short: "Work with the kafka service's broker",
+}
+
+// KafkaTopicsCmd represents the kafka topics command
+var KafkaTopicsCmd = &cobra.Command{
+	Use:   "topics",
+	Short: "Manage topics on the kafka service's broker",
+	Long: `
+	Create and update topics from a topics file, and list, describe or delete them.
+
+	A topics file declares the topics a project needs:
+
+	topics:
+	  - name: orders
+	    partitions: 3
+	    config:
+	      cleanup.policy: compact
+
+	apply creates missing topics, adds partitions and sets the declared configs,
+	printing the plan first. With --dry-run only the plan is printed. Set
+	kafka_topics in .gdc.yml to apply the file whenever up brings up kafka.
+
+	Usage: global_docker_compose kafka topics apply -f topics.yml
+	       global_docker_compose kafka topics list
+	       global_docker_compose kafka topics describe orders
+	       global_docker_compose kafka topics delete orders
+	`,
+}
+
+// KafkaTopicsApplyCmd represents the kafka topics apply command
+var KafkaTopicsApplyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Create and update topics to match a topics file",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if TopicsFile == "" {
+			TopicsFile = config.KafkaTopics
+		}
+		if TopicsFile == "" {
+			return errors.New("no topics file given - use -f or set kafka_topics in .gdc.yml")
+		}
+		info := newComposeInfo()
+		return gdc.ApplyTopicsFile(cmd.Context(), info, TopicsFile, os.Stdout)
+	},
+}
+
+// KafkaTopicsListCmd represents the kafka topics list command
+var KafkaTopicsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the topics on the broker",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if TopicsFormat != "table" && TopicsFormat != "json" {
+			return fmt.Errorf("invalid --format %s - expected table or json", TopicsFormat)
+		}
+		info := newComposeInfo()
+		topics, err := gdc.Topics(cmd.Context(), info, TopicsInternal)
+		if err != nil {
+			return err
+		}
+		if TopicsFormat == "json" {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(topics)
+		}
+		if len(topics) == 0 {
+			fmt.Println("No topics.")
+			return nil
+		}
+		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, "TOPIC\tPARTITIONS\tREPLICATION")
+		for _, topic := range topics {
+			fmt.Fprintf(writer, "%s\t%d\t%d\n", topic.Name, topic.Partitions, topic.ReplicationFactor)
+		}
+		return writer.Flush()
+	},
+}
+
+// KafkaTopicsDescribeCmd represents the kafka topics describe command
+var KafkaTopicsDescribeCmd = &cobra.Command{
+	Use:   "describe <topic>",
+	Short: "Show a topic's partitions, offsets and configs",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if TopicsFormat != "table" && TopicsFormat != "json" {
+			return fmt.Errorf("invalid --format %s - expected table or json", TopicsFormat)
+		}
+		info := newComposeInfo()
+		description, err := gdc.DescribeTopic(cmd.Context(), info, args[0])
+		if err != nil {
+			return err
+		}
+		if TopicsFormat == "json" {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(description)
+		}
+		fmt.Printf("Topic: %s\nPartitions: %d\nReplication factor: %d\n",
+			description.Name, len(description.Partitions), description.ReplicationFactor)
+		if len(description.Config) > 0 {
+			fmt.Println("Config:")
+			keys := []string{}
+			for key := range description.Config {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				fmt.Printf("  %s = %s\n", key, description.Config[key])
+			}
+		}
+		fmt.Println()
+		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, "PARTITION\tLEADER\tREPLICAS\tISR\tSTART\tEND")
+		for _, partition := range description.Partitions {
+			fmt.Fprintf(writer, "%d\t%d\t%s\t%s\t%d\t%d\n",
+				partition.Partition,
+				partition.Leader,
+				joinInts(partition.Replicas),
+				joinInts(partition.ISR),
+				partition.StartOffset,
+				partition.EndOffset,
+			)
+		}
+		return writer.Flush()
+	},
+}
+
+// KafkaTopicsDeleteCmd represents the kafka topics delete command
+var KafkaTopicsDeleteCmd = &cobra.Command{
+	Use:   "delete <topic>...",
+	Short: "Delete topics from the broker",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !TopicsYes && !DryRun {
+			fmt.Printf("This deletes the topics %s and all their messages.\n", strings.Join(args, ", "))
+			confirmed, err := confirm("Continue?")
+			if err != nil {
+				return err
+			}
+			if !confirmed {
+				return errors.New("delete cancelled")
+			}
+		}
+		info := newComposeInfo()
+		return gdc.DeleteTopics(cmd.Context(), info, args)
+	},
+}
+
+// KafkaProduceCmd represents the kafka produce command
+var KafkaProduceCmd = &cobra.Command{
+	Use:   "produce <topic>",
+	Short: "Send messages to a topic from JSON lines",
+	Long: `
+	Send messages to a topic, one per line of the file given with -f or of
+	standard input. Each line is a message as consume writes it:
+
+	{"key": "order-1", "value": {"id": 1}, "headers": {"source": "cli"}}
+
+	so consumed messages can be replayed. Keys and values that are JSON strings
+	are sent as plain strings, and other JSON as is. Every line needs a value,
+	null for a tombstone; a line without one, or with fields consume doesn't
+	write, is an error. With --values each line is just a message's value, and
+	--key gives every message the same key.
+
+	With --value-format avro (or --key-format avro) the JSON is encoded with the
+	latest schema of <topic>-value (or <topic>-key) in the Schema Registry, in
+	its wire format. Use --value-subject or --key-subject for another subject.
+
+	Usage: global_docker_compose kafka produce orders -f orders.jsonl
+	       echo '{"id": 1}' | global_docker_compose kafka produce orders --values --value-format avro
+	`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		input := os.Stdin
+		if MessagesFile != "" && MessagesFile != "-" {
+			file, err := os.Open(MessagesFile)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			input = file
+		}
+		info := newComposeInfo()
+		count, err := gdc.ProduceMessages(cmd.Context(), info, args[0], ProduceOptions, input)
+		if err != nil {
+			return err
+		}
+		if !DryRun {
+			fmt.Fprintf(os.Stderr, "Produced %d messages to %s.\n", count, args[0])
+		}
+		return nil
+	},
+}
+
+// KafkaConsumeCmd represents the kafka consume command
+var KafkaConsumeCmd = &cobra.Command{
+	Use:   "consume <topic>",
+	Short: "Print a topic's messages as JSON lines",
+	Long: `
+	Print a topic's messages as JSON lines, with their partition, offset,
+	timestamp, key, value and headers, to standard output or to the file given
+	with -o. The file can be replayed with produce.
+
+	--from says where to start: earliest (the default), latest, a time such as
+	2021-03-04T05:06:07Z or a duration such as 15m before now. consume stops at
+	the end of the topic unless given --follow, which is implied from latest.
+	Filter messages with --key and --header name or --header name=value.
+
+	With --value-format avro (or --key-format avro) messages in the Schema
+	Registry wire format are decoded with the schemas they were written with.
+
+	Usage: global_docker_compose kafka consume orders --from 1h --key order-1
+	       global_docker_compose kafka consume orders --from latest --value-format avro
+	       global_docker_compose kafka consume orders -o orders.jsonl
+	`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var output io.Writer = os.Stdout
+		var file *lazyFile
+		if MessagesFile != "" && MessagesFile != "-" {
+			file = &lazyFile{path: MessagesFile}
+			defer file.Close()
+			output = file
+		}
+		info := newComposeInfo()
+		count, err := gdc.ConsumeMessages(cmd.Context(), info, args[0], ConsumeOptions, output)
+		if err != nil {
+			return err
+		}
+		if file != nil {
+			// empty the file even if there were no messages
+			if _, err := file.Write(nil); err != nil {
+				return err
+			}
+			if err := file.Close(); err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "Wrote %d messages to %s.\n", count, MessagesFile)
+		}
+		return nil
+	},
+}
+
+// lazyFile is only created when it is first written to, so a command that
+// fails before it has anything to write, e.g. because the topic doesn't
+// exist, leaves an earlier file in its place alone.
+type lazyFile struct {
+	path string
+	file *os.File
+}
+
+func (f *lazyFile) Write(data []byte) (int, error) {
+	if f.file == nil {
+		file, err := os.Create(f.path)
+		if err != nil {
+			return 0, err
+		}
+		f.file = file
+	}
+	return f.file.Write(data)
+}
+
+// Close the file if it was created. It can be called more than once.
+func (f *lazyFile) Close() error {
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// KafkaGroupsCmd represents the kafka groups command
+var KafkaGroupsCmd = &cobra.Command{
+	Use:   "groups",
+	Short: "Inspect consumer groups and reset their offsets",
+	Long: `
+	List consumer groups, show a group's committed offsets, end offsets and lag
+	in each partition, and reset a group's offsets.
+
+	reset --to takes earliest, latest, a time such as 2021-03-04T05:06:07Z, a
+	duration such as 15m before now, or an offset. It resets the partitions of
+	the topics the group has committed offsets for, or of the topics given with
+	--topic, printing the changes first. With --dry-run only the changes are
+	printed. The group's consumers have to be stopped first.
+
+	Usage: global_docker_compose kafka groups list
+	       global_docker_compose kafka groups describe orders-service
+	       global_docker_compose kafka groups reset orders-service --to earliest
+	       global_docker_compose kafka groups reset orders-service --to 1h --topic orders
+	`,
+}
+
+// KafkaGroupsListCmd represents the kafka groups list command
+var KafkaGroupsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the consumer groups on the broker",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if GroupsFormat != "table" && GroupsFormat != "json" {
+			return fmt.Errorf("invalid --format %s - expected table or json", GroupsFormat)
+		}
+		info := newComposeInfo()
+		groups, err := gdc.Groups(cmd.Context(), info)
+		if err != nil {
+			return err
+		}
+		if GroupsFormat == "json" {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(groups)
+		}
+		if len(groups) == 0 {
+			fmt.Println("No consumer groups.")
+			return nil
+		}
+		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, "GROUP\tSTATE\tMEMBERS\tLAG")
+		for _, group := range groups {
+			fmt.Fprintf(writer, "%s\t%s\t%d\t%d\n", group.Name, group.State, group.Members, group.Lag)
+		}
+		return writer.Flush()
+	},
+}
+
+// KafkaGroupsDescribeCmd represents the kafka groups describe command
+var KafkaGroupsDescribeCmd = &cobra.Command{
+	Use:   "describe <group>",
+	Short: "Show a consumer group's members, offsets and lag",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if GroupsFormat != "table" && GroupsFormat != "json" {
+			return fmt.Errorf("invalid --format %s - expected table or json", GroupsFormat)
+		}
+		info := newComposeInfo()
+		description, err := gdc.DescribeGroup(cmd.Context(), info, args[0])
+		if err != nil {
+			return err
+		}
+		if GroupsFormat == "json" {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(description)
+		}
+		fmt.Printf("Group: %s\nState: %s\nMembers: %d\n", description.Name, description.State, len(description.Members))
+		for _, member := range description.Members {
+			fmt.Printf("  %s (%s) on %s\n", member.ClientID, member.ID, member.Host)
+		}
+		fmt.Println()
+		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, "TOPIC\tPARTITION\tCOMMITTED\tEND\tLAG\tMEMBER")
+		for _, partition := range description.Partitions {
+			committed := "-"
+			if partition.Committed >= 0 {
+				committed = fmt.Sprint(partition.Committed)
+			}
+			fmt.Fprintf(writer, "%s\t%d\t%s\t%d\t%d\t%s\n",
+				partition.Topic,
+				partition.Partition,
+				committed,
+				partition.End,
+				partition.Lag,
+				partition.Member,
+			)
+		}
+		return writer.Flush()
+	},
+}
+
+// KafkaGroupsResetCmd represents the kafka groups reset command
+var KafkaGroupsResetCmd = &cobra.Command{
+	Use:   "reset <group>",
+	Short: "Reset a consumer group's offsets",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if GroupsResetTo == "" {
+			return errors.New("no position given - use --to earliest, latest, a time, a duration or an offset")
+		}
+		info := newComposeInfo()
+		resets, err := gdc.PlanGroupReset(cmd.Context(), info, args[0], GroupsResetTo, GroupsResetTopics)
+		if err != nil {
+			return err
+		}
+		gdc.PrintGroupReset(os.Stdout, args[0], resets)
+		return gdc.ResetGroup(cmd.Context(), info, args[0], resets)
+	},
+}
+
+func joinInts(values []int32) string {
+	strs := []string{}
+	for _, value := range values {
+		strs = append(strs, fmt.Sprint(value))
+	}
+	return strings.Join(strs, ",")
+}
+
+func init() {
+	KafkaTopicsApplyCmd.Flags().StringVarP(&TopicsFile, "file", "f", "", "Topics file to apply (default is kafka_topics from .gdc.yml)")
+	KafkaTopicsListCmd.Flags().StringVar(&TopicsFormat, "format", "table", "Output format (table or json)")
+	KafkaTopicsListCmd.Flags().BoolVar(&TopicsInternal, "internal", false, "Include internal topics such as _schemas")
+	KafkaTopicsDescribeCmd.Flags().StringVar(&TopicsFormat, "format", "table", "Output format (table or json)")
+	KafkaTopicsDeleteCmd.Flags().BoolVarP(&TopicsYes, "yes", "y", false, "Don't ask for confirmation")
+	KafkaTopicsCmd.AddCommand(KafkaTopicsApplyCmd, KafkaTopicsListCmd, KafkaTopicsDescribeCmd, KafkaTopicsDeleteCmd)
+
+	KafkaProduceCmd.Flags().StringVarP(&MessagesFile, "file", "f", "", "File of messages to send (default is standard input)")
+	KafkaProduceCmd.Flags().BoolVar(&ProduceOptions.Values, "values", false, "Each line is a message's value")
+	KafkaProduceCmd.Flags().StringVar(&ProduceOptions.Key, "key", "", "Key for every message, with --values")
+	KafkaProduceCmd.Flags().StringVar(&ProduceOptions.KeyFormat, "key-format", gdc.FormatJSON, "Format to send keys in (json or avro)")
+	KafkaProduceCmd.Flags().StringVar(&ProduceOptions.ValueFormat, "value-format", gdc.FormatJSON, "Format to send values in (json or avro)")
+	KafkaProduceCmd.Flags().StringVar(&ProduceOptions.KeySubject, "key-subject", "", "Subject of the Avro key schema (default is <topic>-key)")
+	KafkaProduceCmd.Flags().StringVar(&ProduceOptions.ValueSubject, "value-subject", "", "Subject of the Avro value schema (default is <topic>-value)")
+
+	KafkaConsumeCmd.Flags().StringVarP(&MessagesFile, "output", "o", "", "File to write messages to (default is standard output)")
+	KafkaConsumeCmd.Flags().StringVar(&ConsumeOptions.From, "from", "earliest", "Where to start: earliest, latest, a time or a duration before now")
+	KafkaConsumeCmd.Flags().BoolVar(&ConsumeOptions.Follow, "follow", false, "Keep waiting for new messages")
+	KafkaConsumeCmd.Flags().IntVarP(&ConsumeOptions.Max, "max", "n", 0, "Stop after this many messages")
+	KafkaConsumeCmd.Flags().StringVar(&ConsumeOptions.Key, "key", "", "Only messages with this key")
+	KafkaConsumeCmd.Flags().StringArrayVar(&ConsumeOptions.Headers, "header", nil, "Only messages with this header, as name or name=value (can be given more than once)")
+	KafkaConsumeCmd.Flags().StringVar(&ConsumeOptions.KeyFormat, "key-format", gdc.FormatJSON, "Format of the keys (json or avro)")
+	KafkaConsumeCmd.Flags().StringVar(&ConsumeOptions.ValueFormat, "value-format", gdc.FormatJSON, "Format of the values (json or avro)")
+
+	KafkaGroupsListCmd.Flags().StringVar(&GroupsFormat, "format", "table", "Output format (table or json)")
+	KafkaGroupsDescribeCmd.Flags().StringVar(&GroupsFormat, "format", "table", "Output format (table or json)")
+	KafkaGroupsResetCmd.Flags().StringVar(&GroupsResetTo, "to", "", "Position to reset to: earliest, latest, a time, a duration before now or an offset")
+	KafkaGroupsResetCmd.Flags().StringArrayVar(&GroupsResetTopics, "topic", nil, "Topic to reset (default is the topics the group has offsets for; can be given more than once)")
+	KafkaGroupsCmd.AddCommand(KafkaGroupsListCmd, KafkaGroupsDescribeCmd, KafkaGroupsResetCmd)
+
+	KafkaCmd.AddCommand(KafkaTopicsCmd, KafkaGroupsCmd, KafkaProduceCmd, KafkaConsumeCmd)
+	rootCmd.AddCommand(KafkaCmd)
+}
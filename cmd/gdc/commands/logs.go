@@ -25,17 +25,16 @@ var LogsCmd = &cobra.Command{
 	Use:    "logs",
 	Short:  "Show Docker logs for provided services",
 	Args: cobra.MaximumNArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		info := gdc.NewComposeInfo(ComposeFile, Services)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		info := newComposeInfo()
 		if len(args) > 0 {
-			gdc.Logs(info, args[0])
-		} else {
-			gdc.Logs(info, "")
+			return gdc.Logs(cmd.Context(), info, args[0])
 		}
-		gdc.Cleanup()
+		return gdc.Logs(cmd.Context(), info, "")
 	},
 }
 
 func init() {
+	addCompanionFlags(LogsCmd)
 	rootCmd.AddCommand(LogsCmd)
 }
@@ -0,0 +1,253 @@
+/*
+Package commands Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/wishabi/global-docker-compose/gdc"
+)
+
+// MailFormat format to print messages in (table or json)
+var MailFormat string
+
+// MailTailAll print the messages already received before tailing
+var MailTailAll bool
+
+// MailWaitTo recipient the message to wait for is sent to
+var MailWaitTo string
+
+// MailWaitFrom sender of the message to wait for
+var MailWaitFrom string
+
+// MailWaitSubject regular expression the subject of the message to wait for matches
+var MailWaitSubject string
+
+// MailWaitTimeout how long to wait for a message
+var MailWaitTimeout time.Duration
+
+// MailCmd represents the mail command
+var MailCmd = &cobra.Command{
+	Use:   "mail",
+	Short: "Look at the messages the mailcatcher service has received",
+}
+
+// MailListCmd represents the mail list command
+var MailListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the messages mailcatcher has received",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkMailFormat(); err != nil {
+			return err
+		}
+		info := newComposeInfo()
+		messages, err := gdc.MailMessages(cmd.Context(), info)
+		if err != nil {
+			return err
+		}
+		if MailFormat == "json" {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			encoder.SetEscapeHTML(false)
+			return encoder.Encode(messages)
+		}
+		if len(messages) == 0 {
+			fmt.Println("No messages.")
+			return nil
+		}
+		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, "ID\tRECEIVED\tFROM\tTO\tSUBJECT\tSIZE")
+		for _, message := range messages {
+			fmt.Fprintln(writer, mailRow(message))
+		}
+		return writer.Flush()
+	},
+}
+
+// MailShowCmd represents the mail show command
+var MailShowCmd = &cobra.Command{
+	Use:   "show [id]",
+	Short: "Show a message's headers, plain and html parts and attachments",
+	Long: `
+	Show a message mailcatcher has received: its headers, its plain and html
+	parts and the attachments it has. Without an id the last message received
+	is shown.
+
+	Usage: global_docker_compose mail show
+	       global_docker_compose mail show 3 --format json
+	`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkMailFormat(); err != nil {
+			return err
+		}
+		id := "latest"
+		if len(args) > 0 {
+			id = args[0]
+		}
+		info := newComposeInfo()
+		detail, err := gdc.ShowMail(cmd.Context(), info, id)
+		if err != nil {
+			return err
+		}
+		if MailFormat == "json" {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			encoder.SetEscapeHTML(false)
+			return encoder.Encode(detail)
+		}
+		for _, header := range detail.Headers {
+			fmt.Printf("%s: %s\n", header.Name, header.Value)
+		}
+		if detail.Plain != "" {
+			fmt.Println("\n--- plain ---")
+			fmt.Println(strings.TrimRight(detail.Plain, "\r\n"))
+		}
+		if detail.HTML != "" {
+			fmt.Println("\n--- html ---")
+			fmt.Println(strings.TrimRight(detail.HTML, "\r\n"))
+		}
+		if len(detail.Attachments) > 0 {
+			fmt.Println("\n--- attachments ---")
+			writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(writer, "FILENAME\tTYPE\tSIZE")
+			for _, attachment := range detail.Attachments {
+				fmt.Fprintf(writer, "%s\t%s\t%s\n", attachment.Filename, attachment.Type, attachment.Size)
+			}
+			return writer.Flush()
+		}
+		return nil
+	},
+}
+
+// MailTailCmd represents the mail tail command
+var MailTailCmd = &cobra.Command{
+	Use:   "tail",
+	Short: "Print messages as mailcatcher receives them",
+	Long: `
+	Print a line for each message mailcatcher receives until interrupted, or a
+	JSON object per line with --format json. --all prints the messages already
+	received first.
+
+	Usage: global_docker_compose mail tail
+	`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkMailFormat(); err != nil {
+			return err
+		}
+		info := newComposeInfo()
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetEscapeHTML(false)
+		return gdc.TailMail(cmd.Context(), info, MailTailAll, func(message gdc.MailMessage) error {
+			if MailFormat == "json" {
+				return encoder.Encode(message)
+			}
+			_, err := fmt.Println(strings.ReplaceAll(mailRow(message), "\t", "  "))
+			return err
+		})
+	},
+}
+
+// MailClearCmd represents the mail clear command
+var MailClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Delete every message mailcatcher has received",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		info := newComposeInfo()
+		return gdc.ClearMail(cmd.Context(), info)
+	},
+}
+
+// MailWaitCmd represents the mail wait command
+var MailWaitCmd = &cobra.Command{
+	Use:   "wait",
+	Short: "Wait for a matching message to arrive",
+	Long: `
+	Wait until mailcatcher has a message matching --to, --from and
+	--subject-regex and print it, or fail if none arrives within --timeout.
+	Messages received before wait was run count too, so run mail clear before
+	the step that sends the message.
+
+	Usage: global_docker_compose mail wait --to user@example.com --subject-regex '^Welcome' --timeout 30s
+	`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkMailFormat(); err != nil {
+			return err
+		}
+		filter := gdc.MailFilter{To: MailWaitTo, From: MailWaitFrom}
+		if MailWaitSubject != "" {
+			subject, err := regexp.Compile(MailWaitSubject)
+			if err != nil {
+				return fmt.Errorf("invalid --subject-regex: %w", err)
+			}
+			filter.Subject = subject
+		}
+		info := newComposeInfo()
+		message, err := gdc.WaitForMail(cmd.Context(), info, filter, MailWaitTimeout)
+		if err != nil {
+			return err
+		}
+		if MailFormat == "json" {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			encoder.SetEscapeHTML(false)
+			return encoder.Encode(message)
+		}
+		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, "ID\tRECEIVED\tFROM\tTO\tSUBJECT\tSIZE")
+		fmt.Fprintln(writer, mailRow(message))
+		return writer.Flush()
+	},
+}
+
+// checkMailFormat checks the --format of a mail command.
+func checkMailFormat() error {
+	if MailFormat != "table" && MailFormat != "json" {
+		return fmt.Errorf("invalid --format %s - expected table or json", MailFormat)
+	}
+	return nil
+}
+
+// mailRow is a tab-separated line describing a message.
+func mailRow(message gdc.MailMessage) string {
+	return fmt.Sprintf("%d\t%s\t%s\t%s\t%s\t%s", message.ID,
+		message.Received.Local().Format("2006-01-02 15:04:05"), message.Sender,
+		strings.Join(message.Recipients, ", "), message.Subject, message.Size)
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{MailListCmd, MailShowCmd, MailTailCmd, MailWaitCmd} {
+		cmd.Flags().StringVar(&MailFormat, "format", "table", "Output format (table or json)")
+	}
+	MailTailCmd.Flags().BoolVar(&MailTailAll, "all", false, "Print the messages already received first")
+	MailWaitCmd.Flags().StringVar(&MailWaitTo, "to", "", "Address the message is sent to")
+	MailWaitCmd.Flags().StringVar(&MailWaitFrom, "from", "", "Address the message is sent from")
+	MailWaitCmd.Flags().StringVar(&MailWaitSubject, "subject-regex", "", "Regular expression the message's subject matches")
+	MailWaitCmd.Flags().DurationVar(&MailWaitTimeout, "timeout", 30*time.Second, "How long to wait for the message")
+	MailCmd.AddCommand(MailListCmd, MailShowCmd, MailTailCmd, MailClearCmd, MailWaitCmd)
+	rootCmd.AddCommand(MailCmd)
+}
@@ -16,10 +16,36 @@ limitations under the License.
 package commands
 
 import (
+	"errors"
+	"fmt"
+	"os"
+
 	"github.com/spf13/cobra"
 	"github.com/wishabi/global-docker-compose/gdc"
 )
 
+// MysqlDumpOutput file to write the dump to
+var MysqlDumpOutput string
+
+// MysqlImportDatabase database to import into
+var MysqlImportDatabase string
+
+// MysqlImportCreateDatabase create the database before importing
+var MysqlImportCreateDatabase bool
+
+// MysqlFile file to import, the legacy form of mysql import
+var MysqlFile string
+
+// shadowedFile rejects running a mysql subcommand without arguments when a
+// file of the same name is in the current directory: mysql <file> imports a
+// file, but cobra picks the subcommand, so the user may have meant either.
+func shadowedFile(command string) error {
+	if info, err := os.Stat(command); err != nil || info.IsDir() {
+		return nil
+	}
+	return fmt.Errorf("%s is both a mysql subcommand and a file here - use mysql --file %s to import the file", command, command)
+}
+
 // MysqlCmd represents the mysql command
 var MysqlCmd = &cobra.Command{
 	Use:    "mysql",
@@ -28,19 +54,95 @@ var MysqlCmd = &cobra.Command{
 	Start a MySQL client when passed a service. Example:
 
 	global_docker_compose mysql --services=mysql57
+
+	Passing a file with --file imports it, the same as mysql import:
+
+	global_docker_compose mysql --file dump.sql
+
+	The file can also be given without --file, unless it is named dump or
+	import: those run the subcommands instead, and are refused if a file of
+	that name is in the current directory.
 	`,
 	Args: cobra.MaximumNArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		info := gdc.NewComposeInfo(ComposeFile, Services)
-		var input string
-		if (len(args) > 0) {
-			input = args[0]
+	RunE: func(cmd *cobra.Command, args []string) error {
+		info := newComposeInfo()
+		file := MysqlFile
+		if len(args) > 0 {
+			if file != "" {
+				return errors.New("pass the file to import either with --file or as an argument, not both")
+			}
+			file = args[0]
+		}
+		if file != "" {
+			return gdc.MysqlImport(cmd.Context(), info, file, gdc.MysqlImportOptions{Progress: os.Stderr})
 		}
-		gdc.Mysql(info, input)
-		gdc.Cleanup()
+		return gdc.Mysql(cmd.Context(), info, "")
+	},
+}
+
+// MysqlDumpCmd represents the mysql dump command
+var MysqlDumpCmd = &cobra.Command{
+	Use:   "dump [databases...]",
+	Short: "Dump databases from the MySQL service",
+	Long: `
+	Dump the given databases, or all of them, from the running MySQL service with
+	mysqldump. Output files ending in .gz or .zst are compressed. Without --output
+	the dump is written to stdout.
+
+	Usage: global_docker_compose mysql dump my_app_development -o dump.sql.gz
+
+	To dump every database to stdout while a file named dump is in the current
+	directory, pass -o -.
+	`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 && MysqlDumpOutput == "" {
+			if err := shadowedFile("dump"); err != nil {
+				return err
+			}
+		}
+		info := newComposeInfo()
+		return gdc.MysqlDump(cmd.Context(), info, gdc.MysqlDumpOptions{
+			Databases: args,
+			Output:    MysqlDumpOutput,
+			Progress:  os.Stderr,
+		})
+	},
+}
+
+// MysqlImportCmd represents the mysql import command
+var MysqlImportCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Import a dump into the MySQL service",
+	Long: `
+	Import a .sql, .sql.gz or .sql.zst dump into the running MySQL service. If a
+	statement fails, the line of the dump it is on is reported.
+
+	Usage: global_docker_compose mysql import dump.sql.gz --database my_app_development --create-db
+	`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			if err := shadowedFile("import"); err != nil {
+				return err
+			}
+		}
+		return cobra.ExactArgs(1)(cmd, args)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		info := newComposeInfo()
+		return gdc.MysqlImport(cmd.Context(), info, args[0], gdc.MysqlImportOptions{
+			Database:       MysqlImportDatabase,
+			CreateDatabase: MysqlImportCreateDatabase,
+			Progress:       os.Stderr,
+		})
 	},
 }
 
 func init() {
+	MysqlCmd.Flags().StringVarP(&MysqlFile, "file", "f", "", "Dump to import, the same as mysql import")
+	MysqlDumpCmd.Flags().StringVarP(&MysqlDumpOutput, "output", "o", "", "File to write the dump to, compressed if it ends in .gz or .zst, or - for stdout")
+	MysqlImportCmd.Flags().StringVar(&MysqlImportDatabase, "database", "", "Database to import into")
+	MysqlImportCmd.Flags().BoolVar(&MysqlImportCreateDatabase, "create-db", false, "Create the database if it doesn't exist")
+	MysqlCmd.AddCommand(MysqlDumpCmd)
+	MysqlCmd.AddCommand(MysqlImportCmd)
 	rootCmd.AddCommand(MysqlCmd)
 }
@@ -0,0 +1,217 @@
+/*
+Package commands Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/wishabi/global-docker-compose/gdc"
+)
+
+// QuerySQL SQL query to run
+var QuerySQL string
+
+// QueryPPL PPL query to run
+var QueryPPL string
+
+// QueryCat _cat API to call
+var QueryCat string
+
+// QuerySaved name of a saved query to run
+var QuerySaved string
+
+// QuerySize number of hits to return
+var QuerySize int
+
+// QueryFormat format to print results in (table or json)
+var QueryFormat string
+
+// OpensearchCmd represents the opensearch command
+var OpensearchCmd = &cobra.Command{
+	Use:   "opensearch",
+	Short: "Work with the opensearch service's indices",
+}
+
+// OpensearchApplyCmd represents the opensearch apply command
+var OpensearchApplyCmd = &cobra.Command{
+	Use:   "apply <dir>",
+	Short: "Create templates, ISM policies and indices and seed them from a directory",
+	Long: `
+	Create and update OpenSearch resources declared in a directory, then load
+	seed documents:
+
+	component_templates/<name>.json  bodies of PUT _component_template/<name>
+	index_templates/<name>.json      bodies of PUT _index_template/<name>
+	ism_policies/<name>.json         bodies of PUT _plugins/_ism/policies/<name>
+	indices/<name>.json              settings, mappings and aliases of an index
+	seed/<index>.ndjson              documents to load into an index
+
+	Resource files can be JSON or YAML. Seed files are bulk request bodies, or
+	a document per line with an optional _id, and are only loaded into indices
+	that have no documents, so they aren't duplicated on re-runs. Documents
+	that fail to index are reported with their line.
+
+	apply prints the plan first and changes only what differs: templates and
+	policies are replaced, and indices get missing fields, aliases and dynamic
+	settings. Mappings that have drifted from the declared ones can't be changed
+	in place and are reported as errors, and fields dynamic mapping added that
+	aren't declared are pointed out. With --dry-run only the plan is printed.
+
+	Usage: global_docker_compose opensearch apply search/
+	`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		info := newComposeInfo()
+		return gdc.ApplySearchDir(cmd.Context(), info, args[0], os.Stdout)
+	},
+}
+
+// OpensearchQueryCmd represents the opensearch query command
+var OpensearchQueryCmd = &cobra.Command{
+	Use:   "query [index] [dsl]",
+	Short: "Run a DSL, SQL or PPL query or a _cat API",
+	Long: `
+	Run a query against the opensearch service and print the results as a table,
+	or as the JSON OpenSearch returned with --format json.
+
+	A query DSL request body is given after the index, or read from stdin if it
+	is -, and defaults to match_all. Hits are shown with a column for each
+	field. --sql and --ppl run queries with the SQL and PPL plugins, and --cat
+	calls a _cat API such as indices, shards or health.
+
+	Queries a project runs often can be saved under opensearch_queries in
+	.gdc.yml and run by name:
+
+	opensearch_queries:
+	  top-flyers:
+	    index: flyers
+	    dsl: {query: {match_all: {}}, sort: [{views: desc}]}
+	    size: 5
+	  flyer-counts:
+	    sql: SELECT merchant, COUNT(*) FROM flyers GROUP BY merchant
+
+	Usage: global_docker_compose opensearch query flyers '{"query": {"match": {"title": "weekly"}}}'
+	       global_docker_compose opensearch query --sql 'SELECT * FROM flyers LIMIT 5'
+	       global_docker_compose opensearch query --cat indices
+	       global_docker_compose opensearch query --saved top-flyers
+	`,
+	Args: cobra.MaximumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if QueryFormat != "table" && QueryFormat != "json" {
+			return fmt.Errorf("invalid --format %s - expected table or json", QueryFormat)
+		}
+		query := gdc.SearchQuery{SQL: QuerySQL, PPL: QueryPPL, Cat: QueryCat}
+		if QuerySaved != "" {
+			if len(args) > 0 || QuerySQL != "" || QueryPPL != "" || QueryCat != "" {
+				return fmt.Errorf("--saved can't be combined with another query")
+			}
+			saved, found := config.OpensearchQueries[QuerySaved]
+			if !found {
+				return fmt.Errorf("no saved query %s - add it under opensearch_queries in .gdc.yml", QuerySaved)
+			}
+			query = saved
+		}
+		if len(args) > 0 {
+			query.Index = args[0]
+		}
+		if len(args) > 1 {
+			query.DSL = args[1]
+			if args[1] == "-" {
+				data, err := io.ReadAll(os.Stdin)
+				if err != nil {
+					return err
+				}
+				query.DSL = string(data)
+			}
+		}
+		if cmd.Flags().Changed("size") || query.Size == 0 {
+			query.Size = QuerySize
+		}
+		info := newComposeInfo()
+		result, err := gdc.RunSearchQuery(cmd.Context(), info, query)
+		if err != nil {
+			return err
+		}
+		if QueryFormat == "json" {
+			return printIndented(result.Response)
+		}
+		if len(result.Columns) > 0 {
+			writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(writer, strings.Join(result.Columns, "\t"))
+			for _, row := range result.Rows {
+				fmt.Fprintln(writer, strings.Join(row, "\t"))
+			}
+			if err := writer.Flush(); err != nil {
+				return err
+			}
+		}
+		if result.Summary != "" {
+			fmt.Println(result.Summary)
+		}
+		if len(result.Aggregations) > 0 {
+			fmt.Println("Aggregations:")
+			return printIndented(result.Aggregations)
+		}
+		return nil
+	},
+}
+
+// printIndented prints JSON indented, keeping the order of its keys.
+func printIndented(data json.RawMessage) error {
+	out := bytes.Buffer{}
+	if err := json.Indent(&out, data, "", "  "); err != nil {
+		return err
+	}
+	out.WriteByte('\n')
+	_, err := out.WriteTo(os.Stdout)
+	return err
+}
+
+// describeQuery is a short description of a saved query.
+func describeQuery(query gdc.SearchQuery) string {
+	description := "dsl"
+	switch {
+	case query.SQL != "":
+		description = "sql"
+	case query.PPL != "":
+		description = "ppl"
+	case query.Cat != "":
+		description = "_cat/" + query.Cat
+	}
+	if query.Index != "" {
+		description += " on " + query.Index
+	}
+	return description
+}
+
+func init() {
+	OpensearchQueryCmd.Flags().StringVar(&QuerySQL, "sql", "", "SQL query to run")
+	OpensearchQueryCmd.Flags().StringVar(&QueryPPL, "ppl", "", "PPL query to run")
+	OpensearchQueryCmd.Flags().StringVar(&QueryCat, "cat", "", "_cat API to call, e.g. indices, shards or health")
+	OpensearchQueryCmd.Flags().StringVar(&QuerySaved, "saved", "", "Name of a query saved under opensearch_queries in .gdc.yml")
+	OpensearchQueryCmd.Flags().IntVarP(&QuerySize, "size", "n", 10, "Number of hits to return from a DSL query that doesn't give a size")
+	OpensearchQueryCmd.Flags().StringVar(&QueryFormat, "format", "table", "Output format (table or json)")
+	OpensearchCmd.AddCommand(OpensearchQueryCmd)
+	OpensearchCmd.AddCommand(OpensearchApplyCmd)
+	rootCmd.AddCommand(OpensearchCmd)
+}
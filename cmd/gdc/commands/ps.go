@@ -25,10 +25,9 @@ var PsCmd = &cobra.Command{
 	Use:    "ps",
 	Short:  "Show running containers for provided services",
 	Args: cobra.NoArgs,
-	Run: func(cmd *cobra.Command, args []string) {
-		info := gdc.NewComposeInfo(ComposeFile, Services)
-		gdc.Ps(info)
-		gdc.Cleanup()
+	RunE: func(cmd *cobra.Command, args []string) error {
+		info := newComposeInfo()
+		return gdc.Ps(cmd.Context(), info)
 	},
 }
 
@@ -25,10 +25,9 @@ var RedisCmd = &cobra.Command{
 	Use:    "redis_cli",
 	Short:  "Start a Redis client",
 	Args: cobra.NoArgs,
-	Run: func(cmd *cobra.Command, args []string) {
-		info := gdc.NewComposeInfo(ComposeFile, Services)
-		gdc.RedisCLI(info)
-		gdc.Cleanup()
+	RunE: func(cmd *cobra.Command, args []string) error {
+		info := newComposeInfo()
+		return gdc.RedisCLI(cmd.Context(), info)
 	},
 }
 
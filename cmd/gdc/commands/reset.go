@@ -0,0 +1,100 @@
+/*
+Package commands Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package commands
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/wishabi/global-docker-compose/gdc"
+)
+
+// ResetYes skip the confirmation prompt
+var ResetYes bool
+
+// ResetRecreate bring the service up again after resetting it
+var ResetRecreate bool
+
+// ResetCmd represents the reset command
+var ResetCmd = &cobra.Command{
+	Use:   "reset <service>",
+	Short: "Delete a service's data so it starts from scratch",
+	Long: `
+	Remove the service's container and delete its named volumes, e.g.
+	global_mysql57-data for mysql57. Volumes of other services are left alone.
+	The volumes to be deleted are listed and have to be confirmed, unless --yes
+	is given.
+
+	Usage: global_docker_compose reset mysql57
+	       global_docker_compose reset mysql57 --yes --recreate
+	`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		info := newComposeInfo()
+		resetPlan, err := gdc.PlanReset(info, args[0])
+		if err != nil {
+			return err
+		}
+		if !ResetYes && !DryRun {
+			fmt.Printf("This removes the %s container and deletes its volumes:\n", resetPlan.Service)
+			for _, volume := range resetPlan.Volumes {
+				fmt.Printf("  %s\n", volume)
+			}
+			if len(resetPlan.UsedBy) > 0 {
+				fmt.Printf("%s is also used by %s.\n", resetPlan.Service, strings.Join(resetPlan.UsedBy, ", "))
+			}
+			confirmed, err := confirm("Continue?")
+			if err != nil {
+				return err
+			}
+			if !confirmed {
+				return errors.New("reset cancelled")
+			}
+		}
+		return gdc.Reset(cmd.Context(), info, resetPlan, ResetRecreate)
+	},
+}
+
+// confirm asks a yes/no question on the terminal. Without a terminal to ask
+// on, it fails rather than assuming an answer.
+func confirm(question string) (bool, error) {
+	info, err := os.Stdin.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false, errors.New("cannot ask for confirmation without a terminal - use --yes")
+	}
+	fmt.Printf("%s [y/N] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err == io.EOF {
+		fmt.Println()
+		return false, errors.New("cannot ask for confirmation without a terminal - use --yes")
+	}
+	if err != nil {
+		return false, err
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+func init() {
+	ResetCmd.Flags().BoolVarP(&ResetYes, "yes", "y", false, "Don't ask for confirmation")
+	ResetCmd.Flags().BoolVar(&ResetRecreate, "recreate", false, "Bring the service up again afterwards")
+	rootCmd.AddCommand(ResetCmd)
+}
@@ -1,43 +1,134 @@
 package commands
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
-	"github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
+	"github.com/wishabi/global-docker-compose/gdc"
 )
 
 var cfgFile string
 
-// Services list of services (space delimited)
+// Services list of services (comma delimited)
 var Services string
 
-// ComposeFile optional additional docker-compose.yml file
-var ComposeFile string
+// ComposeFiles optional additional docker-compose.yml files
+var ComposeFiles []string
+
+// DryRun print what would be executed instead of executing it
+var DryRun bool
+
+// PlanFormat format to print the dry run plan in (text or json)
+var PlanFormat string
+
+// NoCompanions only act on the requested services, not their companions
+var NoCompanions bool
+
+// Without companion services to leave out
+var Without []string
+
+// Relogin log in to registries even if a cached login hasn't expired
+var Relogin bool
+
+// config is the effective configuration from config files, environment and flags
+var config settings
+
+// plan collects everything that would have been run when DryRun is set
+var plan = &gdc.Plan{}
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
-	Version: "0.12.0",
+	Version: gdc.Version,
 	Use:     "global_docker_compose (command) --services service1 service2 --compose_file ../docker-compose.yml",
 	Short:   "Generate JSON files to use with the Flipp platform deploy scripts",
 	Long: `
          global_docker_compose can be used to centralize and standardize Docker dependencies used within Flipp.
          The idea is to have one tool that can spin up whatever services are needed and keep that tool updated
          with fixes and improvements, rather than having a separate docker-compose.yml file in every project.
-         The project can have a shell script (denoted "gdc") which calls this tool with the services it needs
-         for itself.
+         The project can have a .gdc.yml file which lists the services it needs for itself.
 
          For more information, please see https://github.com/wishabi/global-docker-compose .
 	`,
 	Args: cobra.ExactArgs(1),
+	// errors are printed by Execute, which also decides the exit code
+	SilenceErrors: true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// past argument validation, so errors are no longer about usage
+		cmd.SilenceUsage = true
+		if PlanFormat != "text" && PlanFormat != "json" {
+			return fmt.Errorf("invalid --plan-format %s - expected text or json", PlanFormat)
+		}
+		return nil
+	},
+	PersistentPostRunE: func(cmd *cobra.Command, args []string) error {
+		if !DryRun {
+			return nil
+		}
+		return plan.Print(os.Stdout, PlanFormat)
+	},
+}
+
+// newComposeInfo builds the compose info from the global flags, recording
+// commands into the plan instead of running them when --dry-run is given.
+func newComposeInfo() gdc.ComposeInfo {
+	info := gdc.NewComposeInfo(config.ComposeFiles, config.Services)
+	info.PortOverrides = config.Ports
+	info.Environment = config.Environment
+	info.ProjectDir = config.ProjectDir
+	info.Registries = config.Registries
+	info.NoCompanions = NoCompanions
+	info.Without = Without
+	info.Relogin = Relogin
+	if DryRun {
+		info.Runner = plan
+	}
+	return info
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
+// When a command fails, gdc exits with the same status as the process it ran.
+//
+// Interrupting gdc cancels the command's context, which stops whatever it is
+// running, and the generated files are still cleaned up. A second interrupt
+// exits immediately.
 func Execute() {
-	cobra.CheckErr(rootCmd.Execute())
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	err := rootCmd.ExecuteContext(ctx)
+	gdc.Cleanup()
+	if ctx.Err() != nil {
+		fmt.Fprintln(os.Stderr, "Interrupted")
+		os.Exit(130)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(exitCode(err))
+	}
+}
+
+// exitCode gdc exits with for the error.
+func exitCode(err error) int {
+	var exitErr *gdc.ExitError
+	if errors.As(err, &exitErr) && exitErr.Code > 0 {
+		return exitErr.Code
+	}
+	return 1
+}
+
+// addCompanionFlags adds the flags controlling companion services to commands
+// that act on the requested services.
+func addCompanionFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&NoCompanions, "no-companions", false, "Leave out companion services (e.g. schema-registry for kafka)")
+	cmd.Flags().StringSliceVar(&Without, "without", []string{}, "Companion services to leave out, e.g. --without control-center")
 }
 
 func init() {
@@ -46,28 +137,18 @@ func init() {
 	rootCmd.PersistentFlags().StringVarP(&Services, "services", "s", "", "Services to perform actions for (required)")
 	rootCmd.MarkFlagRequired("input")
 
-	rootCmd.PersistentFlags().StringVarP(&ComposeFile, "compose_file", "c", "", "Additional docker-compose file to use")
-}
+	// an array rather than a slice so paths containing commas are kept whole
+	rootCmd.PersistentFlags().StringArrayVarP(&ComposeFiles, "compose_file", "c", []string{}, "Additional docker-compose file to use; repeat for several")
 
-// initConfig reads in config file and ENV variables if set.
-func initConfig() {
-	if cfgFile != "" {
-		// Use config file from the flag.
-		viper.SetConfigFile(cfgFile)
-	} else {
-		// Find home directory.
-		home, err := homedir.Dir()
-		cobra.CheckErr(err)
-
-		// Search config in home directory with name ".datadog" (without extension).
-		viper.AddConfigPath(home)
-		viper.SetConfigName(".gdc")
-	}
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "User config file (default is $HOME/.gdc.yml)")
 
-	viper.AutomaticEnv() // read in environment variables that match
+	rootCmd.PersistentFlags().BoolVar(&DryRun, "dry-run", false, "Print the commands and files that would be run or written without doing anything")
+	rootCmd.PersistentFlags().StringVar(&PlanFormat, "plan-format", "text", "Format of the --dry-run plan (text or json)")
+}
 
-	// If a config file is found, read it in.
-	if err := viper.ReadInConfig(); err == nil {
-		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
-	}
+// initConfig reads in the config files and GDC_* environment variables.
+func initConfig() {
+	var err error
+	config, err = loadSettings(rootCmd.PersistentFlags(), cfgFile)
+	cobra.CheckErr(err)
 }
@@ -0,0 +1,29 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/wishabi/global-docker-compose/gdc"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "other error", err: errors.New("boom"), want: 1},
+		{name: "exit error", err: &gdc.ExitError{Command: "docker compose up", Code: 17}, want: 17},
+		{name: "wrapped", err: fmt.Errorf("error restoring: %w", &gdc.ExitError{Command: "docker run", Code: 2}), want: 2},
+		{name: "killed", err: &gdc.ExitError{Command: "docker run", Code: -1}, want: 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if code := exitCode(test.err); code != test.want {
+				t.Errorf("got %d, want %d", code, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+/*
+Package commands Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/wishabi/global-docker-compose/gdc"
+)
+
+// SchemasStrategy subject naming strategy (topic, record or topic-record)
+var SchemasStrategy string
+
+// SchemasFormat format to print results in (text or json)
+var SchemasFormat string
+
+// SchemasCmd represents the schemas command
+var SchemasCmd = &cobra.Command{
+	Use:   "schemas",
+	Short: "Check and register schemas with the schema-registry service",
+	Long: `
+	Check and register the .avsc, .proto and .json schemas in a directory with
+	the local Schema Registry.
+
+	Each file's subject is named by --strategy:
+
+	topic         <file name>-value, or <file name>-key for a file named
+	              e.g. orders-key.avsc (the default)
+	record        the record's full name - the Avro namespace and name, the
+	              protobuf package and first message, or the JSON schema title
+	topic-record  <file name>-<record's full name>
+
+	check compares each schema with the latest version of its subject, checking
+	changed schemas are compatible and printing the differences. push does the
+	same, then registers the new and changed schemas - nothing is registered if
+	any is incompatible.
+
+	Usage: global_docker_compose schemas check schemas/
+	       global_docker_compose schemas push schemas/ --strategy record
+	`,
+}
+
+// SchemasCheckCmd represents the schemas check command
+var SchemasCheckCmd = &cobra.Command{
+	Use:   "check <dir>",
+	Short: "Check schemas against the registered versions",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		checks, err := checkSchemas(cmd, args[0])
+		if err != nil {
+			return err
+		}
+		if err = printSchemaChecks(checks); err != nil {
+			return err
+		}
+		return gdc.IncompatibleSchemas(checks)
+	},
+}
+
+// SchemasPushCmd represents the schemas push command
+var SchemasPushCmd = &cobra.Command{
+	Use:   "push <dir>",
+	Short: "Register new and changed schemas",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		checks, err := checkSchemas(cmd, args[0])
+		if err != nil {
+			return err
+		}
+		err = gdc.PushSchemas(cmd.Context(), newComposeInfo(), checks)
+		if printErr := printSchemaChecks(checks); printErr != nil {
+			return printErr
+		}
+		return err
+	},
+}
+
+func checkSchemas(cmd *cobra.Command, dir string) ([]gdc.SchemaCheck, error) {
+	if SchemasFormat != "text" && SchemasFormat != "json" {
+		return nil, fmt.Errorf("invalid --format %s - expected text or json", SchemasFormat)
+	}
+	schemas, err := gdc.LoadSchemas(dir, SchemasStrategy)
+	if err != nil {
+		return nil, err
+	}
+	return gdc.CheckSchemas(cmd.Context(), newComposeInfo(), schemas)
+}
+
+func printSchemaChecks(checks []gdc.SchemaCheck) error {
+	if SchemasFormat == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(checks)
+	}
+	gdc.PrintSchemaChecks(os.Stdout, checks)
+	return nil
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{SchemasCheckCmd, SchemasPushCmd} {
+		cmd.Flags().StringVar(&SchemasStrategy, "strategy", gdc.TopicNameStrategy, "Subject naming strategy (topic, record or topic-record)")
+		cmd.Flags().StringVar(&SchemasFormat, "format", "text", "Output format (text or json)")
+	}
+	SchemasCmd.AddCommand(SchemasCheckCmd, SchemasPushCmd)
+	rootCmd.AddCommand(SchemasCmd)
+}
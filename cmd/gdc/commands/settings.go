@@ -0,0 +1,269 @@
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/spf13/pflag"
+	"github.com/wishabi/global-docker-compose/gdc"
+	"gopkg.in/yaml.v3"
+)
+
+// projectConfigName is the per-project config file, found by walking up from
+// the current directory.
+const projectConfigName = ".gdc.yml"
+
+// homeConfigNames are the user-wide config files looked for in the home
+// directory, in order.
+var homeConfigNames = []string{".gdc.yml", ".gdc.yaml"}
+
+// stringList accepts either a YAML list or a comma-separated string.
+type stringList []string
+
+func (l *stringList) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.SequenceNode {
+		var list []string
+		if err := node.Decode(&list); err != nil {
+			return err
+		}
+		*l = list
+		return nil
+	}
+	var str string
+	if err := node.Decode(&str); err != nil {
+		return err
+	}
+	*l = splitList(str)
+	return nil
+}
+
+func splitList(str string) []string {
+	result := []string{}
+	for _, s := range strings.Split(str, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// configFile is the format of both the home and the project config files.
+type configFile struct {
+	Services       stringList                  `yaml:"services"`
+	ComposeFiles   stringList                  `yaml:"compose_files"`
+	Ports          map[string]map[int]int      `yaml:"ports"`
+	Environment    map[string]string           `yaml:"environment"`
+	Registries     map[string]gdc.RegistryAuth `yaml:"registries"`
+	EnvNames       map[string]string           `yaml:"env_names"`
+	KafkaTopics    string                      `yaml:"kafka_topics"`
+	DynamodbTables string                      `yaml:"dynamodb_tables"`
+	// named queries for opensearch query --saved
+	OpensearchQueries map[string]gdc.SearchQuery `yaml:"opensearch_queries"`
+}
+
+// settings are the effective configuration after merging the home config,
+// the project config, GDC_* environment variables and flags, in that order.
+type settings struct {
+	Services     []string                    `yaml:"services"`
+	ComposeFiles []string                    `yaml:"compose_files"`
+	Ports        map[string]map[int]int      `yaml:"ports,omitempty"`
+	Environment  map[string]string           `yaml:"environment,omitempty"`
+	Registries   map[string]gdc.RegistryAuth `yaml:"registries,omitempty"`
+	// names the project uses for the variables printed by env
+	EnvNames map[string]string `yaml:"env_names,omitempty"`
+	// topics file to apply after up brings up kafka
+	KafkaTopics string `yaml:"kafka_topics,omitempty"`
+	// tables file to apply after up brings up dynamodb
+	DynamodbTables string `yaml:"dynamodb_tables,omitempty"`
+	// named queries for opensearch query --saved
+	OpensearchQueries map[string]gdc.SearchQuery `yaml:"opensearch_queries,omitempty"`
+	// directory of the project config file, if there is one
+	ProjectDir string `yaml:"-"`
+	// where each value came from, keyed by e.g. "services" or "ports.mysql57.3306"
+	origins map[string]string
+}
+
+func (s *settings) setOrigin(key string, origin string) {
+	if s.origins == nil {
+		s.origins = map[string]string{}
+	}
+	s.origins[key] = origin
+}
+
+// findProjectConfig walks up from the given directory looking for the project
+// config file. It returns an empty string if there is none.
+func findProjectConfig(dir string) string {
+	for {
+		path := filepath.Join(dir, projectConfigName)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+func findHomeConfig() (string, error) {
+	home, err := homedir.Dir()
+	if err != nil {
+		return "", err
+	}
+	for _, name := range homeConfigNames {
+		path := filepath.Join(home, name)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, nil
+		}
+	}
+	return "", nil
+}
+
+func readConfigFile(path string) (configFile, error) {
+	config := configFile{}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+	err = yaml.Unmarshal(data, &config)
+	if err != nil {
+		return config, fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// apply a config file on top of the settings. Relative compose, topics and
+// tables files are resolved against the directory the config file lives in.
+func (s *settings) apply(config configFile, path string) {
+	dir := filepath.Dir(path)
+	if config.Services != nil {
+		s.Services = config.Services
+		s.setOrigin("services", path)
+	}
+	if config.ComposeFiles != nil {
+		s.ComposeFiles = []string{}
+		for _, file := range config.ComposeFiles {
+			s.ComposeFiles = append(s.ComposeFiles, resolvePath(file, dir))
+		}
+		s.setOrigin("compose_files", path)
+	}
+	for service, ports := range config.Ports {
+		if s.Ports == nil {
+			s.Ports = map[string]map[int]int{}
+		}
+		if s.Ports[service] == nil {
+			s.Ports[service] = map[int]int{}
+		}
+		for target, published := range ports {
+			s.Ports[service][target] = published
+			s.setOrigin(fmt.Sprintf("ports.%s.%d", service, target), path)
+		}
+	}
+	for key, value := range config.Environment {
+		if s.Environment == nil {
+			s.Environment = map[string]string{}
+		}
+		s.Environment[key] = value
+		s.setOrigin("environment."+key, path)
+	}
+	for host, auth := range config.Registries {
+		if s.Registries == nil {
+			s.Registries = map[string]gdc.RegistryAuth{}
+		}
+		s.Registries[host] = auth
+		s.setOrigin("registries."+host, path)
+	}
+	if config.KafkaTopics != "" {
+		s.KafkaTopics = resolvePath(config.KafkaTopics, dir)
+		s.setOrigin("kafka_topics", path)
+	}
+	if config.DynamodbTables != "" {
+		s.DynamodbTables = resolvePath(config.DynamodbTables, dir)
+		s.setOrigin("dynamodb_tables", path)
+	}
+	for name, query := range config.OpensearchQueries {
+		if s.OpensearchQueries == nil {
+			s.OpensearchQueries = map[string]gdc.SearchQuery{}
+		}
+		s.OpensearchQueries[name] = query
+		s.setOrigin("opensearch_queries."+name, path)
+	}
+	for name, projectName := range config.EnvNames {
+		if s.EnvNames == nil {
+			s.EnvNames = map[string]string{}
+		}
+		s.EnvNames[name] = projectName
+		s.setOrigin("env_names."+name, path)
+	}
+}
+
+// resolvePath expands ~ in a path from a config file and makes it relative to
+// the config file's directory.
+func resolvePath(path string, dir string) string {
+	if expanded, err := homedir.Expand(path); err == nil {
+		path = expanded
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	return path
+}
+
+// loadSettings merges every configuration source into the effective settings.
+func loadSettings(flags *pflag.FlagSet, homeConfig string) (settings, error) {
+	s := settings{Services: []string{}, ComposeFiles: []string{}}
+	s.setOrigin("services", "default")
+	s.setOrigin("compose_files", "default")
+
+	if homeConfig == "" {
+		found, err := findHomeConfig()
+		if err != nil {
+			return s, err
+		}
+		homeConfig = found
+	}
+	if homeConfig != "" {
+		config, err := readConfigFile(homeConfig)
+		if err != nil {
+			return s, err
+		}
+		s.apply(config, homeConfig)
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return s, err
+	}
+	if projectConfig := findProjectConfig(cwd); projectConfig != "" {
+		config, err := readConfigFile(projectConfig)
+		if err != nil {
+			return s, err
+		}
+		s.apply(config, projectConfig)
+		s.ProjectDir = filepath.Dir(projectConfig)
+	}
+
+	if value, found := os.LookupEnv("GDC_SERVICES"); found {
+		s.Services = splitList(value)
+		s.setOrigin("services", "env GDC_SERVICES")
+	}
+	if value, found := os.LookupEnv("GDC_COMPOSE_FILES"); found {
+		s.ComposeFiles = splitList(value)
+		s.setOrigin("compose_files", "env GDC_COMPOSE_FILES")
+	}
+
+	if flags.Changed("services") {
+		s.Services = splitList(Services)
+		s.setOrigin("services", "flag --services")
+	}
+	if flags.Changed("compose_file") {
+		s.ComposeFiles = ComposeFiles
+		s.setOrigin("compose_files", "flag --compose_file")
+	}
+	return s, nil
+}
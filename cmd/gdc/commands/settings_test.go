@@ -0,0 +1,265 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/spf13/pflag"
+)
+
+// writeConfig writes a config file, creating its directory.
+func writeConfig(t *testing.T, path string, data string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// settingsEnv sets up a home directory with a config file and a project
+// with a .gdc.yml, and works in a directory two levels inside the project.
+func settingsEnv(t *testing.T, homeConfig string, projectConfig string) (home string, project string) {
+	t.Helper()
+	home = t.TempDir()
+	project = t.TempDir()
+	t.Setenv("HOME", home)
+	homedir.DisableCache = true
+	t.Cleanup(func() { homedir.DisableCache = false })
+	for _, name := range []string{"GDC_SERVICES", "GDC_COMPOSE_FILES"} {
+		if value, found := os.LookupEnv(name); found {
+			os.Unsetenv(name)
+			t.Cleanup(func() { os.Setenv(name, value) })
+		}
+	}
+	if homeConfig != "" {
+		writeConfig(t, filepath.Join(home, ".gdc.yml"), homeConfig)
+	}
+	if projectConfig != "" {
+		writeConfig(t, filepath.Join(project, ".gdc.yml"), projectConfig)
+	}
+	dir := filepath.Join(project, "app", "models")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(cwd) })
+	return home, project
+}
+
+// settingsFlags are the global flags loadSettings reads, parsed from args.
+func settingsFlags(t *testing.T, args ...string) *pflag.FlagSet {
+	t.Helper()
+	oldServices, oldComposeFiles := Services, ComposeFiles
+	t.Cleanup(func() { Services, ComposeFiles = oldServices, oldComposeFiles })
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.StringVarP(&Services, "services", "s", "", "")
+	flags.StringArrayVarP(&ComposeFiles, "compose_file", "c", []string{}, "")
+	if err := flags.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return flags
+}
+
+func TestLoadSettingsPrecedence(t *testing.T) {
+	homeConfig := "services: [redis]\ncompose_files: [home.yml]\n"
+	projectConfig := "services: mysql57, kafka\ncompose_files:\n  - ./docker-compose.yml\n"
+	tests := []struct {
+		name         string
+		home         string
+		project      string
+		env          map[string]string
+		args         []string
+		services     []string
+		composeFiles []string
+		origins      map[string]string
+	}{
+		{
+			name:         "defaults",
+			services:     []string{},
+			composeFiles: []string{},
+			origins:      map[string]string{"services": "default", "compose_files": "default"},
+		},
+		{
+			name:         "home config",
+			home:         homeConfig,
+			services:     []string{"redis"},
+			composeFiles: []string{"$HOME/home.yml"},
+			origins:      map[string]string{"services": "$HOME/.gdc.yml", "compose_files": "$HOME/.gdc.yml"},
+		},
+		{
+			name:         "project over home",
+			home:         homeConfig,
+			project:      projectConfig,
+			services:     []string{"mysql57", "kafka"},
+			composeFiles: []string{"$PROJECT/docker-compose.yml"},
+			origins:      map[string]string{"services": "$PROJECT/.gdc.yml", "compose_files": "$PROJECT/.gdc.yml"},
+		},
+		{
+			name:         "project keeps what it doesn't set from home",
+			home:         homeConfig,
+			project:      "services: [mysql57]\n",
+			services:     []string{"mysql57"},
+			composeFiles: []string{"$HOME/home.yml"},
+			origins:      map[string]string{"services": "$PROJECT/.gdc.yml", "compose_files": "$HOME/.gdc.yml"},
+		},
+		{
+			name:         "environment over project",
+			home:         homeConfig,
+			project:      projectConfig,
+			env:          map[string]string{"GDC_SERVICES": "redis,opensearch", "GDC_COMPOSE_FILES": "a.yml, b.yml"},
+			services:     []string{"redis", "opensearch"},
+			composeFiles: []string{"a.yml", "b.yml"},
+			origins:      map[string]string{"services": "env GDC_SERVICES", "compose_files": "env GDC_COMPOSE_FILES"},
+		},
+		{
+			name:         "flags over environment",
+			project:      projectConfig,
+			env:          map[string]string{"GDC_SERVICES": "redis", "GDC_COMPOSE_FILES": "a.yml"},
+			args:         []string{"--services", "mysql8,redis", "-c", "x,y.yml", "-c", "z.yml"},
+			services:     []string{"mysql8", "redis"},
+			composeFiles: []string{"x,y.yml", "z.yml"},
+			origins:      map[string]string{"services": "flag --services", "compose_files": "flag --compose_file"},
+		},
+		{
+			name:         "only some flags",
+			project:      projectConfig,
+			args:         []string{"-s", "redis"},
+			services:     []string{"redis"},
+			composeFiles: []string{"$PROJECT/docker-compose.yml"},
+			origins:      map[string]string{"services": "flag --services", "compose_files": "$PROJECT/.gdc.yml"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			home, project := settingsEnv(t, test.home, test.project)
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+			expand := func(str string) string {
+				return os.Expand(str, func(name string) string {
+					return map[string]string{"HOME": home, "PROJECT": project}[name]
+				})
+			}
+
+			s, err := loadSettings(settingsFlags(t, test.args...), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(s.Services, test.services) {
+				t.Errorf("services = %q, want %q", s.Services, test.services)
+			}
+			composeFiles := []string{}
+			for _, file := range test.composeFiles {
+				composeFiles = append(composeFiles, expand(file))
+			}
+			if !reflect.DeepEqual(s.ComposeFiles, composeFiles) {
+				t.Errorf("compose files = %q, want %q", s.ComposeFiles, composeFiles)
+			}
+			for key, origin := range test.origins {
+				if s.origins[key] != expand(origin) {
+					t.Errorf("origin of %s = %s, want %s", key, s.origins[key], expand(origin))
+				}
+			}
+			if test.project != "" && s.ProjectDir != project {
+				t.Errorf("project dir = %s, want %s", s.ProjectDir, project)
+			}
+		})
+	}
+}
+
+func TestLoadSettingsMergesMaps(t *testing.T) {
+	home, project := settingsEnv(t, `
+ports:
+  mysql57: {3306: 13306}
+  redis: {6379: 16379}
+environment:
+  AWS_REGION: us-east-1
+  LOG_LEVEL: debug
+kafka_topics: ~/topics.yml
+`, `
+ports:
+  redis: {6379: 26379}
+environment:
+  LOG_LEVEL: info
+dynamodb_tables: config/tables.yml
+env_names:
+  mysql57: DB_URL
+`)
+
+	s, err := loadSettings(settingsFlags(t), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ports := map[string]map[int]int{"mysql57": {3306: 13306}, "redis": {6379: 26379}}
+	if !reflect.DeepEqual(s.Ports, ports) {
+		t.Errorf("ports = %v, want %v", s.Ports, ports)
+	}
+	environment := map[string]string{"AWS_REGION": "us-east-1", "LOG_LEVEL": "info"}
+	if !reflect.DeepEqual(s.Environment, environment) {
+		t.Errorf("environment = %v, want %v", s.Environment, environment)
+	}
+	// relative paths are resolved against the directory of the config file
+	// they are in, not the current directory
+	if want := filepath.Join(home, "topics.yml"); s.KafkaTopics != want {
+		t.Errorf("kafka topics = %s, want %s", s.KafkaTopics, want)
+	}
+	if want := filepath.Join(project, "config", "tables.yml"); s.DynamodbTables != want {
+		t.Errorf("dynamodb tables = %s, want %s", s.DynamodbTables, want)
+	}
+
+	homeConfig := filepath.Join(home, ".gdc.yml")
+	projectConfig := filepath.Join(project, ".gdc.yml")
+	origins := map[string]string{
+		"ports.mysql57.3306":     homeConfig,
+		"ports.redis.6379":       projectConfig,
+		"environment.AWS_REGION": homeConfig,
+		"environment.LOG_LEVEL":  projectConfig,
+		"kafka_topics":           homeConfig,
+		"dynamodb_tables":        projectConfig,
+		"env_names.mysql57":      projectConfig,
+	}
+	for key, origin := range origins {
+		if s.origins[key] != origin {
+			t.Errorf("origin of %s = %s, want %s", key, s.origins[key], origin)
+		}
+	}
+}
+
+func TestLoadSettingsConfigFlag(t *testing.T) {
+	home, _ := settingsEnv(t, "services: [redis]\n", "")
+	other := filepath.Join(home, "other", "gdc.yml")
+	writeConfig(t, other, "services: [kafka]\ncompose_files: [extra.yml]\n")
+
+	s, err := loadSettings(settingsFlags(t), other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(s.Services, []string{"kafka"}) || s.origins["services"] != other {
+		t.Errorf("services = %q from %s, want kafka from %s", s.Services, s.origins["services"], other)
+	}
+	if want := filepath.Join(home, "other", "extra.yml"); len(s.ComposeFiles) != 1 || s.ComposeFiles[0] != want {
+		t.Errorf("compose files = %q, want %s", s.ComposeFiles, want)
+	}
+}
+
+func TestLoadSettingsInvalidConfig(t *testing.T) {
+	_, project := settingsEnv(t, "", "services: {redis: 1}\n")
+
+	_, err := loadSettings(settingsFlags(t), "")
+	want := "error parsing config file " + filepath.Join(project, ".gdc.yml")
+	if err == nil || !strings.HasPrefix(err.Error(), want) {
+		t.Errorf("expected an error starting with %q, got %v", want, err)
+	}
+}
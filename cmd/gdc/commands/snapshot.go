@@ -0,0 +1,138 @@
+/*
+Package commands Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/wishabi/global-docker-compose/gdc"
+)
+
+// SnapshotFormat format to list the snapshots in (table or json)
+var SnapshotFormat string
+
+// SnapshotForce replace an existing snapshot on save, or restore an incompatible one
+var SnapshotForce bool
+
+// SnapshotCmd represents the snapshot command
+var SnapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Save and restore snapshots of a service's data",
+	Long: `
+	Save the named volumes of a service, e.g. mysql57-data, to a snapshot and
+	restore them later to get back to a known state. The service is stopped while
+	its volumes are archived or restored, and started again afterwards.
+
+	Snapshots are kept in ~/.gdc/snapshots, together with the image the service
+	ran, the gdc version, their size and when they were taken. Snapshots taken
+	with another major version of the image are not restored unless given --force.
+
+	Usage: global_docker_compose snapshot save mysql57 seeded
+	       global_docker_compose snapshot restore mysql57 seeded
+	       global_docker_compose snapshot list
+	       global_docker_compose snapshot delete mysql57 seeded
+	`,
+}
+
+// SnapshotSaveCmd represents the snapshot save command
+var SnapshotSaveCmd = &cobra.Command{
+	Use:   "save <service> <name>",
+	Short: "Save a snapshot of a service's volumes",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		info := newComposeInfo()
+		options := gdc.SnapshotOptions{Force: SnapshotForce, Progress: os.Stderr}
+		return gdc.SaveSnapshot(cmd.Context(), info, args[0], args[1], options)
+	},
+}
+
+// SnapshotRestoreCmd represents the snapshot restore command
+var SnapshotRestoreCmd = &cobra.Command{
+	Use:   "restore <service> <name>",
+	Short: "Restore a service's volumes from a snapshot",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		info := newComposeInfo()
+		options := gdc.SnapshotOptions{Force: SnapshotForce, Progress: os.Stderr}
+		return gdc.RestoreSnapshot(cmd.Context(), info, args[0], args[1], options)
+	},
+}
+
+// SnapshotListCmd represents the snapshot list command
+var SnapshotListCmd = &cobra.Command{
+	Use:   "list [service]",
+	Short: "List the snapshots of a service, or of all services",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if SnapshotFormat != "table" && SnapshotFormat != "json" {
+			return fmt.Errorf("invalid --format %s - expected table or json", SnapshotFormat)
+		}
+		service := ""
+		if len(args) > 0 {
+			service = args[0]
+		}
+		snapshots, err := gdc.Snapshots(service, os.Stderr)
+		if err != nil {
+			return err
+		}
+		if SnapshotFormat == "json" {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(snapshots)
+		}
+		if len(snapshots) == 0 {
+			fmt.Println("No snapshots saved.")
+			return nil
+		}
+		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, "SERVICE\tNAME\tIMAGE\tSIZE\tCREATED\tGDC")
+		for _, snapshot := range snapshots {
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\n",
+				snapshot.Service,
+				snapshot.Name,
+				snapshot.ImageIdentity,
+				gdc.FormatBytes(snapshot.Size),
+				snapshot.Created.Local().Format(time.RFC822),
+				snapshot.GdcVersion,
+			)
+		}
+		return writer.Flush()
+	},
+}
+
+// SnapshotDeleteCmd represents the snapshot delete command
+var SnapshotDeleteCmd = &cobra.Command{
+	Use:   "delete <service> <name>",
+	Short: "Delete a snapshot",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		info := newComposeInfo()
+		return gdc.DeleteSnapshot(info, args[0], args[1])
+	},
+}
+
+func init() {
+	SnapshotSaveCmd.Flags().BoolVar(&SnapshotForce, "force", false, "Replace an existing snapshot of the same name")
+	SnapshotRestoreCmd.Flags().BoolVar(&SnapshotForce, "force", false, "Restore even if the snapshot was taken with an incompatible image")
+	SnapshotListCmd.Flags().StringVar(&SnapshotFormat, "format", "table", "Output format (table or json)")
+	SnapshotCmd.AddCommand(SnapshotSaveCmd, SnapshotRestoreCmd, SnapshotListCmd, SnapshotDeleteCmd)
+	rootCmd.AddCommand(SnapshotCmd)
+}
@@ -0,0 +1,85 @@
+/*
+Package commands Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/wishabi/global-docker-compose/gdc"
+)
+
+// StatusFormat format to print the status in (table or json)
+var StatusFormat string
+
+// StatusCmd represents the status command
+var StatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the status of the requested services",
+	Long: `
+	Show the container state, health, published ports, connection URL and admin UI
+	link of each requested service and its companions.
+
+	Usage: global_docker_compose status
+	       global_docker_compose status --format json
+	`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if StatusFormat != "table" && StatusFormat != "json" {
+			return fmt.Errorf("invalid --format %s - expected table or json", StatusFormat)
+		}
+		info := newComposeInfo()
+		statuses, err := gdc.Status(cmd.Context(), info)
+		if err != nil || DryRun {
+			return err
+		}
+
+		if StatusFormat == "json" {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(statuses)
+		}
+		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, "SERVICE\tSTATE\tHEALTH\tPORTS\tURL\tUI")
+		for _, status := range statuses {
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\n",
+				status.Service,
+				status.State,
+				orDash(status.Health),
+				orDash(strings.Join(status.Ports, ", ")),
+				orDash(status.URL),
+				orDash(status.UI),
+			)
+		}
+		return writer.Flush()
+	},
+}
+
+func orDash(str string) string {
+	if str == "" {
+		return "-"
+	}
+	return str
+}
+
+func init() {
+	StatusCmd.Flags().StringVar(&StatusFormat, "format", "table", "Output format (table or json)")
+	rootCmd.AddCommand(StatusCmd)
+}
@@ -27,17 +27,21 @@ var StopCmd = &cobra.Command{
 	Long: `
 	Stop either specified or all Docker containers.
 
+	Services another project brought up and still uses are left running, unless
+	--force is given. See the claims command.
+
 	Usage: global_docker_compose stop {service}
 				 global_docker_compose stop
 	`,
 	Args: cobra.MaximumNArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		info := gdc.NewComposeInfo(ComposeFile, Services)
-		gdc.Stop(info)
-		gdc.Cleanup()
+	RunE: func(cmd *cobra.Command, args []string) error {
+		info := newComposeInfo()
+		return gdc.Stop(cmd.Context(), info, Force)
 	},
 }
 
 func init() {
+	StopCmd.Flags().BoolVar(&Force, "force", false, "Stop services even if other projects still use them")
+	addCompanionFlags(StopCmd)
 	rootCmd.AddCommand(StopCmd)
 }
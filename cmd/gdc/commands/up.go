@@ -16,23 +16,60 @@ limitations under the License.
 package commands
 
 import (
+	"time"
+
 	"github.com/spf13/cobra"
 	"github.com/wishabi/global-docker-compose/gdc"
 )
 
+// WaitForReady block until the services are ready after bringing them up
+var WaitForReady bool
+
+// WaitTimeout how long to wait for services to be ready
+var WaitTimeout time.Duration
+
+// RemapPorts publish services on free ports if their host ports are taken
+var RemapPorts bool
+
 // UpCmd represents the up command
 var UpCmd = &cobra.Command{
 	Use:    "up",
 	Short:  "Bring up Docker containers",
-	Long:   `Bring up all configured docker containers.`,
+	Long:   `
+	Bring up all configured docker containers.
+
+	With --wait, block until every service and its companions accept connections
+	(e.g. MySQL sends its handshake and Kafka answers a metadata request).
+
+	Before bringing anything up, the host ports the services publish are checked. If
+	another process already uses one, up fails with a report of who holds it, or with
+	--remap-ports publishes the affected services on free ports instead.
+
+	If the project config names a kafka_topics file and kafka is brought up, the
+	topics in it are applied once the broker is ready. Likewise a dynamodb_tables
+	file is applied once dynamodb is ready.
+
+	Usage: global_docker_compose up --wait --timeout 2m
+	       global_docker_compose up --remap-ports
+	`,
 	Args: cobra.NoArgs,
-	Run: func(cmd *cobra.Command, args []string) {
-		info := gdc.NewComposeInfo(ComposeFile, Services)
-		gdc.Up(info)
-		gdc.Cleanup()
+	RunE: func(cmd *cobra.Command, args []string) error {
+		info := newComposeInfo()
+		return gdc.Up(cmd.Context(), info, gdc.UpOptions{
+			Wait:           WaitForReady,
+			Timeout:        WaitTimeout,
+			RemapPorts:     RemapPorts,
+			KafkaTopics:    config.KafkaTopics,
+			DynamodbTables: config.DynamodbTables,
+		})
 	},
 }
 
 func init() {
+	UpCmd.Flags().BoolVar(&WaitForReady, "wait", false, "Wait for the services to be ready")
+	UpCmd.Flags().DurationVar(&WaitTimeout, "timeout", 2*time.Minute, "How long --wait waits for services to be ready")
+	UpCmd.Flags().BoolVar(&RemapPorts, "remap-ports", false, "Publish services on free ports if their host ports are already in use")
+	UpCmd.Flags().BoolVar(&Relogin, "relogin", false, "Log in to registries again even if a cached login hasn't expired")
+	addCompanionFlags(UpCmd)
 	rootCmd.AddCommand(UpCmd)
 }
@@ -0,0 +1,66 @@
+package gdc
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// renderAddressTemplate fills in a url, ui or env template from an x-gdc
+// block. {{address 3306}} in the template is replaced with the address the
+// given container port is reachable on, as decided by the address function,
+// and {{host 3306}} and {{port 3306}} with its host and port.
+func renderAddressTemplate(text string, address func(port int) (string, error)) (string, error) {
+	part := func(index int) func(int) (string, error) {
+		return func(port int) (string, error) {
+			addr, err := address(port)
+			if err != nil {
+				return "", err
+			}
+			host, p, err := net.SplitHostPort(addr)
+			return []string{host, p}[index], err
+		}
+	}
+	tmpl, err := template.New("address").Option("missingkey=error").Funcs(template.FuncMap{
+		"address": address,
+		"host":    part(0),
+		"port":    part(1),
+	}).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var builder strings.Builder
+	err = tmpl.Execute(&builder, nil)
+	if err != nil {
+		return "", err
+	}
+	return builder.String(), nil
+}
+
+// hostURL renders the template for the service as seen from the host.
+func (compose ComposeInfo) hostURL(file *ComposeFile, service string, text string) (string, error) {
+	return renderAddressTemplate(text, func(port int) (string, error) {
+		address, found := compose.hostAddress(file, service, port)
+		if !found {
+			return "", fmt.Errorf("port %d of service %s is not published", port, service)
+		}
+		return address, nil
+	})
+}
+
+// containerURL renders the template for the service as seen from another
+// container on the same Docker network.
+func (compose ComposeInfo) containerURL(file *ComposeFile, service string, text string) (string, error) {
+	return renderAddressTemplate(text, func(port int) (string, error) {
+		host := service
+		if file.Services[service].Hostname != "" {
+			host = file.Services[service].Hostname
+		}
+		if containerPort, found := file.Services[service].Gdc.ContainerPorts[port]; found {
+			port = containerPort
+		}
+		return net.JoinHostPort(host, strconv.Itoa(port)), nil
+	})
+}
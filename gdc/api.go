@@ -0,0 +1,76 @@
+package gdc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// serviceAddress is where the port of a requested service, or of a companion
+// of one, can be reached from the host.
+func serviceAddress(compose ComposeInfo, command string, service string, port int) (string, error) {
+	file, services, err := requestedServices(compose, command)
+	if err != nil {
+		return "", err
+	}
+	if !contains(services, service) {
+		return "", fmt.Errorf("%s service not provided! Please use the --services option", service)
+	}
+	address, found := compose.hostAddress(file, service, port)
+	if !found {
+		return "", fmt.Errorf("port %d of service %s is not published", port, service)
+	}
+	return address, nil
+}
+
+// apiRequest sends a request to a service's HTTP API. The body, if any, is
+// sent as JSON with the content type given, or as is if it is a []byte, and a
+// JSON response is decoded into result, if given. Error statuses are returned
+// as an *APIError.
+func apiRequest(ctx context.Context, method string, url string, contentType string, body interface{}, result interface{}) error {
+	var reader io.Reader
+	accept := contentType
+	if data, ok := body.([]byte); ok {
+		// e.g. NDJSON, answered with JSON
+		reader = bytes.NewReader(data)
+		accept = "application/json"
+	} else if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", contentType)
+	}
+	request.Header.Set("Accept", accept)
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode >= 400 {
+		return &APIError{Method: method, URL: url, Status: response.StatusCode, Body: strings.TrimSpace(string(data))}
+	}
+	if result == nil || len(data) == 0 {
+		return nil
+	}
+	err = json.Unmarshal(data, result)
+	if err != nil {
+		return fmt.Errorf("error reading response from %s %s: %w", method, url, err)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package gdc
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+// Message formats for keys and values.
+const (
+	// JSON, or a plain string if the message isn't JSON
+	FormatJSON = "json"
+	// Avro in the Schema Registry wire format
+	FormatAvro = "avro"
+)
+
+// the magic byte starting a message in the Schema Registry wire format,
+// followed by the schema's id as 4 bytes
+const wireFormatMagic = 0
+
+// avroSerde converts between JSON and Avro in the Schema Registry wire
+// format, caching the schemas it looks up.
+type avroSerde struct {
+	ctx  context.Context
+	base string
+	ids  map[int]*goavro.Codec
+	// latest version of each subject, looked up when first encoding for it
+	subjects map[string]registeredSchema
+}
+
+func newAvroSerde(ctx context.Context, compose ComposeInfo) (*avroSerde, error) {
+	base, err := schemaRegistryURL(compose, "kafka")
+	if err != nil {
+		return nil, err
+	}
+	return &avroSerde{
+		ctx:      ctx,
+		base:     base,
+		ids:      map[int]*goavro.Codec{},
+		subjects: map[string]registeredSchema{},
+	}, nil
+}
+
+func avroCodec(schema registeredSchema) (*goavro.Codec, error) {
+	if schema.SchemaType != "" && schema.SchemaType != SchemaAvro {
+		return nil, fmt.Errorf("schema %d is %s - only Avro schemas are supported", schema.ID, schema.SchemaType)
+	}
+	codec, err := goavro.NewCodec(schema.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse schema %d: %w", schema.ID, err)
+	}
+	return codec, nil
+}
+
+// codec is the codec for the schema with the id.
+func (s *avroSerde) codec(id int) (*goavro.Codec, error) {
+	if codec, found := s.ids[id]; found {
+		return codec, nil
+	}
+	schema := registeredSchema{ID: id}
+	err := apiRequest(s.ctx, http.MethodGet, fmt.Sprintf("%s/schemas/ids/%d", s.base, id), schemaRegistryContentType, nil, &schema)
+	if err != nil {
+		return nil, fmt.Errorf("error looking up schema %d: %w", id, err)
+	}
+	codec, err := avroCodec(schema)
+	if err != nil {
+		return nil, err
+	}
+	s.ids[id] = codec
+	return codec, nil
+}
+
+// decode converts a message in the wire format to JSON.
+func (s *avroSerde) decode(data []byte) (json.RawMessage, error) {
+	if len(data) < 5 || data[0] != wireFormatMagic {
+		return nil, errors.New("not in the Schema Registry wire format")
+	}
+	codec, err := s.codec(int(binary.BigEndian.Uint32(data[1:5])))
+	if err != nil {
+		return nil, err
+	}
+	native, _, err := codec.NativeFromBinary(data[5:])
+	if err != nil {
+		return nil, err
+	}
+	text, err := codec.TextualFromNative(nil, native)
+	if err != nil {
+		return nil, err
+	}
+	return text, nil
+}
+
+// encode converts JSON to the wire format, using the latest version of the
+// subject's schema.
+func (s *avroSerde) encode(subject string, value json.RawMessage) ([]byte, error) {
+	schema, found := s.subjects[subject]
+	if !found {
+		err := apiRequest(s.ctx, http.MethodGet, s.base+"/subjects/"+url.PathEscape(subject)+"/versions/latest",
+			schemaRegistryContentType, nil, &schema)
+		if registryErrorCode(err) == registrySubjectNotFound {
+			return nil, fmt.Errorf("subject %s has no schemas registered - use schemas push", subject)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error looking up subject %s: %w", subject, err)
+		}
+		s.subjects[subject] = schema
+	}
+	codec, found := s.ids[schema.ID]
+	if !found {
+		var err error
+		codec, err = avroCodec(schema)
+		if err != nil {
+			return nil, err
+		}
+		s.ids[schema.ID] = codec
+	}
+	native, _, err := codec.NativeFromTextual(value)
+	if err != nil {
+		return nil, fmt.Errorf("does not match the latest schema of %s: %w", subject, err)
+	}
+	data := make([]byte, 5)
+	data[0] = wireFormatMagic
+	binary.BigEndian.PutUint32(data[1:], uint32(schema.ID))
+	return codec.BinaryFromNative(data, native)
+}
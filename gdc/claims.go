@@ -0,0 +1,179 @@
+package gdc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Claim is the set of services a project directory has brought up. As every
+// project shares the "global" Compose project, down and stop leave services
+// running while another project still claims them.
+type Claim struct {
+	Project  string    `json:"project"`
+	Services []string  `json:"services"`
+	Updated  time.Time `json:"updated"`
+}
+
+// claimsPath is where the claims are kept. Its directory is only created when
+// they are written, so reading them, e.g. on a dry run, changes nothing.
+func claimsPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".gdc", "state", "claims.json"), nil
+}
+
+// readClaims keyed by project directory. Claims of projects whose directory
+// no longer exists are dropped.
+func readClaims() (map[string]Claim, error) {
+	claims := map[string]Claim{}
+	path, err := claimsPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return claims, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &claims)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	for project := range claims {
+		if _, err := os.Stat(project); os.IsNotExist(err) {
+			delete(claims, project)
+		}
+	}
+	return claims, nil
+}
+
+func writeClaims(claims map[string]Claim) error {
+	path, err := claimsPath()
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(claims, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+// Claims of every project, sorted by project directory.
+func Claims() ([]Claim, error) {
+	claims, err := readClaims()
+	if err != nil {
+		return nil, err
+	}
+	result := []Claim{}
+	for _, project := range sortedKeys(claims) {
+		result = append(result, claims[project])
+	}
+	return result, nil
+}
+
+// project is the directory the claims of this invocation are made for: the
+// directory of the project's .gdc.yml, or the current one.
+func (compose ComposeInfo) project() (string, error) {
+	if compose.ProjectDir != "" {
+		return filepath.Abs(compose.ProjectDir)
+	}
+	return os.Getwd()
+}
+
+// claimServices records that this project uses the services.
+func claimServices(compose ComposeInfo, services []string) error {
+	if _, dryRun := compose.Runner.(fileWriter); dryRun {
+		return nil
+	}
+	project, err := compose.project()
+	if err != nil {
+		return err
+	}
+	claims, err := readClaims()
+	if err != nil {
+		return err
+	}
+	claim := claims[project]
+	claim.Project = project
+	claim.Updated = time.Now()
+	for _, service := range services {
+		if !contains(claim.Services, service) {
+			claim.Services = append(claim.Services, service)
+		}
+	}
+	sort.Strings(claim.Services)
+	claims[project] = claim
+	return writeClaims(claims)
+}
+
+// releaseServices works out how to drop this project's claims on the
+// services, or on all of them if services is nil. It returns the services
+// other projects still claim, with the projects claiming them, and a function
+// that drops the claims, to call once the services are really stopped. With
+// force every claim on the services is dropped, so none are held.
+func releaseServices(compose ComposeInfo, services []string, force bool) (map[string][]string, func() error, error) {
+	project, err := compose.project()
+	if err != nil {
+		return nil, nil, err
+	}
+	claims, err := readClaims()
+	if err != nil {
+		return nil, nil, err
+	}
+	released := func(service string) bool {
+		return services == nil || contains(services, service)
+	}
+	held := map[string][]string{}
+	for _, name := range sortedKeys(claims) {
+		claim := claims[name]
+		if name != project && !force {
+			for _, service := range claim.Services {
+				if released(service) {
+					held[service] = append(held[service], name)
+				}
+			}
+			continue
+		}
+		remaining := []string{}
+		for _, service := range claim.Services {
+			if !released(service) {
+				remaining = append(remaining, service)
+			}
+		}
+		claim.Services = remaining
+		claims[name] = claim
+		if len(remaining) == 0 {
+			delete(claims, name)
+		}
+	}
+	release := func() error {
+		if _, dryRun := compose.Runner.(fileWriter); dryRun {
+			return nil
+		}
+		return writeClaims(claims)
+	}
+	return held, release, nil
+}
+
+func contains(list []string, str string) bool {
+	for _, s := range list {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
@@ -1,61 +1,143 @@
 package gdc
 
-import(
+import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/exec"
 	"strings"
 
 	"github.com/codeskyblue/go-sh"
 )
 
-func shellCommand(session *sh.Session, cmd string) *sh.Session {
-  tokens := strings.Split(cmd, " ")
-	tokensInt := []interface{}{} // doesn't seem to be any direct way to cast []string to []interface{}
-	for _, t := range(tokens[1:]) {
-		tokensInt = append(tokensInt, t)
+// Command is a pipeline of one or more processes, each given as an argv slice.
+// Arguments are handed to the process untouched, so they never need quoting.
+type Command struct {
+	Pipeline [][]string
+	Env      map[string]string
+	Stdin    io.Reader
+	Stdout   io.Writer
+	Stderr   io.Writer
+	// don't echo the command before running it, e.g. when capturing its output
+	Quiet bool
+}
+
+// NewCommand with the given argv.
+func NewCommand(args ...string) *Command {
+	return &Command{Pipeline: [][]string{args}}
+}
+
+// Pipe the output of the command into another process.
+func (c *Command) Pipe(args ...string) *Command {
+	c.Pipeline = append(c.Pipeline, args)
+	return c
+}
+
+// SetEnv sets an environment variable for every process in the pipeline.
+func (c *Command) SetEnv(key string, value string) *Command {
+	if c.Env == nil {
+		c.Env = map[string]string{}
 	}
-  return session.Command(tokens[0], tokensInt...)
+	c.Env[key] = value
+	return c
 }
 
-//RunCommand with a command string and arguments for interpolation using Sprintf
-func RunCommand(cmd string, args... interface{}) {
-	writeDcFile()
-	fullCommand := cmd
-	if (len(args) > 0) {
-		fullCommand = fmt.Sprintf(cmd, args...)
+// String prints the command the way it would be typed into a shell.
+func (c *Command) String() string {
+	parts := []string{}
+	for _, args := range c.Pipeline {
+		quoted := []string{}
+		for _, arg := range args {
+			quoted = append(quoted, ShellQuote(arg))
+		}
+		parts = append(parts, strings.Join(quoted, " "))
 	}
-	fmt.Printf("-> %s\n", fullCommand)
-	command := shellCommand(sh.InteractiveSession(), fullCommand)
-	command.SetEnv("KAFKA_ADV_HOST", os.Getenv("KAFKA_ADV_HOST"))
-	command.SetStdin(os.Stdin)
-	err := command.Run()
-	if (err != nil) {
-		Exit("Error running command! %s", fullCommand)
+	return strings.Join(parts, " | ")
+}
+
+// ShellQuote quotes the argument for a POSIX shell, if it needs quoting.
+func ShellQuote(arg string) string {
+	if arg == "" {
+		return "''"
+	}
+	if strings.ContainsAny(arg, " \t\n'\"\\$`|&;<>()*?[]{}~!#") {
+		return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
 	}
+	return arg
+}
+
+// ExitError is returned when a command, such as docker compose, runs but exits
+// with a non-zero status.
+type ExitError struct {
+	Command string
+	Code    int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("command exited with status %d: %s", e.Code, e.Command)
 }
 
-// RunCommands run a list of commands to be piped into each other
-func RunCommands(commands... string) {
-	writeDcFile()
-	for i, cmd := range(commands) {
-     if (i == 0) {
-			 fmt.Printf("-> %s", cmd)
-		 } else {
-			 fmt.Printf(" | %s", cmd)
-		 }
+// Runner executes commands on behalf of gdc.
+// Commands still running when the context is done are killed.
+type Runner interface {
+	Run(ctx context.Context, cmd *Command) error
+}
+
+// ShellRunner runs commands on the host using go-sh. Unless the command says
+// otherwise it is wired to the terminal's stdin, stdout and stderr.
+type ShellRunner struct{}
+
+// Run the command, echoing it first.
+func (ShellRunner) Run(ctx context.Context, cmd *Command) error {
+	if len(cmd.Pipeline) == 0 {
+		return errors.New("no command given")
+	}
+	if !cmd.Quiet {
+		fmt.Printf("-> %s\n", cmd)
 	}
-	fmt.Println()
-	
+
 	session := sh.InteractiveSession()
 	session.PipeStdErrors = true
 	session.PipeFail = true
-	session.SetStdin(os.Stdin)
-	for _, cmd := range(commands) {
-		session = shellCommand(session, cmd)
+	session.SetEnv("KAFKA_ADV_HOST", os.Getenv("KAFKA_ADV_HOST"))
+	for k, v := range cmd.Env {
+		session.SetEnv(k, v)
 	}
-	err := session.Run()
-	if (err != nil) {
-		Exit("Error running command! %v", commands)
+	if cmd.Stdin != nil {
+		session.SetStdin(cmd.Stdin)
+	}
+	if cmd.Stdout != nil {
+		session.Stdout = cmd.Stdout
+	}
+	if cmd.Stderr != nil {
+		session.Stderr = cmd.Stderr
+	}
+	for _, args := range cmd.Pipeline {
+		// go-sh treats non-string arguments as options, so keep them as strings
+		argsInt := []interface{}{}
+		for _, arg := range args[1:] {
+			argsInt = append(argsInt, arg)
+		}
+		session = session.Command(args[0], argsInt...)
 	}
-}
 
+	err := session.Start()
+	if err != nil {
+		return err
+	}
+	done := sh.Go(session.Wait)
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		session.Kill(os.Kill)
+		<-done
+		return ctx.Err()
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return &ExitError{Command: cmd.String(), Code: exitErr.ExitCode()}
+	}
+	return err
+}
@@ -0,0 +1,121 @@
+package gdc
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		arg  string
+		want string
+	}{
+		{"", "''"},
+		{"redis", "redis"},
+		{"--project-directory=/tmp/x", "--project-directory=/tmp/x"},
+		{"echo a b", "'echo a b'"},
+		{"it's", `'it'\''s'`},
+		{"$HOME", "'$HOME'"},
+		{"a|b", "'a|b'"},
+		{"*.sql", "'*.sql'"},
+	}
+	for _, test := range tests {
+		if got := ShellQuote(test.arg); got != test.want {
+			t.Errorf("ShellQuote(%q) = %s, want %s", test.arg, got, test.want)
+		}
+	}
+}
+
+func TestCommandString(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  *Command
+		want string
+	}{
+		{"single", NewCommand("docker", "ps"), "docker ps"},
+		{"quoted", NewCommand("sh", "-c", "echo a b"), "sh -c 'echo a b'"},
+		{"pipeline", NewCommand("cat", "my dump.sql").Pipe("mysql", "-u", "root"), "cat 'my dump.sql' | mysql -u root"},
+	}
+	for _, test := range tests {
+		if got := test.cmd.String(); got != test.want {
+			t.Errorf("%s: String() = %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestRecordingRunnerExitError(t *testing.T) {
+	runner := &RecordingRunner{ExitCodes: map[string]int{"false": 3}}
+	if err := runner.Run(context.Background(), NewCommand("true")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	err := runner.Run(context.Background(), NewCommand("false"))
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) || exitErr.Code != 3 || exitErr.Command != "false" {
+		t.Fatalf("expected exit error with status 3, got %v", err)
+	}
+	if want := "command exited with status 3: false"; err.Error() != want {
+		t.Errorf("Error() = %s, want %s", err, want)
+	}
+	if got := strings.Join(runner.Executed(), "; "); got != "true; false" {
+		t.Errorf("Executed() = %s", got)
+	}
+}
+
+func TestRecordingRunnerOutput(t *testing.T) {
+	runner := &RecordingRunner{Outputs: map[string]string{"docker ps": "redis\n"}}
+	out := strings.Builder{}
+	cmd := NewCommand("docker", "ps")
+	cmd.Stdout = &out
+	if err := runner.Run(context.Background(), cmd); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if out.String() != "redis\n" {
+		t.Errorf("output = %q, want %q", out.String(), "redis\n")
+	}
+}
+
+func TestShellRunnerExitError(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  *Command
+		code int
+	}{
+		{name: "success", cmd: NewCommand("sh", "-c", "exit 0")},
+		{name: "status", cmd: NewCommand("sh", "-c", "exit 3"), code: 3},
+		{name: "failing pipeline stage", cmd: NewCommand("sh", "-c", "exit 4").Pipe("cat"), code: 4},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.cmd.Quiet = true
+			err := ShellRunner{}.Run(context.Background(), test.cmd)
+			if test.code == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				return
+			}
+			var exitErr *ExitError
+			if !errors.As(err, &exitErr) || exitErr.Code != test.code || exitErr.Command != test.cmd.String() {
+				t.Fatalf("expected exit error with status %d, got %v", test.code, err)
+			}
+		})
+	}
+}
+
+func TestShellRunnerCancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	cmd := NewCommand("sleep", "10")
+	cmd.Quiet = true
+	start := time.Now()
+	err := ShellRunner{}.Run(ctx, cmd)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the context's error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("command was not killed, took %s", elapsed)
+	}
+}
@@ -0,0 +1,103 @@
+package gdc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// gdcExtension is the x-gdc block a service can declare in a compose file.
+type gdcExtension struct {
+	Companions []string   `yaml:"companions"`
+	Probe      *probeSpec `yaml:"probe"`
+	// templates for the connection URL and admin UI link, see renderAddressTemplate
+	URL string `yaml:"url"`
+	UI  string `yaml:"ui"`
+	// connection variables for apps using the service, as templates
+	Env map[string]string `yaml:"env"`
+	// container ports other containers should connect to instead of the one
+	// published to the host, e.g. Kafka's internal listener
+	ContainerPorts map[int]int `yaml:"container_ports"`
+}
+
+func (extension *gdcExtension) merge(override gdcExtension) {
+	if override.Companions != nil {
+		extension.Companions = override.Companions
+	}
+	if override.Probe != nil {
+		extension.Probe = override.Probe
+	}
+	if override.URL != "" {
+		extension.URL = override.URL
+	}
+	if override.UI != "" {
+		extension.UI = override.UI
+	}
+	for name, value := range override.Env {
+		if extension.Env == nil {
+			extension.Env = map[string]string{}
+		}
+		extension.Env[name] = value
+	}
+	for port, containerPort := range override.ContainerPorts {
+		if extension.ContainerPorts == nil {
+			extension.ContainerPorts = map[int]int{}
+		}
+		extension.ContainerPorts[port] = containerPort
+	}
+}
+
+// companions each service declares
+func (f *ComposeFile) companions() map[string][]string {
+	result := map[string][]string{}
+	for name, service := range f.Services {
+		result[name] = service.Gdc.Companions
+	}
+	return result
+}
+
+// resolveServices expands the requested services with their companions,
+// following companions of companions. Requested services are always kept,
+// but companions listed in `without` are skipped along with anything that is
+// only reachable through them.
+func resolveServices(requested []string, companions map[string][]string, noCompanions bool, without []string) ([]string, error) {
+	results := []string{}
+	seen := map[string]bool{}
+	skipped := map[string]bool{}
+	for _, s := range without {
+		skipped[s] = true
+	}
+
+	var visit func(service string, path []string) error
+	visit = func(service string, path []string) error {
+		for _, p := range path {
+			if p == service {
+				return fmt.Errorf("companion cycle detected: %s -> %s", strings.Join(path, " -> "), service)
+			}
+		}
+		if !seen[service] {
+			seen[service] = true
+			results = append(results, service)
+		}
+		if noCompanions {
+			return nil
+		}
+		for _, companion := range companions[service] {
+			if skipped[companion] {
+				continue
+			}
+			err := visit(companion, append(path, service))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, service := range requested {
+		err := visit(service, []string{})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
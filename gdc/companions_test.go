@@ -0,0 +1,128 @@
+package gdc
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestResolveServices(t *testing.T) {
+	companions := map[string][]string{
+		"kafka":           {"zookeeper", "schema-registry"},
+		"schema-registry": {"zookeeper", "registry-ui"},
+		"opensearch":      {"dashboards"},
+	}
+	tests := []struct {
+		name         string
+		requested    []string
+		noCompanions bool
+		without      []string
+		want         []string
+	}{
+		{name: "no companions declared", requested: []string{"redis"}, want: []string{"redis"}},
+		{
+			name:      "companions of companions",
+			requested: []string{"opensearch", "kafka"},
+			want:      []string{"opensearch", "dashboards", "kafka", "zookeeper", "schema-registry", "registry-ui"},
+		},
+		{
+			name:      "shared companions once",
+			requested: []string{"schema-registry", "kafka"},
+			want:      []string{"schema-registry", "zookeeper", "registry-ui", "kafka"},
+		},
+		{name: "no companions", requested: []string{"kafka", "opensearch"}, noCompanions: true, want: []string{"kafka", "opensearch"}},
+		{
+			name:      "without a shared companion",
+			requested: []string{"kafka"},
+			without:   []string{"zookeeper"},
+			want:      []string{"kafka", "schema-registry", "registry-ui"},
+		},
+		{
+			name:      "without skips what is only reachable through it",
+			requested: []string{"kafka"},
+			without:   []string{"schema-registry"},
+			want:      []string{"kafka", "zookeeper"},
+		},
+		{
+			name:      "requested services are kept",
+			requested: []string{"kafka", "zookeeper"},
+			without:   []string{"zookeeper"},
+			want:      []string{"kafka", "schema-registry", "registry-ui", "zookeeper"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := resolveServices(test.requested, companions, test.noCompanions, test.without)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestResolveServicesCycle(t *testing.T) {
+	companions := map[string][]string{"a": {"b"}, "b": {"c"}, "c": {"a"}}
+	_, err := resolveServices([]string{"a"}, companions, false, nil)
+	want := "companion cycle detected: a -> b -> c -> a"
+	if err == nil || err.Error() != want {
+		t.Fatalf("expected error %q, got %v", want, err)
+	}
+}
+
+func TestServiceList(t *testing.T) {
+	extra := filepath.Join(t.TempDir(), "extra.yml")
+	err := os.WriteFile(extra, []byte("services:\n  app:\n    image: app\n    x-gdc:\n      companions: [redis]\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name         string
+		requested    []string
+		noCompanions bool
+		without      []string
+		want         []string
+		err          error
+	}{
+		{name: "companions", requested: []string{"kafka"}, want: []string{"kafka", "zookeeper"}},
+		{name: "additional file companions", requested: []string{"app"}, want: []string{"app", "redis"}},
+		{name: "no companions", requested: []string{"app", "kafka"}, noCompanions: true, want: []string{"app", "kafka"}},
+		{name: "without", requested: []string{"app", "kafka"}, without: []string{"redis", "zookeeper"}, want: []string{"app", "kafka"}},
+		{name: "nothing requested", err: &NoServicesError{Command: "up"}},
+		{
+			name:      "unknown service",
+			requested: []string{"kafka", "mongo"},
+			err:       &ServiceNotFoundError{Command: "up", Service: "mongo", Known: []string{"app", "kafka", "redis", "zookeeper"}},
+		},
+		{
+			name:      "unknown without",
+			requested: []string{"kafka"},
+			without:   []string{"zookeper"},
+			err:       &ServiceNotFoundError{Command: "up", Service: "zookeper", Known: []string{"app", "kafka", "redis", "zookeeper"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			compose, _ := testComposeInfo(t, test.requested...)
+			compose.AdditionalFiles = []string{extra}
+			compose.NoCompanions = test.noCompanions
+			compose.Without = test.without
+			_, services, err := requestedServices(compose, "up")
+			if test.err != nil {
+				if err == nil || !reflect.DeepEqual(err, test.err) {
+					t.Fatalf("expected error %v, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(services, test.want) {
+				t.Errorf("got %q, want %q", services, test.want)
+			}
+		})
+	}
+}
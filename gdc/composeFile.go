@@ -0,0 +1,482 @@
+package gdc
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Location of a definition in a compose file, for error messages.
+type Location struct {
+	File string
+	Line int
+}
+
+func (l Location) String() string {
+	return fmt.Sprintf("%s:%d", l.File, l.Line)
+}
+
+// ComposeFile is the part of a docker-compose file gdc understands. Parsing a
+// file and merging it into another follows the same rules Compose uses.
+type ComposeFile struct {
+	Services map[string]*Service
+	Volumes  map[string]*Volume
+}
+
+// Service defined in a compose file.
+type Service struct {
+	Name          string
+	Image         string
+	Hostname      string
+	ContainerName string
+	// how to build the image, if the service has a build section
+	Build       *ServiceBuild
+	Ports       []Port
+	Volumes     []ServiceVolume
+	Environment map[string]string
+	DependsOn   []string
+	Labels      map[string]string
+	// the service's x-gdc block
+	Gdc gdcExtension
+	// any other x- extension fields
+	Extensions map[string]interface{}
+	Location   Location
+	// where the x-gdc block in effect was declared
+	gdcLocation Location
+	// fields tagged !override or !reset, which replace instead of merge
+	replaced map[string]bool
+}
+
+// ServiceVolume is a volume or bind mount of a service.
+type ServiceVolume struct {
+	// "volume" for named volumes, "bind" for host paths
+	Type     string
+	Source   string
+	Target   string
+	ReadOnly bool
+}
+
+// ServiceBuild is where a service's image is built from.
+type ServiceBuild struct {
+	Context    string `yaml:"context"`
+	Dockerfile string `yaml:"dockerfile"`
+}
+
+// Volume is a top-level named volume.
+type Volume struct {
+	// name of the volume in Docker, if not derived from the project name
+	Name     string `yaml:"name"`
+	External bool   `yaml:"external"`
+}
+
+// ServiceNames in alphabetical order.
+func (f *ComposeFile) ServiceNames() []string {
+	names := []string{}
+	for name := range f.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// composeError is an error at a particular place in a compose file.
+func composeError(location Location, message string, args ...interface{}) error {
+	return fmt.Errorf("%s: %s", location, fmt.Sprintf(message, args...))
+}
+
+// mappingValue finds the value for the key in a YAML mapping node.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// ParseComposeFile parses the compose file's contents. The path is only used
+// in error messages.
+func ParseComposeFile(path string, data []byte) (*ComposeFile, error) {
+	root := yaml.Node{}
+	err := yaml.Unmarshal(data, &root)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(root.Content) == 0 {
+		return nil, fmt.Errorf("%s: file is empty", path)
+	}
+	doc := root.Content[0]
+	if doc.Kind != yaml.MappingNode {
+		return nil, composeError(Location{path, doc.Line}, "expected a mapping at the top level")
+	}
+
+	file := &ComposeFile{Services: map[string]*Service{}, Volumes: map[string]*Volume{}}
+	services := mappingValue(doc, "services")
+	if services == nil {
+		return nil, composeError(Location{path, doc.Line}, "no services section")
+	}
+	if services.Kind != yaml.MappingNode {
+		return nil, composeError(Location{path, services.Line}, "services must be a mapping")
+	}
+	for i := 0; i+1 < len(services.Content); i += 2 {
+		name := services.Content[i].Value
+		service, err := parseService(name, services.Content[i+1], Location{path, services.Content[i].Line})
+		if err != nil {
+			return nil, err
+		}
+		file.Services[name] = service
+	}
+
+	if volumes := mappingValue(doc, "volumes"); volumes != nil {
+		if volumes.Kind != yaml.MappingNode {
+			return nil, composeError(Location{path, volumes.Line}, "volumes must be a mapping")
+		}
+		for i := 0; i+1 < len(volumes.Content); i += 2 {
+			volume := &Volume{}
+			if err := volumes.Content[i+1].Decode(volume); err != nil {
+				return nil, fmt.Errorf("%s: volume %s: %w", path, volumes.Content[i].Value, err)
+			}
+			file.Volumes[volumes.Content[i].Value] = volume
+		}
+	}
+	return file, nil
+}
+
+type rawService struct {
+	Image         string        `yaml:"image"`
+	Hostname      string        `yaml:"hostname"`
+	ContainerName string        `yaml:"container_name"`
+	Build         yaml.Node     `yaml:"build"`
+	Ports         yaml.Node     `yaml:"ports"`
+	Volumes       yaml.Node     `yaml:"volumes"`
+	Environment   yaml.Node     `yaml:"environment"`
+	DependsOn     yaml.Node     `yaml:"depends_on"`
+	Labels        yaml.Node     `yaml:"labels"`
+	Gdc           *gdcExtension `yaml:"x-gdc"`
+}
+
+func parseService(name string, node *yaml.Node, location Location) (*Service, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, composeError(location, "service %s must be a mapping", name)
+	}
+	raw := rawService{}
+	if err := node.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("%s: service %s: %w", location.File, name, err)
+	}
+	service := &Service{
+		Name:          name,
+		Image:         raw.Image,
+		Hostname:      raw.Hostname,
+		ContainerName: raw.ContainerName,
+		Environment:   map[string]string{},
+		Labels:        map[string]string{},
+		Extensions:    map[string]interface{}{},
+		Location:      location,
+		replaced:      map[string]bool{},
+	}
+	service.gdcLocation = location
+	if raw.Gdc != nil {
+		service.Gdc = *raw.Gdc
+		if gdc := mappingValue(node, "x-gdc"); gdc != nil {
+			service.gdcLocation = Location{location.File, gdc.Line}
+		}
+	}
+
+	fields := map[string]*yaml.Node{
+		"ports":       &raw.Ports,
+		"volumes":     &raw.Volumes,
+		"environment": &raw.Environment,
+		"depends_on":  &raw.DependsOn,
+		"labels":      &raw.Labels,
+	}
+	for field, value := range fields {
+		if value.Tag == "!override" || value.Tag == "!reset" {
+			service.replaced[field] = true
+		}
+	}
+
+	for _, item := range sequence(&raw.Ports) {
+		port := Port{}
+		if err := item.Decode(&port); err != nil {
+			return nil, composeError(Location{location.File, item.Line}, "invalid port for service %s: %s", name, err)
+		}
+		service.Ports = append(service.Ports, port)
+	}
+	for _, item := range sequence(&raw.Volumes) {
+		volume, err := parseServiceVolume(item)
+		if err != nil {
+			return nil, composeError(Location{location.File, item.Line}, "invalid volume for service %s: %s", name, err)
+		}
+		service.Volumes = append(service.Volumes, volume)
+	}
+	var err error
+	if service.Environment, err = parseDictionary(&raw.Environment); err != nil {
+		return nil, composeError(Location{location.File, raw.Environment.Line}, "invalid environment for service %s: %s", name, err)
+	}
+	if service.Labels, err = parseDictionary(&raw.Labels); err != nil {
+		return nil, composeError(Location{location.File, raw.Labels.Line}, "invalid labels for service %s: %s", name, err)
+	}
+	switch raw.Build.Kind {
+	case yaml.ScalarNode:
+		service.Build = &ServiceBuild{Context: raw.Build.Value}
+	case yaml.MappingNode:
+		service.Build = &ServiceBuild{}
+		if err := raw.Build.Decode(service.Build); err != nil {
+			return nil, composeError(Location{location.File, raw.Build.Line}, "invalid build for service %s: %s", name, err)
+		}
+	}
+	switch raw.DependsOn.Kind {
+	case yaml.SequenceNode:
+		for _, item := range raw.DependsOn.Content {
+			service.DependsOn = append(service.DependsOn, item.Value)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(raw.DependsOn.Content); i += 2 {
+			service.DependsOn = append(service.DependsOn, raw.DependsOn.Content[i].Value)
+		}
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i].Value
+		if strings.HasPrefix(key, "x-") && key != "x-gdc" {
+			var value interface{}
+			if err := node.Content[i+1].Decode(&value); err != nil {
+				return nil, composeError(Location{location.File, node.Content[i].Line}, "invalid %s for service %s: %s", key, name, err)
+			}
+			service.Extensions[key] = value
+		}
+	}
+	if service.Gdc.Probe != nil {
+		if _, found := probes[service.Gdc.Probe.Type]; !found {
+			return nil, composeError(service.gdcLocation, "unknown probe type %s for service %s", service.Gdc.Probe.Type, name)
+		}
+	}
+	return service, nil
+}
+
+// sequence items of the node, which may be missing or !reset to null
+func sequence(node *yaml.Node) []*yaml.Node {
+	if node.Kind != yaml.SequenceNode {
+		return nil
+	}
+	return node.Content
+}
+
+// parseDictionary reads environment or labels, which may be given either as a
+// mapping or as a list of KEY=VALUE strings.
+func parseDictionary(node *yaml.Node) (map[string]string, error) {
+	result := map[string]string{}
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			value := node.Content[i+1]
+			if value.Tag == "!!null" {
+				result[node.Content[i].Value] = ""
+				continue
+			}
+			if value.Kind != yaml.ScalarNode {
+				return nil, fmt.Errorf("value of %s must be a string", node.Content[i].Value)
+			}
+			result[node.Content[i].Value] = value.Value
+		}
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			key, value, _ := strings.Cut(item.Value, "=")
+			result[key] = value
+		}
+	case 0:
+	default:
+		return nil, fmt.Errorf("expected a mapping or a list")
+	}
+	return result, nil
+}
+
+func parseServiceVolume(node *yaml.Node) (ServiceVolume, error) {
+	volume := ServiceVolume{}
+	if node.Kind == yaml.MappingNode {
+		long := struct {
+			Type     string `yaml:"type"`
+			Source   string `yaml:"source"`
+			Target   string `yaml:"target"`
+			ReadOnly bool   `yaml:"read_only"`
+		}{}
+		if err := node.Decode(&long); err != nil {
+			return volume, err
+		}
+		return ServiceVolume{Type: long.Type, Source: long.Source, Target: long.Target, ReadOnly: long.ReadOnly}, nil
+	}
+	parts := strings.Split(node.Value, ":")
+	switch len(parts) {
+	case 1:
+		// anonymous volume
+		return ServiceVolume{Type: "volume", Target: parts[0]}, nil
+	case 2, 3:
+		volume.Source = parts[0]
+		volume.Target = parts[1]
+		volume.ReadOnly = len(parts) == 3 && strings.Contains(parts[2], "ro")
+	default:
+		return volume, fmt.Errorf("expected source:target[:mode], got %s", node.Value)
+	}
+	volume.Type = "volume"
+	if filepath.IsAbs(volume.Source) || strings.HasPrefix(volume.Source, ".") || strings.HasPrefix(volume.Source, "~") {
+		volume.Type = "bind"
+	}
+	return volume, nil
+}
+
+// UnmarshalYAML reads a port in either short ("8099:8001") or long syntax.
+// Ports that are not published to a fixed host port, such as ranges, bare
+// container ports or ports using variables, are kept with Published set to 0.
+func (p *Port) UnmarshalYAML(node *yaml.Node) error {
+	p.raw = node
+	switch node.Kind {
+	case yaml.ScalarNode:
+		spec := node.Value
+		if i := strings.Index(spec, "/"); i >= 0 {
+			p.Protocol = spec[i+1:]
+			spec = spec[:i]
+		}
+		parts := strings.Split(spec, ":")
+		if len(parts) > 2 {
+			p.HostIP = strings.Join(parts[:len(parts)-2], ":")
+		}
+		target, err := strconv.Atoi(parts[len(parts)-1])
+		if err != nil {
+			return nil
+		}
+		p.Target = target
+		if len(parts) > 1 {
+			if published, err := strconv.Atoi(parts[len(parts)-2]); err == nil {
+				p.Published = published
+			}
+		}
+		return nil
+	case yaml.MappingNode:
+		long := struct {
+			Target    string `yaml:"target"`
+			Published string `yaml:"published"`
+			HostIP    string `yaml:"host_ip"`
+			Protocol  string `yaml:"protocol"`
+		}{}
+		if err := node.Decode(&long); err != nil {
+			return err
+		}
+		p.HostIP = long.HostIP
+		p.Protocol = long.Protocol
+		p.Target, _ = strconv.Atoi(long.Target)
+		p.Published, _ = strconv.Atoi(long.Published)
+		return nil
+	}
+	return fmt.Errorf("expected a string or a mapping")
+}
+
+// Merge the override file into this one using Compose's merge rules: single
+// values are replaced, ports and depends_on are appended to, volumes are
+// merged by their mount path and environment and labels by key. Fields tagged
+// !override or !reset replace the earlier value instead.
+func (f *ComposeFile) Merge(override *ComposeFile) {
+	for name, volume := range override.Volumes {
+		f.Volumes[name] = volume
+	}
+	for name, service := range override.Services {
+		existing, found := f.Services[name]
+		if !found {
+			f.Services[name] = service
+			continue
+		}
+		existing.merge(service)
+	}
+}
+
+func (s *Service) merge(override *Service) {
+	if override.Image != "" {
+		s.Image = override.Image
+	}
+	if override.Hostname != "" {
+		s.Hostname = override.Hostname
+	}
+	if override.ContainerName != "" {
+		s.ContainerName = override.ContainerName
+	}
+	if override.Build != nil {
+		if s.Build == nil {
+			s.Build = &ServiceBuild{}
+		}
+		if override.Build.Context != "" {
+			s.Build.Context = override.Build.Context
+		}
+		if override.Build.Dockerfile != "" {
+			s.Build.Dockerfile = override.Build.Dockerfile
+		}
+	}
+
+	if override.replaced["ports"] {
+		s.Ports = override.Ports
+	} else {
+		for _, port := range override.Ports {
+			duplicate := false
+			for _, p := range s.Ports {
+				duplicate = duplicate || p.key() == port.key()
+			}
+			if !duplicate {
+				s.Ports = append(s.Ports, port)
+			}
+		}
+	}
+
+	if override.replaced["volumes"] {
+		s.Volumes = override.Volumes
+	} else {
+		for _, volume := range override.Volumes {
+			replaced := false
+			for i, v := range s.Volumes {
+				if v.Target == volume.Target {
+					s.Volumes[i] = volume
+					replaced = true
+				}
+			}
+			if !replaced {
+				s.Volumes = append(s.Volumes, volume)
+			}
+		}
+	}
+
+	if override.replaced["environment"] {
+		s.Environment = map[string]string{}
+	}
+	for k, v := range override.Environment {
+		s.Environment[k] = v
+	}
+	if override.replaced["labels"] {
+		s.Labels = map[string]string{}
+	}
+	for k, v := range override.Labels {
+		s.Labels[k] = v
+	}
+
+	if override.replaced["depends_on"] {
+		s.DependsOn = override.DependsOn
+	} else {
+		for _, dependency := range override.DependsOn {
+			duplicate := false
+			for _, d := range s.DependsOn {
+				duplicate = duplicate || d == dependency
+			}
+			if !duplicate {
+				s.DependsOn = append(s.DependsOn, dependency)
+			}
+		}
+	}
+
+	for k, v := range override.Extensions {
+		s.Extensions[k] = v
+	}
+	if override.gdcLocation != override.Location {
+		s.gdcLocation = override.gdcLocation
+	}
+	s.Gdc.merge(override.Gdc)
+}
@@ -0,0 +1,254 @@
+package gdc
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPortSyntax(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want Port
+	}{
+		{name: "published", yaml: `"8099:8001"`, want: Port{Published: 8099, Target: 8001}},
+		{name: "host ip and protocol", yaml: `"127.0.0.1:3306:3306/tcp"`, want: Port{HostIP: "127.0.0.1", Published: 3306, Target: 3306, Protocol: "tcp"}},
+		{name: "ipv6 host ip", yaml: `"::1:8080:80"`, want: Port{HostIP: "::1", Published: 8080, Target: 80}},
+		{name: "container port only", yaml: `"6379"`, want: Port{Target: 6379}},
+		{name: "number", yaml: `6379`, want: Port{Target: 6379}},
+		{name: "variable", yaml: `"${PORT}:80/udp"`, want: Port{Target: 80, Protocol: "udp"}},
+		{name: "range", yaml: `"9000-9001:9000-9001"`, want: Port{}},
+		{
+			name: "long syntax",
+			yaml: "{target: 80, published: \"8080\", host_ip: 127.0.0.1, protocol: udp}",
+			want: Port{HostIP: "127.0.0.1", Published: 8080, Target: 80, Protocol: "udp"},
+		},
+		{name: "long syntax range", yaml: "{target: 80, published: 8080-8081}", want: Port{Target: 80}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := fmt.Sprintf("services:\n  app:\n    ports:\n      - %s\n", test.yaml)
+			file, err := ParseComposeFile("test.yml", []byte(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			ports := file.Services["app"].Ports
+			if len(ports) != 1 {
+				t.Fatalf("expected one port, got %v", ports)
+			}
+			port := ports[0]
+			port.raw = nil
+			if port != test.want {
+				t.Errorf("got %+v, want %+v", port, test.want)
+			}
+		})
+	}
+}
+
+const mergeBase = `
+services:
+  app:
+    image: app:1
+    ports:
+      - "8080:80"
+    environment:
+      A: "1"
+      B: "2"
+    volumes:
+      - app-data:/data
+      - ./config:/config:ro
+    depends_on: [db]
+    labels:
+      team: core
+  db:
+    image: mysql:5.7
+volumes:
+  app-data: {}
+`
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name        string
+		override    string
+		image       string
+		ports       []string
+		environment map[string]string
+		volumes     []ServiceVolume
+		dependsOn   []string
+		labels      map[string]string
+	}{
+		{
+			name:        "nothing to merge",
+			override:    "services:\n  app: {}\n",
+			image:       "app:1",
+			ports:       []string{"8080:80"},
+			environment: map[string]string{"A": "1", "B": "2"},
+			volumes: []ServiceVolume{
+				{Type: "volume", Source: "app-data", Target: "/data"},
+				{Type: "bind", Source: "./config", Target: "/config", ReadOnly: true},
+			},
+			dependsOn: []string{"db"},
+			labels:    map[string]string{"team": "core"},
+		},
+		{
+			name: "merged",
+			override: `
+services:
+  app:
+    image: app:2
+    ports: ["8080:80", "9090:90"]
+    environment: [B=3, C=4]
+    volumes:
+      - type: bind
+        source: /tmp/data
+        target: /data
+      - /cache
+    depends_on:
+      db: {condition: service_started}
+      redis: {condition: service_started}
+    labels:
+      owner: me
+`,
+			image:       "app:2",
+			ports:       []string{"8080:80", "9090:90"},
+			environment: map[string]string{"A": "1", "B": "3", "C": "4"},
+			volumes: []ServiceVolume{
+				{Type: "bind", Source: "/tmp/data", Target: "/data"},
+				{Type: "bind", Source: "./config", Target: "/config", ReadOnly: true},
+				{Type: "volume", Target: "/cache"},
+			},
+			dependsOn: []string{"db", "redis"},
+			labels:    map[string]string{"team": "core", "owner": "me"},
+		},
+		{
+			name: "override",
+			override: `
+services:
+  app:
+    ports: !override ["9090:80"]
+    environment: !override {C: "4"}
+    volumes: !override [other:/other]
+    depends_on: !override [redis]
+    labels: !override {owner: me}
+`,
+			image:       "app:1",
+			ports:       []string{"9090:80"},
+			environment: map[string]string{"C": "4"},
+			volumes:     []ServiceVolume{{Type: "volume", Source: "other", Target: "/other"}},
+			dependsOn:   []string{"redis"},
+			labels:      map[string]string{"owner": "me"},
+		},
+		{
+			name: "reset",
+			override: `
+services:
+  app:
+    ports: !reset []
+    environment: !reset {}
+    volumes: !reset null
+    depends_on: !reset []
+    labels: !reset {}
+`,
+			image:       "app:1",
+			environment: map[string]string{},
+			labels:      map[string]string{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			base, err := ParseComposeFile("base.yml", []byte(mergeBase))
+			if err != nil {
+				t.Fatal(err)
+			}
+			override, err := ParseComposeFile("override.yml", []byte(test.override))
+			if err != nil {
+				t.Fatal(err)
+			}
+			base.Merge(override)
+			app := base.Services["app"]
+			if app.Image != test.image {
+				t.Errorf("image = %s, want %s", app.Image, test.image)
+			}
+			ports := []string{}
+			for _, port := range app.Ports {
+				ports = append(ports, port.String())
+			}
+			if strings.Join(ports, " ") != strings.Join(test.ports, " ") {
+				t.Errorf("ports = %v, want %v", ports, test.ports)
+			}
+			if !reflect.DeepEqual(app.Environment, test.environment) {
+				t.Errorf("environment = %v, want %v", app.Environment, test.environment)
+			}
+			if len(app.Volumes) != len(test.volumes) || (len(app.Volumes) > 0 && !reflect.DeepEqual(app.Volumes, test.volumes)) {
+				t.Errorf("volumes = %+v, want %+v", app.Volumes, test.volumes)
+			}
+			if strings.Join(app.DependsOn, " ") != strings.Join(test.dependsOn, " ") {
+				t.Errorf("depends_on = %v, want %v", app.DependsOn, test.dependsOn)
+			}
+			if !reflect.DeepEqual(app.Labels, test.labels) {
+				t.Errorf("labels = %v, want %v", app.Labels, test.labels)
+			}
+			if base.Services["db"].Image != "mysql:5.7" {
+				t.Errorf("expected db to be left alone, got %+v", base.Services["db"])
+			}
+		})
+	}
+}
+
+func TestMergeAddsServicesAndVolumes(t *testing.T) {
+	base, err := ParseComposeFile("base.yml", []byte(mergeBase))
+	if err != nil {
+		t.Fatal(err)
+	}
+	override, err := ParseComposeFile("override.yml", []byte("services:\n  worker:\n    image: app:1\nvolumes:\n  app-data:\n    name: shared\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	base.Merge(override)
+	if names := base.ServiceNames(); strings.Join(names, " ") != "app db worker" {
+		t.Errorf("services = %v", names)
+	}
+	if volume := base.Volumes["app-data"]; volume == nil || volume.Name != "shared" {
+		t.Errorf("app-data = %+v", volume)
+	}
+}
+
+func TestComposeFileErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		err  string
+	}{
+		{name: "bad yaml", data: "services:\n  app: [\n", err: "extra.yml: yaml: line 2"},
+		{name: "empty", data: "", err: "extra.yml: file is empty"},
+		{name: "not a mapping", data: "- app\n", err: "extra.yml:1: expected a mapping at the top level"},
+		{name: "no services", data: "volumes: {}\n", err: "extra.yml:1: no services section"},
+		{name: "services a list", data: "\nservices:\n  - app\n", err: "extra.yml:3: services must be a mapping"},
+		{name: "service not a mapping", data: "services:\n  redis: {}\n  app: app:1\n", err: "extra.yml:3: service app must be a mapping"},
+		{name: "bad port", data: "services:\n  app:\n    ports:\n      - \"80\"\n      - [80]\n", err: "extra.yml:5: invalid port for service app"},
+		{name: "bad volume", data: "services:\n  app:\n    volumes:\n      - a:b:c:d\n", err: "extra.yml:4: invalid volume for service app"},
+		{name: "bad environment", data: "services:\n  app:\n    image: app\n    environment: {A: [1]}\n", err: "extra.yml:4: invalid environment for service app"},
+		{name: "bad labels", data: "services:\n  app:\n    labels: app\n", err: "extra.yml:3: invalid labels for service app"},
+		{name: "unknown probe", data: "services:\n  app:\n    image: app\n    x-gdc:\n      probe: {type: telnet}\n", err: "extra.yml:5: unknown probe type telnet for service app"},
+		{name: "bad volume definition", data: "services:\n  app: {}\nvolumes:\n  data: [1]\n", err: "extra.yml: volume data:"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseComposeFile("extra.yml", []byte(test.data))
+			if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+				t.Errorf("expected an error starting with %q, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestLoadComposeFileUnknownCompanion(t *testing.T) {
+	compose := ComposeInfo{MainFile: []byte("services:\n  redis:\n    image: redis\n  app:\n    image: app\n    x-gdc:\n      companions: [sidekick]\n")}
+	_, err := compose.LoadComposeFile()
+	want := mainFileName + ":7: unknown companion sidekick for service app"
+	if err == nil || err.Error() != want {
+		t.Errorf("expected %q, got %v", want, err)
+	}
+}
@@ -1,74 +1,132 @@
 package gdc
 
 import (
+	"bytes"
 	"io/ioutil"
-
-	"gopkg.in/yaml.v2"
+	"sync"
 )
 
-//ComposeInfo containing information about the Docker Compose command
+// mainFileName is how the built-in compose file is named in error messages.
+const mainFileName = "docker-compose.yml (built-in)"
+
+// ComposeInfo containing information about the Docker Compose command
 type ComposeInfo struct {
-	MainFile []byte
-  AdditionalFile string
+	MainFile          []byte
+	AdditionalFiles   []string
 	RequestedServices []string
-	cachedConfiguredServices []string
+	NoCompanions      bool
+	Without           []string
+	// host ports to publish services on instead, keyed by service and container port
+	PortOverrides map[string]map[int]int
+	// environment variables passed to every command
+	Environment map[string]string
+	// directory docker compose resolves relative paths against, if not the current one
+	ProjectDir string
+	// how to log in to image registries, keyed by registry host
+	Registries map[string]RegistryAuth
+	// log in to registries again even if a cached login hasn't expired
+	Relogin bool
+	Runner  Runner
+	// shared by copies, so commands only parse the compose files once
+	cache *composeCache
 }
 
-func servicesFromCompose(data []byte) []string {
-	cf := make(map[interface{}]interface{})
-  err := yaml.Unmarshal(data, &cf)
-	if (err != nil) {
-		Exit("Error parsing compose file %s", err)
+// composeCache holds the compose file parsed from the files it was loaded from.
+type composeCache struct {
+	mutex           sync.Mutex
+	mainFile        []byte
+	additionalFiles []string
+	file            *ComposeFile
+}
+
+// get is the cached file if it was loaded from the same files.
+func (c *composeCache) get(compose ComposeInfo) *ComposeFile {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.file == nil || !bytes.Equal(c.mainFile, compose.MainFile) || !equalStrings(c.additionalFiles, compose.AdditionalFiles) {
+		return nil
 	}
+	return c.file
+}
 
-	// get services from map because Go has no `keys` method...
-	serviceMap := cf["services"].(map[interface{}]interface{})
-	services := []string{}
-  for k := range(serviceMap) {
-		services = append(services, k.(string))
+func (c *composeCache) set(compose ComposeInfo, file *ComposeFile) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.mainFile = compose.MainFile
+	c.additionalFiles = append([]string{}, compose.AdditionalFiles...)
+	c.file = file
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
 	}
-	return services
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
 }
 
-func (compose ComposeInfo) configuredServices() []string {
-	if (len(compose.cachedConfiguredServices) > 0) {
-		return compose.cachedConfiguredServices
+// LoadComposeFile parses the main and additional compose files and merges them
+// the way Compose does, checking the x-gdc blocks refer to known services.
+// Compose infos made by NewComposeInfo only do this once; the result is shared,
+// so callers must not change it.
+func (compose ComposeInfo) LoadComposeFile() (*ComposeFile, error) {
+	if compose.cache != nil {
+		if file := compose.cache.get(compose); file != nil {
+			return file, nil
+		}
 	}
-	services := servicesFromCompose((compose.MainFile))
-	if (len(compose.AdditionalFile) > 0) {
-		file, err := ioutil.ReadFile(compose.AdditionalFile)
-		if (err != nil) {
-			Exit("Error reading additional Compose file: %s", err)
+	result, err := ParseComposeFile(mainFileName, compose.MainFile)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range compose.AdditionalFiles {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
 		}
-		newServices := servicesFromCompose(file)
-		for _, s := range(newServices) {
-			services = append(services, s)
+		file, err := ParseComposeFile(path, data)
+		if err != nil {
+			return nil, err
 		}
+		result.Merge(file)
+	}
+	for _, name := range result.ServiceNames() {
+		service := result.Services[name]
+		for _, companion := range service.Gdc.Companions {
+			if _, found := result.Services[companion]; !found {
+				return nil, composeError(service.gdcLocation, "unknown companion %s for service %s", companion, name)
+			}
+		}
+	}
+	if compose.cache != nil {
+		compose.cache.set(compose, result)
 	}
-	compose.cachedConfiguredServices = services
-	return services
+	return result, nil
 }
 
-// IsServiceConfigured in the compose files or not
+// IsServiceConfigured in the compose files or not. It is false if the compose
+// files cannot be read.
 func (compose ComposeInfo) IsServiceConfigured(service string) bool {
-	found := false
-	for _, s := range(compose.configuredServices()) {
-			if (s == service) {
-				found = true
-				break
-			}
+	file, err := compose.LoadComposeFile()
+	if err != nil {
+		return false
 	}
+	_, found := file.Services[service]
 	return found
 }
 
 // IsServiceRequested in the command line or not
 func (compose ComposeInfo) IsServiceRequested(service string) bool {
 	found := false
-	for _, s := range(compose.RequestedServices) {
-			if (s == service) {
-				found = true
-				break
-			}
+	for _, s := range compose.RequestedServices {
+		if s == service {
+			found = true
+			break
+		}
 	}
 	return found
 }
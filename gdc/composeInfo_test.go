@@ -0,0 +1,44 @@
+package gdc
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadComposeFileCaches(t *testing.T) {
+	extra := filepath.Join(t.TempDir(), "extra.yml")
+	err := os.WriteFile(extra, []byte("services:\n  app:\n    image: app\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compose := NewComposeInfo([]string{extra}, nil)
+	compose.MainFile = []byte(testCompose)
+	first, err := compose.LoadComposeFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// copies share the cache, so the file is not read again
+	os.Remove(extra)
+	copied := compose
+	second, err := copied.LoadComposeFile()
+	if err != nil {
+		t.Fatalf("expected the cached file, got %s", err)
+	}
+	if first != second {
+		t.Error("expected the same parsed file")
+	}
+	if !copied.IsServiceConfigured("app") {
+		t.Error("expected app from the additional file")
+	}
+
+	// other files are parsed afresh
+	copied.AdditionalFiles = nil
+	third, err := copied.LoadComposeFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third == first || third.Services["app"] != nil {
+		t.Error("expected the compose file without the additional file")
+	}
+}
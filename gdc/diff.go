@@ -0,0 +1,71 @@
+package gdc
+
+// lines of unchanged context shown around each change in a diff
+const diffContext = 2
+
+// diffLines compares two texts split into lines, returning the changes as
+// lines prefixed with "-" for removed, "+" for added and " " for unchanged
+// context. Runs of unchanged lines away from any change are replaced by
+// "...".
+func diffLines(from []string, to []string) []string {
+	// longest common subsequence, built from the end so the diff can be read
+	// from the start
+	lcs := make([][]int, len(from)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(to)+1)
+	}
+	for i := len(from) - 1; i >= 0; i-- {
+		for j := len(to) - 1; j >= 0; j-- {
+			if from[i] == to[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	all := []string{}
+	i, j := 0, 0
+	for i < len(from) || j < len(to) {
+		switch {
+		case i < len(from) && j < len(to) && from[i] == to[j]:
+			all = append(all, " "+from[i])
+			i++
+			j++
+		case i < len(from) && (j == len(to) || lcs[i+1][j] >= lcs[i][j+1]):
+			all = append(all, "-"+from[i])
+			i++
+		default:
+			all = append(all, "+"+to[j])
+			j++
+		}
+	}
+
+	// keep only the context around changes
+	keep := make([]bool, len(all))
+	for k, line := range all {
+		if line[0] == ' ' {
+			continue
+		}
+		for c := k - diffContext; c <= k+diffContext; c++ {
+			if c >= 0 && c < len(all) {
+				keep[c] = true
+			}
+		}
+	}
+	result := []string{}
+	skipped := false
+	for k, line := range all {
+		if !keep[k] {
+			skipped = true
+			continue
+		}
+		if skipped && len(result) > 0 {
+			result = append(result, "...")
+		}
+		skipped = false
+		result = append(result, line)
+	}
+	return result
+}
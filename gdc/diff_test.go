@@ -0,0 +1,65 @@
+package gdc
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name string
+		from string
+		to   string
+		want []string
+	}{
+		{
+			name: "unchanged",
+			from: "a b c",
+			to:   "a b c",
+			want: []string{},
+		},
+		{
+			name: "all added",
+			from: "",
+			to:   "a b",
+			want: []string{"+a", "+b"},
+		},
+		{
+			name: "all removed",
+			from: "a b",
+			to:   "",
+			want: []string{"-a", "-b"},
+		},
+		{
+			name: "changed line with context",
+			from: "a b c d e f g",
+			to:   "a b c X e f g",
+			want: []string{" b", " c", "-d", "+X", " e", " f"},
+		},
+		{
+			name: "insertion",
+			from: "a b c",
+			to:   "a b X c",
+			want: []string{" a", " b", "+X", " c"},
+		},
+		{
+			name: "changes far apart",
+			from: "a b c d e f g h i j",
+			to:   "X b c d e f g h i Y",
+			want: []string{"-a", "+X", " b", " c", "...", " h", " i", "-j", "+Y"},
+		},
+		{
+			name: "changes close together share context",
+			from: "a b c d e",
+			to:   "a X c Y e",
+			want: []string{" a", "-b", "+X", " c", "-d", "+Y", " e"},
+		},
+	}
+	for _, test := range tests {
+		got := diffLines(strings.Fields(test.from), strings.Fields(test.to))
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: diffLines() = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
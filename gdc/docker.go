@@ -1,214 +1,439 @@
 package gdc
 
 import (
+	"context"
 	_ "embed" // to allow embedding the docker-compose file
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"strings"
+	"time"
 )
 
 //go:embed docker-compose.yml
 var dcFile []byte
-var outputFile = "./docker-compose-out.yml"
 
-// NewComposeInfo with the given additional file and requested services
-func NewComposeInfo(additionalFile string, requestedServices string) ComposeInfo {
-	serviceArray := []string{}
-	if len(requestedServices) > 0 {
-		serviceArray = strings.Split(requestedServices, ",")
-	}
+// names of the generated files, see generatedPath
+const outputFile = "docker-compose.yml"
+const portsOutputFile = "docker-compose-ports.yml"
+
+// NewComposeInfo with the given additional files and requested services
+func NewComposeInfo(additionalFiles []string, requestedServices []string) ComposeInfo {
 	return ComposeInfo{
 		MainFile:          dcFile,
-		AdditionalFile:    additionalFile,
-		RequestedServices: serviceArray,
+		AdditionalFiles:   additionalFiles,
+		RequestedServices: requestedServices,
+		Runner:            ShellRunner{},
+		cache:             &composeCache{},
 	}
 }
 
 // save the in-memory docker-compose.yml file to disk so we can pass it in
 // trying to pass it into stdin causes issues when there is an additional file
-func writeDcFile() {
-	// check if file exists
-	_, err := os.Stat(outputFile)
-	if err == nil {
-		return
+// and with commands that read stdin themselves, like exec
+func writeDcFile(compose ComposeInfo) error {
+	file, err := compose.LoadComposeFile()
+	if err != nil {
+		return err
+	}
+	overrides, err := compose.portOverrideFile(file)
+	if err != nil {
+		return err
+	}
+	if writer, ok := compose.Runner.(fileWriter); ok {
+		writer.WriteFile(generatedPath(outputFile), dcFile, 0600)
+		if overrides != nil {
+			writer.WriteFile(generatedPath(portsOutputFile), overrides, 0600)
+		}
+		return nil
 	}
 
-	ioutil.WriteFile(outputFile, dcFile, 0644)
+	if overrides != nil {
+		err = materialize(generatedPath(portsOutputFile), overrides)
+		if err != nil {
+			return err
+		}
+	}
+	return materialize(generatedPath(outputFile), dcFile)
 }
 
-// Cleanup the output files.
-func Cleanup() {
-	os.Remove(outputFile)
+// validateService checks the service is defined in the compose files.
+func validateService(file *ComposeFile, command string, service string) error {
+	if _, found := file.Services[service]; !found {
+		return &ServiceNotFoundError{Command: command, Service: service, Known: file.ServiceNames()}
+	}
+	return nil
 }
 
-// Exit cleanly from the program.
-func Exit(message string, args ...interface{}) {
-	Cleanup()
-	if len(message) > 0 {
-		if len(args) > 0 {
-			fmt.Printf(message, args...)
-			fmt.Println()
-		} else {
-			fmt.Println(message)
+// serviceList is the requested services along with their companions.
+func serviceList(compose ComposeInfo, file *ComposeFile, command string) ([]string, error) {
+	if len(compose.RequestedServices) == 0 {
+		return nil, &NoServicesError{Command: command}
+	}
+	for _, services := range [][]string{compose.RequestedServices, compose.Without} {
+		for _, service := range services {
+			if err := validateService(file, command, service); err != nil {
+				return nil, err
+			}
 		}
 	}
-	os.Exit(1)
+	results, err := resolveServices(compose.RequestedServices, file.companions(), compose.NoCompanions, compose.Without)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving services for command %s: %w", command, err)
+	}
+	return results, nil
 }
 
-func exitServiceNotFound(compose ComposeInfo, command string, service string) {
-	services := strings.Join(compose.configuredServices(), ", ")
-	str := `
-Cannot execute command %s - %s is not a known service!
-Known services: %s
-`
-	Exit(str, command, service, services)
+// requestedServices loads the compose files and lists the requested services
+// along with their companions.
+func requestedServices(compose ComposeInfo, command string) (*ComposeFile, []string, error) {
+	file, err := compose.LoadComposeFile()
+	if err != nil {
+		return nil, nil, err
+	}
+	services, err := serviceList(compose, file, command)
+	return file, services, err
 }
 
-func validateService(compose ComposeInfo, command string, service string) {
-	if !compose.IsServiceConfigured((service)) {
-		exitServiceNotFound(compose, command, service)
+// runner to execute commands with, defaulting to running them for real
+func (compose ComposeInfo) runner() Runner {
+	if compose.Runner == nil {
+		return ShellRunner{}
 	}
+	return compose.Runner
 }
 
-func serviceString(compose ComposeInfo, command string) string {
-	if len(compose.RequestedServices) == 0 {
-		Exit("No services provided for command %s! Use the --services option.", command)
+// run the command with the compose file written out
+func run(ctx context.Context, compose ComposeInfo, cmd *Command) error {
+	err := writeDcFile(compose)
+	if err != nil {
+		return err
 	}
-	results := []string{}
-	for _, service := range compose.RequestedServices {
-		if !compose.IsServiceConfigured(service) {
-			exitServiceNotFound(compose, command, service)
-		}
-		results = append(results, service)
-		if service == "kafka" {
-			results = append(results, "schema-registry", "control-center")
-		}
-		if service == "redis" {
-			results = append(results, "redisinsight")
+	for k, v := range compose.Environment {
+		if _, found := cmd.Env[k]; !found {
+			cmd.SetEnv(k, v)
 		}
-		if service == "dynamodb" {
-			results = append(results, "dynamodb-admin")
+	}
+	return compose.runner().Run(ctx, cmd)
+}
+
+// composeArgs builds the argv for a docker compose invocation. Compose
+// resolves relative paths against the directory of the first file, which is
+// now gdc's private one, so the project directory is always given to keep
+// relative volume paths in additional compose files working.
+func composeArgs(compose ComposeInfo, args ...string) []string {
+	projectDir := compose.ProjectDir
+	if len(projectDir) == 0 {
+		projectDir = "."
+	}
+	argv := []string{"docker", "compose", "-p", "global", "--project-directory", projectDir}
+	argv = append(argv, "-f", generatedPath(outputFile))
+	for _, path := range compose.AdditionalFiles {
+		argv = append(argv, "-f", path)
+	}
+	if len(compose.PortOverrides) > 0 {
+		argv = append(argv, "-f", generatedPath(portsOutputFile))
+	}
+	return append(argv, args...)
+}
+
+func composeCommand(compose ComposeInfo, args ...string) *Command {
+	return NewCommand(composeArgs(compose, args...)...)
+}
+
+// serviceVolumes are the service's named volumes, keyed by their name in the
+// compose files, with the name Docker knows each by.
+func serviceVolumes(file *ComposeFile, service string) map[string]string {
+	volumes := map[string]string{}
+	for _, volume := range file.Services[service].Volumes {
+		if volume.Type != "volume" || volume.Source == "" {
+			continue
 		}
-		if service == "opensearch" {
-			results = append(results, "opensearch-dashboards")
+		name := "global_" + volume.Source
+		if declared, found := file.Volumes[volume.Source]; found && declared != nil {
+			if declared.Name != "" {
+				name = os.ExpandEnv(declared.Name)
+			} else if declared.External {
+				name = volume.Source
+			}
 		}
+		volumes[volume.Source] = name
 	}
-	return strings.Join(results, " ")
+	return volumes
 }
 
-func mainCommand(compose ComposeInfo) string {
-	cmd := fmt.Sprintf("docker compose -p global -f %s", outputFile)
-	if len(compose.AdditionalFile) > 0 {
-		cmd = fmt.Sprintf("%s -f %s", cmd, compose.AdditionalFile)
+func executeDockerCommand(ctx context.Context, compose ComposeInfo, service string, command []string, inputFile string) error {
+	if len(inputFile) > 0 {
+		args := append([]string{"exec", "-T", service}, command...)
+		cmd := NewCommand("cat", inputFile)
+		cmd.Pipe(composeArgs(compose, args...)...)
+		return run(ctx, compose, cmd)
 	}
-	return cmd
+	args := append([]string{"exec", service}, command...)
+	return run(ctx, compose, composeCommand(compose, args...))
 }
 
-func executeDockerCommand(compose ComposeInfo, service string, command string, inputFile string) {
-	if len(inputFile) > 0 {
-		RunCommands(
-			fmt.Sprintf("cat %s", inputFile),
-			fmt.Sprintf("%s exec -T %s %s", mainCommand(compose), service, command),
-		)
-	} else {
-		RunCommand("%s exec %s %s", mainCommand(compose), service, command)
+// Build the image for the given service
+func Build(ctx context.Context, service string, compose ComposeInfo, noCache bool) error {
+	args := []string{"build"}
+	if noCache {
+		args = append(args, "--no-cache")
+	}
 
+	file, err := compose.LoadComposeFile()
+	if err != nil {
+		return err
+	}
+	err = validateService(file, "build", service)
+	if err != nil {
+		return err
+	}
+	unlock, err := lockProject(ctx, compose)
+	if err != nil {
+		return err
 	}
+	defer unlock()
+	err = loginForServices(ctx, compose, file, []string{service})
+	if err != nil {
+		return err
+	}
+	return run(ctx, compose, composeCommand(compose, append(args, service)...))
 }
 
-func ecrLogin() {
-	RunCommands("aws ecr get-login-password", "docker login --password-stdin -u AWS 421990735784.dkr.ecr.us-east-1.amazonaws.com")
+// UpOptions control how Up brings up the containers
+type UpOptions struct {
+	// wait for the services to be ready before returning
+	Wait    bool
+	Timeout time.Duration
+	// move services whose host ports are taken to free ports instead of failing
+	RemapPorts bool
+	// topics file to apply once kafka is ready, if kafka is brought up
+	KafkaTopics string
+	// tables file to apply once dynamodb is ready, if dynamodb is brought up
+	DynamodbTables string
 }
 
-func Build(service string, compose ComposeInfo, noCache bool) {
-	cmd := fmt.Sprintf("%s build", mainCommand(compose))
-	if noCache {
-		cmd = fmt.Sprintf("%s --no-cache", cmd)
+// Up bring up the Docker containers, claiming them for the project. If kafka
+// or dynamodb is brought up and a topics or tables file is given, the topics
+// or tables are applied once the service is ready.
+func Up(ctx context.Context, compose ComposeInfo, options UpOptions) error {
+	file, services, err := requestedServices(compose, "up")
+	if err != nil {
+		return err
+	}
+	unlock, err := lockProject(ctx, compose)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	compose, err = checkPorts(ctx, compose, file, services, options.RemapPorts)
+	if err != nil {
+		return err
+	}
+	err = loginForServices(ctx, compose, file, services)
+	if err != nil {
+		return err
+	}
+	err = run(ctx, compose, composeCommand(compose, append([]string{"up", "-d"}, services...)...))
+	if err != nil {
+		return err
 	}
+	err = claimServices(compose, services)
+	if err != nil {
+		return err
+	}
+	if options.Wait {
+		err = Wait(ctx, compose, options.Timeout)
+		if err != nil {
+			return err
+		}
+	}
+	if options.KafkaTopics != "" && contains(services, "kafka") {
+		err = applyAfterUp(ctx, compose, file, options, "kafka", "Kafka topics", options.KafkaTopics, func() error {
+			return ApplyTopicsFile(ctx, compose, options.KafkaTopics, os.Stdout)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if options.DynamodbTables != "" && contains(services, "dynamodb") {
+		return applyAfterUp(ctx, compose, file, options, "dynamodb", "DynamoDB tables", options.DynamodbTables, func() error {
+			return ApplyTablesFile(ctx, compose, options.DynamodbTables, os.Stdout)
+		})
+	}
+	return nil
+}
 
-	ecrLogin()
-	RunCommand("%s %s", cmd, service)
+// applyAfterUp waits for the service to be ready, unless Up already waited,
+// then applies a file of the things it declares, such as topics.
+func applyAfterUp(ctx context.Context, compose ComposeInfo, file *ComposeFile, options UpOptions,
+	service string, what string, path string, apply func() error) error {
+	if !options.Wait {
+		err := waitFor(ctx, compose, file, []string{service}, options.Timeout)
+		if err != nil {
+			return err
+		}
+	}
+	if dryRunRequest(compose, service, fmt.Sprintf("apply %s from %s", what, path)) {
+		return nil
+	}
+	fmt.Printf("Applying %s from %s\n", what, path)
+	return apply()
 }
 
-// Up bring up the Docker containers
-func Up(compose ComposeInfo) {
-	str := serviceString(compose, "up")
-	ecrLogin()
-	RunCommand("%s up -d %s", mainCommand(compose), str)
+// servicesToRelease works out which services down or stop should act on: the
+// given service, the requested ones, or every service if none were requested.
+// Services other projects still claim are left out unless force is set. all
+// is true if every service can be acted on. Calling release drops this
+// project's claims on them, once they have been stopped.
+func servicesToRelease(compose ComposeInfo, command string, service string, force bool) (services []string, all bool, release func() error, err error) {
+	file, err := compose.LoadComposeFile()
+	if err != nil {
+		return nil, false, nil, err
+	}
+	if service != "" {
+		err = validateService(file, command, service)
+		services = []string{service}
+	} else if len(compose.RequestedServices) > 0 {
+		services, err = serviceList(compose, file, command)
+	}
+	if err != nil {
+		return nil, false, nil, err
+	}
+	held, release, err := releaseServices(compose, services, force)
+	if err != nil {
+		return nil, false, nil, err
+	}
+	if services == nil {
+		if len(held) == 0 {
+			return nil, true, release, nil
+		}
+		services = file.ServiceNames()
+	}
+	verb := map[string]string{"down": "remove", "stop": "stop"}[command]
+	result := []string{}
+	for _, s := range services {
+		if projects, found := held[s]; found {
+			fmt.Printf("Leaving %s running - still used by %s (use --force to %s it anyway)\n", s, strings.Join(projects, ", "), verb)
+			continue
+		}
+		result = append(result, s)
+	}
+	return result, false, release, nil
 }
 
-// Down bring down the Docker containers
-func Down(compose ComposeInfo, service string) {
-	if len(compose.RequestedServices) > 0 {
-		fmt.Printf("Requested services ,%v", compose.RequestedServices[0])
-		var command string
-		if service != "" {
-			command = service
-		} else {
-			command = serviceString(compose, "down")
+// Down bring down the Docker containers. Services another project still
+// claims are left running unless force is set.
+func Down(ctx context.Context, compose ComposeInfo, service string, force bool) error {
+	unlock, err := lockProject(ctx, compose)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	services, all, release, err := servicesToRelease(compose, "down", service, force)
+	if err != nil {
+		return err
+	}
+	if all {
+		err = run(ctx, compose, composeCommand(compose, "down"))
+		if err != nil {
+			return err
 		}
-		RunCommand("%s stop %s", mainCommand(compose), command)
-		RunCommand("%s rm -f %s", mainCommand(compose), command)
-	} else {
-		RunCommand("%s down", mainCommand(compose))
+		return release()
 	}
+	if len(services) > 0 {
+		err = run(ctx, compose, composeCommand(compose, append([]string{"stop"}, services...)...))
+		if err != nil {
+			return err
+		}
+		err = run(ctx, compose, composeCommand(compose, append([]string{"rm", "-f"}, services...)...))
+		if err != nil {
+			return err
+		}
+	}
+	return release()
 }
 
-// Stop the Docker containers
-func Stop(compose ComposeInfo) {
-	if len(compose.RequestedServices) > 0 {
-		fmt.Printf("Requested services ,%v", compose.RequestedServices[0])
-		RunCommand("%s stop %s", mainCommand(compose), serviceString(compose, "stop"))
-	} else {
-		RunCommand("%s stop", mainCommand(compose))
+// Stop the Docker containers. Services another project still claims are left
+// running unless force is set.
+func Stop(ctx context.Context, compose ComposeInfo, force bool) error {
+	unlock, err := lockProject(ctx, compose)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	services, all, release, err := servicesToRelease(compose, "stop", "", force)
+	if err != nil {
+		return err
+	}
+	if all {
+		err = run(ctx, compose, composeCommand(compose, "stop"))
+	} else if len(services) > 0 {
+		err = run(ctx, compose, composeCommand(compose, append([]string{"stop"}, services...)...))
+	}
+	if err != nil {
+		return err
 	}
+	return release()
 }
 
 // Logs show the logs for the selected containers
-func Logs(compose ComposeInfo, service string) {
-	var command string
-	if service != "" {
-		command = service
-	} else {
-		command = serviceString(compose, "logs")
+func Logs(ctx context.Context, compose ComposeInfo, service string) error {
+	services := []string{service}
+	if service == "" {
+		var err error
+		_, services, err = requestedServices(compose, "logs")
+		if err != nil {
+			return err
+		}
 	}
-	RunCommand("%s logs -f %s", mainCommand(compose), command)
+	return run(ctx, compose, composeCommand(compose, append([]string{"logs", "-f"}, services...)...))
 }
 
 // Ps show the currently running containers
-func Ps(compose ComposeInfo) {
-	RunCommand("%s ps", mainCommand(compose))
+func Ps(ctx context.Context, compose ComposeInfo) error {
+	return run(ctx, compose, composeCommand(compose, "ps"))
 }
 
 // Exec execute a command against a service
-func Exec(compose ComposeInfo, service string, command []string) {
-	validateService(compose, "exec", service)
-	executeDockerCommand(compose, service, strings.Join(command, " "), "")
+func Exec(ctx context.Context, compose ComposeInfo, service string, command []string) error {
+	file, err := compose.LoadComposeFile()
+	if err != nil {
+		return err
+	}
+	err = validateService(file, "exec", service)
+	if err != nil {
+		return err
+	}
+	return executeDockerCommand(ctx, compose, service, command, "")
 }
 
-// Mysql start a mysql client
-func Mysql(compose ComposeInfo, input string) {
-	// check which version is running
+// mysqlService is the MySQL version that was requested.
+func mysqlService(compose ComposeInfo) (string, error) {
 	versions := []string{"mysql56", "mysql57", "mysql8"}
 	for _, version := range versions {
 		if compose.IsServiceRequested(version) {
-			executeDockerCommand(compose, version, "mysql", input)
-			return
+			return version, nil
 		}
 	}
+	return "", errors.New("mysql service not provided! Please use the --services option")
+}
 
-	// not found
-	Exit("mysql service not provided! Please use the --services option!")
-
+// Mysql start a mysql client
+func Mysql(ctx context.Context, compose ComposeInfo, input string) error {
+	service, err := mysqlService(compose)
+	if err != nil {
+		return err
+	}
+	return executeDockerCommand(ctx, compose, service, []string{"mysql"}, input)
 }
 
 // RedisCLI starts up the Redis command line
-func RedisCLI(compose ComposeInfo) {
-	executeDockerCommand(compose, "redis", "redis-cli", "")
+func RedisCLI(ctx context.Context, compose ComposeInfo) error {
+	return executeDockerCommand(ctx, compose, "redis", []string{"redis-cli"}, "")
 }
 
 // Config print docker compose config
-func Config(compose ComposeInfo) {
-	RunCommand("%s config", mainCommand(compose))
+func Config(ctx context.Context, compose ComposeInfo) error {
+	return run(ctx, compose, composeCommand(compose, "config"))
 }
@@ -0,0 +1,280 @@
+package gdc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testCompose is a compose file whose services publish no ports, so tests
+// don't depend on what is listening on the host.
+const testCompose = `
+services:
+  redis:
+    image: redis:6
+  kafka:
+    image: confluentinc/cp-kafka:7.4.0
+    x-gdc:
+      companions: [zookeeper]
+  zookeeper:
+    image: confluentinc/cp-zookeeper:7.4.0
+`
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	Cleanup()
+	os.Exit(code)
+}
+
+// testComposeInfo records commands instead of running them, with claims and
+// locks kept in a temporary home directory.
+func testComposeInfo(t *testing.T, services ...string) (ComposeInfo, *RecordingRunner) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	runner := &RecordingRunner{}
+	compose := ComposeInfo{
+		MainFile:          []byte(testCompose),
+		RequestedServices: services,
+		ProjectDir:        t.TempDir(),
+		Runner:            runner,
+	}
+	return compose, runner
+}
+
+// composeLine is the command line of a docker compose invocation.
+func composeLine(compose ComposeInfo, args ...string) string {
+	return composeCommand(compose, args...).String()
+}
+
+func TestComposeArgs(t *testing.T) {
+	generated := generatedPath(outputFile)
+	ports := generatedPath(portsOutputFile)
+	tests := []struct {
+		name    string
+		compose ComposeInfo
+		args    []string
+		want    []string
+	}{
+		{
+			name:    "defaults",
+			compose: ComposeInfo{},
+			args:    []string{"ps"},
+			want:    []string{"docker", "compose", "-p", "global", "--project-directory", ".", "-f", generated, "ps"},
+		},
+		{
+			name:    "project directory and additional files",
+			compose: ComposeInfo{ProjectDir: "/src/app", AdditionalFiles: []string{"extra.yml", "more.yml"}},
+			args:    []string{"up", "-d", "redis"},
+			want: []string{"docker", "compose", "-p", "global", "--project-directory", "/src/app",
+				"-f", generated, "-f", "extra.yml", "-f", "more.yml", "up", "-d", "redis"},
+		},
+		{
+			name:    "port overrides",
+			compose: ComposeInfo{PortOverrides: map[string]map[int]int{"redis": {6379: 6380}}},
+			args:    []string{"up", "-d"},
+			want:    []string{"docker", "compose", "-p", "global", "--project-directory", ".", "-f", generated, "-f", ports, "up", "-d"},
+		},
+	}
+	for _, test := range tests {
+		got := composeArgs(test.compose, test.args...)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: composeArgs() =\n%v\nwant\n%v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestUp(t *testing.T) {
+	tests := []struct {
+		name     string
+		services []string
+		without  []string
+		want     []string
+	}{
+		{"single service", []string{"redis"}, nil, []string{"redis"}},
+		{"with companions", []string{"kafka"}, nil, []string{"kafka", "zookeeper"}},
+		{"without companions", []string{"kafka"}, []string{"zookeeper"}, []string{"kafka"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			compose, runner := testComposeInfo(t, test.services...)
+			compose.Without = test.without
+			err := Up(context.Background(), compose, UpOptions{})
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			want := []string{
+				composeLine(compose, append([]string{"ps", "--format", "json"}, test.want...)...),
+				composeLine(compose, append([]string{"up", "-d"}, test.want...)...),
+			}
+			if got := runner.Executed(); !reflect.DeepEqual(got, want) {
+				t.Errorf("commands =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+			}
+			claims, err := Claims()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(claims) != 1 || !reflect.DeepEqual(claims[0].Services, test.want) {
+				t.Errorf("claims = %+v, want services %v", claims, test.want)
+			}
+		})
+	}
+}
+
+func TestUpErrors(t *testing.T) {
+	compose, _ := testComposeInfo(t)
+	var noServices *NoServicesError
+	if err := Up(context.Background(), compose, UpOptions{}); !errors.As(err, &noServices) {
+		t.Errorf("expected NoServicesError, got %v", err)
+	}
+	compose.RequestedServices = []string{"nosuch"}
+	var notFound *ServiceNotFoundError
+	if err := Up(context.Background(), compose, UpOptions{}); !errors.As(err, &notFound) {
+		t.Errorf("expected ServiceNotFoundError, got %v", err)
+	}
+}
+
+func TestUpExitError(t *testing.T) {
+	compose, runner := testComposeInfo(t, "redis")
+	up := composeLine(compose, "up", "-d", "redis")
+	runner.ExitCodes = map[string]int{up: 17}
+	err := Up(context.Background(), compose, UpOptions{})
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) || exitErr.Code != 17 || exitErr.Command != up {
+		t.Fatalf("expected exit error with status 17, got %v", err)
+	}
+	claims, err := Claims()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claims) != 0 {
+		t.Errorf("services were claimed although up failed: %+v", claims)
+	}
+}
+
+func TestDown(t *testing.T) {
+	tests := []struct {
+		name    string
+		service string
+		want    [][]string
+	}{
+		{"everything", "", [][]string{{"down"}}},
+		{"one service", "redis", [][]string{{"stop", "redis"}, {"rm", "-f", "redis"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			compose, runner := testComposeInfo(t)
+			err := Down(context.Background(), compose, test.service, false)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			want := []string{}
+			for _, args := range test.want {
+				want = append(want, composeLine(compose, args...))
+			}
+			if got := runner.Executed(); !reflect.DeepEqual(got, want) {
+				t.Errorf("commands =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+			}
+		})
+	}
+}
+
+func TestExec(t *testing.T) {
+	compose, runner := testComposeInfo(t)
+	err := Exec(context.Background(), compose, "redis", []string{"sh", "-c", "echo a b"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := []string{composeLine(compose, "exec", "redis", "sh", "-c", "echo a b")}
+	if got := runner.Executed(); !reflect.DeepEqual(got, want) {
+		t.Errorf("commands = %v, want %v", got, want)
+	}
+	if got := runner.Commands[0].Pipeline[0]; got[len(got)-1] != "echo a b" {
+		t.Errorf("last argument = %q, want it passed as one argument", got[len(got)-1])
+	}
+
+	runner.ExitCodes = map[string]int{want[0]: 2}
+	var exitErr *ExitError
+	if err := Exec(context.Background(), compose, "redis", []string{"sh", "-c", "echo a b"}); !errors.As(err, &exitErr) || exitErr.Code != 2 {
+		t.Errorf("expected exit error with status 2, got %v", err)
+	}
+	var notFound *ServiceNotFoundError
+	if err := Exec(context.Background(), compose, "nosuch", []string{"sh"}); !errors.As(err, &notFound) {
+		t.Errorf("expected ServiceNotFoundError, got %v", err)
+	}
+}
+
+func TestUpDryRunSkipsPortCheck(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+	t.Setenv("HOME", t.TempDir())
+	plan := &Plan{}
+	compose := ComposeInfo{
+		MainFile:          []byte(fmt.Sprintf("services:\n  redis:\n    image: redis:6\n    ports: [\"%d:6379\"]\n", port)),
+		RequestedServices: []string{"redis"},
+		ProjectDir:        t.TempDir(),
+		Runner:            plan,
+	}
+	err = Up(context.Background(), compose, UpOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, step := range plan.Steps {
+		if strings.Contains(step.Command, "lsof") || strings.Contains(step.Command, " ps ") {
+			t.Errorf("dry run ran %s", step.Command)
+		}
+	}
+	if plan.Steps[0].Request != "check host ports are free" {
+		t.Errorf("first step = %+v, want the port check", plan.Steps[0])
+	}
+}
+
+func TestDownKeepsClaimsWhenComposeFails(t *testing.T) {
+	compose, runner := testComposeInfo(t, "redis")
+	if err := Up(context.Background(), compose, UpOptions{}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	runner.ExitCodes = map[string]int{composeLine(compose, "rm", "-f", "redis"): 1}
+	if err := Down(context.Background(), compose, "", false); err == nil {
+		t.Fatal("expected down to fail")
+	}
+	claims, err := Claims()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claims) != 1 || !reflect.DeepEqual(claims[0].Services, []string{"redis"}) {
+		t.Errorf("claims = %+v, want redis still claimed", claims)
+	}
+
+	runner.ExitCodes = nil
+	if err := Down(context.Background(), compose, "", false); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if claims, _ = Claims(); len(claims) != 0 {
+		t.Errorf("claims = %+v, want none after down", claims)
+	}
+}
+
+func TestDownDryRunLeavesHomeAlone(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	compose := ComposeInfo{MainFile: []byte(testCompose), ProjectDir: t.TempDir(), Runner: &Plan{}}
+	if err := Down(context.Background(), compose, "", false); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	entries, err := os.ReadDir(home)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("dry run created %s in the home directory", entries[0].Name())
+	}
+}
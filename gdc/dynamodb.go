@@ -0,0 +1,156 @@
+package gdc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// port DynamoDB Local listens on
+const dynamodbPort = 8000
+
+// how often to check whether a table or index has finished being created
+var dynamodbPollInterval = 500 * time.Millisecond
+
+// dynamodbAddress is where the requested dynamodb service can be reached.
+func dynamodbAddress(compose ComposeInfo) (string, error) {
+	return serviceAddress(compose, "dynamodb", "dynamodb", dynamodbPort)
+}
+
+// dynamodbRequest calls an operation of the DynamoDB API, such as ListTables,
+// decoding the response into result if given. DynamoDB Local insists on an
+// Authorization header but does not check the signature. Errors are returned
+// as an *APIError.
+func dynamodbRequest(ctx context.Context, address string, operation string, body interface{}, result interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("http://%s/", address)
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	request.Header.Set("X-Amz-Target", "DynamoDB_20120810."+operation)
+	request.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential=gdc/20200101/us-east-1/dynamodb/aws4_request, SignedHeaders=host, Signature=0")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	data, err = io.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode >= 400 {
+		return &APIError{Method: operation, URL: url, Status: response.StatusCode, Body: strings.TrimSpace(string(data))}
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(data, result)
+}
+
+// dynamodbErrorType is the type of a DynamoDB API error, such as
+// ResourceNotFoundException, or an empty string if it isn't one.
+func dynamodbErrorType(err error) string {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return ""
+	}
+	body := struct {
+		Type string `json:"__type"`
+	}{}
+	json.Unmarshal([]byte(apiErr.Body), &body)
+	return body.Type[strings.LastIndex(body.Type, "#")+1:]
+}
+
+// dynamodbMessage is the message of a DynamoDB API error, or the error itself
+// if it has none.
+func dynamodbMessage(err error) string {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		body := struct {
+			Message      string `json:"message"`
+			MessageUpper string `json:"Message"`
+		}{}
+		json.Unmarshal([]byte(apiErr.Body), &body)
+		if body.Message != "" {
+			return body.Message
+		}
+		if body.MessageUpper != "" {
+			return body.MessageUpper
+		}
+	}
+	return err.Error()
+}
+
+type dynamoKey struct {
+	AttributeName string `json:"AttributeName"`
+	KeyType       string `json:"KeyType"`
+}
+
+type dynamoIndex struct {
+	IndexName   string      `json:"IndexName"`
+	KeySchema   []dynamoKey `json:"KeySchema"`
+	IndexStatus string      `json:"IndexStatus,omitempty"`
+}
+
+// dynamoTable is the parts of a table's definition that are compared.
+type dynamoTable struct {
+	TableName              string        `json:"TableName"`
+	TableStatus            string        `json:"TableStatus,omitempty"`
+	KeySchema              []dynamoKey   `json:"KeySchema"`
+	GlobalSecondaryIndexes []dynamoIndex `json:"GlobalSecondaryIndexes"`
+	LocalSecondaryIndexes  []dynamoIndex `json:"LocalSecondaryIndexes"`
+	ItemCount              int64         `json:"ItemCount,omitempty"`
+}
+
+// describeTable returns the table's definition, or nil if there is no such
+// table.
+func describeTable(ctx context.Context, address string, table string) (*dynamoTable, error) {
+	result := struct {
+		Table dynamoTable `json:"Table"`
+	}{}
+	err := dynamodbRequest(ctx, address, "DescribeTable", map[string]string{"TableName": table}, &result)
+	if dynamodbErrorType(err) == "ResourceNotFoundException" {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error describing table %s: %s", table, dynamodbMessage(err))
+	}
+	return &result.Table, nil
+}
+
+// waitForTable waits until the table and its indexes are active.
+func waitForTable(ctx context.Context, address string, table string) error {
+	for {
+		description, err := describeTable(ctx, address, table)
+		if err != nil {
+			return err
+		}
+		active := description != nil && description.TableStatus == "ACTIVE"
+		if active {
+			for _, index := range description.GlobalSecondaryIndexes {
+				if index.IndexStatus != "" && index.IndexStatus != "ACTIVE" {
+					active = false
+				}
+			}
+		}
+		if active {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(dynamodbPollInterval):
+		}
+	}
+}
@@ -0,0 +1,535 @@
+package gdc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// most items BatchWriteItem takes at once
+const dynamodbBatchSize = 25
+
+// backoff between retries of throttled requests, doubling up to the maximum
+var dynamodbBackoff = 50 * time.Millisecond
+var dynamodbMaxBackoff = 5 * time.Second
+
+// how many throttled attempts in a row are retried before giving up
+const dynamodbRetries = 15
+
+// how often an import's checkpoint is saved
+var checkpointInterval = time.Second
+
+// errors DynamoDB returns when requests are throttled
+var throttlingErrors = map[string]bool{
+	"ProvisionedThroughputExceededException": true,
+	"ThrottlingException":                    true,
+	"RequestLimitExceeded":                   true,
+}
+
+// DynamodbExportOptions are options for exporting a table.
+type DynamodbExportOptions struct {
+	// file to write, or empty or - for stdout; compressed if it ends in .gz
+	// or .zst
+	Output string
+	// how many segments of the table to scan in parallel
+	Segments int
+	Progress io.Writer
+}
+
+// DynamodbImportOptions are options for importing items into a table.
+type DynamodbImportOptions struct {
+	// how many batches to write in parallel
+	Workers int
+	// carry on from where an interrupted import of the same file stopped
+	Resume   bool
+	Progress io.Writer
+}
+
+// DynamodbImportError is returned when an import fails part way through.
+type DynamodbImportError struct {
+	File  string
+	Table string
+	// lines of the file imported before it failed
+	Line int64
+	// whether the import can be resumed
+	Resumable bool
+	Err       error
+}
+
+func (e *DynamodbImportError) Error() string {
+	if e.Resumable {
+		return fmt.Sprintf("error importing %s into %s after line %d: %s - run again with --resume to carry on from there",
+			e.File, e.Table, e.Line, e.Err)
+	}
+	return fmt.Sprintf("error importing %s into %s after line %d: %s", e.File, e.Table, e.Line, e.Err)
+}
+
+func (e *DynamodbImportError) Unwrap() error {
+	return e.Err
+}
+
+// dynamodbRetrying calls dynamodbRequest, backing off and retrying while the
+// request is throttled.
+func dynamodbRetrying(ctx context.Context, address string, operation string, body interface{}, result interface{}) error {
+	backoff := dynamodbBackoff
+	for attempt := 1; ; attempt++ {
+		err := dynamodbRequest(ctx, address, operation, body, result)
+		if err == nil || !throttlingErrors[dynamodbErrorType(err)] || attempt == dynamodbRetries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > dynamodbMaxBackoff {
+			backoff = dynamodbMaxBackoff
+		}
+	}
+}
+
+// exportLine is a line of an export, in the format of DynamoDB's exports to S3.
+type exportLine struct {
+	Item map[string]interface{} `json:"Item"`
+}
+
+// scanSegment sends every item in the segment of the table to the channel.
+func scanSegment(ctx context.Context, address string, table string, segment int, segments int, items chan<- map[string]interface{}) error {
+	request := map[string]interface{}{
+		"TableName":     table,
+		"Segment":       segment,
+		"TotalSegments": segments,
+	}
+	for {
+		result := struct {
+			Items            []map[string]interface{} `json:"Items"`
+			LastEvaluatedKey map[string]interface{}   `json:"LastEvaluatedKey"`
+		}{}
+		err := dynamodbRetrying(ctx, address, "Scan", request, &result)
+		if err != nil {
+			return fmt.Errorf("error scanning table %s: %s", table, dynamodbMessage(err))
+		}
+		for _, item := range result.Items {
+			select {
+			case items <- item:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if len(result.LastEvaluatedKey) == 0 {
+			return nil
+		}
+		request["ExclusiveStartKey"] = result.LastEvaluatedKey
+	}
+}
+
+// DynamodbExport writes every item in the table as newline-delimited DynamoDB
+// JSON, scanning segments of the table in parallel, and returns how many items
+// were written. A regular output file is only replaced once the export is
+// complete.
+func DynamodbExport(ctx context.Context, compose ComposeInfo, table string, options DynamodbExportOptions) (int64, error) {
+	address, err := dynamodbAddress(compose)
+	if err != nil {
+		return 0, err
+	}
+	if dryRunRequest(compose, "dynamodb", fmt.Sprintf("export table %s", table)) {
+		return 0, nil
+	}
+	description, err := describeTable(ctx, address, table)
+	if err != nil {
+		return 0, err
+	}
+	if description == nil {
+		return 0, fmt.Errorf("table %s not found", table)
+	}
+	segments := options.Segments
+	if segments < 1 {
+		segments = 1
+	}
+
+	out, err := createOutput(options.Output)
+	if err != nil {
+		return 0, err
+	}
+	defer out.discard()
+	writer, err := compressor(options.Output, out)
+	if err != nil {
+		return 0, err
+	}
+	progress := newProgress(options.Progress, "Exported", 0)
+	buffered := bufio.NewWriter(progressWriter{writer, progress})
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	items := make(chan map[string]interface{}, 100)
+	errs := make(chan error, segments)
+	wait := sync.WaitGroup{}
+	for segment := 0; segment < segments; segment++ {
+		wait.Add(1)
+		go func(segment int) {
+			defer wait.Done()
+			if err := scanSegment(ctx, address, table, segment, segments, items); err != nil {
+				errs <- err
+				cancel()
+			}
+		}(segment)
+	}
+	go func() {
+		wait.Wait()
+		close(items)
+	}()
+
+	encoder := json.NewEncoder(buffered)
+	count := int64(0)
+	for item := range items {
+		if err = encoder.Encode(exportLine{item}); err != nil {
+			cancel()
+			return count, err
+		}
+		count++
+	}
+	select {
+	case err = <-errs:
+		return count, err
+	default:
+	}
+	if err = buffered.Flush(); err != nil {
+		return count, err
+	}
+	if err = writer.Close(); err != nil {
+		return count, err
+	}
+	progress.finish()
+	return count, out.commit()
+}
+
+// importCheckpoint records how far an import got, so it can be resumed.
+type importCheckpoint struct {
+	File    string    `json:"file"`
+	Table   string    `json:"table"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	// every line up to and including this one has been imported
+	Line int64 `json:"line"`
+}
+
+// checkpointPath is where the checkpoint of importing the file into the table
+// is kept.
+func checkpointPath(file string, table string) (string, error) {
+	dir, err := gdcDir()
+	if err != nil {
+		return "", err
+	}
+	dir = filepath.Join(dir, "imports")
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256([]byte(file))
+	return filepath.Join(dir, fmt.Sprintf("%s-%s.json", table, hex.EncodeToString(hash[:6]))), nil
+}
+
+// importBatch is a batch of items to write, numbered in the order they were
+// read.
+type importBatch struct {
+	number int
+	// line of the file the last item is on
+	line  int64
+	items []map[string]interface{}
+}
+
+// importTracker works out how far through the file an import has got as
+// batches finish in any order.
+type importTracker struct {
+	mutex    sync.Mutex
+	finished map[int]int64
+	next     int
+	line     int64
+	items    int64
+}
+
+func (t *importTracker) done(batch importBatch) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.items += int64(len(batch.items))
+	t.finished[batch.number] = batch.line
+	for line, found := t.finished[t.next]; found; line, found = t.finished[t.next] {
+		t.line = line
+		delete(t.finished, t.next)
+		t.next++
+	}
+}
+
+func (t *importTracker) position() (int64, int64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.line, t.items
+}
+
+// writeBatch writes the items to the table, retrying the items DynamoDB
+// leaves unprocessed when throttled until all are written.
+func writeBatch(ctx context.Context, address string, table string, items []map[string]interface{}) error {
+	requests := []interface{}{}
+	for _, item := range items {
+		requests = append(requests, map[string]interface{}{"PutRequest": map[string]interface{}{"Item": item}})
+	}
+	backoff := dynamodbBackoff
+	for attempt := 1; ; attempt++ {
+		result := struct {
+			UnprocessedItems map[string][]interface{} `json:"UnprocessedItems"`
+		}{}
+		err := dynamodbRetrying(ctx, address, "BatchWriteItem", map[string]interface{}{
+			"RequestItems": map[string]interface{}{table: requests},
+		}, &result)
+		if dynamodbErrorType(err) != "" {
+			return errors.New(dynamodbMessage(err))
+		}
+		if err != nil {
+			return err
+		}
+		unprocessed := result.UnprocessedItems[table]
+		if len(unprocessed) == 0 {
+			return nil
+		}
+		if len(unprocessed) < len(requests) {
+			// some got through, so start backing off again
+			attempt, backoff = 1, dynamodbBackoff
+		} else if attempt == dynamodbRetries {
+			return fmt.Errorf("%d items still unprocessed after %d attempts", len(unprocessed), attempt)
+		}
+		requests = unprocessed
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > dynamodbMaxBackoff {
+			backoff = dynamodbMaxBackoff
+		}
+	}
+}
+
+// importItem reads a line of an import: an item in DynamoDB JSON, on its own
+// or under Item as DynamoDB exports it, or with plain values.
+func importItem(line []byte) (map[string]interface{}, error) {
+	item := map[string]interface{}{}
+	// numbers are kept as they are written, see seedValue
+	decoder := json.NewDecoder(bytes.NewReader(line))
+	decoder.UseNumber()
+	err := decoder.Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	if wrapped, ok := item["Item"].(map[string]interface{}); ok && len(item) == 1 {
+		item = wrapped
+	}
+	return dynamoItem(item)
+}
+
+// DynamodbImport writes the items in the file, or stdin if it is -, to the
+// table in batches, several at a time, and returns how many were written.
+// The file may be compressed with gzip (.gz) or zstd (.zst). If an import of
+// a file fails part way through, a DynamodbImportError says how far it got,
+// and running it again with Resume carries on from there.
+func DynamodbImport(ctx context.Context, compose ComposeInfo, table string, input string, options DynamodbImportOptions) (int64, error) {
+	address, err := dynamodbAddress(compose)
+	if err != nil {
+		return 0, err
+	}
+	if dryRunRequest(compose, "dynamodb", fmt.Sprintf("import %s into table %s", input, table)) {
+		return 0, nil
+	}
+	description, err := describeTable(ctx, address, table)
+	if err != nil {
+		return 0, err
+	}
+	if description == nil {
+		return 0, fmt.Errorf("table %s not found - create it with dynamodb apply", table)
+	}
+	workers := options.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	fromStdin := input == "-"
+	var source io.Reader = os.Stdin
+	var size int64
+	var checkpoint importCheckpoint
+	checkpointFile := ""
+	if fromStdin {
+		if options.Resume {
+			return 0, errors.New("an import from stdin cannot be resumed")
+		}
+	} else {
+		absolute, err := filepath.Abs(input)
+		if err != nil {
+			return 0, err
+		}
+		file, err := os.Open(input)
+		if err != nil {
+			return 0, err
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil {
+			return 0, err
+		}
+		size = info.Size()
+		source = file
+		checkpoint = importCheckpoint{File: absolute, Table: table, Size: size, ModTime: info.ModTime()}
+		checkpointFile, err = checkpointPath(absolute, table)
+		if err != nil {
+			return 0, err
+		}
+		if options.Resume {
+			saved := importCheckpoint{}
+			data, err := ioutil.ReadFile(checkpointFile)
+			if errors.Is(err, os.ErrNotExist) {
+				return 0, fmt.Errorf("there is no interrupted import of %s into %s to resume", input, table)
+			}
+			if err == nil {
+				err = json.Unmarshal(data, &saved)
+			}
+			if err != nil {
+				return 0, fmt.Errorf("error reading checkpoint %s: %w", checkpointFile, err)
+			}
+			if saved.Size != size || !saved.ModTime.Equal(info.ModTime()) {
+				return 0, fmt.Errorf("%s has changed since its import was interrupted, so it cannot be resumed", input)
+			}
+			checkpoint.Line = saved.Line
+		}
+	}
+	// lines before this were imported before the import was interrupted
+	resumeLine := checkpoint.Line
+	// called from the saving goroutine too, so it leaves checkpoint alone
+	saveCheckpoint := func(line int64) {
+		if checkpointFile == "" {
+			return
+		}
+		saved := checkpoint
+		saved.Line = line
+		if data, err := json.Marshal(saved); err == nil {
+			ioutil.WriteFile(checkpointFile, data, 0600)
+		}
+	}
+
+	progress := newProgress(options.Progress, "Imported", size)
+	reader, err := decompressor(input, progressReader{source, progress})
+	if err != nil {
+		return 0, fmt.Errorf("error reading %s: %w", input, err)
+	}
+	defer reader.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	tracker := &importTracker{finished: map[int]int64{}, line: resumeLine}
+	batches := make(chan importBatch, workers)
+	var failure error
+	failed := sync.Once{}
+	fail := func(err error) {
+		failed.Do(func() {
+			failure = err
+			cancel()
+		})
+	}
+	wait := sync.WaitGroup{}
+	for worker := 0; worker < workers; worker++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for batch := range batches {
+				if err := writeBatch(ctx, address, table, batch.items); err != nil {
+					fail(err)
+					return
+				}
+				tracker.done(batch)
+			}
+		}()
+	}
+	stopSaving := make(chan struct{})
+	saving := sync.WaitGroup{}
+	saving.Add(1)
+	go func() {
+		defer saving.Done()
+		for {
+			select {
+			case <-stopSaving:
+				return
+			case <-time.After(checkpointInterval):
+				line, _ := tracker.position()
+				saveCheckpoint(line)
+			}
+		}
+	}()
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	batch := importBatch{}
+	line := int64(0)
+	send := func() bool {
+		select {
+		case batches <- batch:
+			batch = importBatch{number: batch.number + 1}
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if line <= resumeLine || len(text) == 0 {
+			continue
+		}
+		item, err := importItem(text)
+		if err != nil {
+			fail(fmt.Errorf("line %d: %w", line, err))
+			break
+		}
+		batch.items = append(batch.items, item)
+		batch.line = line
+		if len(batch.items) == dynamodbBatchSize && !send() {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fail(err)
+	}
+	if len(batch.items) > 0 && ctx.Err() == nil {
+		send()
+	}
+	close(batches)
+	wait.Wait()
+	close(stopSaving)
+	saving.Wait()
+
+	done, items := tracker.position()
+	if failure == nil && ctx.Err() != nil {
+		// interrupted
+		failure = ctx.Err()
+	}
+	if failure != nil {
+		saveCheckpoint(done)
+		name := input
+		if fromStdin {
+			name = "stdin"
+		}
+		return items, &DynamodbImportError{File: name, Table: table, Line: done, Resumable: !fromStdin, Err: failure}
+	}
+	if checkpointFile != "" {
+		os.Remove(checkpointFile)
+	}
+	progress.finish()
+	return items, nil
+}
@@ -0,0 +1,233 @@
+package gdc
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dataTest is a fake DynamoDB with a flyers table of the given number of
+// items, and fast backoff and checkpoints.
+func dataTest(t *testing.T, items int) (*fakeDynamodb, ComposeInfo) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	backoff, maxBackoff, interval := dynamodbBackoff, dynamodbMaxBackoff, checkpointInterval
+	dynamodbBackoff, dynamodbMaxBackoff, checkpointInterval = time.Millisecond, 5*time.Millisecond, 10*time.Millisecond
+	t.Cleanup(func() {
+		dynamodbBackoff, dynamodbMaxBackoff, checkpointInterval = backoff, maxBackoff, interval
+	})
+	fake, address := newFakeDynamodb(t)
+	for _, name := range []string{"flyers", "copy"} {
+		fake.tables[name] = &dynamoTable{TableName: name, TableStatus: "ACTIVE", KeySchema: []dynamoKey{{AttributeName: "id", KeyType: "HASH"}}}
+	}
+	for i := 1; i <= items; i++ {
+		fake.put("flyers", map[string]interface{}{
+			"id":    map[string]interface{}{"S": fmt.Sprintf("flyer-%03d", i)},
+			"views": map[string]interface{}{"N": fmt.Sprint(i * 10)},
+			"tags":  map[string]interface{}{"SS": []interface{}{"a", "b"}},
+		})
+	}
+	return fake, dynamodbCompose(t, address)
+}
+
+// writeItems writes an import file of the given number of items with plain
+// values, one per line.
+func writeItems(t *testing.T, count int) string {
+	t.Helper()
+	lines := []string{}
+	for i := 1; i <= count; i++ {
+		lines = append(lines, fmt.Sprintf(`{"id": "item-%03d", "n": %d}`, i, i))
+	}
+	path := filepath.Join(t.TempDir(), "items.jsonl")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDynamodbExportImport(t *testing.T) {
+	for _, name := range []string{"items.jsonl", "items.jsonl.gz", "items.jsonl.zst"} {
+		t.Run(name, func(t *testing.T) {
+			fake, compose := dataTest(t, 60)
+			fake.scanLimit = 7
+			output := filepath.Join(t.TempDir(), name)
+			ctx := context.Background()
+
+			count, err := DynamodbExport(ctx, compose, "flyers", DynamodbExportOptions{Output: output, Segments: 3})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != 60 {
+				t.Errorf("exported %d items, want 60", count)
+			}
+			// three segments of 20 items in pages of 7
+			if scans := len(fake.requests["Scan"]); scans != 9 {
+				t.Errorf("expected 9 scans, got %d", scans)
+			}
+
+			count, err = DynamodbImport(ctx, compose, "copy", output, DynamodbImportOptions{Workers: 2})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != 60 {
+				t.Errorf("imported %d items, want 60", count)
+			}
+			if !reflect.DeepEqual(fake.items["copy"], fake.items["flyers"]) {
+				t.Errorf("expected the copy to have the same items, got %d items", len(fake.items["copy"]))
+			}
+		})
+	}
+}
+
+func TestDynamodbExportLines(t *testing.T) {
+	_, compose := dataTest(t, 2)
+	output := filepath.Join(t.TempDir(), "items.jsonl")
+	if _, err := DynamodbExport(context.Background(), compose, "flyers", DynamodbExportOptions{Output: output}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the format of DynamoDB's exports to S3
+	want := `{"Item":{"id":{"S":"flyer-001"},"tags":{"SS":["a","b"]},"views":{"N":"10"}}}` + "\n" +
+		`{"Item":{"id":{"S":"flyer-002"},"tags":{"SS":["a","b"]},"views":{"N":"20"}}}` + "\n"
+	if string(data) != want {
+		t.Errorf("export = %s, want %s", data, want)
+	}
+}
+
+func TestDynamodbExportToDevice(t *testing.T) {
+	info, err := os.Stat(os.DevNull)
+	if err != nil || info.Mode().IsRegular() {
+		t.Skip("no null device")
+	}
+	_, compose := dataTest(t, 3)
+	count, err := DynamodbExport(context.Background(), compose, "flyers", DynamodbExportOptions{Output: os.DevNull})
+	if err != nil || count != 3 {
+		t.Fatalf("exported %d items, %v", count, err)
+	}
+	if info, err = os.Stat(os.DevNull); err != nil || info.Mode().IsRegular() {
+		t.Errorf("expected %s to be left a device", os.DevNull)
+	}
+}
+
+func TestDynamodbExportMissingTable(t *testing.T) {
+	_, compose := dataTest(t, 0)
+	output := filepath.Join(t.TempDir(), "items.jsonl")
+	_, err := DynamodbExport(context.Background(), compose, "orders", DynamodbExportOptions{Output: output})
+	if err == nil || err.Error() != "table orders not found" {
+		t.Errorf("expected the table not to be found, got %v", err)
+	}
+	if _, err := os.Stat(output); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected no output file, got %v", err)
+	}
+}
+
+func TestDynamodbImportRetries(t *testing.T) {
+	fake, compose := dataTest(t, 0)
+	fake.throttle = 2
+	fake.unprocessed = 3
+	input := writeItems(t, 60)
+
+	count, err := DynamodbImport(context.Background(), compose, "copy", input, DynamodbImportOptions{Workers: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 60 || len(fake.items["copy"]) != 60 {
+		t.Errorf("imported %d items and the table has %d, want 60", count, len(fake.items["copy"]))
+	}
+	// three batches, two throttled calls and three calls leaving items over
+	if fake.batches != 8 {
+		t.Errorf("expected 8 BatchWriteItem calls, got %d", fake.batches)
+	}
+	item := fake.items["copy"][`{"S":"item-007"}`]
+	if !reflect.DeepEqual(item, map[string]interface{}{"id": map[string]interface{}{"S": "item-007"}, "n": map[string]interface{}{"N": "7"}}) {
+		t.Errorf("item-007 = %v", item)
+	}
+}
+
+func TestDynamodbImportResume(t *testing.T) {
+	fake, compose := dataTest(t, 0)
+	fake.rejectBatch = 3
+	input := writeItems(t, 110)
+	ctx := context.Background()
+
+	_, err := DynamodbImport(ctx, compose, "copy", input, DynamodbImportOptions{Workers: 1, Resume: true})
+	if err == nil || !strings.Contains(err.Error(), "there is no interrupted import") {
+		t.Errorf("expected nothing to resume, got %v", err)
+	}
+
+	count, err := DynamodbImport(ctx, compose, "copy", input, DynamodbImportOptions{Workers: 1})
+	importErr := &DynamodbImportError{}
+	if !errors.As(err, &importErr) {
+		t.Fatalf("expected an import error, got %v", err)
+	}
+	if count != 50 || importErr.Line != 50 || !importErr.Resumable || importErr.Table != "copy" {
+		t.Errorf("imported %d items, error %+v", count, importErr)
+	}
+	if !strings.Contains(err.Error(), "run again with --resume") {
+		t.Errorf("expected a hint to resume, got %s", err)
+	}
+
+	requests := len(fake.requests["BatchWriteItem"])
+	count, err = DynamodbImport(ctx, compose, "copy", input, DynamodbImportOptions{Workers: 1, Resume: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 60 || len(fake.items["copy"]) != 110 {
+		t.Errorf("resumed with %d items and the table has %d, want 60 and 110", count, len(fake.items["copy"]))
+	}
+	// lines 51 to 110 in three batches
+	if resumed := len(fake.requests["BatchWriteItem"]) - requests; resumed != 3 {
+		t.Errorf("expected 3 batches when resuming, got %d", resumed)
+	}
+
+	// a finished import leaves nothing to resume
+	_, err = DynamodbImport(ctx, compose, "copy", input, DynamodbImportOptions{Workers: 1, Resume: true})
+	if err == nil || !strings.Contains(err.Error(), "there is no interrupted import") {
+		t.Errorf("expected nothing to resume, got %v", err)
+	}
+}
+
+func TestDynamodbImportResumeChangedFile(t *testing.T) {
+	fake, compose := dataTest(t, 0)
+	fake.rejectBatch = 2
+	input := writeItems(t, 60)
+	ctx := context.Background()
+	if _, err := DynamodbImport(ctx, compose, "copy", input, DynamodbImportOptions{Workers: 1}); err == nil {
+		t.Fatal("expected the import to fail")
+	}
+	file, err := os.OpenFile(input, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer := bufio.NewWriter(file)
+	writer.WriteString(`{"id": "item-999"}` + "\n")
+	writer.Flush()
+	file.Close()
+
+	_, err = DynamodbImport(ctx, compose, "copy", input, DynamodbImportOptions{Workers: 1, Resume: true})
+	if err == nil || !strings.Contains(err.Error(), "has changed since its import was interrupted") {
+		t.Errorf("expected the changed file to be refused, got %v", err)
+	}
+}
+
+func TestDynamodbImportBadLine(t *testing.T) {
+	_, compose := dataTest(t, 0)
+	input := filepath.Join(t.TempDir(), "items.jsonl")
+	os.WriteFile(input, []byte("{\"id\": \"a\"}\n\nnot json\n"), 0600)
+
+	_, err := DynamodbImport(context.Background(), compose, "copy", input, DynamodbImportOptions{})
+	importErr := &DynamodbImportError{}
+	if !errors.As(err, &importErr) || !strings.Contains(err.Error(), "line 3:") {
+		t.Errorf("expected an error on line 3, got %v", err)
+	}
+}
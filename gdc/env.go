@@ -0,0 +1,109 @@
+package gdc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Perspectives to build connection settings from.
+const (
+	// apps running on the host, connecting through published ports
+	FromHost = "host"
+	// apps running in containers on the same Docker network
+	FromContainer = "container"
+)
+
+// EnvVar is a connection setting for one of the services.
+type EnvVar struct {
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+	Service string `json:"service"`
+}
+
+// Env returns the connection settings the requested services and their
+// companions declare in their x-gdc env blocks, as seen from the given
+// perspective. If several services set the same variable, the one requested
+// last wins. The variables are sorted by name.
+func Env(compose ComposeInfo, from string) ([]EnvVar, error) {
+	if from != FromHost && from != FromContainer {
+		return nil, fmt.Errorf("unknown perspective %s - expected %s or %s", from, FromHost, FromContainer)
+	}
+	file, services, err := requestedServices(compose, "env")
+	if err != nil {
+		return nil, err
+	}
+	vars := map[string]EnvVar{}
+	for _, service := range services {
+		env := file.Services[service].Gdc.Env
+		for _, name := range sortedKeys(env) {
+			render := compose.hostURL
+			if from == FromContainer {
+				render = compose.containerURL
+			}
+			value, err := render(file, service, env[name])
+			if err != nil {
+				return nil, fmt.Errorf("error building %s for service %s: %w", name, service, err)
+			}
+			vars[name] = EnvVar{Name: name, Value: value, Service: service}
+		}
+	}
+	result := []EnvVar{}
+	for _, name := range sortedKeys(vars) {
+		result = append(result, vars[name])
+	}
+	return result, nil
+}
+
+// RenameEnv applies a project's variable names, keyed by the default name. A
+// variable renamed to an empty string is left out.
+func RenameEnv(vars []EnvVar, names map[string]string) []EnvVar {
+	result := []EnvVar{}
+	for _, v := range vars {
+		if name, found := names[v.Name]; found {
+			if name == "" {
+				continue
+			}
+			v.Name = name
+		}
+		result = append(result, v)
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+var plainValue = regexp.MustCompile(`^[A-Za-z0-9_./:@,+=-]*$`)
+
+// PrintEnv writes the variables as a .env file ("dotenv"), shell exports
+// ("shell" or "direnv", to eval or put in an .envrc) or a JSON object
+// ("json").
+func PrintEnv(w io.Writer, vars []EnvVar, format string) error {
+	switch format {
+	case "dotenv":
+		for _, v := range vars {
+			value := v.Value
+			if !plainValue.MatchString(value) {
+				value = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value) + `"`
+			}
+			fmt.Fprintf(w, "%s=%s\n", v.Name, value)
+		}
+	case "shell", "direnv":
+		for _, v := range vars {
+			fmt.Fprintf(w, "export %s=%s\n", v.Name, ShellQuote(v.Value))
+		}
+	case "json":
+		object := map[string]string{}
+		for _, v := range vars {
+			object[v.Name] = v.Value
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(object)
+	default:
+		return fmt.Errorf("unknown format %s - expected dotenv, shell, json or direnv", format)
+	}
+	return nil
+}
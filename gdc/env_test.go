@@ -0,0 +1,163 @@
+package gdc
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const envCompose = `
+services:
+  mysql:
+    image: mysql:5.7
+    ports: ["3306:3306"]
+    x-gdc:
+      env:
+        DATABASE_URL: mysql2://root@{{address 3306}}/app
+        DB_HOST: "{{host 3306}}"
+        DB_PORT: "{{port 3306}}"
+  kafka:
+    image: confluentinc/cp-kafka:7.4.0
+    hostname: broker
+    ports: ["9092:9092"]
+    x-gdc:
+      companions: [schema-registry]
+      env:
+        KAFKA_BROKERS: "{{address 9092}}"
+      container_ports:
+        9092: 29092
+  schema-registry:
+    image: confluentinc/cp-schema-registry:7.4.0
+    ports: ["8081:8081"]
+    x-gdc:
+      env:
+        SCHEMA_REGISTRY_URL: http://{{address 8081}}
+  mysql8:
+    image: mysql:8.0
+    ports: ["3307:3306"]
+    x-gdc:
+      env:
+        DATABASE_URL: mysql2://root@{{address 3306}}/app
+`
+
+func TestEnv(t *testing.T) {
+	tests := []struct {
+		name      string
+		services  []string
+		from      string
+		overrides map[string]map[int]int
+		want      []EnvVar
+	}{
+		{
+			name:     "from the host",
+			services: []string{"kafka", "mysql"},
+			from:     FromHost,
+			want: []EnvVar{
+				{Name: "DATABASE_URL", Value: "mysql2://root@127.0.0.1:3306/app", Service: "mysql"},
+				{Name: "DB_HOST", Value: "127.0.0.1", Service: "mysql"},
+				{Name: "DB_PORT", Value: "3306", Service: "mysql"},
+				{Name: "KAFKA_BROKERS", Value: "127.0.0.1:9092", Service: "kafka"},
+				{Name: "SCHEMA_REGISTRY_URL", Value: "http://127.0.0.1:8081", Service: "schema-registry"},
+			},
+		},
+		{
+			name:     "from a container",
+			services: []string{"kafka"},
+			from:     FromContainer,
+			want: []EnvVar{
+				{Name: "KAFKA_BROKERS", Value: "broker:29092", Service: "kafka"},
+				{Name: "SCHEMA_REGISTRY_URL", Value: "http://schema-registry:8081", Service: "schema-registry"},
+			},
+		},
+		{
+			name:      "remapped ports",
+			services:  []string{"kafka"},
+			from:      FromHost,
+			overrides: map[string]map[int]int{"kafka": {9092: 19092}},
+			want: []EnvVar{
+				{Name: "KAFKA_BROKERS", Value: "127.0.0.1:19092", Service: "kafka"},
+				{Name: "SCHEMA_REGISTRY_URL", Value: "http://127.0.0.1:8081", Service: "schema-registry"},
+			},
+		},
+		{
+			name:     "requested last wins",
+			services: []string{"mysql8", "mysql"},
+			from:     FromHost,
+			want: []EnvVar{
+				{Name: "DATABASE_URL", Value: "mysql2://root@127.0.0.1:3306/app", Service: "mysql"},
+				{Name: "DB_HOST", Value: "127.0.0.1", Service: "mysql"},
+				{Name: "DB_PORT", Value: "3306", Service: "mysql"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			compose, _ := testComposeInfo(t, test.services...)
+			compose.MainFile = []byte(envCompose)
+			compose.PortOverrides = test.overrides
+			vars, err := Env(compose, test.from)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(vars, test.want) {
+				t.Errorf("got %+v, want %+v", vars, test.want)
+			}
+		})
+	}
+}
+
+func TestEnvUnknownPerspective(t *testing.T) {
+	compose, _ := testComposeInfo(t, "mysql")
+	_, err := Env(compose, "vm")
+	if err == nil || err.Error() != "unknown perspective vm - expected host or container" {
+		t.Errorf("expected an unknown perspective error, got %v", err)
+	}
+}
+
+func TestRenameEnv(t *testing.T) {
+	vars := []EnvVar{
+		{Name: "DATABASE_URL", Value: "a", Service: "mysql"},
+		{Name: "DB_HOST", Value: "b", Service: "mysql"},
+		{Name: "KAFKA_BROKERS", Value: "c", Service: "kafka"},
+	}
+	renamed := RenameEnv(vars, map[string]string{"KAFKA_BROKERS": "BROKERS", "DB_HOST": ""})
+	want := []EnvVar{
+		{Name: "BROKERS", Value: "c", Service: "kafka"},
+		{Name: "DATABASE_URL", Value: "a", Service: "mysql"},
+	}
+	if !reflect.DeepEqual(renamed, want) {
+		t.Errorf("got %+v, want %+v", renamed, want)
+	}
+}
+
+func TestPrintEnv(t *testing.T) {
+	vars := []EnvVar{
+		{Name: "DATABASE_URL", Value: "mysql2://root@127.0.0.1:3306/app"},
+		{Name: "GREETING", Value: "it's \"here\"\nnow"},
+	}
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{format: "dotenv", want: "DATABASE_URL=mysql2://root@127.0.0.1:3306/app\nGREETING=\"it's \\\"here\\\"\\nnow\"\n"},
+		{format: "shell", want: "export DATABASE_URL=mysql2://root@127.0.0.1:3306/app\nexport GREETING='it'\\''s \"here\"\nnow'\n"},
+		{format: "direnv", want: "export DATABASE_URL=mysql2://root@127.0.0.1:3306/app\nexport GREETING='it'\\''s \"here\"\nnow'\n"},
+		{format: "json", want: "{\n  \"DATABASE_URL\": \"mysql2://root@127.0.0.1:3306/app\",\n  \"GREETING\": \"it's \\\"here\\\"\\nnow\"\n}\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.format, func(t *testing.T) {
+			var out strings.Builder
+			if err := PrintEnv(&out, vars, test.format); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != test.want {
+				t.Errorf("got\n%s\nwant\n%s", out.String(), test.want)
+			}
+		})
+	}
+
+	err := PrintEnv(&strings.Builder{}, vars, "yaml")
+	if err == nil || err.Error() != "unknown format yaml - expected dotenv, shell, json or direnv" {
+		t.Errorf("expected an unknown format error, got %v", err)
+	}
+}
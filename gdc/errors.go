@@ -0,0 +1,92 @@
+package gdc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ServiceNotFoundError is returned when a command is given a service that
+// none of the compose files define.
+type ServiceNotFoundError struct {
+	Command string
+	Service string
+	// services the compose files do define
+	Known []string
+}
+
+func (e *ServiceNotFoundError) Error() string {
+	return fmt.Sprintf("cannot execute command %s - %s is not a known service! Known services: %s",
+		e.Command, e.Service, strings.Join(e.Known, ", "))
+}
+
+// NoServicesError is returned when a command needs services but none were
+// requested.
+type NoServicesError struct {
+	Command string
+}
+
+func (e *NoServicesError) Error() string {
+	return fmt.Sprintf("no services provided for command %s! Use the --services option.", e.Command)
+}
+
+// RegistryAuthError is returned when gdc cannot log in to an image registry.
+type RegistryAuthError struct {
+	Registry string
+	Err      error
+}
+
+func (e *RegistryAuthError) Error() string {
+	return fmt.Sprintf("cannot log in to registry %s: %s", e.Registry, e.Err)
+}
+
+func (e *RegistryAuthError) Unwrap() error {
+	return e.Err
+}
+
+// NotReadyError is returned by Wait when services are still not ready once
+// the timeout passes.
+type NotReadyError struct {
+	Timeout time.Duration
+	// the last probe failure of each service that is not ready
+	Failures map[string]error
+}
+
+func (e *NotReadyError) Error() string {
+	lines := []string{}
+	for service, err := range e.Failures {
+		lines = append(lines, fmt.Sprintf("  %s: %s", service, err))
+	}
+	sort.Strings(lines)
+	return fmt.Sprintf("timed out after %s waiting for:\n%s", e.Timeout, strings.Join(lines, "\n"))
+}
+
+// SnapshotIncompatibleError is returned when restoring a snapshot taken with
+// an image of another major version than the service now runs.
+type SnapshotIncompatibleError struct {
+	Service  string
+	Snapshot string
+	// image the snapshot was taken with
+	SnapshotImage string
+	// image the service runs now
+	Image string
+}
+
+func (e *SnapshotIncompatibleError) Error() string {
+	return fmt.Sprintf("snapshot %s of %s was taken with %s, which is not compatible with %s - use --force to restore it anyway",
+		e.Snapshot, e.Service, e.SnapshotImage, e.Image)
+}
+
+// APIError is returned when a service's HTTP API responds with an error.
+type APIError struct {
+	Method string
+	URL    string
+	Status int
+	// the response body, which usually explains the error
+	Body string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s %s returned HTTP %d: %s", e.Method, e.URL, e.Status, e.Body)
+}
@@ -0,0 +1,65 @@
+package gdc
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestErrorMessages(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{
+			name: "service not found",
+			err:  &ServiceNotFoundError{Command: "up", Service: "mongo", Known: []string{"kafka", "redis"}},
+			want: "cannot execute command up - mongo is not a known service! Known services: kafka, redis",
+		},
+		{
+			name: "no services",
+			err:  &NoServicesError{Command: "logs"},
+			want: "no services provided for command logs! Use the --services option.",
+		},
+		{
+			name: "registry auth",
+			err:  &RegistryAuthError{Registry: "ghcr.io", Err: errors.New("no credential helper given")},
+			want: "cannot log in to registry ghcr.io: no credential helper given",
+		},
+		{
+			name: "not ready, sorted by service",
+			err: &NotReadyError{Timeout: 2 * time.Minute, Failures: map[string]error{
+				"redis": errors.New("connection refused"),
+				"kafka": errors.New("no brokers available"),
+			}},
+			want: "timed out after 2m0s waiting for:\n  kafka: no brokers available\n  redis: connection refused",
+		},
+		{
+			name: "snapshot incompatible",
+			err:  &SnapshotIncompatibleError{Service: "mysql", Snapshot: "seed", SnapshotImage: "mysql:5.7", Image: "mysql:8.0"},
+			want: "snapshot seed of mysql was taken with mysql:5.7, which is not compatible with mysql:8.0 - use --force to restore it anyway",
+		},
+		{
+			name: "api",
+			err:  &APIError{Method: "PUT", URL: "http://127.0.0.1:9200/orders", Status: 400, Body: "resource_already_exists_exception"},
+			want: "PUT http://127.0.0.1:9200/orders returned HTTP 400: resource_already_exists_exception",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.err.Error() != test.want {
+				t.Errorf("got %q, want %q", test.err.Error(), test.want)
+			}
+		})
+	}
+}
+
+func TestRegistryAuthErrorUnwraps(t *testing.T) {
+	exitErr := &ExitError{Command: "docker login", Code: 1}
+	var err error = &RegistryAuthError{Registry: "ghcr.io", Err: exitErr}
+	var unwrapped *ExitError
+	if !errors.As(err, &unwrapped) || unwrapped != exitErr {
+		t.Errorf("expected the exit error to be unwrapped, got %v", unwrapped)
+	}
+}
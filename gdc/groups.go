@@ -0,0 +1,294 @@
+package gdc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kerr"
+)
+
+// GroupInfo is a consumer group on the broker.
+type GroupInfo struct {
+	Name    string `json:"name"`
+	State   string `json:"state"`
+	Members int    `json:"members"`
+	// total lag over the partitions the group has offsets for
+	Lag int64 `json:"lag"`
+}
+
+// GroupMember is a consumer in a group.
+type GroupMember struct {
+	ID       string `json:"id"`
+	ClientID string `json:"client_id"`
+	Host     string `json:"host"`
+}
+
+// GroupPartition is a group's position in a partition.
+type GroupPartition struct {
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	// -1 if the group hasn't committed an offset
+	Committed int64 `json:"committed"`
+	End       int64 `json:"end"`
+	Lag       int64 `json:"lag"`
+	// client id of the member consuming the partition, if any
+	Member string `json:"member,omitempty"`
+}
+
+// GroupDescription is the members and offsets of a consumer group.
+type GroupDescription struct {
+	Name       string           `json:"name"`
+	State      string           `json:"state"`
+	Members    []GroupMember    `json:"members"`
+	Partitions []GroupPartition `json:"partitions"`
+}
+
+// GroupOffsetReset is a change to a group's committed offset in a partition.
+type GroupOffsetReset struct {
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	// -1 if the group hasn't committed an offset
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
+}
+
+// groupLag describes the groups and their lag.
+func groupLag(ctx context.Context, admin *kadm.Client, groups ...string) (kadm.DescribedGroupLags, error) {
+	lags, err := admin.Lag(ctx, groups...)
+	if err == nil {
+		err = lags.Error()
+	}
+	if errors.Is(err, kerr.GroupIDNotFound) && len(groups) == 1 {
+		return nil, fmt.Errorf("consumer group %s not found", groups[0])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error describing consumer groups: %w", err)
+	}
+	return lags, nil
+}
+
+// Groups lists the consumer groups on the broker.
+func Groups(ctx context.Context, compose ComposeInfo) ([]GroupInfo, error) {
+	admin, err := kafkaAdmin(compose)
+	if err != nil {
+		return nil, err
+	}
+	defer admin.Close()
+	listed, err := admin.ListGroups(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing consumer groups: %w", err)
+	}
+	result := []GroupInfo{}
+	if len(listed) == 0 {
+		return result, nil
+	}
+	lags, err := groupLag(ctx, admin, listed.Groups()...)
+	if err != nil {
+		return nil, err
+	}
+	for _, lag := range lags.Sorted() {
+		info := GroupInfo{Name: lag.Group, State: lag.State, Members: len(lag.Members)}
+		for _, partition := range lag.Lag.Sorted() {
+			if partition.Lag > 0 {
+				info.Lag += partition.Lag
+			}
+		}
+		result = append(result, info)
+	}
+	return result, nil
+}
+
+// DescribeGroup returns a consumer group's members and its committed offset,
+// the end offset and the lag of each partition it consumes.
+func DescribeGroup(ctx context.Context, compose ComposeInfo, group string) (GroupDescription, error) {
+	description := GroupDescription{Name: group}
+	admin, err := kafkaAdmin(compose)
+	if err != nil {
+		return description, err
+	}
+	defer admin.Close()
+	lags, err := groupLag(ctx, admin, group)
+	if err != nil {
+		return description, err
+	}
+	lag := lags[group]
+	if lag.State == "Dead" {
+		return description, fmt.Errorf("consumer group %s not found", group)
+	}
+	description.State = lag.State
+	description.Members = []GroupMember{}
+	for _, member := range lag.Members {
+		description.Members = append(description.Members, GroupMember{
+			ID:       member.MemberID,
+			ClientID: member.ClientID,
+			Host:     member.ClientHost,
+		})
+	}
+	description.Partitions = []GroupPartition{}
+	for _, partition := range lag.Lag.Sorted() {
+		info := GroupPartition{
+			Topic:     partition.Topic,
+			Partition: partition.Partition,
+			Committed: partition.Commit.At,
+			End:       partition.End.Offset,
+			Lag:       partition.Lag,
+		}
+		if partition.Member != nil {
+			info.Member = partition.Member.ClientID
+		}
+		description.Partitions = append(description.Partitions, info)
+	}
+	return description, nil
+}
+
+// PlanGroupReset works out the offsets to reset a consumer group to in each
+// partition of the topics, or of the topics it has committed offsets for if
+// none are given. The position is earliest, latest, a time (RFC 3339), a
+// duration before now or an offset, which is kept within each partition's
+// start and end.
+func PlanGroupReset(ctx context.Context, compose ComposeInfo, group string, position string, topics []string) ([]GroupOffsetReset, error) {
+	admin, err := kafkaAdmin(compose)
+	if err != nil {
+		return nil, err
+	}
+	defer admin.Close()
+	committed, err := admin.FetchOffsets(ctx, group)
+	if err == nil {
+		err = committed.Error()
+	}
+	if errors.Is(err, kerr.GroupIDNotFound) {
+		// offsets can be set for a group that hasn't run yet
+		committed, err = kadm.OffsetResponses{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading offsets of consumer group %s: %w", group, err)
+	}
+	if len(topics) == 0 {
+		topics = committed.Partitions().Topics()
+		if len(topics) == 0 {
+			return nil, fmt.Errorf("consumer group %s has no committed offsets - use --topic to say which topics to reset", group)
+		}
+	}
+	sort.Strings(topics)
+
+	starts, err := offsetsAt(ctx, admin, "earliest", topics...)
+	if err != nil {
+		return nil, err
+	}
+	ends, err := offsetsAt(ctx, admin, "latest", topics...)
+	if err != nil {
+		return nil, err
+	}
+	var targets kadm.ListedOffsets
+	offset, offsetErr := strconv.ParseInt(position, 10, 64)
+	if offsetErr != nil {
+		targets, err = offsetsAt(ctx, admin, position, topics...)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return planResets(committed.Offsets(), starts, ends, targets, offset), nil
+}
+
+// planResets works out the reset of each partition from the committed
+// offsets to the targets, or to the offset if there are no targets, kept
+// within the partition's start and end offsets.
+func planResets(committed kadm.Offsets, starts, ends, targets kadm.ListedOffsets, offset int64) []GroupOffsetReset {
+	partitions := []kadm.ListedOffset{}
+	ends.Each(func(end kadm.ListedOffset) {
+		partitions = append(partitions, end)
+	})
+	sort.Slice(partitions, func(i, j int) bool {
+		if partitions[i].Topic != partitions[j].Topic {
+			return partitions[i].Topic < partitions[j].Topic
+		}
+		return partitions[i].Partition < partitions[j].Partition
+	})
+	resets := []GroupOffsetReset{}
+	for _, end := range partitions {
+		reset := GroupOffsetReset{Topic: end.Topic, Partition: end.Partition, From: -1}
+		if commit, found := committed.Lookup(end.Topic, end.Partition); found {
+			reset.From = commit.At
+		}
+		if targets == nil {
+			start, _ := starts.Lookup(end.Topic, end.Partition)
+			reset.To = offset
+			if reset.To < start.Offset {
+				reset.To = start.Offset
+			}
+			if reset.To > end.Offset {
+				reset.To = end.Offset
+			}
+		} else {
+			target, _ := targets.Lookup(end.Topic, end.Partition)
+			reset.To = target.Offset
+		}
+		resets = append(resets, reset)
+	}
+	return resets
+}
+
+// PrintGroupReset describes the offsets a reset changes.
+func PrintGroupReset(w io.Writer, group string, resets []GroupOffsetReset) {
+	changes := 0
+	for _, reset := range resets {
+		from := "none"
+		if reset.From >= 0 {
+			from = strconv.FormatInt(reset.From, 10)
+		}
+		if reset.From == reset.To {
+			fmt.Fprintf(w, "  %s/%d: %s (unchanged)\n", reset.Topic, reset.Partition, from)
+			continue
+		}
+		fmt.Fprintf(w, "~ %s/%d: %s -> %d\n", reset.Topic, reset.Partition, from, reset.To)
+		changes++
+	}
+	if changes == 0 {
+		fmt.Fprintf(w, "Offsets of %s are up to date.\n", group)
+		return
+	}
+	fmt.Fprintf(w, "Plan: %d to reset.\n", changes)
+}
+
+// ResetGroup commits the offsets of the reset for the consumer group. Kafka
+// only allows this while the group has no members, so its consumers have to
+// be stopped first.
+func ResetGroup(ctx context.Context, compose ComposeInfo, group string, resets []GroupOffsetReset) error {
+	offsets := kadm.Offsets{}
+	for _, reset := range resets {
+		if reset.From != reset.To {
+			offsets.Add(kadm.Offset{Topic: reset.Topic, Partition: reset.Partition, At: reset.To, LeaderEpoch: -1})
+		}
+	}
+	if len(offsets) == 0 {
+		return nil
+	}
+	if dryRunRequest(compose, "kafka", "reset offsets of consumer group "+group) {
+		return nil
+	}
+	admin, err := kafkaAdmin(compose)
+	if err != nil {
+		return err
+	}
+	defer admin.Close()
+	described, err := admin.DescribeGroups(ctx, group)
+	if err == nil {
+		err = described.Error()
+	}
+	if err != nil && !errors.Is(err, kerr.GroupIDNotFound) {
+		return fmt.Errorf("error describing consumer group %s: %w", group, err)
+	}
+	if members := len(described[group].Members); members > 0 {
+		return fmt.Errorf("consumer group %s has %d active members - stop its consumers before resetting its offsets", group, members)
+	}
+	err = admin.CommitAllOffsets(ctx, group, offsets)
+	if err != nil {
+		return fmt.Errorf("error resetting offsets of consumer group %s: %w", group, err)
+	}
+	return nil
+}
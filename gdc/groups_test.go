@@ -0,0 +1,108 @@
+package gdc
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+)
+
+// listedOffsets of the orders topic's partitions.
+func listedOffsets(offsets ...int64) kadm.ListedOffsets {
+	result := kadm.ListedOffsets{"orders": {}}
+	for partition, offset := range offsets {
+		result["orders"][int32(partition)] = kadm.ListedOffset{Topic: "orders", Partition: int32(partition), Offset: offset}
+	}
+	return result
+}
+
+func TestPlanResets(t *testing.T) {
+	starts := listedOffsets(0, 10, 0)
+	ends := listedOffsets(100, 50, 0)
+	committed := kadm.Offsets{}
+	committed.AddOffset("orders", 0, 40, -1)
+	committed.AddOffset("orders", 1, 50, -1)
+	tests := []struct {
+		name    string
+		targets kadm.ListedOffsets
+		offset  int64
+		want    []int64
+	}{
+		{name: "earliest", targets: starts, want: []int64{0, 10, 0}},
+		{name: "latest", targets: ends, want: []int64{100, 50, 0}},
+		{name: "time", targets: listedOffsets(60, 50, 0), want: []int64{60, 50, 0}},
+		{name: "offset", offset: 30, want: []int64{30, 30, 0}},
+		{name: "offset before the start", offset: 5, want: []int64{5, 10, 0}},
+		{name: "offset after the end", offset: 70, want: []int64{70, 50, 0}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resets := planResets(committed, starts, ends, test.targets, test.offset)
+			// partition 2 has no committed offset
+			want := []GroupOffsetReset{
+				{Topic: "orders", Partition: 0, From: 40, To: test.want[0]},
+				{Topic: "orders", Partition: 1, From: 50, To: test.want[1]},
+				{Topic: "orders", Partition: 2, From: -1, To: test.want[2]},
+			}
+			if !reflect.DeepEqual(resets, want) {
+				t.Errorf("got %+v, want %+v", resets, want)
+			}
+		})
+	}
+}
+
+func TestPlanResetsSortsPartitions(t *testing.T) {
+	ends := kadm.ListedOffsets{
+		"payments": {0: {Topic: "payments", Partition: 0, Offset: 5}},
+		"orders": {
+			1: {Topic: "orders", Partition: 1, Offset: 7},
+			0: {Topic: "orders", Partition: 0, Offset: 3},
+		},
+	}
+	resets := planResets(kadm.Offsets{}, kadm.ListedOffsets{}, ends, ends, 0)
+	want := []GroupOffsetReset{
+		{Topic: "orders", Partition: 0, From: -1, To: 3},
+		{Topic: "orders", Partition: 1, From: -1, To: 7},
+		{Topic: "payments", Partition: 0, From: -1, To: 5},
+	}
+	if !reflect.DeepEqual(resets, want) {
+		t.Errorf("got %+v, want %+v", resets, want)
+	}
+}
+
+func TestPrintGroupReset(t *testing.T) {
+	tests := []struct {
+		name   string
+		resets []GroupOffsetReset
+		want   string
+	}{
+		{
+			name: "changes",
+			resets: []GroupOffsetReset{
+				{Topic: "orders", Partition: 0, From: 40, To: 0},
+				{Topic: "orders", Partition: 1, From: 10, To: 10},
+				{Topic: "orders", Partition: 2, From: -1, To: 0},
+			},
+			want: `~ orders/0: 40 -> 0
+  orders/1: 10 (unchanged)
+~ orders/2: none -> 0
+Plan: 2 to reset.
+`,
+		},
+		{
+			name:   "up to date",
+			resets: []GroupOffsetReset{{Topic: "orders", Partition: 0, From: 10, To: 10}},
+			want:   "  orders/0: 10 (unchanged)\nOffsets of billing are up to date.\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var out strings.Builder
+			PrintGroupReset(&out, "billing", test.resets)
+			if out.String() != test.want {
+				t.Errorf("got\n%s\nwant\n%s", out.String(), test.want)
+			}
+		})
+	}
+}
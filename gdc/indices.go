@@ -0,0 +1,773 @@
+package gdc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Kinds of resources opensearch apply manages.
+const (
+	ComponentTemplate = "component template"
+	IndexTemplate     = "index template"
+	IsmPolicy         = "ISM policy"
+	SearchIndex       = "index"
+)
+
+// directories of an OpenSearch directory that declare each kind of resource,
+// in the order they are applied, so indices pick up the templates
+var searchDirs = []struct {
+	dir  string
+	kind string
+}{
+	{"component_templates", ComponentTemplate},
+	{"index_templates", IndexTemplate},
+	{"ism_policies", IsmPolicy},
+	{"indices", SearchIndex},
+}
+
+// directory of seed files, named after the index they are loaded into
+const seedDir = "seed"
+
+// most documents sent in one bulk request
+const bulkBatchSize = 500
+
+// settings that can only be set when an index is created
+var staticSettings = []string{
+	"settings.index.number_of_shards",
+	"settings.index.number_of_routing_shards",
+	"settings.index.codec",
+	"settings.index.analysis.",
+	"settings.index.sort.",
+}
+
+// SearchResource is a template, ISM policy or index declared in a file, with
+// the body of the request that creates it.
+type SearchResource struct {
+	Kind string                 `json:"kind"`
+	Name string                 `json:"name"`
+	Path string                 `json:"path"`
+	Body map[string]interface{} `json:"body"`
+}
+
+// SeedFile is a file of documents to bulk-load into an index.
+type SeedFile struct {
+	Index string `json:"index"`
+	Path  string `json:"path"`
+
+	operations []bulkOperation
+}
+
+// bulkOperation is an action of a bulk request and the document it indexes,
+// if any.
+type bulkOperation struct {
+	// line of the seed file the operation starts on
+	line   int
+	action json.RawMessage
+	source json.RawMessage
+}
+
+// SearchSpecs are the resources and seed files declared in an OpenSearch
+// directory.
+type SearchSpecs struct {
+	Resources []SearchResource
+	Seeds     []SeedFile
+}
+
+// Actions in an OpenSearch plan.
+const (
+	SearchCreate = "create"
+	SearchUpdate = "update"
+	SearchSeed   = "seed"
+	// an index has fields that aren't declared; reported but not changed
+	SearchDrift = "drift"
+)
+
+// SearchChange is a change needed to make OpenSearch match a resource or seed
+// file.
+type SearchChange struct {
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	Action string `json:"action"`
+	Path   string `json:"path"`
+	// what an update changes or drift found, e.g. "+ mappings.properties.sku.type: keyword"
+	Changes []string `json:"changes,omitempty"`
+	// documents to seed
+	Documents int `json:"documents,omitempty"`
+
+	resource SearchResource
+	seed     SeedFile
+	// parts of an index to update
+	mappings bool
+	settings map[string]string
+	aliases  []string
+	// version of an ISM policy being updated
+	seqNo       int64
+	primaryTerm int64
+}
+
+// loadSearchResource reads a JSON or YAML file declaring a resource.
+func loadSearchResource(path string, kind string) (SearchResource, error) {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	resource := SearchResource{Kind: kind, Name: name, Path: path}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return resource, err
+	}
+	err = yaml.Unmarshal(data, &resource.Body)
+	if err != nil {
+		return resource, fmt.Errorf("%s: %w", path, err)
+	}
+	if resource.Body == nil {
+		resource.Body = map[string]interface{}{}
+	}
+	// through JSON so nested values are what encoding/json produces
+	err = convert(resource.Body, &resource.Body)
+	if err != nil {
+		return resource, fmt.Errorf("%s: %w", path, err)
+	}
+	return resource, nil
+}
+
+// loadSeedFile reads an NDJSON seed file: either a bulk request body, with an
+// action line such as {"index": {"_id": "1"}} before each document, or one
+// document per line, indexed with its _id field as its ID if it has one.
+func loadSeedFile(path string) (SeedFile, error) {
+	seed := SeedFile{Index: strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)), Path: path}
+	file, err := os.Open(path)
+	if err != nil {
+		return seed, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	bulk := false
+	var pending *bulkOperation
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		object := map[string]json.RawMessage{}
+		if err := json.Unmarshal(text, &object); err != nil {
+			return seed, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if pending != nil {
+			pending.source = append(json.RawMessage{}, text...)
+			seed.operations = append(seed.operations, *pending)
+			pending = nil
+			continue
+		}
+		action := ""
+		if len(object) == 1 {
+			for key := range object {
+				action = key
+			}
+		}
+		if len(seed.operations) == 0 && (action == "index" || action == "create" || action == "update" || action == "delete") {
+			bulk = true
+		}
+		if bulk {
+			operation := bulkOperation{line: line, action: append(json.RawMessage{}, text...)}
+			if action == "delete" {
+				seed.operations = append(seed.operations, operation)
+			} else if action == "index" || action == "create" || action == "update" {
+				pending = &operation
+			} else {
+				return seed, fmt.Errorf("%s:%d: expected a bulk action such as {\"index\": {}}", path, line)
+			}
+			continue
+		}
+		meta := map[string]interface{}{}
+		if id, found := object["_id"]; found {
+			meta["_id"] = id
+			delete(object, "_id")
+		}
+		source, _ := json.Marshal(object)
+		index, _ := json.Marshal(map[string]interface{}{"index": meta})
+		seed.operations = append(seed.operations, bulkOperation{line: line, action: index, source: source})
+	}
+	if err := scanner.Err(); err != nil {
+		return seed, fmt.Errorf("%s: %w", path, err)
+	}
+	if pending != nil {
+		return seed, fmt.Errorf("%s:%d: bulk action has no document after it", path, pending.line)
+	}
+	return seed, nil
+}
+
+// LoadSearchSpecs reads the resources declared in an OpenSearch directory:
+//
+//	component_templates/<name>.json
+//	index_templates/<name>.json
+//	ism_policies/<name>.json
+//	indices/<name>.json
+//	seed/<index>.ndjson
+//
+// Each resource file, in JSON or YAML, holds the body of the request that
+// creates it, e.g. the settings, mappings and aliases of an index.
+func LoadSearchSpecs(dir string) (SearchSpecs, error) {
+	specs := SearchSpecs{}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return specs, err
+	}
+	if !info.IsDir() {
+		return specs, fmt.Errorf("%s is not a directory", dir)
+	}
+	for _, kind := range searchDirs {
+		entries, err := os.ReadDir(filepath.Join(dir, kind.dir))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return specs, err
+		}
+		names := map[string]string{}
+		for _, entry := range entries {
+			ext := strings.ToLower(filepath.Ext(entry.Name()))
+			if entry.IsDir() || (ext != ".json" && ext != ".yml" && ext != ".yaml") {
+				continue
+			}
+			resource, err := loadSearchResource(filepath.Join(dir, kind.dir, entry.Name()), kind.kind)
+			if err != nil {
+				return specs, err
+			}
+			if other, found := names[resource.Name]; found {
+				return specs, fmt.Errorf("%s and %s both declare %s %s", other, resource.Path, kind.kind, resource.Name)
+			}
+			names[resource.Name] = resource.Path
+			specs.Resources = append(specs.Resources, resource)
+		}
+	}
+	entries, err := os.ReadDir(filepath.Join(dir, seedDir))
+	if err != nil && !os.IsNotExist(err) {
+		return specs, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || strings.ToLower(filepath.Ext(entry.Name())) != ".ndjson" {
+			continue
+		}
+		seed, err := loadSeedFile(filepath.Join(dir, seedDir, entry.Name()))
+		if err != nil {
+			return specs, err
+		}
+		specs.Seeds = append(specs.Seeds, seed)
+	}
+	if len(specs.Resources) == 0 && len(specs.Seeds) == 0 {
+		return specs, fmt.Errorf("nothing found in %s - expected component_templates, index_templates, ism_policies, indices or seed directories", dir)
+	}
+	return specs, nil
+}
+
+// canonicalPath puts settings under index. the way OpenSearch returns them,
+// so number_of_replicas and index.number_of_replicas compare the same.
+func canonicalPath(path string) string {
+	parts := strings.Split(path, ".")
+	for i, part := range parts {
+		if part == "settings" && i+1 < len(parts) && parts[i+1] != "index" {
+			canonical := append([]string{}, parts[:i+1]...)
+			canonical = append(canonical, "index")
+			return strings.Join(append(canonical, parts[i+1:]...), ".")
+		}
+	}
+	return path
+}
+
+// flatten adds the leaves of the value to paths, keyed by their dotted path
+// such as mappings.properties.sku.type. Values are compared as strings, since
+// OpenSearch returns settings as strings.
+func flatten(prefix string, value interface{}, paths map[string]string) {
+	join := func(key string) string {
+		if prefix == "" {
+			return key
+		}
+		return prefix + "." + key
+	}
+	switch value := value.(type) {
+	case map[string]interface{}:
+		if len(value) == 0 && prefix != "" {
+			paths[canonicalPath(prefix)] = "{}"
+		}
+		for key, v := range value {
+			flatten(join(key), v, paths)
+		}
+	case []interface{}:
+		if len(value) == 0 {
+			paths[canonicalPath(prefix)] = "[]"
+		}
+		for i, v := range value {
+			flatten(join(strconv.Itoa(i)), v, paths)
+		}
+	default:
+		paths[canonicalPath(prefix)] = fmt.Sprint(value)
+	}
+}
+
+// declaredDiff compares what is declared with what OpenSearch has, ignoring
+// anything OpenSearch has that isn't declared, such as defaults it fills in.
+// It returns the paths that are missing and the paths that differ.
+func declaredDiff(declared interface{}, actual interface{}) ([]string, []string, map[string]string, map[string]string) {
+	want := map[string]string{}
+	have := map[string]string{}
+	flatten("", declared, want)
+	flatten("", actual, have)
+	missing, changed := []string{}, []string{}
+	for _, path := range sortedKeys(want) {
+		value, found := have[path]
+		if !found {
+			// OpenSearch leaves out the type of object fields
+			if strings.HasSuffix(path, ".type") && want[path] == "object" {
+				continue
+			}
+			missing = append(missing, path)
+		} else if value != want[path] {
+			changed = append(changed, path)
+		}
+	}
+	return missing, changed, want, have
+}
+
+// describeDiff lists the differences the way the plan prints them.
+func describeDiff(missing []string, changed []string, want map[string]string, have map[string]string) []string {
+	lines := []string{}
+	for _, path := range missing {
+		lines = append(lines, fmt.Sprintf("+ %s: %s", path, want[path]))
+	}
+	for _, path := range changed {
+		lines = append(lines, fmt.Sprintf("~ %s: %s -> %s", path, have[path], want[path]))
+	}
+	return lines
+}
+
+// searchPath is the API path of a resource.
+func searchPath(resource SearchResource) string {
+	name := url.PathEscape(resource.Name)
+	switch resource.Kind {
+	case ComponentTemplate:
+		return "/_component_template/" + name
+	case IndexTemplate:
+		return "/_index_template/" + name
+	case IsmPolicy:
+		return "/_plugins/_ism/policies/" + name
+	}
+	return "/" + name
+}
+
+// currentResource fetches a resource from OpenSearch in the shape it is
+// declared in, returning nil if it doesn't exist.
+func currentResource(ctx context.Context, base string, resource SearchResource) (map[string]interface{}, error) {
+	result := map[string]interface{}{}
+	err := apiRequest(ctx, http.MethodGet, base+searchPath(resource), "application/json", nil, &result)
+	if notFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting %s %s: %s", resource.Kind, resource.Name, opensearchMessage(err))
+	}
+	unwrap := func(list string, key string) map[string]interface{} {
+		items, _ := result[list].([]interface{})
+		for _, item := range items {
+			if item, ok := item.(map[string]interface{}); ok && item["name"] == resource.Name {
+				body, _ := item[key].(map[string]interface{})
+				return body
+			}
+		}
+		return nil
+	}
+	switch resource.Kind {
+	case ComponentTemplate:
+		return unwrap("component_templates", "component_template"), nil
+	case IndexTemplate:
+		return unwrap("index_templates", "index_template"), nil
+	case SearchIndex:
+		// keyed by the index's name, which differs if the name is an alias
+		for _, body := range result {
+			body, _ := body.(map[string]interface{})
+			return body, nil
+		}
+		return nil, nil
+	}
+	return result, nil
+}
+
+// isStaticSetting is whether the setting, a path under settings.index, can
+// only be set when an index is created.
+func isStaticSetting(path string) bool {
+	for _, setting := range staticSettings {
+		if path == setting || (strings.HasSuffix(setting, ".") && strings.HasPrefix(path, setting)) {
+			return true
+		}
+	}
+	return false
+}
+
+// planIndex compares an index with its declaration. Missing fields, changed
+// dynamic settings and missing or changed aliases are updated, while changed
+// field mappings and static settings, which OpenSearch can't change in
+// place, are returned as problems. Mapped fields that aren't declared are
+// reported as drift, unless a template declares them.
+func planIndex(resource SearchResource, current map[string]interface{}, templateFields map[string]string) (SearchChange, *SearchChange, []string) {
+	change := SearchChange{Kind: SearchIndex, Name: resource.Name, Action: SearchUpdate, Path: resource.Path, resource: resource}
+	problems := []string{}
+	declared := map[string]interface{}{}
+	actual := map[string]interface{}{}
+	for _, part := range []string{"mappings", "settings"} {
+		if value, found := resource.Body[part]; found {
+			declared[part] = value
+			actual[part] = current[part]
+		}
+	}
+	missing, changed, want, have := declaredDiff(declared, actual)
+	for _, path := range changed {
+		if strings.HasPrefix(path, "mappings.") {
+			problems = append(problems, fmt.Sprintf("%s: mapping of index %s has drifted: %s is %s, not %s - delete the index and apply again to recreate it",
+				resource.Path, resource.Name, path, have[path], want[path]))
+		} else if isStaticSetting(path) {
+			problems = append(problems, fmt.Sprintf("%s: %s of index %s is %s, not %s, and can only be set when it is created - delete the index and apply again to recreate it",
+				resource.Path, path, resource.Name, have[path], want[path]))
+		}
+	}
+	for _, path := range append(missing, changed...) {
+		if strings.HasPrefix(path, "mappings.") {
+			change.mappings = true
+		} else if !isStaticSetting(path) {
+			if change.settings == nil {
+				change.settings = map[string]string{}
+			}
+			change.settings[strings.TrimPrefix(path, "settings.")] = want[path]
+		} else if !contains(changed, path) {
+			problems = append(problems, fmt.Sprintf("%s: %s of index %s can only be set when it is created - delete the index and apply again to recreate it",
+				resource.Path, path, resource.Name))
+		}
+	}
+	change.Changes = describeDiff(missing, changed, want, have)
+
+	aliases, _ := resource.Body["aliases"].(map[string]interface{})
+	currentAliases, _ := current["aliases"].(map[string]interface{})
+	for _, alias := range sortedKeys(aliases) {
+		existing, found := currentAliases[alias]
+		if !found {
+			change.aliases = append(change.aliases, alias)
+			change.Changes = append(change.Changes, "+ alias "+alias)
+			continue
+		}
+		missing, changed, _, _ := declaredDiff(aliases[alias], existing)
+		if len(missing)+len(changed) > 0 {
+			change.aliases = append(change.aliases, alias)
+			change.Changes = append(change.Changes, "~ alias "+alias)
+		}
+	}
+
+	var drift *SearchChange
+	if declared["mappings"] != nil {
+		// fields dynamic mapping added that aren't declared
+		_, _, declaredFields, actualFields := declaredDiff(declared["mappings"], current["mappings"])
+		undeclared := []string{}
+		for _, path := range sortedKeys(actualFields) {
+			_, declared := declaredFields[path]
+			_, templated := templateFields[path]
+			if !declared && !templated && strings.HasSuffix(path, ".type") && strings.HasPrefix(path, "properties.") {
+				undeclared = append(undeclared, fmt.Sprintf("? mappings.%s: %s", path, actualFields[path]))
+			}
+		}
+		if len(undeclared) > 0 {
+			drift = &SearchChange{Kind: SearchIndex, Name: resource.Name, Action: SearchDrift, Path: resource.Path, Changes: undeclared}
+		}
+	}
+	return change, drift, problems
+}
+
+// documentCount is how many documents the index has, 0 if it doesn't exist.
+func documentCount(ctx context.Context, base string, index string) (int, error) {
+	result := struct {
+		Count int `json:"count"`
+	}{}
+	err := apiRequest(ctx, http.MethodGet, base+"/"+url.PathEscape(index)+"/_count", "application/json", nil, &result)
+	if notFound(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error counting documents in %s: %s", index, opensearchMessage(err))
+	}
+	return result.Count, nil
+}
+
+// PlanSearch compares the specs with OpenSearch and works out what has to be
+// created or updated. Templates and ISM policies that differ from their
+// declarations are replaced. Indices get missing fields, aliases and changed
+// dynamic settings, but mappings that differ from the declared ones can only
+// be fixed by recreating the index, so they are reported as errors. Seed files
+// are loaded into indices that have no documents.
+func PlanSearch(ctx context.Context, compose ComposeInfo, specs SearchSpecs) ([]SearchChange, error) {
+	base, err := opensearchURL(compose, "opensearch")
+	if err != nil {
+		return nil, err
+	}
+	changes := []SearchChange{}
+	drifts := []SearchChange{}
+	problems := []string{}
+	// fields templates declare, which indices needn't declare themselves
+	templateFields := map[string]string{}
+	for _, resource := range specs.Resources {
+		if template, ok := resource.Body["template"].(map[string]interface{}); ok {
+			flatten("", template["mappings"], templateFields)
+		}
+	}
+	for _, resource := range specs.Resources {
+		current, err := currentResource(ctx, base, resource)
+		if err != nil {
+			return nil, err
+		}
+		if current == nil {
+			changes = append(changes, SearchChange{Kind: resource.Kind, Name: resource.Name, Action: SearchCreate, Path: resource.Path, resource: resource})
+			continue
+		}
+		if resource.Kind == SearchIndex {
+			change, drift, indexProblems := planIndex(resource, current, templateFields)
+			problems = append(problems, indexProblems...)
+			if change.mappings || len(change.settings) > 0 || len(change.aliases) > 0 {
+				changes = append(changes, change)
+			}
+			if drift != nil {
+				drifts = append(drifts, *drift)
+			}
+			continue
+		}
+		missing, changed, want, have := declaredDiff(resource.Body, current)
+		if len(missing)+len(changed) == 0 {
+			continue
+		}
+		change := SearchChange{Kind: resource.Kind, Name: resource.Name, Action: SearchUpdate, Path: resource.Path, resource: resource,
+			Changes: describeDiff(missing, changed, want, have)}
+		if resource.Kind == IsmPolicy {
+			seqNo, _ := current["_seq_no"].(float64)
+			primaryTerm, _ := current["_primary_term"].(float64)
+			change.seqNo, change.primaryTerm = int64(seqNo), int64(primaryTerm)
+		}
+		changes = append(changes, change)
+	}
+	for _, seed := range specs.Seeds {
+		count, err := documentCount(ctx, base, seed.Index)
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 && len(seed.operations) > 0 {
+			changes = append(changes, SearchChange{Kind: SearchIndex, Name: seed.Index, Action: SearchSeed, Path: seed.Path,
+				Documents: len(seed.operations), seed: seed})
+		}
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("%s", strings.Join(problems, "\n"))
+	}
+	return append(changes, drifts...), nil
+}
+
+// PrintSearchPlan describes the changes.
+func PrintSearchPlan(w io.Writer, changes []SearchChange) {
+	creates, updates, documents, drifts := 0, 0, 0, 0
+	for _, change := range changes {
+		switch change.Action {
+		case SearchCreate:
+			creates++
+			fmt.Fprintf(w, "+ create %s %s\n", change.Kind, change.Name)
+		case SearchUpdate:
+			updates++
+			fmt.Fprintf(w, "~ update %s %s\n", change.Kind, change.Name)
+		case SearchSeed:
+			documents += change.Documents
+			fmt.Fprintf(w, "  seed %s with %d documents from %s\n", change.Name, change.Documents, change.Path)
+		case SearchDrift:
+			drifts++
+			fmt.Fprintf(w, "! %s %s has fields that aren't declared in %s\n", change.Kind, change.Name, change.Path)
+		}
+		for _, line := range change.Changes {
+			fmt.Fprintf(w, "    %s\n", line)
+		}
+	}
+	if creates+updates+documents == 0 {
+		fmt.Fprintln(w, "OpenSearch is up to date.")
+		return
+	}
+	fmt.Fprintf(w, "Plan: %d to create, %d to update, %d documents to seed.\n", creates, updates, documents)
+}
+
+// bulkFailure is a document a bulk request failed to index.
+type bulkFailure struct {
+	line   int
+	status int
+	reason string
+}
+
+// bulkLoad sends the operations to the index in batches, returning how many
+// succeeded and the ones that failed.
+func bulkLoad(ctx context.Context, base string, index string, operations []bulkOperation) (int, []bulkFailure, error) {
+	loaded := 0
+	failures := []bulkFailure{}
+	for start := 0; start < len(operations); start += bulkBatchSize {
+		batch := operations[start:]
+		if len(batch) > bulkBatchSize {
+			batch = batch[:bulkBatchSize]
+		}
+		body := bytes.Buffer{}
+		for _, operation := range batch {
+			body.Write(operation.action)
+			body.WriteByte('\n')
+			if operation.source != nil {
+				body.Write(operation.source)
+				body.WriteByte('\n')
+			}
+		}
+		result := struct {
+			Items []map[string]struct {
+				Status int `json:"status"`
+				Error  *struct {
+					Type   string `json:"type"`
+					Reason string `json:"reason"`
+				} `json:"error"`
+			} `json:"items"`
+		}{}
+		err := apiRequest(ctx, http.MethodPost, base+"/"+url.PathEscape(index)+"/_bulk", "application/x-ndjson", body.Bytes(), &result)
+		if err != nil {
+			return loaded, failures, fmt.Errorf("error seeding %s: %s", index, opensearchMessage(err))
+		}
+		for i, item := range result.Items {
+			for _, outcome := range item {
+				if outcome.Error == nil {
+					loaded++
+					continue
+				}
+				failures = append(failures, bulkFailure{
+					line:   batch[i].line,
+					status: outcome.Status,
+					reason: outcome.Error.Type + ": " + outcome.Error.Reason,
+				})
+			}
+		}
+	}
+	err := apiRequest(ctx, http.MethodPost, base+"/"+url.PathEscape(index)+"/_refresh", "application/json", nil, nil)
+	if err != nil {
+		return loaded, failures, fmt.Errorf("error refreshing %s: %s", index, opensearchMessage(err))
+	}
+	return loaded, failures, nil
+}
+
+// applySearchChange makes one change.
+func applySearchChange(ctx context.Context, base string, change SearchChange) error {
+	resource := change.resource
+	path := base + searchPath(resource)
+	switch {
+	case change.Action == SearchCreate:
+		return apiRequest(ctx, http.MethodPut, path, "application/json", resource.Body, nil)
+	case resource.Kind == IsmPolicy:
+		path += fmt.Sprintf("?if_seq_no=%d&if_primary_term=%d", change.seqNo, change.primaryTerm)
+		return apiRequest(ctx, http.MethodPut, path, "application/json", resource.Body, nil)
+	case resource.Kind != SearchIndex:
+		return apiRequest(ctx, http.MethodPut, path, "application/json", resource.Body, nil)
+	}
+	if change.mappings {
+		err := apiRequest(ctx, http.MethodPut, path+"/_mapping", "application/json", resource.Body["mappings"], nil)
+		if err != nil {
+			return err
+		}
+	}
+	if len(change.settings) > 0 {
+		err := apiRequest(ctx, http.MethodPut, path+"/_settings", "application/json", change.settings, nil)
+		if err != nil {
+			return err
+		}
+	}
+	if len(change.aliases) > 0 {
+		aliases, _ := resource.Body["aliases"].(map[string]interface{})
+		actions := []interface{}{}
+		for _, alias := range change.aliases {
+			add := map[string]interface{}{"index": resource.Name, "alias": alias}
+			if options, ok := aliases[alias].(map[string]interface{}); ok {
+				for key, value := range options {
+					add[key] = value
+				}
+			}
+			actions = append(actions, map[string]interface{}{"add": add})
+		}
+		err := apiRequest(ctx, http.MethodPost, base+"/_aliases", "application/json", map[string]interface{}{"actions": actions}, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ApplySearch makes the changes in OpenSearch, reporting the documents seeded
+// and any that failed to index to the writer. Documents failing doesn't stop
+// the rest being loaded, but is returned as an error at the end.
+func ApplySearch(ctx context.Context, compose ComposeInfo, changes []SearchChange, w io.Writer) error {
+	if _, dryRun := compose.Runner.(*Plan); dryRun {
+		for _, change := range changes {
+			if change.Action != SearchDrift {
+				dryRunRequest(compose, "opensearch", fmt.Sprintf("%s %s %s", change.Action, change.Kind, change.Name))
+			}
+		}
+		return nil
+	}
+	base, err := opensearchURL(compose, "opensearch")
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, change := range changes {
+		switch change.Action {
+		case SearchCreate, SearchUpdate:
+			err = applySearchChange(ctx, base, change)
+			if err != nil {
+				verb := "creating"
+				if change.Action == SearchUpdate {
+					verb = "updating"
+				}
+				return fmt.Errorf("%s: error %s %s %s: %s", change.Path, verb, change.Kind, change.Name, opensearchMessage(err))
+			}
+		case SearchSeed:
+			loaded, failures, err := bulkLoad(ctx, base, change.Name, change.seed.operations)
+			if err != nil {
+				return fmt.Errorf("%s: %w", change.Path, err)
+			}
+			fmt.Fprintf(w, "Seeded %s with %d of %d documents from %s.\n", change.Name, loaded, change.Documents, change.Path)
+			for _, failure := range failures {
+				fmt.Fprintf(w, "  %s:%d: HTTP %d %s\n", change.Path, failure.line, failure.status, failure.reason)
+			}
+			failed += len(failures)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d documents failed to index", failed)
+	}
+	return nil
+}
+
+// ApplySearchDir plans the changes an OpenSearch directory needs, prints them
+// and applies them.
+func ApplySearchDir(ctx context.Context, compose ComposeInfo, dir string, w io.Writer) error {
+	specs, err := LoadSearchSpecs(dir)
+	if err != nil {
+		return err
+	}
+	changes, err := PlanSearch(ctx, compose, specs)
+	if err != nil {
+		return err
+	}
+	PrintSearchPlan(w, changes)
+	return ApplySearch(ctx, compose, changes, w)
+}
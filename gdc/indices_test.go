@@ -0,0 +1,297 @@
+package gdc
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeFiles writes the files, keyed by their path under dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoadSeedFile(t *testing.T) {
+	type operation struct {
+		Line   int
+		Action string
+		Source string
+	}
+	tests := []struct {
+		name string
+		data string
+		want []operation
+		err  string
+	}{
+		{
+			name: "documents",
+			data: "{\"_id\": \"1\", \"sku\": \"a\"}\n\n{\"sku\": \"b\"}\n",
+			want: []operation{
+				{1, `{"index":{"_id":"1"}}`, `{"sku":"a"}`},
+				{3, `{"index":{}}`, `{"sku":"b"}`},
+			},
+		},
+		{
+			name: "bulk",
+			data: "{\"index\": {\"_id\": \"1\"}}\n{\"sku\": \"a\"}\n{\"delete\": {\"_id\": \"2\"}}\n{\"create\": {}}\n{\"sku\": \"c\"}\n",
+			want: []operation{
+				{1, `{"index": {"_id": "1"}}`, `{"sku": "a"}`},
+				{3, `{"delete": {"_id": "2"}}`, ``},
+				{4, `{"create": {}}`, `{"sku": "c"}`},
+			},
+		},
+		{name: "not json", data: "{\"sku\": \"a\"}\nsku,b\n", err: "products.ndjson:2: invalid character"},
+		{name: "bulk without action", data: "{\"index\": {}}\n{\"sku\": \"a\"}\n{\"sku\": \"b\"}\n", err: "products.ndjson:3: expected a bulk action"},
+		{name: "bulk action at the end", data: "{\"index\": {}}\n", err: "products.ndjson:1: bulk action has no document after it"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "products.ndjson")
+			if err := os.WriteFile(path, []byte(test.data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			seed, err := loadSeedFile(path)
+			if test.err != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), filepath.Join(filepath.Dir(path), test.err)) {
+					t.Fatalf("expected error %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if seed.Index != "products" {
+				t.Errorf("index = %s, want products", seed.Index)
+			}
+			got := []operation{}
+			for _, o := range seed.operations {
+				got = append(got, operation{o.line, string(o.action), string(o.source)})
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadSearchSpecs(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"indices/products.yml":                     "settings:\n  number_of_replicas: 0\n",
+		"indices/README.md":                        "not a resource",
+		"index_templates/logs.json":                `{"index_patterns": ["logs-*"], "priority": 1}`,
+		"component_templates/timestamps.json":      `{"template": {"mappings": {"properties": {"@timestamp": {"type": "date"}}}}}`,
+		"seed/products.ndjson":                     "{\"sku\": \"a\"}\n",
+		"seed/notes.txt":                           "ignored",
+		"ism_policies/retention/nested/ignored.js": "ignored",
+	})
+	specs, err := LoadSearchSpecs(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resources := []string{}
+	for _, resource := range specs.Resources {
+		resources = append(resources, resource.Kind+" "+resource.Name)
+	}
+	want := []string{"component template timestamps", "index template logs", "index products"}
+	if !reflect.DeepEqual(resources, want) {
+		t.Errorf("got resources %q, want %q", resources, want)
+	}
+	// YAML bodies are decoded the way JSON ones are
+	if replicas := specs.Resources[2].Body["settings"].(map[string]interface{})["number_of_replicas"]; replicas != float64(0) {
+		t.Errorf("expected replicas as a JSON number, got %#v", replicas)
+	}
+	if len(specs.Seeds) != 1 || specs.Seeds[0].Index != "products" {
+		t.Errorf("got seeds %+v", specs.Seeds)
+	}
+}
+
+func TestLoadSearchSpecsErrors(t *testing.T) {
+	duplicate := t.TempDir()
+	writeFiles(t, duplicate, map[string]string{"indices/products.json": "{}", "indices/products.yml": "{}"})
+	empty := t.TempDir()
+	writeFiles(t, empty, map[string]string{"mappings/products.json": "{}"})
+	tests := []struct {
+		name string
+		dir  string
+		err  string
+	}{
+		{name: "declared twice", dir: duplicate, err: "both declare index products"},
+		{name: "nothing declared", dir: empty, err: "nothing found in " + empty},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := LoadSearchSpecs(test.dir)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("expected error containing %q, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestDeclaredDiff(t *testing.T) {
+	declared := map[string]interface{}{
+		"settings": map[string]interface{}{"number_of_replicas": float64(0), "refresh_interval": "1s"},
+		"mappings": map[string]interface{}{"properties": map[string]interface{}{
+			"sku":     map[string]interface{}{"type": "keyword"},
+			"price":   map[string]interface{}{"type": "float"},
+			"address": map[string]interface{}{"type": "object", "properties": map[string]interface{}{"city": map[string]interface{}{"type": "text"}}},
+		}},
+	}
+	// as OpenSearch returns it: settings as strings under index, defaults
+	// filled in and no type for object fields
+	actual := map[string]interface{}{
+		"settings": map[string]interface{}{"index": map[string]interface{}{"number_of_replicas": "0", "refresh_interval": "30s", "number_of_shards": "1"}},
+		"mappings": map[string]interface{}{"properties": map[string]interface{}{
+			"sku":     map[string]interface{}{"type": "text"},
+			"address": map[string]interface{}{"properties": map[string]interface{}{"city": map[string]interface{}{"type": "text"}}},
+		}},
+	}
+	missing, changed, want, have := declaredDiff(declared, actual)
+	if !reflect.DeepEqual(missing, []string{"mappings.properties.price.type"}) {
+		t.Errorf("missing = %q", missing)
+	}
+	if !reflect.DeepEqual(changed, []string{"mappings.properties.sku.type", "settings.index.refresh_interval"}) {
+		t.Errorf("changed = %q", changed)
+	}
+	lines := describeDiff(missing, changed, want, have)
+	wantLines := []string{
+		"+ mappings.properties.price.type: float",
+		"~ mappings.properties.sku.type: text -> keyword",
+		"~ settings.index.refresh_interval: 30s -> 1s",
+	}
+	if !reflect.DeepEqual(lines, wantLines) {
+		t.Errorf("describeDiff = %q, want %q", lines, wantLines)
+	}
+}
+
+// jsonBody decodes a JSON body the way resources are loaded.
+func jsonBody(t *testing.T, data string) map[string]interface{} {
+	t.Helper()
+	body := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(data), &body); err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func TestPlanIndex(t *testing.T) {
+	current := `{
+		"settings": {"index": {"number_of_shards": "1", "number_of_replicas": "1", "refresh_interval": "1s"}},
+		"mappings": {"properties": {"sku": {"type": "keyword"}, "name": {"type": "text"}, "@timestamp": {"type": "date"}}},
+		"aliases": {"catalog": {}, "search": {"filter": {"term": {"active": true}}}}
+	}`
+	tests := []struct {
+		name     string
+		declared string
+		changes  []string
+		mappings bool
+		settings map[string]string
+		aliases  []string
+		drift    []string
+		problems []string
+	}{
+		{
+			name:     "up to date",
+			declared: `{"settings": {"number_of_replicas": 1}, "mappings": {"properties": {"sku": {"type": "keyword"}, "name": {"type": "text"}}}, "aliases": {"catalog": {}}}`,
+		},
+		{
+			name:     "new field, dynamic setting and aliases",
+			declared: `{"settings": {"number_of_replicas": 0}, "mappings": {"properties": {"sku": {"type": "keyword"}, "name": {"type": "text"}, "price": {"type": "float"}}}, "aliases": {"products": {}, "search": {"filter": {"term": {"active": false}}}}}`,
+			changes: []string{
+				"+ mappings.properties.price.type: float",
+				"~ settings.index.number_of_replicas: 1 -> 0",
+				"+ alias products",
+				"~ alias search",
+			},
+			mappings: true,
+			settings: map[string]string{"index.number_of_replicas": "0"},
+			aliases:  []string{"products", "search"},
+		},
+		{
+			name:     "undeclared fields",
+			declared: `{"mappings": {"properties": {"sku": {"type": "keyword"}}}}`,
+			drift:    []string{"? mappings.properties.name.type: text"},
+		},
+		{
+			name:     "changed mapping and static setting",
+			declared: `{"settings": {"number_of_shards": 3, "codec": "best_compression"}, "mappings": {"properties": {"sku": {"type": "text"}, "name": {"type": "text"}}}}`,
+			changes: []string{
+				"+ settings.index.codec: best_compression",
+				"~ mappings.properties.sku.type: keyword -> text",
+				"~ settings.index.number_of_shards: 1 -> 3",
+			},
+			mappings: true,
+			problems: []string{
+				"indices/products.json: mapping of index products has drifted: mappings.properties.sku.type is keyword, not text - delete the index and apply again to recreate it",
+				"indices/products.json: settings.index.number_of_shards of index products is 1, not 3, and can only be set when it is created - delete the index and apply again to recreate it",
+				"indices/products.json: settings.index.codec of index products can only be set when it is created - delete the index and apply again to recreate it",
+			},
+		},
+	}
+	// @timestamp comes from a template, so it isn't drift
+	templateFields := map[string]string{"properties.@timestamp.type": "date"}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resource := SearchResource{Kind: SearchIndex, Name: "products", Path: "indices/products.json", Body: jsonBody(t, test.declared)}
+			change, drift, problems := planIndex(resource, jsonBody(t, current), templateFields)
+			if !reflect.DeepEqual(change.Changes, test.changes) && len(change.Changes)+len(test.changes) > 0 {
+				t.Errorf("changes = %q, want %q", change.Changes, test.changes)
+			}
+			if change.mappings != test.mappings || !reflect.DeepEqual(change.settings, test.settings) || !reflect.DeepEqual(change.aliases, test.aliases) {
+				t.Errorf("updates mappings %v, settings %v, aliases %q; want %v, %v, %q",
+					change.mappings, change.settings, change.aliases, test.mappings, test.settings, test.aliases)
+			}
+			var driftChanges []string
+			if drift != nil {
+				driftChanges = drift.Changes
+			}
+			if !reflect.DeepEqual(driftChanges, test.drift) {
+				t.Errorf("drift = %q, want %q", driftChanges, test.drift)
+			}
+			if !reflect.DeepEqual(problems, test.problems) && len(problems)+len(test.problems) > 0 {
+				t.Errorf("problems =\n%s\nwant\n%s", strings.Join(problems, "\n"), strings.Join(test.problems, "\n"))
+			}
+		})
+	}
+}
+
+func TestPrintSearchPlan(t *testing.T) {
+	changes := []SearchChange{
+		{Kind: ComponentTemplate, Name: "timestamps", Action: SearchCreate},
+		{Kind: SearchIndex, Name: "products", Action: SearchUpdate, Changes: []string{"+ mappings.properties.price.type: float"}},
+		{Kind: SearchIndex, Name: "products", Action: SearchSeed, Path: "seed/products.ndjson", Documents: 20},
+		{Kind: SearchIndex, Name: "orders", Action: SearchDrift, Path: "indices/orders.json", Changes: []string{"? mappings.properties.note.type: text"}},
+	}
+	var out strings.Builder
+	PrintSearchPlan(&out, changes)
+	want := `+ create component template timestamps
+~ update index products
+    + mappings.properties.price.type: float
+  seed products with 20 documents from seed/products.ndjson
+! index orders has fields that aren't declared in indices/orders.json
+    ? mappings.properties.note.type: text
+Plan: 1 to create, 1 to update, 20 documents to seed.
+`
+	if out.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+	}
+
+	out.Reset()
+	PrintSearchPlan(&out, changes[3:])
+	if !strings.HasSuffix(out.String(), "OpenSearch is up to date.\n") {
+		t.Errorf("expected only drift to leave OpenSearch up to date, got\n%s", out.String())
+	}
+}
@@ -0,0 +1,90 @@
+package gdc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// port the kafka service's broker listens on for clients on the host
+const kafkaPort = 9092
+
+// how long to wait for the broker to accept a connection
+var kafkaDialTimeout = 10 * time.Second
+
+// kafkaClient connects to the requested kafka service's broker. The broker
+// advertises the address it was configured with, which is wrong when its port
+// has been overridden, so as the local cluster has a single broker every
+// connection goes to the address gdc published it on instead.
+func kafkaClient(compose ComposeInfo, opts ...kgo.Opt) (*kgo.Client, error) {
+	address, err := serviceAddress(compose, "kafka", "kafka", kafkaPort)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{Timeout: kafkaDialTimeout}
+	opts = append([]kgo.Opt{
+		kgo.SeedBrokers(address),
+		kgo.Dialer(func(ctx context.Context, network string, host string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, address)
+		}),
+	}, opts...)
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to kafka at %s: %w", address, err)
+	}
+	return client, nil
+}
+
+// kafkaAdmin connects an admin client to the requested kafka service. Close
+// it when done.
+func kafkaAdmin(compose ComposeInfo) (*kadm.Client, error) {
+	client, err := kafkaClient(compose)
+	if err != nil {
+		return nil, err
+	}
+	return kadm.NewClient(client), nil
+}
+
+// offsetsAt lists the offsets of the topics' partitions at a position:
+// earliest, latest, a time (RFC 3339) or a duration before now. From a time,
+// partitions with no messages after it are at their end.
+func offsetsAt(ctx context.Context, admin *kadm.Client, position string, topics ...string) (kadm.ListedOffsets, error) {
+	var offsets kadm.ListedOffsets
+	var err error
+	switch position {
+	case "earliest":
+		offsets, err = admin.ListStartOffsets(ctx, topics...)
+	case "latest":
+		offsets, err = admin.ListEndOffsets(ctx, topics...)
+	default:
+		at, parseErr := time.Parse(time.RFC3339, position)
+		if parseErr != nil {
+			ago, durationErr := time.ParseDuration(position)
+			if durationErr != nil || ago < 0 {
+				return nil, fmt.Errorf("invalid position %s - expected earliest, latest, a time such as 2021-03-04T05:06:07Z or a duration such as 1h", position)
+			}
+			at = time.Now().Add(-ago)
+		}
+		offsets, err = admin.ListOffsetsAfterMilli(ctx, at.UnixMilli(), topics...)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading offsets: %w", err)
+	}
+	for _, partitions := range offsets {
+		for _, offset := range partitions {
+			if errors.Is(offset.Err, kerr.UnknownTopicOrPartition) {
+				return nil, fmt.Errorf("topic %s not found", offset.Topic)
+			}
+			if offset.Err != nil {
+				return nil, fmt.Errorf("error reading offsets of %s: %w", offset.Topic, offset.Err)
+			}
+		}
+	}
+	return offsets, nil
+}
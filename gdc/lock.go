@@ -0,0 +1,81 @@
+package gdc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// how often to retry taking a lock held by another gdc process
+var lockRetryInterval = 200 * time.Millisecond
+
+// gdcDir is where gdc keeps state shared between invocations, ~/.gdc.
+func gdcDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(home, ".gdc")
+	return dir, os.MkdirAll(dir, 0700)
+}
+
+// lockProject takes an exclusive lock for changing the containers, waiting for
+// any other gdc process holding it. All projects share the "global" Compose
+// project, so the lock is per user rather than per repository. The returned
+// function releases it.
+func lockProject(ctx context.Context, compose ComposeInfo) (func(), error) {
+	if _, ok := compose.Runner.(fileWriter); ok {
+		// nothing is changed on a dry run
+		return func() {}, nil
+	}
+	dir, err := gdcDir()
+	if err != nil {
+		return nil, fmt.Errorf("error creating lock: %w", err)
+	}
+	path := filepath.Join(dir, "global.lock")
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("error creating lock: %w", err)
+	}
+
+	waiting := false
+	for {
+		err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, syscall.EWOULDBLOCK) {
+			file.Close()
+			return nil, fmt.Errorf("error taking lock %s: %w", path, err)
+		}
+		if !waiting {
+			waiting = true
+			holder := "another gdc process"
+			if pid, err := ioutil.ReadFile(path); err == nil && len(strings.TrimSpace(string(pid))) > 0 {
+				holder = fmt.Sprintf("gdc (pid %s)", strings.TrimSpace(string(pid)))
+			}
+			fmt.Printf("Waiting for %s to finish...\n", holder)
+		}
+		select {
+		case <-ctx.Done():
+			file.Close()
+			return nil, ctx.Err()
+		case <-time.After(lockRetryInterval):
+		}
+	}
+
+	file.Truncate(0)
+	file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	return func() {
+		file.Truncate(0)
+		syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		file.Close()
+	}, nil
+}
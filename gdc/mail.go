@@ -0,0 +1,319 @@
+package gdc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// port of Mailcatcher's web interface and API
+const mailcatcherPort = 1080
+
+// how often tail and wait check for new messages
+var mailPollInterval = 500 * time.Millisecond
+
+// MailMessage is a message Mailcatcher received.
+type MailMessage struct {
+	ID         int         `json:"id"`
+	Sender     string      `json:"sender"`
+	Recipients []string    `json:"recipients"`
+	Subject    string      `json:"subject"`
+	Size       json.Number `json:"size"`
+	Received   time.Time   `json:"created_at"`
+}
+
+// MailHeader is a header of a message.
+type MailHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// MailAttachment is a file attached to a message.
+type MailAttachment struct {
+	Filename string      `json:"filename"`
+	Type     string      `json:"type"`
+	Size     json.Number `json:"size"`
+}
+
+// MailDetail is a message with its headers, parts and attachments.
+type MailDetail struct {
+	MailMessage
+	// in the order they appear in the message
+	Headers []MailHeader `json:"headers"`
+	// parts the message has, e.g. plain and html
+	Formats     []string         `json:"formats"`
+	Plain       string           `json:"plain,omitempty"`
+	HTML        string           `json:"html,omitempty"`
+	Attachments []MailAttachment `json:"attachments"`
+}
+
+// MailFilter picks messages out by recipient, sender and subject. Empty
+// fields match anything.
+type MailFilter struct {
+	To      string
+	From    string
+	Subject *regexp.Regexp
+}
+
+// mailcatcherURL is the base URL of the requested mailcatcher service's API.
+func mailcatcherURL(compose ComposeInfo) (string, error) {
+	address, err := serviceAddress(compose, "mail", "mailcatcher", mailcatcherPort)
+	if err != nil {
+		return "", err
+	}
+	return "http://" + address, nil
+}
+
+// mailText fetches a text part of a message, such as its plain or html body.
+func mailText(ctx context.Context, url string) (string, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return "", err
+	}
+	if response.StatusCode >= 400 {
+		return "", &APIError{Method: http.MethodGet, URL: url, Status: response.StatusCode, Body: strings.TrimSpace(string(data))}
+	}
+	return string(data), nil
+}
+
+// mailAddress is the bare address in e.g. "<x@example.com>" or
+// "X <x@example.com>".
+func mailAddress(address string) string {
+	if parsed, err := mail.ParseAddress(address); err == nil {
+		return parsed.Address
+	}
+	return strings.Trim(strings.TrimSpace(address), "<>")
+}
+
+// Matches is whether the message passes the filter.
+func (f MailFilter) Matches(message MailMessage) bool {
+	if f.From != "" && !strings.EqualFold(mailAddress(message.Sender), f.From) {
+		return false
+	}
+	if f.To != "" {
+		found := false
+		for _, recipient := range message.Recipients {
+			found = found || strings.EqualFold(mailAddress(recipient), f.To)
+		}
+		if !found {
+			return false
+		}
+	}
+	return f.Subject == nil || f.Subject.MatchString(message.Subject)
+}
+
+// String describes the filter, e.g. "to x@example.com with a subject matching ^Welcome".
+func (f MailFilter) String() string {
+	parts := []string{}
+	if f.To != "" {
+		parts = append(parts, "to "+f.To)
+	}
+	if f.From != "" {
+		parts = append(parts, "from "+f.From)
+	}
+	if f.Subject != nil {
+		parts = append(parts, "with a subject matching "+f.Subject.String())
+	}
+	return strings.Join(parts, " ")
+}
+
+// MailMessages lists the messages Mailcatcher has received, oldest first.
+func MailMessages(ctx context.Context, compose ComposeInfo) ([]MailMessage, error) {
+	base, err := mailcatcherURL(compose)
+	if err != nil {
+		return nil, err
+	}
+	return mailMessages(ctx, base)
+}
+
+func mailMessages(ctx context.Context, base string) ([]MailMessage, error) {
+	messages := []MailMessage{}
+	err := apiRequest(ctx, http.MethodGet, base+"/messages", "application/json", nil, &messages)
+	if err != nil {
+		return nil, fmt.Errorf("error listing messages: %w", err)
+	}
+	sort.SliceStable(messages, func(i, j int) bool {
+		return messages[i].ID < messages[j].ID
+	})
+	return messages, nil
+}
+
+// mailHeaders reads the headers of a message's source in order, unfolding
+// headers that continue over several lines.
+func mailHeaders(source string) []MailHeader {
+	headers := []MailHeader{}
+	scanner := bufio.NewScanner(strings.NewReader(source))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			break
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(headers) > 0 {
+			headers[len(headers)-1].Value += " " + strings.TrimSpace(line)
+			continue
+		}
+		name, value, found := strings.Cut(line, ":")
+		if found {
+			headers = append(headers, MailHeader{Name: name, Value: strings.TrimSpace(value)})
+		}
+	}
+	return headers
+}
+
+// ShowMail fetches a message's headers, plain and html parts and the list of
+// its attachments. The id can be latest for the last message received.
+func ShowMail(ctx context.Context, compose ComposeInfo, id string) (MailDetail, error) {
+	detail := MailDetail{}
+	base, err := mailcatcherURL(compose)
+	if err != nil {
+		return detail, err
+	}
+	if id == "latest" {
+		messages, err := mailMessages(ctx, base)
+		if err != nil {
+			return detail, err
+		}
+		if len(messages) == 0 {
+			return detail, errors.New("no messages have been received")
+		}
+		id = fmt.Sprint(messages[len(messages)-1].ID)
+	}
+	url := base + "/messages/" + id
+	err = apiRequest(ctx, http.MethodGet, url+".json", "application/json", nil, &detail)
+	if notFound(err) {
+		return detail, fmt.Errorf("message %s not found - use mail list to see the messages", id)
+	}
+	if err != nil {
+		return detail, fmt.Errorf("error getting message %s: %w", id, err)
+	}
+	source, err := mailText(ctx, url+".source")
+	if err != nil {
+		return detail, fmt.Errorf("error getting message %s: %w", id, err)
+	}
+	detail.Headers = mailHeaders(source)
+	if contains(detail.Formats, "plain") {
+		if detail.Plain, err = mailText(ctx, url+".plain"); err != nil {
+			return detail, fmt.Errorf("error getting plain part of message %s: %w", id, err)
+		}
+	}
+	if contains(detail.Formats, "html") {
+		if detail.HTML, err = mailText(ctx, url+".html"); err != nil {
+			return detail, fmt.Errorf("error getting html part of message %s: %w", id, err)
+		}
+	}
+	if detail.Attachments == nil {
+		detail.Attachments = []MailAttachment{}
+	}
+	return detail, nil
+}
+
+// ClearMail deletes every message Mailcatcher has received.
+func ClearMail(ctx context.Context, compose ComposeInfo) error {
+	base, err := mailcatcherURL(compose)
+	if err != nil {
+		return err
+	}
+	if dryRunRequest(compose, "mailcatcher", "delete all messages") {
+		return nil
+	}
+	err = apiRequest(ctx, http.MethodDelete, base+"/messages", "application/json", nil, nil)
+	if err != nil {
+		return fmt.Errorf("error clearing messages: %w", err)
+	}
+	return nil
+}
+
+// mailKey tells messages apart even if Mailcatcher reuses IDs after being
+// cleared.
+func mailKey(message MailMessage) string {
+	return fmt.Sprintf("%d@%s", message.ID, message.Received.Format(time.RFC3339Nano))
+}
+
+// TailMail calls found with each message that arrives until the context is
+// done, and with the messages already there first if all is set.
+func TailMail(ctx context.Context, compose ComposeInfo, all bool, found func(MailMessage) error) error {
+	base, err := mailcatcherURL(compose)
+	if err != nil {
+		return err
+	}
+	seen := map[string]bool{}
+	for first := true; ; first = false {
+		messages, err := mailMessages(ctx, base)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, message := range messages {
+			key := mailKey(message)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			if !first || all {
+				if err := found(message); err != nil {
+					return err
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(mailPollInterval):
+		}
+	}
+}
+
+// WaitForMail waits for a message matching the filter, including ones that
+// had arrived before it was called, and returns the first one. It fails if
+// none has arrived by the timeout.
+func WaitForMail(ctx context.Context, compose ComposeInfo, filter MailFilter, timeout time.Duration) (MailMessage, error) {
+	base, err := mailcatcherURL(compose)
+	if err != nil {
+		return MailMessage{}, err
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		messages, err := mailMessages(ctx, base)
+		if err != nil {
+			return MailMessage{}, err
+		}
+		for _, message := range messages {
+			if filter.Matches(message) {
+				return message, nil
+			}
+		}
+		if !time.Now().Before(deadline) {
+			description := "no message"
+			if filter.String() != "" {
+				description += " " + filter.String()
+			}
+			return MailMessage{}, fmt.Errorf("%s arrived within %s", description, timeout)
+		}
+		select {
+		case <-ctx.Done():
+			return MailMessage{}, ctx.Err()
+		case <-time.After(mailPollInterval):
+		}
+	}
+}
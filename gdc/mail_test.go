@@ -0,0 +1,303 @@
+package gdc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeMailcatcher is enough of Mailcatcher's API to list, show and clear
+// messages.
+type fakeMailcatcher struct {
+	mutex    sync.Mutex
+	messages []MailMessage
+	sources  map[int]string
+	nextID   int
+}
+
+func newFakeMailcatcher(t *testing.T) (*fakeMailcatcher, ComposeInfo) {
+	t.Helper()
+	mailcatcher := &fakeMailcatcher{sources: map[int]string{}, nextID: 1}
+	server := httptest.NewServer(mailcatcher)
+	t.Cleanup(server.Close)
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	compose := ComposeInfo{
+		MainFile:          []byte(fmt.Sprintf("services:\n  mailcatcher:\n    image: sj26/mailcatcher\n    ports: [\"%s:1080\"]\n", port)),
+		RequestedServices: []string{"mailcatcher"},
+		Runner:            &RecordingRunner{},
+	}
+	interval := mailPollInterval
+	mailPollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { mailPollInterval = interval })
+	return mailcatcher, compose
+}
+
+// deliver a message given as its source.
+func (m *fakeMailcatcher) deliver(from string, to []string, subject string, source string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.messages = append(m.messages, MailMessage{
+		ID:         m.nextID,
+		Sender:     from,
+		Recipients: to,
+		Subject:    subject,
+		Size:       json.Number(strconv.Itoa(len(source))),
+		Received:   time.Date(2024, 5, 1, 12, 0, m.nextID, 0, time.UTC),
+	})
+	m.sources[m.nextID] = source
+	m.nextID++
+}
+
+func (m *fakeMailcatcher) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if req.URL.Path == "/messages" {
+		switch req.Method {
+		case http.MethodGet:
+			json.NewEncoder(w).Encode(m.messages)
+		case http.MethodDelete:
+			m.messages = nil
+			w.WriteHeader(http.StatusNoContent)
+		}
+		return
+	}
+	name := strings.TrimPrefix(req.URL.Path, "/messages/")
+	idText, format, _ := strings.Cut(name, ".")
+	id, _ := strconv.Atoi(idText)
+	for _, message := range m.messages {
+		if message.ID != id {
+			continue
+		}
+		source := m.sources[id]
+		_, body, _ := strings.Cut(source, "\r\n\r\n")
+		switch format {
+		case "json":
+			json.NewEncoder(w).Encode(MailDetail{MailMessage: message, Formats: []string{"source", "plain"}})
+		case "source":
+			fmt.Fprint(w, source)
+		case "plain":
+			fmt.Fprint(w, body)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNotFound)
+}
+
+func TestMailHeaders(t *testing.T) {
+	source := "From: Flipp <noreply@example.com>\r\n" +
+		"To: a@example.com,\r\n" +
+		"\tb@example.com\r\n" +
+		"Subject: Your weekly\r\n" +
+		"  flyers are here\r\n" +
+		"X-Empty:\r\n" +
+		"\r\n" +
+		"Body: not a header\r\n"
+	want := []MailHeader{
+		{Name: "From", Value: "Flipp <noreply@example.com>"},
+		{Name: "To", Value: "a@example.com, b@example.com"},
+		{Name: "Subject", Value: "Your weekly flyers are here"},
+		{Name: "X-Empty", Value: ""},
+	}
+	if got := mailHeaders(source); !reflect.DeepEqual(got, want) {
+		t.Errorf("headers = %q, want %q", got, want)
+	}
+}
+
+func TestMailFilter(t *testing.T) {
+	message := MailMessage{
+		Sender:     "<noreply@example.com>",
+		Recipients: []string{"<a@example.com>", "Bea Smith <B@Example.com>"},
+		Subject:    "Welcome to Flipp",
+	}
+	tests := []struct {
+		name    string
+		filter  MailFilter
+		matches bool
+		str     string
+	}{
+		{name: "everything", filter: MailFilter{}, matches: true, str: ""},
+		{name: "recipient", filter: MailFilter{To: "a@example.com"}, matches: true, str: "to a@example.com"},
+		{name: "named recipient", filter: MailFilter{To: "b@example.com"}, matches: true, str: "to b@example.com"},
+		{name: "other recipient", filter: MailFilter{To: "c@example.com"}, matches: false, str: "to c@example.com"},
+		{name: "sender", filter: MailFilter{From: "NoReply@example.com"}, matches: true, str: "from NoReply@example.com"},
+		{name: "other sender", filter: MailFilter{From: "a@example.com"}, matches: false, str: "from a@example.com"},
+		{name: "subject", filter: MailFilter{Subject: regexp.MustCompile("^Welcome")}, matches: true, str: "with a subject matching ^Welcome"},
+		{name: "other subject", filter: MailFilter{Subject: regexp.MustCompile("^Flipp")}, matches: false, str: "with a subject matching ^Flipp"},
+		{
+			name:    "all of them",
+			filter:  MailFilter{To: "b@example.com", From: "noreply@example.com", Subject: regexp.MustCompile("(?i)flipp$")},
+			matches: true,
+			str:     "to b@example.com from noreply@example.com with a subject matching (?i)flipp$",
+		},
+		{
+			name:    "all but one",
+			filter:  MailFilter{To: "b@example.com", From: "noreply@example.com", Subject: regexp.MustCompile("Goodbye")},
+			matches: false,
+			str:     "to b@example.com from noreply@example.com with a subject matching Goodbye",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.filter.Matches(message); got != test.matches {
+				t.Errorf("Matches = %v, want %v", got, test.matches)
+			}
+			if got := test.filter.String(); got != test.str {
+				t.Errorf("String = %q, want %q", got, test.str)
+			}
+		})
+	}
+}
+
+func TestMailMessages(t *testing.T) {
+	mailcatcher, compose := newFakeMailcatcher(t)
+	mailcatcher.deliver("<a@example.com>", []string{"<b@example.com>"}, "First", "Subject: First\r\n\r\nHi\r\n")
+	mailcatcher.deliver("<a@example.com>", []string{"<b@example.com>"}, "Second", "Subject: Second\r\n\r\nHi again\r\n")
+	// Mailcatcher lists the newest first
+	mailcatcher.messages[0], mailcatcher.messages[1] = mailcatcher.messages[1], mailcatcher.messages[0]
+
+	messages, err := MailMessages(context.Background(), compose)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 || messages[0].Subject != "First" || messages[1].Subject != "Second" {
+		t.Errorf("expected the messages oldest first, got %+v", messages)
+	}
+}
+
+func TestShowMail(t *testing.T) {
+	mailcatcher, compose := newFakeMailcatcher(t)
+	ctx := context.Background()
+	if _, err := ShowMail(ctx, compose, "latest"); err == nil || err.Error() != "no messages have been received" {
+		t.Errorf("expected no messages, got %v", err)
+	}
+	mailcatcher.deliver("<a@example.com>", []string{"<b@example.com>"}, "First", "Subject: First\r\n\r\nHi\r\n")
+	mailcatcher.deliver("<a@example.com>", []string{"<b@example.com>"}, "Second", "Subject: Second\r\nX-Campaign: spring\r\n\r\nHi again\r\n")
+
+	detail, err := ShowMail(ctx, compose, "latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if detail.ID != 2 || detail.Plain != "Hi again\r\n" || detail.HTML != "" {
+		t.Errorf("got message %d with plain %q and html %q", detail.ID, detail.Plain, detail.HTML)
+	}
+	headers := []MailHeader{{Name: "Subject", Value: "Second"}, {Name: "X-Campaign", Value: "spring"}}
+	if !reflect.DeepEqual(detail.Headers, headers) {
+		t.Errorf("headers = %q, want %q", detail.Headers, headers)
+	}
+	if detail.Attachments == nil {
+		t.Error("expected an empty list of attachments")
+	}
+
+	if detail, err = ShowMail(ctx, compose, "1"); err != nil || detail.Subject != "First" {
+		t.Errorf("expected the first message, got %+v, %v", detail, err)
+	}
+	_, err = ShowMail(ctx, compose, "7")
+	if err == nil || !strings.Contains(err.Error(), "message 7 not found") {
+		t.Errorf("expected message 7 not to be found, got %v", err)
+	}
+}
+
+func TestClearMail(t *testing.T) {
+	mailcatcher, compose := newFakeMailcatcher(t)
+	mailcatcher.deliver("<a@example.com>", []string{"<b@example.com>"}, "First", "Subject: First\r\n\r\nHi\r\n")
+
+	plan := &Plan{}
+	dryRun := compose
+	dryRun.Runner = plan
+	if err := ClearMail(context.Background(), dryRun); err != nil {
+		t.Fatal(err)
+	}
+	if len(mailcatcher.messages) != 1 {
+		t.Error("expected a dry run to leave the messages")
+	}
+	if err := ClearMail(context.Background(), compose); err != nil {
+		t.Fatal(err)
+	}
+	if len(mailcatcher.messages) != 0 {
+		t.Errorf("expected the messages to be cleared, got %+v", mailcatcher.messages)
+	}
+}
+
+func TestWaitForMail(t *testing.T) {
+	mailcatcher, compose := newFakeMailcatcher(t)
+	mailcatcher.deliver("<noreply@example.com>", []string{"<a@example.com>"}, "Welcome", "Subject: Welcome\r\n\r\nHi\r\n")
+	filter := MailFilter{To: "b@example.com", Subject: regexp.MustCompile("^Reset")}
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		mailcatcher.deliver("<noreply@example.com>", []string{"Bea <b@example.com>"}, "Welcome", "Subject: Welcome\r\n\r\nHi\r\n")
+		mailcatcher.deliver("<noreply@example.com>", []string{"Bea <b@example.com>"}, "Reset your password", "Subject: Reset\r\n\r\nHi\r\n")
+	}()
+
+	message, err := WaitForMail(context.Background(), compose, filter, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message.ID != 3 {
+		t.Errorf("expected message 3, got %+v", message)
+	}
+
+	// messages that arrived before waiting count too
+	message, err = WaitForMail(context.Background(), compose, MailFilter{To: "a@example.com"}, time.Second)
+	if err != nil || message.ID != 1 {
+		t.Errorf("expected message 1, got %+v, %v", message, err)
+	}
+}
+
+func TestWaitForMailTimeout(t *testing.T) {
+	mailcatcher, compose := newFakeMailcatcher(t)
+	mailcatcher.deliver("<noreply@example.com>", []string{"<a@example.com>"}, "Welcome", "Subject: Welcome\r\n\r\nHi\r\n")
+
+	_, err := WaitForMail(context.Background(), compose, MailFilter{To: "b@example.com"}, 50*time.Millisecond)
+	if err == nil || err.Error() != "no message to b@example.com arrived within 50ms" {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+	_, err = WaitForMail(context.Background(), compose, MailFilter{From: "nobody@example.com"}, 0)
+	if err == nil || err.Error() != "no message from nobody@example.com arrived within 0s" {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+}
+
+func TestTailMail(t *testing.T) {
+	for _, all := range []bool{false, true} {
+		t.Run(fmt.Sprintf("all %v", all), func(t *testing.T) {
+			mailcatcher, compose := newFakeMailcatcher(t)
+			mailcatcher.deliver("<a@example.com>", []string{"<b@example.com>"}, "Old", "Subject: Old\r\n\r\nHi\r\n")
+			go func() {
+				time.Sleep(30 * time.Millisecond)
+				mailcatcher.deliver("<a@example.com>", []string{"<b@example.com>"}, "New", "Subject: New\r\n\r\nHi\r\n")
+			}()
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			subjects := []string{}
+			err := TailMail(ctx, compose, all, func(message MailMessage) error {
+				subjects = append(subjects, message.Subject)
+				if message.Subject == "New" {
+					cancel()
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []string{"New"}
+			if all {
+				want = []string{"Old", "New"}
+			}
+			if !reflect.DeepEqual(subjects, want) {
+				t.Errorf("got %q, want %q", subjects, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,394 @@
+package gdc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// Message is a kafka message as consume writes it and produce reads it, one
+// per line. A key or value that is JSON is written as is, and anything else as
+// a string.
+type Message struct {
+	Topic     string          `json:"topic,omitempty"`
+	Partition int32           `json:"partition"`
+	Offset    int64           `json:"offset"`
+	Timestamp time.Time       `json:"timestamp"`
+	Key       json.RawMessage `json:"key,omitempty"`
+	// null for a tombstone
+	Value   json.RawMessage   `json:"value"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// ProduceOptions are options for producing messages.
+type ProduceOptions struct {
+	// each line is a message's value rather than a Message
+	Values bool
+	// key for every message when Values is set
+	Key string
+	// FormatJSON or FormatAvro
+	KeyFormat   string
+	ValueFormat string
+	// subjects whose latest schemas Avro is encoded with, <topic>-key and
+	// <topic>-value by default
+	KeySubject   string
+	ValueSubject string
+}
+
+// ConsumeOptions are options for consuming messages.
+type ConsumeOptions struct {
+	// earliest, latest, a time (RFC 3339) or a duration before now
+	From string
+	// keep waiting for new messages instead of stopping at the end of the
+	// topic; always the case from latest
+	Follow bool
+	// stop after this many messages, if more than 0
+	Max int
+	// only messages with this key
+	Key string
+	// only messages with these headers, as name or name=value
+	Headers []string
+	// FormatJSON or FormatAvro
+	KeyFormat   string
+	ValueFormat string
+}
+
+func validFormat(format string) error {
+	if format != FormatJSON && format != FormatAvro && format != "" {
+		return fmt.Errorf("unknown message format %s - expected %s or %s", format, FormatJSON, FormatAvro)
+	}
+	return nil
+}
+
+// toJSON is the data as JSON: as is if it is JSON already, or as a string.
+func toJSON(data []byte) json.RawMessage {
+	if json.Valid(data) {
+		return json.RawMessage(data)
+	}
+	str, _ := json.Marshal(string(data))
+	return str
+}
+
+// fromJSON is the inverse of toJSON: strings are sent as they are, and other
+// JSON compacted.
+func fromJSON(value json.RawMessage) ([]byte, error) {
+	var str string
+	if err := json.Unmarshal(value, &str); err == nil {
+		return []byte(str), nil
+	}
+	buf := bytes.Buffer{}
+	err := json.Compact(&buf, value)
+	return buf.Bytes(), err
+}
+
+// parseMessage reads a line in the format consume writes. Unknown fields are
+// refused so a mistyped line isn't sent, and the value must be given: null
+// for a tombstone.
+func parseMessage(text []byte) (Message, error) {
+	message := Message{}
+	decoder := json.NewDecoder(bytes.NewReader(text))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&message); err != nil {
+		return message, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return message, errors.New("unexpected data after the message")
+	}
+	if message.Value == nil {
+		return message, errors.New(`no "value" - use null for a tombstone, or --values if each line is a value`)
+	}
+	return message, nil
+}
+
+// ProduceMessages sends each line of the reader to the topic, returning how
+// many were sent.
+func ProduceMessages(ctx context.Context, compose ComposeInfo, topic string, opts ProduceOptions, r io.Reader) (int, error) {
+	if err := validFormat(opts.KeyFormat); err != nil {
+		return 0, err
+	}
+	if err := validFormat(opts.ValueFormat); err != nil {
+		return 0, err
+	}
+	if opts.KeySubject == "" {
+		opts.KeySubject = topic + "-key"
+	}
+	if opts.ValueSubject == "" {
+		opts.ValueSubject = topic + "-value"
+	}
+	if dryRunRequest(compose, "kafka", "produce messages to "+topic) {
+		return 0, nil
+	}
+	var serde *avroSerde
+	if opts.KeyFormat == FormatAvro || opts.ValueFormat == FormatAvro {
+		var err error
+		serde, err = newAvroSerde(ctx, compose)
+		if err != nil {
+			return 0, err
+		}
+	}
+	encode := func(data json.RawMessage, format string, subject string) ([]byte, error) {
+		if data == nil || string(data) == "null" {
+			return nil, nil
+		}
+		if format == FormatAvro {
+			return serde.encode(subject, data)
+		}
+		return fromJSON(data)
+	}
+
+	client, err := kafkaClient(compose, kgo.DefaultProduceTopic(topic), kgo.AllowAutoTopicCreation())
+	if err != nil {
+		return 0, err
+	}
+	defer client.Close()
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	records := []*kgo.Record{}
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		message := Message{}
+		if opts.Values {
+			message.Value = toJSON(text)
+			if opts.Key != "" {
+				message.Key, _ = json.Marshal(opts.Key)
+			}
+		} else if message, err = parseMessage(text); err != nil {
+			return 0, fmt.Errorf("line %d: %w", line, err)
+		}
+		record := &kgo.Record{Timestamp: message.Timestamp}
+		record.Key, err = encode(message.Key, opts.KeyFormat, opts.KeySubject)
+		if err != nil {
+			return 0, fmt.Errorf("line %d: key %w", line, err)
+		}
+		record.Value, err = encode(message.Value, opts.ValueFormat, opts.ValueSubject)
+		if err != nil {
+			return 0, fmt.Errorf("line %d: value %w", line, err)
+		}
+		for name, value := range message.Headers {
+			record.Headers = append(record.Headers, kgo.RecordHeader{Key: name, Value: []byte(value)})
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	err = client.ProduceSync(ctx, records...).FirstErr()
+	if errors.Is(err, kerr.UnknownTopicOrPartition) {
+		return 0, fmt.Errorf("topic %s not found - create it with kafka topics apply", topic)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error producing to %s: %w", topic, err)
+	}
+	return len(records), nil
+}
+
+// consumeStart is the offset of each partition of the topic to start
+// consuming from, and the end offset of each partition.
+func consumeStart(ctx context.Context, compose ComposeInfo, topic string, from string) (map[int32]int64, map[int32]int64, error) {
+	admin, err := kafkaAdmin(compose)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer admin.Close()
+	if from == "" {
+		from = "earliest"
+	}
+	ends, err := offsetsAt(ctx, admin, "latest", topic)
+	if err != nil {
+		return nil, nil, err
+	}
+	starts, err := offsetsAt(ctx, admin, from, topic)
+	if err != nil {
+		return nil, nil, err
+	}
+	start := map[int32]int64{}
+	end := map[int32]int64{}
+	for partition, offset := range ends[topic] {
+		end[partition] = offset.Offset
+		start[partition] = starts[topic][partition].Offset
+	}
+	if len(end) == 0 {
+		return nil, nil, fmt.Errorf("topic %s not found", topic)
+	}
+	return start, end, nil
+}
+
+// headerFilter is whether the record has the headers, given as name or
+// name=value.
+func headerFilter(record *kgo.Record, headers []string) bool {
+	for _, header := range headers {
+		name, value, hasValue := strings.Cut(header, "=")
+		found := false
+		for _, h := range record.Headers {
+			if h.Key == name && (!hasValue || string(h.Value) == value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// consumeEnds tracks which partitions still have offsets to read before the
+// end offsets consume started with.
+type consumeEnds struct {
+	end       map[int32]int64
+	remaining map[int32]bool
+}
+
+func newConsumeEnds(start map[int32]int64, end map[int32]int64) consumeEnds {
+	ends := consumeEnds{end: end, remaining: map[int32]bool{}}
+	for partition, offset := range start {
+		if offset < end[partition] {
+			ends.remaining[partition] = true
+		}
+	}
+	return ends
+}
+
+// done is whether every partition has been read to its end.
+func (e consumeEnds) done() bool {
+	return len(e.remaining) == 0
+}
+
+// read moves the partition's position past the record, returning whether the
+// record is before the end. The position only reaches the end through the
+// records returned, so control records such as transaction markers, which
+// take up offsets without being messages, must be read too.
+func (e consumeEnds) read(record *kgo.Record) bool {
+	if !e.remaining[record.Partition] {
+		return false
+	}
+	if record.Offset+1 >= e.end[record.Partition] {
+		delete(e.remaining, record.Partition)
+	}
+	return record.Offset < e.end[record.Partition]
+}
+
+// ConsumeMessages writes the topic's messages to the writer as JSON lines,
+// returning how many were written. Unless following, it stops at the end of
+// the topic as it was when it started.
+func ConsumeMessages(ctx context.Context, compose ComposeInfo, topic string, opts ConsumeOptions, w io.Writer) (int, error) {
+	if err := validFormat(opts.KeyFormat); err != nil {
+		return 0, err
+	}
+	if err := validFormat(opts.ValueFormat); err != nil {
+		return 0, err
+	}
+	start, end, err := consumeStart(ctx, compose, topic, opts.From)
+	if err != nil {
+		return 0, err
+	}
+	follow := opts.Follow || opts.From == "latest"
+	ends := newConsumeEnds(start, end)
+	offsets := map[int32]kgo.Offset{}
+	for partition, offset := range start {
+		offsets[partition] = kgo.NewOffset().At(offset)
+	}
+	if !follow && ends.done() {
+		return 0, nil
+	}
+
+	var serde *avroSerde
+	if opts.KeyFormat == FormatAvro || opts.ValueFormat == FormatAvro {
+		serde, err = newAvroSerde(ctx, compose)
+		if err != nil {
+			return 0, err
+		}
+	}
+	decode := func(record *kgo.Record, data []byte, format string, part string) (json.RawMessage, error) {
+		if data == nil {
+			return nil, nil
+		}
+		if format != FormatAvro {
+			return toJSON(data), nil
+		}
+		value, err := serde.decode(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s at offset %d of partition %d: %w", part, record.Offset, record.Partition, err)
+		}
+		return value, nil
+	}
+
+	// control records are kept so their offsets count towards the end
+	client, err := kafkaClient(compose, kgo.ConsumePartitions(map[string]map[int32]kgo.Offset{topic: offsets}), kgo.KeepControlRecords())
+	if err != nil {
+		return 0, err
+	}
+	defer client.Close()
+
+	encoder := json.NewEncoder(w)
+	count := 0
+	for follow || !ends.done() {
+		fetches := client.PollFetches(ctx)
+		if err := ctx.Err(); err != nil {
+			if errors.Is(err, context.Canceled) && follow {
+				return count, nil
+			}
+			return count, err
+		}
+		if err := fetches.Err(); err != nil {
+			return count, fmt.Errorf("error consuming from %s: %w", topic, err)
+		}
+		for _, record := range fetches.Records() {
+			if !follow && !ends.read(record) {
+				continue
+			}
+			if record.Attrs.IsControl() || !headerFilter(record, opts.Headers) {
+				continue
+			}
+			message := Message{
+				Topic:     record.Topic,
+				Partition: record.Partition,
+				Offset:    record.Offset,
+				Timestamp: record.Timestamp,
+			}
+			message.Key, err = decode(record, record.Key, opts.KeyFormat, "key")
+			if err != nil {
+				return count, err
+			}
+			if opts.Key != "" {
+				// compared as produce would send it, so Avro keys match too
+				if key, _ := fromJSON(message.Key); message.Key == nil || string(key) != opts.Key {
+					continue
+				}
+			}
+			message.Value, err = decode(record, record.Value, opts.ValueFormat, "value")
+			if err != nil {
+				return count, err
+			}
+			for _, header := range record.Headers {
+				if message.Headers == nil {
+					message.Headers = map[string]string{}
+				}
+				message.Headers[header.Key] = string(header.Value)
+			}
+			if err := encoder.Encode(message); err != nil {
+				return count, err
+			}
+			count++
+			if opts.Max > 0 && count >= opts.Max {
+				return count, nil
+			}
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,163 @@
+package gdc
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func TestParseMessage(t *testing.T) {
+	tests := []struct {
+		name  string
+		line  string
+		key   string
+		value string
+		err   string
+	}{
+		{
+			name:  "key and value",
+			line:  `{"key": "order-1", "value": {"id": 1}, "headers": {"source": "cli"}}`,
+			key:   `"order-1"`,
+			value: `{"id": 1}`,
+		},
+		{
+			name:  "tombstone",
+			line:  `{"key": "order-1", "value": null}`,
+			key:   `"order-1"`,
+			value: "null",
+		},
+		{
+			name:  "as consume writes it",
+			line:  `{"topic":"orders","partition":0,"offset":3,"timestamp":"2024-01-02T03:04:05Z","value":"x"}`,
+			value: `"x"`,
+		},
+		{
+			name: "no value",
+			line: `{"key": "order-1", "headers": {"source": "cli"}}`,
+			err:  `no "value"`,
+		},
+		{
+			name: "mistyped field",
+			line: `{"key": "order-1", "vaule": 1}`,
+			err:  `unknown field "vaule"`,
+		},
+		{
+			name: "not an object",
+			line: `{"id": 1}`,
+			err:  `unknown field "id"`,
+		},
+		{
+			name: "trailing data",
+			line: `{"value": 1} {"value": 2}`,
+			err:  "unexpected data",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			message, err := parseMessage([]byte(test.line))
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected an error containing %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(message.Key) != test.key || string(message.Value) != test.value {
+				t.Errorf("got key %s value %s, want key %s value %s", message.Key, message.Value, test.key, test.value)
+			}
+		})
+	}
+}
+
+func TestConsumeEnds(t *testing.T) {
+	tests := []struct {
+		name  string
+		start map[int32]int64
+		end   map[int32]int64
+		// offsets returned by the client, keyed by partition
+		records map[int32][]int64
+		kept    map[int32][]int64
+		done    bool
+	}{
+		{
+			name:    "read to the end",
+			start:   map[int32]int64{0: 0, 1: 0},
+			end:     map[int32]int64{0: 2, 1: 1},
+			records: map[int32][]int64{0: {0, 1}, 1: {0}},
+			kept:    map[int32][]int64{0: {0, 1}, 1: {0}},
+			done:    true,
+		},
+		{
+			name:    "not yet at the end",
+			start:   map[int32]int64{0: 0},
+			end:     map[int32]int64{0: 3},
+			records: map[int32][]int64{0: {0, 1}},
+			kept:    map[int32][]int64{0: {0, 1}},
+		},
+		{
+			// offset 2 is a transaction's commit marker, a control record
+			// the client returns along with the messages
+			name:    "commit marker at the tail",
+			start:   map[int32]int64{0: 0},
+			end:     map[int32]int64{0: 3},
+			records: map[int32][]int64{0: {0, 1, 2}},
+			kept:    map[int32][]int64{0: {0, 1, 2}},
+			done:    true,
+		},
+		{
+			name:    "only a marker left",
+			start:   map[int32]int64{0: 2},
+			end:     map[int32]int64{0: 3},
+			records: map[int32][]int64{0: {2}},
+			kept:    map[int32][]int64{0: {2}},
+			done:    true,
+		},
+		{
+			// compaction leaves gaps in the offsets
+			name:    "gap before the tail",
+			start:   map[int32]int64{0: 0},
+			end:     map[int32]int64{0: 6},
+			records: map[int32][]int64{0: {0, 1, 5}},
+			kept:    map[int32][]int64{0: {0, 1, 5}},
+			done:    true,
+		},
+		{
+			name:    "records after the end",
+			start:   map[int32]int64{0: 0},
+			end:     map[int32]int64{0: 2},
+			records: map[int32][]int64{0: {0, 3, 4}},
+			kept:    map[int32][]int64{0: {0}},
+			done:    true,
+		},
+		{
+			name:  "empty partitions",
+			start: map[int32]int64{0: 4, 1: 0},
+			end:   map[int32]int64{0: 4, 1: 0},
+			kept:  map[int32][]int64{},
+			done:  true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ends := newConsumeEnds(test.start, test.end)
+			kept := map[int32][]int64{}
+			for partition, offsets := range test.records {
+				for _, offset := range offsets {
+					if ends.read(&kgo.Record{Partition: partition, Offset: offset}) {
+						kept[partition] = append(kept[partition], offset)
+					}
+				}
+			}
+			if !reflect.DeepEqual(kept, test.kept) {
+				t.Errorf("kept %v, want %v", kept, test.kept)
+			}
+			if ends.done() != test.done {
+				t.Errorf("done = %v, want %v", ends.done(), test.done)
+			}
+		})
+	}
+}
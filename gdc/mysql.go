@@ -0,0 +1,306 @@
+package gdc
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// MysqlDumpOptions control what MysqlDump dumps and where to.
+type MysqlDumpOptions struct {
+	// databases to dump, or all of them if empty
+	Databases []string
+	// file to write to, compressed if it ends in .gz or .zst, or stdout if
+	// empty or "-"
+	Output string
+	// where to report progress, if anywhere
+	Progress io.Writer
+}
+
+// MysqlImportOptions control how MysqlImport imports a dump.
+type MysqlImportOptions struct {
+	// database to import into, for dumps that don't select one themselves
+	Database string
+	// create the database first if it doesn't exist
+	CreateDatabase bool
+	// where to report progress, if anywhere
+	Progress io.Writer
+}
+
+// MysqlImportError is returned when MySQL rejects a statement in a dump.
+type MysqlImportError struct {
+	File string
+	// line of the dump the failing statement is on, 0 if unknown
+	Line int
+	// start of the failing statement
+	Statement string
+	Err       error
+}
+
+func (e *MysqlImportError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("error importing %s: %s", e.File, e.Err)
+	}
+	return fmt.Sprintf("error importing %s at line %d: %s\n  %s", e.File, e.Line, e.Err, e.Statement)
+}
+
+func (e *MysqlImportError) Unwrap() error {
+	return e.Err
+}
+
+// mysql reports errors as e.g. "ERROR 1064 (42000) at line 12: ..."
+var mysqlErrorLine = regexp.MustCompile(`ERROR \d+ \(\w+\) at line (\d+)`)
+
+// longest part of a failing statement to show
+const statementPreview = 200
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// compressor for the file name's extension
+func compressor(name string, w io.Writer) (io.WriteCloser, error) {
+	switch {
+	case strings.HasSuffix(name, ".gz"):
+		return gzip.NewWriter(w), nil
+	case strings.HasSuffix(name, ".zst"):
+		return zstd.NewWriter(w)
+	}
+	return nopWriteCloser{w}, nil
+}
+
+// decompressor for the file name's extension
+func decompressor(name string, r io.Reader) (io.ReadCloser, error) {
+	switch {
+	case strings.HasSuffix(name, ".gz"):
+		return gzip.NewReader(r)
+	case strings.HasSuffix(name, ".zst"):
+		decoder, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	}
+	return io.NopCloser(r), nil
+}
+
+// dumpOutput is where a dump or export goes: stdout, a temporary file that
+// replaces a regular output file once it is complete, or a device or pipe
+// such as /dev/null or a FIFO, which is written to directly.
+type dumpOutput struct {
+	io.Writer
+	path string
+	file *os.File
+	// whether file is a temporary file to rename over path
+	temp bool
+}
+
+// createOutput opens the output for a dump, stdout if the path is empty or "-".
+func createOutput(path string) (*dumpOutput, error) {
+	if path == "" || path == "-" {
+		return &dumpOutput{Writer: os.Stdout}, nil
+	}
+	info, err := os.Stat(path)
+	if err == nil && !info.Mode().IsRegular() {
+		file, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			return nil, err
+		}
+		return &dumpOutput{Writer: file, path: path, file: file}, nil
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return nil, err
+	}
+	return &dumpOutput{Writer: file, path: path, file: file, temp: true}, nil
+}
+
+// toStdout is whether the output is stdout, which then carries only the dump.
+func (o *dumpOutput) toStdout() bool {
+	return o.path == ""
+}
+
+// commit finishes the output, moving a temporary file into place.
+func (o *dumpOutput) commit() error {
+	if o.file == nil {
+		return nil
+	}
+	file := o.file
+	o.file = nil
+	if !o.temp {
+		return file.Close()
+	}
+	defer os.Remove(file.Name())
+	err := file.Chmod(0644)
+	if err == nil {
+		err = file.Close()
+	} else {
+		file.Close()
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), o.path)
+}
+
+// discard closes an output that wasn't committed, removing its temporary file.
+func (o *dumpOutput) discard() {
+	if o.file == nil {
+		return
+	}
+	o.file.Close()
+	if o.temp {
+		os.Remove(o.file.Name())
+	}
+	o.file = nil
+}
+
+// MysqlDump dumps databases from the requested MySQL service with mysqldump.
+// A dump to a regular file is written to a temporary file which replaces the
+// output file only once it is complete.
+func MysqlDump(ctx context.Context, compose ComposeInfo, options MysqlDumpOptions) error {
+	service, err := mysqlService(compose)
+	if err != nil {
+		return err
+	}
+	args := []string{"exec", "-T", service, "mysqldump", "--single-transaction", "--no-tablespaces", "--routines"}
+	if len(options.Databases) > 0 {
+		args = append(append(args, "--databases"), options.Databases...)
+	} else {
+		args = append(args, "--all-databases")
+	}
+	cmd := composeCommand(compose, args...)
+	if _, dryRun := compose.Runner.(fileWriter); dryRun {
+		return run(ctx, compose, cmd)
+	}
+
+	out, err := createOutput(options.Output)
+	if err != nil {
+		return err
+	}
+	defer out.discard()
+	writer, err := compressor(options.Output, out)
+	if err != nil {
+		return err
+	}
+	progress := newProgress(options.Progress, "Dumped", 0)
+	cmd.Stdout = progressWriter{writer, progress}
+	// the dump itself may be going to stdout
+	cmd.Quiet = out.toStdout()
+	err = run(ctx, compose, cmd)
+	if err != nil {
+		return err
+	}
+	err = writer.Close()
+	if err != nil {
+		return err
+	}
+	progress.finish()
+	return out.commit()
+}
+
+// MysqlImport imports a dump, which may be compressed with gzip (.gz) or
+// zstd (.zst), into the requested MySQL service. If MySQL rejects a
+// statement, a MysqlImportError gives its line in the dump.
+func MysqlImport(ctx context.Context, compose ComposeInfo, input string, options MysqlImportOptions) error {
+	service, err := mysqlService(compose)
+	if err != nil {
+		return err
+	}
+	if options.CreateDatabase {
+		if options.Database == "" {
+			return errors.New("a --database is needed to create one")
+		}
+		create := fmt.Sprintf("CREATE DATABASE IF NOT EXISTS `%s`", strings.ReplaceAll(options.Database, "`", "``"))
+		err = run(ctx, compose, composeCommand(compose, "exec", "-T", service, "mysql", "-e", create))
+		if err != nil {
+			return err
+		}
+	}
+	args := []string{"exec", "-T", service, "mysql"}
+	if options.Database != "" {
+		args = append(args, options.Database)
+	}
+	cmd := composeCommand(compose, args...)
+	if _, dryRun := compose.Runner.(fileWriter); dryRun {
+		return run(ctx, compose, cmd)
+	}
+
+	file, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	// progress is measured on the file as read, so compressed dumps show
+	// how far through the file the import is
+	progress := newProgress(options.Progress, "Imported", info.Size())
+	reader, err := decompressor(input, progressReader{file, progress})
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", input, err)
+	}
+	defer reader.Close()
+
+	var stderr bytes.Buffer
+	cmd.Stdin = reader
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+	err = run(ctx, compose, cmd)
+	if err != nil {
+		importErr := &MysqlImportError{File: input, Err: err}
+		if match := mysqlErrorLine.FindStringSubmatch(stderr.String()); match != nil {
+			importErr.Line, _ = strconv.Atoi(match[1])
+			importErr.Statement = dumpLine(input, importErr.Line)
+		}
+		return importErr
+	}
+	progress.finish()
+	return nil
+}
+
+// dumpLine reads the start of the line from the dump, which may be huge for
+// extended inserts.
+func dumpLine(input string, line int) string {
+	file, err := os.Open(input)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+	reader, err := decompressor(input, file)
+	if err != nil {
+		return ""
+	}
+	defer reader.Close()
+	buffered := bufio.NewReader(reader)
+	for current := 1; ; current++ {
+		text, err := buffered.ReadString('\n')
+		if current == line {
+			text = strings.TrimRight(text, "\r\n")
+			if len(text) > statementPreview {
+				text = text[:statementPreview] + "..."
+			}
+			return text
+		}
+		if err != nil {
+			return ""
+		}
+	}
+}
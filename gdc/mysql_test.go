@@ -0,0 +1,177 @@
+package gdc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMysqlDumpToFile(t *testing.T) {
+	compose, runner := testComposeInfo(t, "mysql57")
+	dump := composeLine(compose, "exec", "-T", "mysql57", "mysqldump", "--single-transaction", "--no-tablespaces", "--routines", "--databases", "app")
+	runner.Outputs = map[string]string{dump: "CREATE TABLE t (id int);\n"}
+	output := filepath.Join(t.TempDir(), "dump.sql.gz")
+
+	err := MysqlDump(context.Background(), compose, MysqlDumpOptions{Databases: []string{"app"}, Output: output})
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "CREATE TABLE t (id int);\n" {
+		t.Errorf("dump = %q", data)
+	}
+	// only the dump is left in the directory
+	entries, _ := os.ReadDir(filepath.Dir(output))
+	if len(entries) != 1 {
+		t.Errorf("expected only the dump, got %d files", len(entries))
+	}
+}
+
+func TestMysqlDumpToDevice(t *testing.T) {
+	info, err := os.Stat(os.DevNull)
+	if err != nil || info.Mode().IsRegular() {
+		t.Skip("no null device")
+	}
+	compose, runner := testComposeInfo(t, "mysql57")
+	dump := composeLine(compose, "exec", "-T", "mysql57", "mysqldump", "--single-transaction", "--no-tablespaces", "--routines", "--all-databases")
+	runner.Outputs = map[string]string{dump: "CREATE TABLE t (id int);\n"}
+
+	err = MysqlDump(context.Background(), compose, MysqlDumpOptions{Output: os.DevNull})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err = os.Stat(os.DevNull)
+	if err != nil || info.Mode().IsRegular() {
+		t.Errorf("expected %s to be left a device", os.DevNull)
+	}
+}
+
+// writeDump writes a dump, compressed according to its name.
+func writeDump(t *testing.T, name string, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	writer, err := compressor(name, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(writer, data)
+	if err = writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const testDump = "-- MySQL dump\nUSE app;\nINSERT INTO t VALUES (1),(2);\nINSERT INTO t VALUES (3;\n"
+
+func TestMysqlImport(t *testing.T) {
+	for _, name := range []string{"dump.sql", "dump.sql.gz", "dump.sql.zst"} {
+		t.Run(name, func(t *testing.T) {
+			compose, runner := testComposeInfo(t, "mysql57")
+			path := writeDump(t, name, testDump)
+
+			err := MysqlImport(context.Background(), compose, path, MysqlImportOptions{Database: "app"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			mysql := composeLine(compose, "exec", "-T", "mysql57", "mysql", "app")
+			if got := string(runner.Inputs[mysql]); got != testDump {
+				t.Errorf("mysql was given %q, want %q", got, testDump)
+			}
+		})
+	}
+}
+
+func TestMysqlImportCreatesDatabase(t *testing.T) {
+	compose, runner := testComposeInfo(t, "mysql57")
+	path := writeDump(t, "dump.sql", testDump)
+
+	err := MysqlImport(context.Background(), compose, path, MysqlImportOptions{Database: "my`app", CreateDatabase: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	create := composeLine(compose, "exec", "-T", "mysql57", "mysql", "-e", "CREATE DATABASE IF NOT EXISTS `my``app`")
+	if executed := runner.Executed(); len(executed) == 0 || executed[0] != create {
+		t.Errorf("expected the database to be created first, got %q", executed)
+	}
+}
+
+func TestMysqlImportError(t *testing.T) {
+	tests := []struct {
+		name      string
+		stderr    string
+		line      int
+		statement string
+	}{
+		{
+			name:      "line reported",
+			stderr:    "ERROR 1064 (42000) at line 4: You have an error in your SQL syntax\n",
+			line:      4,
+			statement: "INSERT INTO t VALUES (3;",
+		},
+		{
+			name:   "no line",
+			stderr: "ERROR 2002 (HY000): Can't connect to local MySQL server\n",
+		},
+		{
+			name:   "line past the end",
+			stderr: "ERROR 1064 (42000) at line 40: You have an error in your SQL syntax\n",
+			line:   40,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			compose, runner := testComposeInfo(t, "mysql57")
+			path := writeDump(t, "dump.sql.gz", testDump)
+			mysql := composeLine(compose, "exec", "-T", "mysql57", "mysql")
+			runner.ErrorOutputs = map[string]string{mysql: test.stderr}
+			runner.ExitCodes = map[string]int{mysql: 1}
+
+			err := MysqlImport(context.Background(), compose, path, MysqlImportOptions{Progress: &bytes.Buffer{}})
+			importErr := &MysqlImportError{}
+			if !errors.As(err, &importErr) {
+				t.Fatalf("expected a MysqlImportError, got %v", err)
+			}
+			if importErr.File != path || importErr.Line != test.line || importErr.Statement != test.statement {
+				t.Errorf("got line %d %q, want line %d %q", importErr.Line, importErr.Statement, test.line, test.statement)
+			}
+			exitErr := &ExitError{}
+			if !errors.As(err, &exitErr) || exitErr.Code != 1 {
+				t.Errorf("expected the exit error to be wrapped, got %v", err)
+			}
+		})
+	}
+}
+
+func TestDumpLinePreview(t *testing.T) {
+	long := "INSERT INTO t VALUES " + strings.Repeat("(1),", 100)
+	path := writeDump(t, "dump.sql.zst", "USE app;\n"+long+"\n")
+	if got := dumpLine(path, 1); got != "USE app;" {
+		t.Errorf("line 1 = %q", got)
+	}
+	if got := dumpLine(path, 2); got != long[:statementPreview]+"..." {
+		t.Errorf("line 2 = %q", got)
+	}
+}
@@ -0,0 +1,50 @@
+package gdc
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// port OpenSearch's REST API listens on
+const opensearchPort = 9200
+
+// opensearchURL is the base URL of the requested opensearch service's API.
+func opensearchURL(compose ComposeInfo, command string) (string, error) {
+	address, err := serviceAddress(compose, command, "opensearch", opensearchPort)
+	if err != nil {
+		return "", err
+	}
+	return "http://" + address, nil
+}
+
+// opensearchMessage is the reason OpenSearch gave for an API error, such as
+// {"type": "resource_already_exists_exception", "reason": "..."}, or the error
+// itself if it gave none. The SQL and PPL plugins add details.
+func opensearchMessage(err error) string {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return err.Error()
+	}
+	body := struct {
+		Error struct {
+			Type    string `json:"type"`
+			Reason  string `json:"reason"`
+			Details string `json:"details"`
+		} `json:"error"`
+	}{}
+	json.Unmarshal([]byte(apiErr.Body), &body)
+	if body.Error.Reason == "" {
+		return err.Error()
+	}
+	message := body.Error.Type + ": " + body.Error.Reason
+	if body.Error.Details != "" {
+		message += " - " + body.Error.Details
+	}
+	return message
+}
+
+// notFound is whether the error is an HTTP 404.
+func notFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.Status == 404
+}
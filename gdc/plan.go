@@ -0,0 +1,146 @@
+package gdc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PlanStep is a single side effect gdc would have performed.
+type PlanStep struct {
+	Action   string            `json:"action"`
+	Command  string            `json:"command,omitempty"`
+	Pipeline [][]string        `json:"pipeline,omitempty"`
+	Env      map[string]string `json:"env,omitempty"`
+	Path     string            `json:"path,omitempty"`
+	Bytes    int               `json:"bytes,omitempty"`
+	Services []string          `json:"services,omitempty"`
+	Timeout  string            `json:"timeout,omitempty"`
+	Request  string            `json:"request,omitempty"`
+}
+
+// Plan is a Runner that records what would be executed and written without
+// doing any of it. Use it to implement a dry run.
+type Plan struct {
+	Steps []PlanStep `json:"steps"`
+	mutex sync.Mutex
+}
+
+// fileWriter is implemented by runners that want to intercept files gdc
+// generates, rather than having them written to disk.
+type fileWriter interface {
+	WriteFile(name string, data []byte, perm os.FileMode) error
+}
+
+// Run records the command.
+func (p *Plan) Run(ctx context.Context, cmd *Command) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.Steps = append(p.Steps, PlanStep{
+		Action:   "run",
+		Command:  cmd.String(),
+		Pipeline: cmd.Pipeline,
+		Env:      cmd.Env,
+	})
+	return nil
+}
+
+// WriteFile records the file write. Repeated writes to the same path are only
+// recorded once, as gdc reuses a file it has already generated.
+func (p *Plan) WriteFile(name string, data []byte, perm os.FileMode) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for _, step := range p.Steps {
+		if step.Action == "write" && step.Path == name {
+			return nil
+		}
+	}
+	p.Steps = append(p.Steps, PlanStep{
+		Action: "write",
+		Path:   name,
+		Bytes:  len(data),
+	})
+	return nil
+}
+
+// wait records waiting for services to become ready.
+func (p *Plan) wait(services []string, timeout time.Duration) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.Steps = append(p.Steps, PlanStep{
+		Action:   "wait",
+		Services: services,
+		Timeout:  timeout.String(),
+	})
+}
+
+// remove records deleting a file or directory.
+func (p *Plan) remove(path string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.Steps = append(p.Steps, PlanStep{
+		Action: "delete",
+		Path:   path,
+	})
+}
+
+// request records a request that would have been sent to a service's API.
+func (p *Plan) request(service string, request string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.Steps = append(p.Steps, PlanStep{
+		Action:   "request",
+		Services: []string{service},
+		Request:  request,
+	})
+}
+
+// dryRunRequest records the request on a dry run. It returns true if the
+// request was recorded, in which case it must not be sent.
+func dryRunRequest(compose ComposeInfo, service string, request string) bool {
+	plan, ok := compose.Runner.(*Plan)
+	if ok {
+		plan.request(service, request)
+	}
+	return ok
+}
+
+// Print the plan in either "text" or "json" format.
+func (p *Plan) Print(w io.Writer, format string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(p)
+	case "text", "":
+		fmt.Fprintln(w, "Dry run - the following would be performed:")
+		for i, step := range p.Steps {
+			switch step.Action {
+			case "write":
+				fmt.Fprintf(w, "%3d. write %s (%d bytes)\n", i+1, step.Path, step.Bytes)
+			case "delete":
+				fmt.Fprintf(w, "%3d. delete %s\n", i+1, step.Path)
+			case "request":
+				fmt.Fprintf(w, "%3d. call  %s on %s\n", i+1, step.Request, strings.Join(step.Services, ", "))
+			case "wait":
+				fmt.Fprintf(w, "%3d. wait  up to %s for %s to be ready\n", i+1, step.Timeout, strings.Join(step.Services, ", "))
+			default:
+				env := ""
+				for _, key := range sortedKeys(step.Env) {
+					env += fmt.Sprintf("%s=%s ", key, ShellQuote(step.Env[key]))
+				}
+				fmt.Fprintf(w, "%3d. run   %s%s\n", i+1, env, step.Command)
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown plan format %s - expected text or json", format)
+	}
+}
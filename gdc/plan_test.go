@@ -0,0 +1,107 @@
+package gdc
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testPlan() *Plan {
+	plan := &Plan{}
+	plan.WriteFile("/tmp/gdc/docker-compose.yml", []byte("services: {}\n"), 0600)
+	plan.WriteFile("/tmp/gdc/docker-compose.yml", []byte("services: {}\n"), 0600)
+	plan.Run(context.Background(), NewCommand("docker", "compose", "up", "-d", "redis").SetEnv("COMPOSE_PROJECT_NAME", "my app"))
+	plan.Run(context.Background(), NewCommand("aws", "ecr", "get-login-password").Pipe("docker", "login", "--password-stdin", "ecr"))
+	plan.wait([]string{"redis", "kafka"}, 2*time.Minute)
+	plan.request("kafka", "create topic orders")
+	plan.remove("/home/me/.gdc/snapshots/mysql/old")
+	return plan
+}
+
+func TestPlanPrint(t *testing.T) {
+	var out strings.Builder
+	err := testPlan().Print(&out, "text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `Dry run - the following would be performed:
+  1. write /tmp/gdc/docker-compose.yml (13 bytes)
+  2. run   COMPOSE_PROJECT_NAME='my app' docker compose up -d redis
+  3. run   aws ecr get-login-password | docker login --password-stdin ecr
+  4. wait  up to 2m0s for redis, kafka to be ready
+  5. call  create topic orders on kafka
+  6. delete /home/me/.gdc/snapshots/mysql/old
+`
+	if out.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestPlanPrintJSON(t *testing.T) {
+	var out strings.Builder
+	err := testPlan().Print(&out, "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		Steps []PlanStep `json:"steps"`
+	}
+	err = json.Unmarshal([]byte(out.String()), &decoded)
+	if err != nil {
+		t.Fatalf("%v in\n%s", err, out.String())
+	}
+	actions := []string{}
+	for _, step := range decoded.Steps {
+		actions = append(actions, step.Action)
+	}
+	if strings.Join(actions, " ") != "write run run wait request delete" {
+		t.Errorf("got actions %q", actions)
+	}
+	if pipeline := decoded.Steps[2].Pipeline; len(pipeline) != 2 || pipeline[1][0] != "docker" {
+		t.Errorf("expected the pipeline to be kept, got %q", pipeline)
+	}
+	if decoded.Steps[1].Env["COMPOSE_PROJECT_NAME"] != "my app" {
+		t.Errorf("expected the environment to be kept, got %v", decoded.Steps[1].Env)
+	}
+}
+
+func TestPlanPrintUnknownFormat(t *testing.T) {
+	err := testPlan().Print(&strings.Builder{}, "yaml")
+	if err == nil || err.Error() != "unknown plan format yaml - expected text or json" {
+		t.Errorf("expected an unknown format error, got %v", err)
+	}
+}
+
+func TestUpDryRunWritesNothing(t *testing.T) {
+	compose, _ := testComposeInfo(t, "kafka")
+	plan := &Plan{}
+	compose.Runner = plan
+	// other tests may have generated the compose file already
+	os.Remove(generatedPath(outputFile))
+	err := Up(context.Background(), compose, UpOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writes := 0
+	ran := false
+	for _, step := range plan.Steps {
+		switch step.Action {
+		case "write":
+			writes++
+			if _, err := os.Stat(step.Path); err == nil {
+				t.Errorf("dry run wrote %s", step.Path)
+			}
+		case "run":
+			ran = ran || step.Command == composeLine(compose, "up", "-d", "kafka", "zookeeper")
+		}
+	}
+	if writes != 1 {
+		t.Errorf("expected the compose file to be written once, got %d writes in %+v", writes, plan.Steps)
+	}
+	if !ran {
+		t.Errorf("expected compose up in the plan, got %+v", plan.Steps)
+	}
+}
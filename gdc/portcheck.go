@@ -0,0 +1,214 @@
+package gdc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// portConflict is a host port a service wants to publish on which something
+// else is already listening.
+type portConflict struct {
+	service string
+	port    Port
+	owner   string
+}
+
+// portInUse checks whether anything is listening on the host port. Binding
+// alone is not enough, as some platforms let us bind the wildcard address
+// while another process holds the port on 127.0.0.1.
+func portInUse(port int) bool {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return true
+	}
+	listener.Close()
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", port), 200*time.Millisecond)
+	if err == nil {
+		conn.Close()
+		return true
+	}
+	return false
+}
+
+// portOwner tries to find the process listening on the port using lsof. It
+// returns an empty string if it can't tell.
+func portOwner(ctx context.Context, compose ComposeInfo, port int) string {
+	var out bytes.Buffer
+	cmd := NewCommand("lsof", "-nP", fmt.Sprintf("-iTCP:%d", port), "-sTCP:LISTEN", "-Fpc")
+	cmd.Stdout = &out
+	cmd.Stderr = &bytes.Buffer{}
+	cmd.Quiet = true
+	if compose.runner().Run(ctx, cmd) != nil {
+		return ""
+	}
+	pid, command := "", ""
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "p") && pid == "":
+			pid = line[1:]
+		case strings.HasPrefix(line, "c") && command == "":
+			command = line[1:]
+		}
+	}
+	if pid == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s (pid %s)", command, pid)
+}
+
+// runningPorts are the host ports published by the services' containers that
+// are already running. Those are ours, so they are not conflicts.
+func runningPorts(ctx context.Context, compose ComposeInfo, services []string) (map[int]bool, error) {
+	var out bytes.Buffer
+	cmd := composeCommand(compose, append([]string{"ps", "--format", "json"}, services...)...)
+	cmd.Stdout = &out
+	cmd.Quiet = true
+	err := run(ctx, compose, cmd)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := parsePs(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("error reading container status: %w", err)
+	}
+	result := map[int]bool{}
+	for _, entry := range entries {
+		for _, publisher := range entry.Publishers {
+			result[publisher.PublishedPort] = true
+		}
+	}
+	return result, nil
+}
+
+// publishedPorts of the services, with PortOverrides applied.
+func (compose ComposeInfo) publishedPorts(file *ComposeFile, services []string) map[string][]Port {
+	result := map[string][]Port{}
+	for _, service := range services {
+		for _, port := range file.servicePorts(service) {
+			if port.Published == 0 || (port.Protocol != "" && port.Protocol != "tcp") {
+				continue
+			}
+			if override, found := compose.PortOverrides[service][port.Target]; found {
+				port.Published = override
+			}
+			result[service] = append(result[service], port)
+		}
+	}
+	return result
+}
+
+// findPortConflicts between the services and whatever is running on the host.
+func findPortConflicts(ctx context.Context, compose ComposeInfo, file *ComposeFile, services []string) ([]portConflict, error) {
+	running, err := runningPorts(ctx, compose, services)
+	if err != nil {
+		return nil, err
+	}
+	conflicts := []portConflict{}
+	published := compose.publishedPorts(file, services)
+	for _, service := range services {
+		for _, port := range published[service] {
+			if running[port.Published] || !portInUse(port.Published) {
+				continue
+			}
+			conflicts = append(conflicts, portConflict{
+				service: service,
+				port:    port,
+				owner:   portOwner(ctx, compose, port.Published),
+			})
+		}
+	}
+	return conflicts, nil
+}
+
+// freePort finds the first port above the given one which is neither in use
+// nor claimed by any configured service.
+func freePort(from int, claimed map[int]bool) (int, bool) {
+	for port := from + 1; port <= 65535; port++ {
+		if !claimed[port] && !portInUse(port) {
+			return port, true
+		}
+	}
+	return 0, false
+}
+
+// checkPorts makes sure the services' host ports are free before bringing
+// them up. With remap set, services whose ports are taken are moved to free
+// ports via PortOverrides; otherwise an error reports who holds them. A dry
+// run can't tell which ports the stack itself holds, so it only records the
+// check.
+func checkPorts(ctx context.Context, compose ComposeInfo, file *ComposeFile, services []string, remap bool) (ComposeInfo, error) {
+	if dryRunRequest(compose, strings.Join(services, ", "), "check host ports are free") {
+		return compose, nil
+	}
+	conflicts, err := findPortConflicts(ctx, compose, file, services)
+	if err != nil || len(conflicts) == 0 {
+		return compose, err
+	}
+
+	lines := []string{}
+	for _, conflict := range conflicts {
+		owner := conflict.owner
+		if owner == "" {
+			owner = "another process"
+		}
+		lines = append(lines, fmt.Sprintf("  %s: port %d (container port %d) is used by %s",
+			conflict.service, conflict.port.Published, conflict.port.Target, owner))
+	}
+	if !remap {
+		return compose, fmt.Errorf("cannot bring up services - host ports are already in use:\n%s\nStop those processes, or run again with --remap-ports to publish the services on free ports",
+			strings.Join(lines, "\n"))
+	}
+
+	claimed := map[int]bool{}
+	for _, ports := range compose.publishedPorts(file, file.ServiceNames()) {
+		for _, port := range ports {
+			claimed[port.Published] = true
+		}
+	}
+	overrides := map[string]map[int]int{}
+	for service, ports := range compose.PortOverrides {
+		overrides[service] = map[int]int{}
+		for target, published := range ports {
+			overrides[service][target] = published
+		}
+	}
+	mapping := []string{}
+	for _, conflict := range conflicts {
+		port, found := freePort(conflict.port.Published, claimed)
+		if !found {
+			return compose, fmt.Errorf("cannot find a free port for service %s to replace port %d", conflict.service, conflict.port.Published)
+		}
+		claimed[port] = true
+		if overrides[conflict.service] == nil {
+			overrides[conflict.service] = map[int]int{}
+		}
+		overrides[conflict.service][conflict.port.Target] = port
+		mapping = append(mapping, fmt.Sprintf("  %s: %d -> %d", conflict.service, conflict.port.Published, port))
+	}
+	compose.PortOverrides = overrides
+
+	fmt.Printf("Host ports already in use:\n%s\n", strings.Join(lines, "\n"))
+	fmt.Printf("Remapped to free ports:\n%s\n", strings.Join(mapping, "\n"))
+	fmt.Println("To keep these ports, add them to your .gdc.yml:")
+	fmt.Println("ports:")
+	for _, service := range sortedKeys(overrides) {
+		fmt.Printf("  %s:\n", service)
+		targets := []int{}
+		for target := range overrides[service] {
+			targets = append(targets, target)
+		}
+		sort.Ints(targets)
+		for _, target := range targets {
+			fmt.Printf("    %d: %d\n", target, overrides[service][target])
+		}
+	}
+	return compose, nil
+}
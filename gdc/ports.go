@@ -0,0 +1,107 @@
+package gdc
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Port published by a service to the host.
+type Port struct {
+	HostIP    string
+	Published int
+	Target    int
+	Protocol  string
+	raw       *yaml.Node
+}
+
+// String prints the port in Compose's short syntax.
+func (p Port) String() string {
+	str := fmt.Sprintf("%d:%d", p.Published, p.Target)
+	if p.HostIP != "" {
+		str = fmt.Sprintf("%s:%s", p.HostIP, str)
+	}
+	if p.Protocol != "" && p.Protocol != "tcp" {
+		str = fmt.Sprintf("%s/%s", str, p.Protocol)
+	}
+	return str
+}
+
+// key identifies the port when merging compose files.
+func (p Port) key() string {
+	if p.raw != nil && p.raw.Kind == yaml.ScalarNode {
+		return p.raw.Value
+	}
+	return p.String()
+}
+
+// servicePorts the service declares, or none if it isn't defined.
+func (f *ComposeFile) servicePorts(service string) []Port {
+	if s, found := f.Services[service]; found {
+		return s.Ports
+	}
+	return nil
+}
+
+// portOverrideFile generates a compose file which republishes services on the
+// host ports given in PortOverrides, keyed by service and container port.
+// It returns nil if there is nothing to override.
+func (compose ComposeInfo) portOverrideFile(file *ComposeFile) ([]byte, error) {
+	if len(compose.PortOverrides) == 0 {
+		return nil, nil
+	}
+	var builder strings.Builder
+	builder.WriteString("services:\n")
+	for _, service := range sortedKeys(compose.PortOverrides) {
+		overrides := compose.PortOverrides[service]
+		for target := range overrides {
+			found := false
+			for _, port := range file.servicePorts(service) {
+				found = found || (port.Target == target && port.Published != 0)
+			}
+			if !found {
+				return nil, fmt.Errorf("cannot override port %d - it is not published by service %s", target, service)
+			}
+		}
+		// !override replaces the ports list instead of appending to it
+		builder.WriteString(fmt.Sprintf("  %s:\n    ports: !override\n", service))
+		for _, port := range file.servicePorts(service) {
+			if hostPort, found := overrides[port.Target]; found && port.Published != 0 {
+				port.Published = hostPort
+				builder.WriteString(fmt.Sprintf("      - %q\n", port.String()))
+				continue
+			}
+			raw, err := yaml.Marshal([]interface{}{port.raw})
+			if err != nil {
+				return nil, fmt.Errorf("error generating port overrides: %w", err)
+			}
+			for _, line := range strings.Split(strings.TrimRight(string(raw), "\n"), "\n") {
+				builder.WriteString("      " + line + "\n")
+			}
+		}
+	}
+	return []byte(builder.String()), nil
+}
+
+// hostAddress returns the address a service's container port is reachable on
+// from the host, taking PortOverrides into account.
+func (compose ComposeInfo) hostAddress(file *ComposeFile, service string, target int) (string, bool) {
+	for _, port := range file.servicePorts(service) {
+		if port.Target != target || port.Published == 0 {
+			continue
+		}
+		published := port.Published
+		if override, found := compose.PortOverrides[service][target]; found {
+			published = override
+		}
+		host := port.HostIP
+		if host == "" || host == "0.0.0.0" {
+			host = "127.0.0.1"
+		}
+		return net.JoinHostPort(host, strconv.Itoa(published)), true
+	}
+	return "", false
+}
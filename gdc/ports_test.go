@@ -0,0 +1,290 @@
+package gdc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const portsCompose = `
+services:
+  mysql:
+    image: mysql:5.7
+    ports:
+      - "127.0.0.1:3306:3306"
+      - "33060"
+      - target: 8080
+        published: 8080
+        protocol: udp
+    x-gdc:
+      url: mysql://root@{{address 3306}}/
+  kafka:
+    image: confluentinc/cp-kafka:7.4.0
+    hostname: broker
+    ports:
+      - "9092:9092"
+    x-gdc:
+      url: kafka://{{host 9092}}:{{port 9092}}
+      container_ports:
+        9092: 29092
+  redis:
+    image: redis:6
+`
+
+func parsePortsCompose(t *testing.T) *ComposeFile {
+	t.Helper()
+	file, err := ParseComposeFile("test.yml", []byte(portsCompose))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestPortOverrideFile(t *testing.T) {
+	tests := []struct {
+		name      string
+		overrides map[string]map[int]int
+		want      map[string][]string
+		err       string
+	}{
+		{name: "no overrides"},
+		{
+			name:      "one port",
+			overrides: map[string]map[int]int{"kafka": {9092: 19092}},
+			want: map[string][]string{
+				"mysql": {"127.0.0.1:3306:3306", "0:33060", "8080:8080/udp"},
+				"kafka": {"19092:9092"},
+			},
+		},
+		{
+			name:      "keeps the host ip and other ports",
+			overrides: map[string]map[int]int{"mysql": {3306: 13306}, "kafka": {9092: 19092}},
+			want: map[string][]string{
+				"mysql": {"127.0.0.1:13306:3306", "0:33060", "8080:8080/udp"},
+				"kafka": {"19092:9092"},
+			},
+		},
+		{
+			name:      "unpublished port",
+			overrides: map[string]map[int]int{"mysql": {33060: 13306}},
+			err:       "cannot override port 33060 - it is not published by service mysql",
+		},
+		{
+			name:      "unknown service",
+			overrides: map[string]map[int]int{"redis": {6379: 16379}},
+			err:       "cannot override port 6379 - it is not published by service redis",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := parsePortsCompose(t)
+			compose := ComposeInfo{PortOverrides: test.overrides}
+			data, err := compose.portOverrideFile(file)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("expected error %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.want == nil {
+				if data != nil {
+					t.Fatalf("expected no override file, got\n%s", data)
+				}
+				return
+			}
+			override, err := ParseComposeFile("ports.yml", data)
+			if err != nil {
+				t.Fatalf("%v in\n%s", err, data)
+			}
+			// merged the way Compose merges it, the ports must be replaced
+			// rather than appended to
+			file.Merge(override)
+			for _, service := range file.ServiceNames() {
+				ports := []string{}
+				for _, port := range file.servicePorts(service) {
+					ports = append(ports, port.String())
+				}
+				if len(ports) == 0 {
+					continue
+				}
+				if !reflect.DeepEqual(ports, test.want[service]) {
+					t.Errorf("%s: got ports %q, want %q", service, ports, test.want[service])
+				}
+			}
+		})
+	}
+}
+
+func TestPortOverrideFileKeepsLongSyntax(t *testing.T) {
+	compose := ComposeInfo{PortOverrides: map[string]map[int]int{"mysql": {3306: 13306}}}
+	data, err := compose.portOverrideFile(parsePortsCompose(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `services:
+  mysql:
+    ports: !override
+      - "127.0.0.1:13306:3306"
+      - "33060"
+      - target: 8080
+        published: 8080
+        protocol: udp
+`
+	if string(data) != want {
+		t.Errorf("got\n%s\nwant\n%s", data, want)
+	}
+}
+
+func TestHostAddress(t *testing.T) {
+	tests := []struct {
+		name      string
+		service   string
+		target    int
+		overrides map[string]map[int]int
+		want      string
+		found     bool
+	}{
+		{name: "host ip", service: "mysql", target: 3306, want: "127.0.0.1:3306", found: true},
+		{name: "any host ip", service: "kafka", target: 9092, want: "127.0.0.1:9092", found: true},
+		{
+			name:      "overridden",
+			service:   "kafka",
+			target:    9092,
+			overrides: map[string]map[int]int{"kafka": {9092: 19092}},
+			want:      "127.0.0.1:19092",
+			found:     true,
+		},
+		{
+			name:      "other service overridden",
+			service:   "kafka",
+			target:    9092,
+			overrides: map[string]map[int]int{"mysql": {3306: 13306}},
+			want:      "127.0.0.1:9092",
+			found:     true,
+		},
+		{name: "not published", service: "mysql", target: 33060},
+		{name: "unknown port", service: "mysql", target: 1234},
+		{name: "unknown service", service: "postgres", target: 5432},
+	}
+	file := parsePortsCompose(t)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			compose := ComposeInfo{PortOverrides: test.overrides}
+			address, found := compose.hostAddress(file, test.service, test.target)
+			if address != test.want || found != test.found {
+				t.Errorf("got %q, %v, want %q, %v", address, found, test.want, test.found)
+			}
+		})
+	}
+}
+
+func TestAddressTemplates(t *testing.T) {
+	file := parsePortsCompose(t)
+	compose := ComposeInfo{PortOverrides: map[string]map[int]int{"kafka": {9092: 19092}}}
+	tests := []struct {
+		name    string
+		service string
+		render  func(*ComposeFile, string, string) (string, error)
+		want    string
+		err     string
+	}{
+		{name: "host", service: "mysql", render: compose.hostURL, want: "mysql://root@127.0.0.1:3306/"},
+		{name: "remapped host", service: "kafka", render: compose.hostURL, want: "kafka://127.0.0.1:19092"},
+		{name: "container", service: "mysql", render: compose.containerURL, want: "mysql://root@mysql:3306/"},
+		{name: "container port and hostname", service: "kafka", render: compose.containerURL, want: "kafka://broker:29092"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			url, err := test.render(file, test.service, file.Services[test.service].Gdc.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if url != test.want {
+				t.Errorf("got %q, want %q", url, test.want)
+			}
+		})
+	}
+
+	_, err := compose.hostURL(file, "mysql", "{{address 33060}}")
+	if err == nil || !strings.Contains(err.Error(), "port 33060 of service mysql is not published") {
+		t.Errorf("expected an unpublished port error, got %v", err)
+	}
+}
+
+func TestPublishedPorts(t *testing.T) {
+	compose := ComposeInfo{PortOverrides: map[string]map[int]int{"mysql": {3306: 13306}}}
+	published := compose.publishedPorts(parsePortsCompose(t), []string{"mysql", "kafka", "redis"})
+	got := map[string][]string{}
+	for service, ports := range published {
+		for _, port := range ports {
+			got[service] = append(got[service], port.String())
+		}
+	}
+	// only TCP ports with a host port, which is the overridden one if given
+	want := map[string][]string{
+		"mysql": {"127.0.0.1:13306:3306"},
+		"kafka": {"9092:9092"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestCheckPorts(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	taken := listener.Addr().(*net.TCPAddr).Port
+	data := fmt.Sprintf("services:\n  web:\n    image: nginx\n    ports:\n      - \"%d:80\"\n", taken)
+
+	tests := []struct {
+		name    string
+		running bool
+		remap   bool
+		err     string
+	}{
+		{name: "conflict", err: fmt.Sprintf("web: port %d (container port 80) is used by another process", taken)},
+		{name: "remapped", remap: true},
+		{name: "already running", running: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			compose, runner := testComposeInfo(t, "web")
+			compose.MainFile = []byte(data)
+			file, err := compose.LoadComposeFile()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.running {
+				runner.Outputs = map[string]string{
+					composeLine(compose, "ps", "--format", "json", "web"): fmt.Sprintf(`{"Service":"web","Publishers":[{"PublishedPort":%d,"TargetPort":80}]}`, taken),
+				}
+			}
+			result, err := checkPorts(context.Background(), compose, file, []string{"web"}, test.remap)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error containing %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			published, remapped := result.PortOverrides["web"][80]
+			if remapped != test.remap {
+				t.Fatalf("expected remapped %v, got overrides %v", test.remap, result.PortOverrides)
+			}
+			if remapped && published <= taken {
+				t.Errorf("expected a free port above %d, got %d", taken, published)
+			}
+		})
+	}
+}
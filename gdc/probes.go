@@ -0,0 +1,207 @@
+package gdc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// probeSpec is how a service declares its readiness probe in its x-gdc block.
+// Port is the container port; the probe connects to wherever it is published.
+type probeSpec struct {
+	Type string `yaml:"type"`
+	Port int    `yaml:"port"`
+	Path string `yaml:"path"`
+}
+
+// probe checks once whether a service is ready at the given host address,
+// returning an error describing why not.
+type probe func(ctx context.Context, address string, spec probeSpec) error
+
+var probes = map[string]probe{
+	"tcp":        tcpProbe,
+	"mysql":      mysqlProbe,
+	"redis":      redisProbe,
+	"kafka":      kafkaProbe,
+	"http":       httpProbe,
+	"opensearch": opensearchProbe,
+	"dynamodb":   dynamodbProbe,
+	"smtp":       smtpProbe,
+}
+
+// how long a single probe attempt may take
+var probeAttemptTimeout = 2 * time.Second
+
+func dial(ctx context.Context, address string) (net.Conn, error) {
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(probeAttemptTimeout)
+	}
+	conn.SetDeadline(deadline)
+	return conn, nil
+}
+
+func tcpProbe(ctx context.Context, address string, spec probeSpec) error {
+	conn, err := dial(ctx, address)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// mysqlProbe waits for the server's initial handshake packet. While the image
+// is initializing, mysqld only listens on its socket, so a handshake over TCP
+// means the real server is up.
+func mysqlProbe(ctx context.Context, address string, spec probeSpec) error {
+	conn, err := dial(ctx, address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return fmt.Errorf("no handshake: %w", err)
+	}
+	length := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(conn, payload); err != nil {
+		return fmt.Errorf("no handshake: %w", err)
+	}
+	switch {
+	case len(payload) > 0 && payload[0] == 10:
+		return nil
+	case len(payload) > 3 && payload[0] == 0xff:
+		return fmt.Errorf("server refused connection: %s", payload[3:])
+	}
+	return fmt.Errorf("unexpected handshake packet")
+}
+
+func redisProbe(ctx context.Context, address string, spec probeSpec) error {
+	conn, err := dial(ctx, address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("PING\r\n")); err != nil {
+		return err
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "+PONG") {
+		return fmt.Errorf("unexpected reply to PING: %s", strings.TrimSpace(line))
+	}
+	return nil
+}
+
+// kafkaProbe sends a version 0 Metadata request and checks that the broker
+// answers with at least one broker.
+func kafkaProbe(ctx context.Context, address string, spec probeSpec) error {
+	conn, err := dial(ctx, address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	clientID := "gdc"
+	var request bytes.Buffer
+	binary.Write(&request, binary.BigEndian, int16(3)) // api key: Metadata
+	binary.Write(&request, binary.BigEndian, int16(0)) // api version
+	binary.Write(&request, binary.BigEndian, int32(1)) // correlation id
+	binary.Write(&request, binary.BigEndian, int16(len(clientID)))
+	request.WriteString(clientID)
+	binary.Write(&request, binary.BigEndian, int32(0)) // no topics
+	size := make([]byte, 4)
+	binary.BigEndian.PutUint32(size, uint32(request.Len()))
+	if _, err := conn.Write(append(size, request.Bytes()...)); err != nil {
+		return err
+	}
+
+	response := make([]byte, 12)
+	if _, err := io.ReadFull(conn, response); err != nil {
+		return fmt.Errorf("no metadata response: %w", err)
+	}
+	if correlation := binary.BigEndian.Uint32(response[4:8]); correlation != 1 {
+		return fmt.Errorf("unexpected metadata response")
+	}
+	if brokers := int32(binary.BigEndian.Uint32(response[8:12])); brokers < 1 {
+		return fmt.Errorf("no brokers available")
+	}
+	return nil
+}
+
+func httpGet(ctx context.Context, url string) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return http.DefaultClient.Do(request)
+}
+
+func httpProbe(ctx context.Context, address string, spec probeSpec) error {
+	response, err := httpGet(ctx, fmt.Sprintf("http://%s%s", address, spec.Path))
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode >= 400 {
+		return fmt.Errorf("%s returned HTTP %d", spec.Path, response.StatusCode)
+	}
+	return nil
+}
+
+func opensearchProbe(ctx context.Context, address string, spec probeSpec) error {
+	response, err := httpGet(ctx, fmt.Sprintf("http://%s/_cluster/health", address))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("_cluster/health returned HTTP %d", response.StatusCode)
+	}
+	health := struct {
+		Status string `json:"status"`
+	}{}
+	if err := json.NewDecoder(response.Body).Decode(&health); err != nil {
+		return err
+	}
+	if health.Status == "red" {
+		return fmt.Errorf("cluster health is red")
+	}
+	return nil
+}
+
+// dynamodbProbe calls ListTables.
+func dynamodbProbe(ctx context.Context, address string, spec probeSpec) error {
+	return dynamodbRequest(ctx, address, "ListTables", struct{}{}, nil)
+}
+
+func smtpProbe(ctx context.Context, address string, spec probeSpec) error {
+	conn, err := dial(ctx, address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("no SMTP banner: %w", err)
+	}
+	if !strings.HasPrefix(line, "220") {
+		return fmt.Errorf("unexpected SMTP banner: %s", strings.TrimSpace(line))
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+package gdc
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeServer accepts connections on a local port and hands each to serve.
+func fakeServer(t *testing.T, serve func(conn net.Conn)) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				serve(conn)
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// closedAddress is a local address nothing listens on.
+func closedAddress(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+	return address
+}
+
+// mysqlPacket is a packet with the given payload.
+func mysqlPacket(payload ...byte) []byte {
+	return append([]byte{byte(len(payload)), 0, 0, 0}, payload...)
+}
+
+// replyLine answers the first line read with the reply.
+func replyLine(reply string) func(net.Conn) {
+	return func(conn net.Conn) {
+		bufio.NewReader(conn).ReadString('\n')
+		io.WriteString(conn, reply)
+	}
+}
+
+// kafkaMetadata answers a metadata request with the given number of brokers.
+func kafkaMetadata(correlation uint32, brokers uint32) func(net.Conn) {
+	return func(conn net.Conn) {
+		size := make([]byte, 4)
+		if _, err := io.ReadFull(conn, size); err != nil {
+			return
+		}
+		io.CopyN(io.Discard, conn, int64(binary.BigEndian.Uint32(size)))
+		response := make([]byte, 12)
+		binary.BigEndian.PutUint32(response[0:4], 8)
+		binary.BigEndian.PutUint32(response[4:8], correlation)
+		binary.BigEndian.PutUint32(response[8:12], brokers)
+		conn.Write(response)
+	}
+}
+
+func TestProbes(t *testing.T) {
+	httpStatus := func(status int, body string) string {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+			io.WriteString(w, body)
+		}))
+		t.Cleanup(server.Close)
+		return strings.TrimPrefix(server.URL, "http://")
+	}
+	tests := []struct {
+		name    string
+		probe   string
+		address string
+		spec    probeSpec
+		err     string
+	}{
+		{name: "tcp", probe: "tcp", address: fakeServer(t, func(net.Conn) {})},
+		{name: "tcp closed", probe: "tcp", address: closedAddress(t), err: "connection refused"},
+		{name: "mysql", probe: "mysql", address: fakeServer(t, func(conn net.Conn) { conn.Write(mysqlPacket(10, '8', '.', '0')) })},
+		{
+			name:  "mysql refused",
+			probe: "mysql",
+			address: fakeServer(t, func(conn net.Conn) {
+				conn.Write(mysqlPacket(append([]byte{0xff, 0x6a, 0x04}, "Host not allowed"...)...))
+			}),
+			err: "server refused connection: Host not allowed",
+		},
+		{name: "mysql initializing", probe: "mysql", address: fakeServer(t, func(net.Conn) {}), err: "no handshake: EOF"},
+		{name: "redis", probe: "redis", address: fakeServer(t, replyLine("+PONG\r\n"))},
+		{name: "redis loading", probe: "redis", address: fakeServer(t, replyLine("-LOADING Redis is loading\r\n")), err: "unexpected reply to PING: -LOADING Redis is loading"},
+		{name: "kafka", probe: "kafka", address: fakeServer(t, kafkaMetadata(1, 1))},
+		{name: "kafka without brokers", probe: "kafka", address: fakeServer(t, kafkaMetadata(1, 0)), err: "no brokers available"},
+		{name: "kafka other correlation", probe: "kafka", address: fakeServer(t, kafkaMetadata(7, 1)), err: "unexpected metadata response"},
+		{name: "http", probe: "http", address: httpStatus(http.StatusOK, ""), spec: probeSpec{Path: "/health"}},
+		{name: "http error", probe: "http", address: httpStatus(http.StatusServiceUnavailable, ""), spec: probeSpec{Path: "/health"}, err: "/health returned HTTP 503"},
+		{name: "opensearch yellow", probe: "opensearch", address: httpStatus(http.StatusOK, `{"status":"yellow"}`)},
+		{name: "opensearch red", probe: "opensearch", address: httpStatus(http.StatusOK, `{"status":"red"}`), err: "cluster health is red"},
+		{name: "smtp", probe: "smtp", address: fakeServer(t, func(conn net.Conn) { io.WriteString(conn, "220 mailcatcher ESMTP\r\n") })},
+		{
+			name:    "smtp unavailable",
+			probe:   "smtp",
+			address: fakeServer(t, func(conn net.Conn) { io.WriteString(conn, "554 no service\r\n") }),
+			err:     "unexpected SMTP banner: 554 no service",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			err := probes[test.probe](ctx, test.address, test.spec)
+			if test.err == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("expected error containing %q, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+const readinessCompose = `
+services:
+  mysql:
+    image: mysql:5.7
+    ports: ["3306:3306"]
+    x-gdc:
+      probe: {type: mysql, port: 3306}
+  web:
+    image: nginx
+    ports: ["8080", "8081:80", "9090:90"]
+  worker:
+    image: worker
+  hidden:
+    image: hidden
+    ports: ["1235"]
+    x-gdc:
+      probe: {type: tcp, port: 1235}
+`
+
+func TestReadinessChecks(t *testing.T) {
+	file, err := ParseComposeFile("test.yml", []byte(readinessCompose))
+	if err != nil {
+		t.Fatal(err)
+	}
+	type check struct {
+		Service string
+		Address string
+		Spec    probeSpec
+	}
+	tests := []struct {
+		name      string
+		services  []string
+		overrides map[string]map[int]int
+		want      []check
+		err       string
+	}{
+		{
+			name:     "declared and first published port",
+			services: []string{"mysql", "web", "worker"},
+			want: []check{
+				{"mysql", "127.0.0.1:3306", probeSpec{Type: "mysql", Port: 3306}},
+				{"web", "127.0.0.1:8081", probeSpec{Type: "tcp", Port: 80}},
+			},
+		},
+		{
+			name:      "remapped port",
+			services:  []string{"mysql"},
+			overrides: map[string]map[int]int{"mysql": {3306: 13306}},
+			want:      []check{{"mysql", "127.0.0.1:13306", probeSpec{Type: "mysql", Port: 3306}}},
+		},
+		{name: "unpublished port", services: []string{"hidden"}, err: "cannot probe service hidden - port 1235 is not published"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			compose := ComposeInfo{PortOverrides: test.overrides}
+			checks, err := compose.readinessChecks(file, test.services)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("expected error %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []check{}
+			for _, c := range checks {
+				got = append(got, check{c.service, c.address, c.spec})
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestWaitFor(t *testing.T) {
+	interval := probeInterval
+	probeInterval = 10 * time.Millisecond
+	defer func() { probeInterval = interval }()
+
+	// redis only answers from the third attempt, kafka never does
+	var attempts int32
+	redis := fakeServer(t, func(conn net.Conn) {
+		if atomic.AddInt32(&attempts, 1) >= 3 {
+			replyLine("+PONG\r\n")(conn)
+		}
+	})
+	kafka := closedAddress(t)
+	_, redisPort, _ := net.SplitHostPort(redis)
+	_, kafkaPort, _ := net.SplitHostPort(kafka)
+	file, err := ParseComposeFile("test.yml", []byte(fmt.Sprintf(`
+services:
+  redis:
+    image: redis:6
+    ports: ["%s:6379"]
+    x-gdc:
+      probe: {type: redis, port: 6379}
+  kafka:
+    image: confluentinc/cp-kafka:7.4.0
+    ports: ["%s:9092"]
+`, redisPort, kafkaPort)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = waitFor(context.Background(), ComposeInfo{}, file, []string{"redis"}, 5*time.Second)
+	if err != nil {
+		t.Fatalf("expected redis to become ready, got %v", err)
+	}
+
+	err = waitFor(context.Background(), ComposeInfo{}, file, []string{"redis", "kafka"}, 100*time.Millisecond)
+	var notReady *NotReadyError
+	if !errors.As(err, &notReady) {
+		t.Fatalf("expected NotReadyError, got %v", err)
+	}
+	if len(notReady.Failures) != 1 || notReady.Failures["kafka"] == nil {
+		t.Errorf("expected only kafka to fail, got %v", notReady.Failures)
+	}
+}
@@ -0,0 +1,110 @@
+package gdc
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// how often progress is redrawn on a terminal
+var progressInterval = 200 * time.Millisecond
+
+// progress of a transfer, redrawn in place on a terminal. On anything else
+// only the final summary is printed, to keep logs readable.
+type progress struct {
+	out   io.Writer
+	verb  string
+	total int64
+	done  int64
+	start time.Time
+	drawn time.Time
+	tty   bool
+	mutex sync.Mutex
+}
+
+// newProgress reports on the writer, which may be nil to report nothing.
+// total is the expected number of bytes, or 0 if unknown.
+func newProgress(out io.Writer, verb string, total int64) *progress {
+	p := &progress{out: out, verb: verb, total: total, start: time.Now()}
+	if file, ok := out.(*os.File); ok {
+		if info, err := file.Stat(); err == nil {
+			p.tty = info.Mode()&os.ModeCharDevice != 0
+		}
+	}
+	return p
+}
+
+func (p *progress) add(n int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.done += int64(n)
+	if p.out == nil || !p.tty || time.Since(p.drawn) < progressInterval {
+		return
+	}
+	p.drawn = time.Now()
+	fmt.Fprintf(p.out, "\r\033[K%s", p.line())
+}
+
+func (p *progress) line() string {
+	elapsed := time.Since(p.start)
+	rate := float64(p.done) / elapsed.Seconds()
+	if p.total > 0 {
+		return fmt.Sprintf("%s %s of %s (%d%%) at %s/s", p.verb, FormatBytes(p.done), FormatBytes(p.total),
+			p.done*100/p.total, FormatBytes(int64(rate)))
+	}
+	return fmt.Sprintf("%s %s at %s/s", p.verb, FormatBytes(p.done), FormatBytes(int64(rate)))
+}
+
+// finish prints the summary.
+func (p *progress) finish() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.out == nil {
+		return
+	}
+	if p.tty {
+		fmt.Fprint(p.out, "\r\033[K")
+	}
+	elapsed := time.Since(p.start)
+	fmt.Fprintf(p.out, "%s %s in %s (%s/s)\n", p.verb, FormatBytes(p.done), elapsed.Round(100*time.Millisecond),
+		FormatBytes(int64(float64(p.done)/elapsed.Seconds())))
+}
+
+type progressReader struct {
+	reader   io.Reader
+	progress *progress
+}
+
+func (r progressReader) Read(b []byte) (int, error) {
+	n, err := r.reader.Read(b)
+	r.progress.add(n)
+	return n, err
+}
+
+type progressWriter struct {
+	writer   io.Writer
+	progress *progress
+}
+
+func (w progressWriter) Write(b []byte) (int, error) {
+	n, err := w.writer.Write(b)
+	w.progress.add(n)
+	return n, err
+}
+
+// FormatBytes as e.g. 12.3 MB
+func FormatBytes(n int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	value := float64(n)
+	unit := 0
+	for value >= 1000 && unit < len(units)-1 {
+		value /= 1000
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d B", n)
+	}
+	return fmt.Sprintf("%.1f %s", value, units[unit])
+}
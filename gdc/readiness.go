@@ -0,0 +1,124 @@
+package gdc
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// how long to wait between probe attempts for a service that is not ready
+var probeInterval = time.Second
+
+// readinessCheck is how a single service will be checked for readiness.
+type readinessCheck struct {
+	service string
+	address string
+	spec    probeSpec
+	probe   probe
+}
+
+type readinessResult struct {
+	service string
+	elapsed time.Duration
+	err     error
+}
+
+// readinessChecks for the given services. Services without a declared probe
+// are checked by connecting to their first published port, and services that
+// publish no ports at all are not checked.
+func (compose ComposeInfo) readinessChecks(file *ComposeFile, services []string) ([]readinessCheck, error) {
+	checks := []readinessCheck{}
+	for _, service := range services {
+		spec := probeSpec{Type: "tcp"}
+		if file.Services[service].Gdc.Probe != nil {
+			spec = *file.Services[service].Gdc.Probe
+		} else {
+			for _, port := range file.servicePorts(service) {
+				if port.Published != 0 {
+					spec.Port = port.Target
+					break
+				}
+			}
+			if spec.Port == 0 {
+				continue
+			}
+		}
+		probe, found := probes[spec.Type]
+		if !found {
+			return nil, fmt.Errorf("unknown probe type %s for service %s", spec.Type, service)
+		}
+		address, found := compose.hostAddress(file, service, spec.Port)
+		if !found {
+			return nil, fmt.Errorf("cannot probe service %s - port %d is not published", service, spec.Port)
+		}
+		checks = append(checks, readinessCheck{service: service, address: address, spec: spec, probe: probe})
+	}
+	return checks, nil
+}
+
+// poll the check until it succeeds or the context is done
+func (check readinessCheck) poll(ctx context.Context) error {
+	for {
+		attemptCtx, cancel := context.WithTimeout(ctx, probeAttemptTimeout)
+		err := check.probe(attemptCtx, check.address, check.spec)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(probeInterval):
+		}
+	}
+}
+
+// Wait until the requested services and their companions are ready to accept
+// connections. Once the timeout passes it returns a NotReadyError with the
+// services that are still not ready.
+func Wait(ctx context.Context, compose ComposeInfo, timeout time.Duration) error {
+	file, services, err := requestedServices(compose, "up")
+	if err != nil {
+		return err
+	}
+	return waitFor(ctx, compose, file, services, timeout)
+}
+
+// waitFor the given services to be ready.
+func waitFor(ctx context.Context, compose ComposeInfo, file *ComposeFile, services []string, timeout time.Duration) error {
+	if plan, ok := compose.Runner.(*Plan); ok {
+		plan.wait(services, timeout)
+		return nil
+	}
+	checks, err := compose.readinessChecks(file, services)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Waiting up to %s for %s to be ready...\n", timeout, strings.Join(services, ", "))
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	results := make(chan readinessResult)
+	for _, check := range checks {
+		go func(check readinessCheck) {
+			err := check.poll(ctx)
+			results <- readinessResult{service: check.service, elapsed: time.Since(start), err: err}
+		}(check)
+	}
+
+	failures := map[string]error{}
+	for range checks {
+		result := <-results
+		if result.err != nil {
+			failures[result.service] = result.err
+			continue
+		}
+		fmt.Printf("  %s is ready (%s)\n", result.service, result.elapsed.Round(100*time.Millisecond))
+	}
+	if len(failures) > 0 {
+		return &NotReadyError{Timeout: timeout, Failures: failures}
+	}
+	return nil
+}
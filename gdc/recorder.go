@@ -0,0 +1,59 @@
+package gdc
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// RecordingRunner is a Runner that records commands instead of executing them.
+// Outputs, ErrorOutputs and ExitCodes are keyed by the command's String() form
+// and let a caller fake what the command would have printed and how it would
+// have exited. Inputs records what each command was given on stdin.
+type RecordingRunner struct {
+	Commands     []*Command
+	Outputs      map[string]string
+	ErrorOutputs map[string]string
+	ExitCodes    map[string]int
+	Inputs       map[string][]byte
+	mutex        sync.Mutex
+}
+
+// Run records the command and replays any canned output or exit code.
+func (r *RecordingRunner) Run(ctx context.Context, cmd *Command) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.Commands = append(r.Commands, cmd)
+	key := cmd.String()
+	if cmd.Stdin != nil {
+		input, err := io.ReadAll(cmd.Stdin)
+		if err != nil {
+			return err
+		}
+		if r.Inputs == nil {
+			r.Inputs = map[string][]byte{}
+		}
+		r.Inputs[key] = input
+	}
+	if output, ok := r.Outputs[key]; ok && cmd.Stdout != nil {
+		io.WriteString(cmd.Stdout, output)
+	}
+	if output, ok := r.ErrorOutputs[key]; ok && cmd.Stderr != nil {
+		io.WriteString(cmd.Stderr, output)
+	}
+	if code, ok := r.ExitCodes[key]; ok && code != 0 {
+		return &ExitError{Command: key, Code: code}
+	}
+	return nil
+}
+
+// Executed returns the String() form of every recorded command, in order.
+func (r *RecordingRunner) Executed() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	result := []string{}
+	for _, cmd := range r.Commands {
+		result = append(result, cmd.String())
+	}
+	return result
+}
@@ -0,0 +1,314 @@
+package gdc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// RegistryAuth configures how gdc logs in to an image registry before pulling
+// or building images. Registries without one are left to Docker, except for
+// ECR registries which are logged in to with the AWS CLI by default.
+type RegistryAuth struct {
+	// ecr, helper or token
+	Type string `yaml:"type" json:"type"`
+	// for ecr: the AWS profile to use, and the region if it differs from the
+	// one in the registry's host name
+	Profile string `yaml:"profile,omitempty" json:"profile,omitempty"`
+	Region  string `yaml:"region,omitempty" json:"region,omitempty"`
+	// for helper: the Docker credential helper, e.g. osxkeychain to run
+	// docker-credential-osxkeychain
+	Helper string `yaml:"helper,omitempty" json:"helper,omitempty"`
+	// for token: the user name and the token, either given directly or read
+	// from an environment variable
+	Username string `yaml:"username,omitempty" json:"username,omitempty"`
+	Token    string `yaml:"token,omitempty" json:"token,omitempty"`
+	TokenEnv string `yaml:"token_env,omitempty" json:"token_env,omitempty"`
+}
+
+// a registryAuthenticator logs Docker in to the registry. It returns when the
+// login expires, or the zero time if it isn't known.
+type registryAuthenticator func(ctx context.Context, compose ComposeInfo, host string, auth RegistryAuth) (time.Time, error)
+
+var registryAuthenticators = map[string]registryAuthenticator{
+	"ecr":    ecrLogin,
+	"helper": helperLogin,
+	"token":  tokenLogin,
+}
+
+// how long an ECR login lasts
+var ecrTokenLifetime = 12 * time.Hour
+
+// logins are renewed this long before they expire
+var loginExpiryMargin = 5 * time.Minute
+
+var ecrHost = regexp.MustCompile(`^\d+\.dkr\.ecr\.([a-z0-9-]+)\.amazonaws\.com(\.cn)?$`)
+
+// imageRegistry is the host of the registry an image reference points to.
+func imageRegistry(image string) string {
+	if i := strings.Index(image, "/"); i >= 0 {
+		first := image[:i]
+		if strings.ContainsAny(first, ".:") || first == "localhost" {
+			return first
+		}
+	}
+	return "docker.io"
+}
+
+// registryAuth for the host, and whether it needs logging in to at all.
+func (compose ComposeInfo) registryAuth(host string) (RegistryAuth, bool) {
+	if auth, found := compose.Registries[host]; found {
+		return auth, true
+	}
+	if ecrHost.MatchString(host) {
+		return RegistryAuth{Type: "ecr"}, true
+	}
+	return RegistryAuth{}, false
+}
+
+// dockerfileImages are the base images named in a Dockerfile's FROM lines,
+// leaving out scratch and earlier build stages.
+func dockerfileImages(path string) ([]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	images := []string{}
+	stages := map[string]bool{"scratch": true}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || !strings.EqualFold(fields[0], "FROM") {
+			continue
+		}
+		fields = fields[1:]
+		for len(fields) > 0 && strings.HasPrefix(fields[0], "--") {
+			fields = fields[1:]
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		image := os.ExpandEnv(fields[0])
+		if !stages[strings.ToLower(image)] {
+			images = append(images, image)
+		}
+		if len(fields) >= 3 && strings.EqualFold(fields[1], "AS") {
+			stages[strings.ToLower(fields[2])] = true
+		}
+	}
+	return images, scanner.Err()
+}
+
+// serviceImages are the images the services run, and the base images of the
+// ones that are built.
+func (compose ComposeInfo) serviceImages(file *ComposeFile, services []string) ([]string, error) {
+	images := []string{}
+	for _, name := range services {
+		service, found := file.Services[name]
+		if !found {
+			continue
+		}
+		if service.Image != "" {
+			images = append(images, os.ExpandEnv(service.Image))
+		}
+		if service.Build == nil {
+			continue
+		}
+		dir := service.Build.Context
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(compose.ProjectDir, dir)
+		}
+		dockerfile := service.Build.Dockerfile
+		if dockerfile == "" {
+			dockerfile = "Dockerfile"
+		}
+		if !filepath.IsAbs(dockerfile) {
+			dockerfile = filepath.Join(dir, dockerfile)
+		}
+		base, err := dockerfileImages(dockerfile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading Dockerfile for service %s: %w", name, err)
+		}
+		images = append(images, base...)
+	}
+	return images, nil
+}
+
+// loginRecord is a cached registry login.
+type loginRecord struct {
+	// hash of the RegistryAuth the login was made with
+	Auth    string    `json:"auth"`
+	Expires time.Time `json:"expires"`
+}
+
+func (auth RegistryAuth) fingerprint() string {
+	data, _ := json.Marshal(auth)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func loginCachePath() (string, error) {
+	dir, err := gdcDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "registry-logins.json"), nil
+}
+
+// readLoginCache returns the cached logins, or none if there is no cache.
+func readLoginCache() map[string]loginRecord {
+	cache := map[string]loginRecord{}
+	path, err := loginCachePath()
+	if err != nil {
+		return cache
+	}
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		json.Unmarshal(data, &cache)
+	}
+	return cache
+}
+
+func writeLoginCache(cache map[string]loginRecord) error {
+	path, err := loginCachePath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+// authenticateRegistries logs in to the registries the images come from which
+// need it. Logins that expire are cached until shortly before they do, unless
+// Relogin is set.
+func authenticateRegistries(ctx context.Context, compose ComposeInfo, images []string) error {
+	hosts := map[string]bool{}
+	for _, image := range images {
+		hosts[imageRegistry(image)] = true
+	}
+	cache := readLoginCache()
+	changed := false
+	for _, host := range sortedKeys(hosts) {
+		auth, needed := compose.registryAuth(host)
+		if !needed {
+			continue
+		}
+		authenticator, found := registryAuthenticators[auth.Type]
+		if !found {
+			return &RegistryAuthError{Registry: host, Err: fmt.Errorf("unknown auth type %s - expected ecr, helper or token", auth.Type)}
+		}
+		record, cached := cache[host]
+		if cached && !compose.Relogin && record.Auth == auth.fingerprint() && time.Now().Add(loginExpiryMargin).Before(record.Expires) {
+			continue
+		}
+		expires, err := authenticator(ctx, compose, host, auth)
+		if err != nil {
+			return &RegistryAuthError{Registry: host, Err: err}
+		}
+		if _, dryRun := compose.Runner.(fileWriter); !dryRun && !expires.IsZero() {
+			cache[host] = loginRecord{Auth: auth.fingerprint(), Expires: expires}
+			changed = true
+		}
+	}
+	if changed {
+		return writeLoginCache(cache)
+	}
+	return nil
+}
+
+// dockerLogin logs Docker in with the password, which is passed on stdin so it
+// never shows up in the process list.
+func dockerLogin(ctx context.Context, compose ComposeInfo, host string, username string, password string) error {
+	cmd := NewCommand("docker", "login", "--username", username, "--password-stdin", host)
+	cmd.Stdin = strings.NewReader(password)
+	return compose.runner().Run(ctx, cmd)
+}
+
+func ecrLogin(ctx context.Context, compose ComposeInfo, host string, auth RegistryAuth) (time.Time, error) {
+	region := auth.Region
+	if region == "" {
+		match := ecrHost.FindStringSubmatch(host)
+		if match == nil {
+			return time.Time{}, fmt.Errorf("no region given and %s is not an ECR host name", host)
+		}
+		region = match[1]
+	}
+	args := []string{"aws", "ecr", "get-login-password", "--region", region}
+	if auth.Profile != "" {
+		args = append(args, "--profile", auth.Profile)
+	}
+	cmd := NewCommand(args...)
+	cmd.Pipe("docker", "login", "--username", "AWS", "--password-stdin", host)
+	err := compose.runner().Run(ctx, cmd)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Now().Add(ecrTokenLifetime), nil
+}
+
+func helperLogin(ctx context.Context, compose ComposeInfo, host string, auth RegistryAuth) (time.Time, error) {
+	if auth.Helper == "" {
+		return time.Time{}, fmt.Errorf("no credential helper given")
+	}
+	var out bytes.Buffer
+	cmd := NewCommand("docker-credential-"+auth.Helper, "get")
+	cmd.Stdin = strings.NewReader(host)
+	cmd.Stdout = &out
+	cmd.Quiet = true
+	err := compose.runner().Run(ctx, cmd)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if _, dryRun := compose.Runner.(fileWriter); dryRun {
+		return time.Time{}, nil
+	}
+	credentials := struct {
+		Username string
+		Secret   string
+	}{}
+	err = json.Unmarshal(out.Bytes(), &credentials)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error reading credentials from docker-credential-%s: %w", auth.Helper, err)
+	}
+	return time.Time{}, dockerLogin(ctx, compose, host, credentials.Username, credentials.Secret)
+}
+
+func tokenLogin(ctx context.Context, compose ComposeInfo, host string, auth RegistryAuth) (time.Time, error) {
+	token := auth.Token
+	if auth.TokenEnv != "" {
+		token = os.Getenv(auth.TokenEnv)
+	}
+	if token == "" {
+		source := "token"
+		if auth.TokenEnv != "" {
+			source = "environment variable " + auth.TokenEnv
+		}
+		return time.Time{}, fmt.Errorf("no token given - set %s", source)
+	}
+	if auth.Username == "" {
+		return time.Time{}, fmt.Errorf("no username given")
+	}
+	return time.Time{}, dockerLogin(ctx, compose, host, auth.Username, token)
+}
+
+// loginForServices logs in to the registries the services' images need.
+func loginForServices(ctx context.Context, compose ComposeInfo, file *ComposeFile, services []string) error {
+	images, err := compose.serviceImages(file, services)
+	if err != nil {
+		return err
+	}
+	return authenticateRegistries(ctx, compose, images)
+}
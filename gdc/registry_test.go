@@ -0,0 +1,53 @@
+package gdc
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuthenticateRegistriesCache(t *testing.T) {
+	const host = "123456789012.dkr.ecr.us-east-1.amazonaws.com"
+	images := []string{host + "/app:latest", "redis:6"}
+	tests := []struct {
+		name    string
+		cached  loginRecord
+		relogin bool
+		want    bool
+	}{
+		{"no cache", loginRecord{}, false, true},
+		{"cached", loginRecord{Auth: RegistryAuth{Type: "ecr"}.fingerprint(), Expires: time.Now().Add(time.Hour)}, false, false},
+		{"about to expire", loginRecord{Auth: RegistryAuth{Type: "ecr"}.fingerprint(), Expires: time.Now().Add(time.Minute)}, false, true},
+		{"other auth", loginRecord{Auth: RegistryAuth{Type: "ecr", Profile: "other"}.fingerprint(), Expires: time.Now().Add(time.Hour)}, false, true},
+		{"relogin", loginRecord{Auth: RegistryAuth{Type: "ecr"}.fingerprint(), Expires: time.Now().Add(time.Hour)}, true, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			compose, runner := testComposeInfo(t)
+			compose.Relogin = test.relogin
+			if !test.cached.Expires.IsZero() {
+				if err := writeLoginCache(map[string]loginRecord{host: test.cached}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := authenticateRegistries(context.Background(), compose, images); err != nil {
+				t.Fatal(err)
+			}
+			executed := runner.Executed()
+			if !test.want {
+				if len(executed) != 0 {
+					t.Fatalf("expected the cached login to be used, ran %q", executed)
+				}
+				return
+			}
+			if len(executed) != 1 || !strings.Contains(executed[0], "docker login --username AWS --password-stdin "+host) {
+				t.Fatalf("expected an ECR login, ran %q", executed)
+			}
+			cache := readLoginCache()
+			if !cache[host].Expires.After(time.Now().Add(11 * time.Hour)) {
+				t.Errorf("expected the new login to be cached, got %+v", cache[host])
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package gdc
+
+import (
+	"context"
+	"fmt"
+)
+
+// ResetPlan is what resetting a service deletes.
+type ResetPlan struct {
+	Service string
+	// Docker names of the service's named volumes
+	Volumes []string
+	// other projects which claim the service
+	UsedBy []string
+}
+
+// PlanReset works out which volumes resetting the service would delete, so
+// they can be confirmed first.
+func PlanReset(compose ComposeInfo, service string) (ResetPlan, error) {
+	plan := ResetPlan{Service: service}
+	file, err := compose.LoadComposeFile()
+	if err != nil {
+		return plan, err
+	}
+	err = validateService(file, "reset", service)
+	if err != nil {
+		return plan, err
+	}
+	volumes := serviceVolumes(file, service)
+	if len(volumes) == 0 {
+		return plan, fmt.Errorf("service %s has no named volumes to reset", service)
+	}
+	for _, name := range sortedKeys(volumes) {
+		plan.Volumes = append(plan.Volumes, volumes[name])
+	}
+	project, err := compose.project()
+	if err != nil {
+		return plan, err
+	}
+	claims, err := readClaims()
+	if err != nil {
+		return plan, err
+	}
+	for _, name := range sortedKeys(claims) {
+		if name != project && contains(claims[name].Services, service) {
+			plan.UsedBy = append(plan.UsedBy, name)
+		}
+	}
+	return plan, nil
+}
+
+// Reset removes the service's container and deletes its named volumes, so it
+// starts from scratch. Volumes of other services are left alone. With
+// recreate the service is brought up again afterwards.
+func Reset(ctx context.Context, compose ComposeInfo, plan ResetPlan, recreate bool) error {
+	err := func() error {
+		unlock, err := lockProject(ctx, compose)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		err = run(ctx, compose, composeCommand(compose, "rm", "--stop", "--force", plan.Service))
+		if err != nil {
+			return err
+		}
+		// volumes that were never created are fine to miss
+		return run(ctx, compose, NewCommand(append([]string{"docker", "volume", "rm", "--force"}, plan.Volumes...)...))
+	}()
+	if err != nil || !recreate {
+		return err
+	}
+	compose.RequestedServices = []string{plan.Service}
+	compose.NoCompanions = true
+	return Up(ctx, compose, UpOptions{})
+}
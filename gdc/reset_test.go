@@ -0,0 +1,141 @@
+package gdc
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const resetCompose = `
+services:
+  mysql:
+    image: mysql:5.7
+    volumes:
+      - mysql-data:/var/lib/mysql
+      - ./conf:/etc/mysql/conf.d
+      - type: volume
+        source: mysql-logs
+        target: /var/log/mysql
+      - shared:/shared
+      - type: tmpfs
+        target: /tmp
+    x-gdc:
+      companions: [redis]
+  redis:
+    image: redis:6
+    volumes:
+      - redis-data:/data
+  web:
+    image: nginx
+    volumes:
+      - ./html:/usr/share/nginx/html
+volumes:
+  mysql-data: {}
+  mysql-logs:
+    name: mysql-logs-${GDC_TEST_SUFFIX}
+  redis-data: {}
+  shared:
+    external: true
+`
+
+func resetTest(t *testing.T) (ComposeInfo, *RecordingRunner) {
+	t.Helper()
+	compose, runner := testComposeInfo(t)
+	compose.MainFile = []byte(resetCompose)
+	t.Setenv("GDC_TEST_SUFFIX", "test")
+	return compose, runner
+}
+
+func TestPlanReset(t *testing.T) {
+	compose, runner := resetTest(t)
+	other, unrelated := t.TempDir(), t.TempDir()
+	claims := map[string][]string{
+		compose.ProjectDir:              {"mysql", "redis"},
+		other:                           {"mysql"},
+		unrelated:                       {"redis"},
+		filepath.Join(other, "removed"): {"mysql"},
+	}
+	written := map[string]Claim{}
+	for project, services := range claims {
+		written[project] = Claim{Project: project, Services: services, Updated: time.Now()}
+	}
+	if err := writeClaims(written); err != nil {
+		t.Fatal(err)
+	}
+	plan, err := PlanReset(compose, "mysql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ResetPlan{
+		Service: "mysql",
+		Volumes: []string{"global_mysql-data", "mysql-logs-test", "shared"},
+		UsedBy:  []string{other},
+	}
+	if !reflect.DeepEqual(plan, want) {
+		t.Errorf("got %+v, want %+v", plan, want)
+	}
+	if executed := runner.Executed(); len(executed) != 0 {
+		t.Errorf("planning ran %q", executed)
+	}
+}
+
+func TestPlanResetErrors(t *testing.T) {
+	compose, _ := resetTest(t)
+	if _, err := PlanReset(compose, "web"); err == nil || err.Error() != "service web has no named volumes to reset" {
+		t.Errorf("expected a no volumes error, got %v", err)
+	}
+	var notFound *ServiceNotFoundError
+	if _, err := PlanReset(compose, "postgres"); !errors.As(err, &notFound) {
+		t.Errorf("expected ServiceNotFoundError, got %v", err)
+	}
+}
+
+func TestReset(t *testing.T) {
+	for _, recreate := range []bool{false, true} {
+		name := "reset"
+		if recreate {
+			name = "recreate"
+		}
+		t.Run(name, func(t *testing.T) {
+			compose, runner := resetTest(t)
+			compose.RequestedServices = []string{"mysql", "web"}
+			plan := ResetPlan{Service: "mysql", Volumes: []string{"global_mysql-data", "mysql-logs-test"}}
+			err := Reset(context.Background(), compose, plan, recreate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []string{
+				composeLine(compose, "rm", "--stop", "--force", "mysql"),
+				"docker volume rm --force global_mysql-data mysql-logs-test",
+			}
+			if recreate {
+				// only the service itself, not its companions or the other
+				// requested services
+				want = append(want,
+					composeLine(compose, "ps", "--format", "json", "mysql"),
+					composeLine(compose, "up", "-d", "mysql"))
+			}
+			if got := runner.Executed(); !reflect.DeepEqual(got, want) {
+				t.Errorf("commands =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+			}
+		})
+	}
+}
+
+func TestResetKeepsVolumesWhenRemoveFails(t *testing.T) {
+	compose, runner := resetTest(t)
+	rm := composeLine(compose, "rm", "--stop", "--force", "mysql")
+	runner.ExitCodes = map[string]int{rm: 1}
+	err := Reset(context.Background(), compose, ResetPlan{Service: "mysql", Volumes: []string{"global_mysql-data"}}, true)
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("expected ExitError, got %v", err)
+	}
+	if got := runner.Executed(); !reflect.DeepEqual(got, []string{rm}) {
+		t.Errorf("expected nothing to run after the failed remove, ran %q", got)
+	}
+}
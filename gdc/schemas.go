@@ -0,0 +1,407 @@
+package gdc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// port the schema-registry service listens on
+const schemaRegistryPort = 8081
+
+const schemaRegistryContentType = "application/vnd.schemaregistry.v1+json"
+
+// Schema types, as the Schema Registry names them.
+const (
+	SchemaAvro     = "AVRO"
+	SchemaProtobuf = "PROTOBUF"
+	SchemaJSON     = "JSON"
+)
+
+// Subject naming strategies, matching the serializers' strategies.
+const (
+	// <topic>-value, or <topic>-key for files named <topic>-key
+	TopicNameStrategy = "topic"
+	// the record's full name
+	RecordNameStrategy = "record"
+	// <topic>-<record's full name>
+	TopicRecordNameStrategy = "topic-record"
+)
+
+// Results of checking a schema against the registry.
+const (
+	SchemaNew          = "new"
+	SchemaUnchanged    = "unchanged"
+	SchemaCompatible   = "compatible"
+	SchemaIncompatible = "incompatible"
+)
+
+var schemaTypes = map[string]string{
+	".avsc":  SchemaAvro,
+	".proto": SchemaProtobuf,
+	".json":  SchemaJSON,
+}
+
+var protoPackage = regexp.MustCompile(`(?m)^\s*package\s+([\w.]+)\s*;`)
+var protoMessage = regexp.MustCompile(`(?m)^\s*message\s+(\w+)`)
+
+// SchemaFile is a local schema and the subject it is registered under.
+type SchemaFile struct {
+	Path    string `json:"path"`
+	Subject string `json:"subject"`
+	Type    string `json:"type"`
+	Schema  string `json:"-"`
+}
+
+// SchemaCheck is how a local schema compares with its subject's latest
+// version in the registry.
+type SchemaCheck struct {
+	SchemaFile
+	Status string `json:"status"`
+	// the subject's latest version, or 0 if it has none; after a push, the
+	// version the schema was registered as
+	Version int `json:"version,omitempty"`
+	ID      int `json:"id,omitempty"`
+	// why the schema is incompatible
+	Messages []string `json:"messages,omitempty"`
+	// changes from the latest version
+	Diff []string `json:"diff,omitempty"`
+	// whether push registered the schema
+	Registered bool `json:"registered,omitempty"`
+}
+
+type registeredSchema struct {
+	Subject    string `json:"subject"`
+	ID         int    `json:"id"`
+	Version    int    `json:"version"`
+	Schema     string `json:"schema"`
+	SchemaType string `json:"schemaType"`
+}
+
+type schemaRequest struct {
+	Schema     string `json:"schema"`
+	SchemaType string `json:"schemaType,omitempty"`
+}
+
+// schemaRecordName is the full name of the record the schema defines.
+func schemaRecordName(schema SchemaFile) (string, error) {
+	switch schema.Type {
+	case SchemaProtobuf:
+		message := protoMessage.FindStringSubmatch(schema.Schema)
+		if message == nil {
+			return "", errors.New("no message defined")
+		}
+		if pkg := protoPackage.FindStringSubmatch(schema.Schema); pkg != nil {
+			return pkg[1] + "." + message[1], nil
+		}
+		return message[1], nil
+	case SchemaJSON:
+		object := struct {
+			Title string `json:"title"`
+		}{}
+		err := json.Unmarshal([]byte(schema.Schema), &object)
+		if err != nil {
+			return "", err
+		}
+		if object.Title == "" {
+			return "", errors.New("no title given")
+		}
+		return object.Title, nil
+	default:
+		record := struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		}{}
+		err := json.Unmarshal([]byte(schema.Schema), &record)
+		if err != nil {
+			return "", fmt.Errorf("not a named Avro type: %w", err)
+		}
+		if record.Name == "" {
+			return "", errors.New("not a named Avro type")
+		}
+		if record.Namespace == "" || strings.Contains(record.Name, ".") {
+			return record.Name, nil
+		}
+		return record.Namespace + "." + record.Name, nil
+	}
+}
+
+// schemaSubject names the subject for the schema with the strategy. The
+// topic is the file's name without its extension; a -key or -value suffix
+// says which part of the message the schema is for, and value is assumed
+// without one.
+func schemaSubject(schema SchemaFile, strategy string) (string, error) {
+	topic := strings.TrimSuffix(filepath.Base(schema.Path), filepath.Ext(schema.Path))
+	suffix := "-value"
+	for _, s := range []string{"-key", "-value"} {
+		if strings.HasSuffix(topic, s) {
+			topic, suffix = strings.TrimSuffix(topic, s), s
+		}
+	}
+	switch strategy {
+	case TopicNameStrategy, "":
+		return topic + suffix, nil
+	case RecordNameStrategy, TopicRecordNameStrategy:
+		record, err := schemaRecordName(schema)
+		if err != nil {
+			return "", fmt.Errorf("cannot name subject for %s: %w", schema.Path, err)
+		}
+		if strategy == RecordNameStrategy {
+			return record, nil
+		}
+		return topic + "-" + record, nil
+	}
+	return "", fmt.Errorf("unknown subject naming strategy %s - expected %s, %s or %s",
+		strategy, TopicNameStrategy, RecordNameStrategy, TopicRecordNameStrategy)
+}
+
+// LoadSchemas finds the .avsc, .proto and .json schemas in the directory and
+// its subdirectories, and names their subjects with the strategy.
+func LoadSchemas(dir string, strategy string) ([]SchemaFile, error) {
+	schemas := []SchemaFile{}
+	subjects := map[string]string{}
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		schemaType, found := schemaTypes[strings.ToLower(filepath.Ext(path))]
+		if entry.IsDir() || !found {
+			return nil
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		schema := SchemaFile{Path: path, Type: schemaType, Schema: string(data)}
+		if schemaType != SchemaProtobuf && !json.Valid(data) {
+			return fmt.Errorf("%s is not valid JSON", path)
+		}
+		schema.Subject, err = schemaSubject(schema, strategy)
+		if err != nil {
+			return err
+		}
+		if other, found := subjects[schema.Subject]; found {
+			return fmt.Errorf("%s and %s are both for subject %s", other, path, schema.Subject)
+		}
+		subjects[schema.Subject] = path
+		schemas = append(schemas, schema)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(schemas) == 0 {
+		return nil, fmt.Errorf("no .avsc, .proto or .json schemas found in %s", dir)
+	}
+	return schemas, nil
+}
+
+// schemaRegistryURL is the base URL of the requested schema-registry
+// service's API.
+func schemaRegistryURL(compose ComposeInfo, command string) (string, error) {
+	address, err := serviceAddress(compose, command, "schema-registry", schemaRegistryPort)
+	if err != nil {
+		return "", err
+	}
+	return "http://" + address, nil
+}
+
+// registryErrorCode is the Schema Registry's error code in an API error, or
+// 0 if there is none.
+func registryErrorCode(err error) int {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return 0
+	}
+	body := struct {
+		ErrorCode int `json:"error_code"`
+	}{}
+	json.Unmarshal([]byte(apiErr.Body), &body)
+	return body.ErrorCode
+}
+
+// the registry's error codes for a subject or a schema that isn't there
+const (
+	registrySubjectNotFound = 40401
+	registrySchemaNotFound  = 40403
+)
+
+func (schema SchemaFile) request() schemaRequest {
+	request := schemaRequest{Schema: schema.Schema}
+	if schema.Type != SchemaAvro {
+		request.SchemaType = schema.Type
+	}
+	return request
+}
+
+// schemaLines splits a schema into lines to diff, with JSON schemas laid out
+// the same way so only real changes show.
+func schemaLines(schemaType string, schema string) []string {
+	if schemaType != SchemaProtobuf {
+		var value interface{}
+		if err := json.Unmarshal([]byte(schema), &value); err == nil {
+			if data, err := json.MarshalIndent(value, "", "  "); err == nil {
+				schema = string(data)
+			}
+		}
+	}
+	return strings.Split(strings.TrimRight(schema, "\n"), "\n")
+}
+
+// CheckSchemas compares each schema with the latest version of its subject
+// in the registry, checking the changed ones are compatible with it.
+func CheckSchemas(ctx context.Context, compose ComposeInfo, schemas []SchemaFile) ([]SchemaCheck, error) {
+	base, err := schemaRegistryURL(compose, "schemas")
+	if err != nil {
+		return nil, err
+	}
+	checks := []SchemaCheck{}
+	for _, schema := range schemas {
+		check := SchemaCheck{SchemaFile: schema}
+		subject := url.PathEscape(schema.Subject)
+
+		latest := registeredSchema{}
+		err := apiRequest(ctx, http.MethodGet, base+"/subjects/"+subject+"/versions/latest", schemaRegistryContentType, nil, &latest)
+		if registryErrorCode(err) == registrySubjectNotFound {
+			check.Status = SchemaNew
+			check.Diff = diffLines(nil, schemaLines(schema.Type, schema.Schema))
+			checks = append(checks, check)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading subject %s: %w", schema.Subject, err)
+		}
+		check.Version = latest.Version
+		check.ID = latest.ID
+
+		// the registry compares schemas in their canonical form, so an
+		// unchanged schema is found even if it is formatted differently
+		existing := registeredSchema{}
+		err = apiRequest(ctx, http.MethodPost, base+"/subjects/"+subject, schemaRegistryContentType, schema.request(), &existing)
+		if err == nil && existing.Version == latest.Version {
+			check.Status = SchemaUnchanged
+			checks = append(checks, check)
+			continue
+		}
+		if err != nil && registryErrorCode(err) != registrySchemaNotFound {
+			return nil, fmt.Errorf("error looking up schema %s: %w", schema.Path, err)
+		}
+
+		compatibility := struct {
+			IsCompatible bool     `json:"is_compatible"`
+			Messages     []string `json:"messages"`
+		}{}
+		err = apiRequest(ctx, http.MethodPost, base+"/compatibility/subjects/"+subject+"/versions/latest?verbose=true",
+			schemaRegistryContentType, schema.request(), &compatibility)
+		if err != nil {
+			return nil, fmt.Errorf("error checking compatibility of %s: %w", schema.Path, err)
+		}
+		check.Status = SchemaCompatible
+		if !compatibility.IsCompatible {
+			check.Status = SchemaIncompatible
+			check.Messages = compatibility.Messages
+		}
+		check.Diff = diffLines(schemaLines(latest.SchemaType, latest.Schema), schemaLines(schema.Type, schema.Schema))
+		checks = append(checks, check)
+	}
+	return checks, nil
+}
+
+// IncompatibleSchemasError is returned when schemas are not compatible with
+// the latest versions of their subjects.
+type IncompatibleSchemasError struct {
+	Subjects []string
+}
+
+func (e *IncompatibleSchemasError) Error() string {
+	return fmt.Sprintf("schemas are not compatible with the registered versions of %s", strings.Join(e.Subjects, ", "))
+}
+
+// IncompatibleSchemas returns an IncompatibleSchemasError if any check failed.
+func IncompatibleSchemas(checks []SchemaCheck) error {
+	subjects := []string{}
+	for _, check := range checks {
+		if check.Status == SchemaIncompatible {
+			subjects = append(subjects, check.Subject)
+		}
+	}
+	if len(subjects) > 0 {
+		return &IncompatibleSchemasError{Subjects: subjects}
+	}
+	return nil
+}
+
+// PushSchemas registers the new and changed schemas from the checks. If any
+// is incompatible none are registered and an IncompatibleSchemasError is
+// returned. The checks are updated with the versions registered.
+func PushSchemas(ctx context.Context, compose ComposeInfo, checks []SchemaCheck) error {
+	err := IncompatibleSchemas(checks)
+	if err != nil {
+		return err
+	}
+	base, err := schemaRegistryURL(compose, "schemas")
+	if err != nil {
+		return err
+	}
+	for i, check := range checks {
+		if check.Status == SchemaUnchanged {
+			continue
+		}
+		subject := url.PathEscape(check.Subject)
+		if dryRunRequest(compose, "schema-registry", fmt.Sprintf("register %s as %s", check.Path, check.Subject)) {
+			continue
+		}
+		err = apiRequest(ctx, http.MethodPost, base+"/subjects/"+subject+"/versions", schemaRegistryContentType, check.request(), nil)
+		if err != nil {
+			return fmt.Errorf("error registering %s as %s: %w", check.Path, check.Subject, err)
+		}
+		registered := registeredSchema{}
+		err = apiRequest(ctx, http.MethodPost, base+"/subjects/"+subject, schemaRegistryContentType, check.request(), &registered)
+		if err != nil {
+			return fmt.Errorf("error looking up %s after registering it: %w", check.Subject, err)
+		}
+		checks[i].Version = registered.Version
+		checks[i].ID = registered.ID
+		checks[i].Registered = true
+	}
+	return nil
+}
+
+// PrintSchemaChecks describes how each schema compares with the registry,
+// with the changes from the latest version.
+func PrintSchemaChecks(w io.Writer, checks []SchemaCheck) {
+	for _, check := range checks {
+		switch {
+		case check.Registered:
+			mark := "~"
+			if check.Status == SchemaNew {
+				mark = "+"
+			}
+			fmt.Fprintf(w, "%s %s (%s): registered as version %d, id %d\n", mark, check.Subject, check.Path, check.Version, check.ID)
+		case check.Status == SchemaNew:
+			fmt.Fprintf(w, "+ %s (%s): new subject\n", check.Subject, check.Path)
+		case check.Status == SchemaUnchanged:
+			fmt.Fprintf(w, "  %s (%s): unchanged, version %d\n", check.Subject, check.Path, check.Version)
+			continue
+		case check.Status == SchemaCompatible:
+			fmt.Fprintf(w, "~ %s (%s): version %d -> %d, compatible\n", check.Subject, check.Path, check.Version, check.Version+1)
+		case check.Status == SchemaIncompatible:
+			fmt.Fprintf(w, "! %s (%s): not compatible with version %d\n", check.Subject, check.Path, check.Version)
+			for _, message := range check.Messages {
+				fmt.Fprintf(w, "    %s\n", message)
+			}
+		}
+		for _, line := range check.Diff {
+			fmt.Fprintf(w, "    %s\n", line)
+		}
+	}
+}
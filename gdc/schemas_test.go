@@ -0,0 +1,241 @@
+package gdc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeRegistry is enough of the Schema Registry API for checking and pushing
+// schemas. A schema is incompatible if it has a field named "required", as if
+// it had been added without a default.
+type fakeRegistry struct {
+	mutex    sync.Mutex
+	subjects map[string][]registeredSchema
+	nextID   int
+	// registrations made, as "subject:version"
+	registered []string
+}
+
+func newFakeRegistry(t *testing.T) (*fakeRegistry, ComposeInfo) {
+	registry := &fakeRegistry{subjects: map[string][]registeredSchema{}, nextID: 1}
+	server := httptest.NewServer(registry)
+	t.Cleanup(server.Close)
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	compose := ComposeInfo{
+		MainFile:          []byte(fmt.Sprintf("services:\n  schema-registry:\n    image: confluentinc/cp-schema-registry\n    ports: [\"%s:8081\"]\n", port)),
+		RequestedServices: []string{"schema-registry"},
+		Runner:            &RecordingRunner{},
+	}
+	return registry, compose
+}
+
+// canonical form of a schema, which the registry compares schemas by
+func canonicalSchema(schema string) string {
+	buf := bytes.Buffer{}
+	if err := json.Compact(&buf, []byte(schema)); err != nil {
+		return schema
+	}
+	return buf.String()
+}
+
+func (r *fakeRegistry) add(subject string, schema string) {
+	versions := r.subjects[subject]
+	r.subjects[subject] = append(versions, registeredSchema{
+		Subject: subject, ID: r.nextID, Version: len(versions) + 1, Schema: schema, SchemaType: SchemaAvro,
+	})
+	r.nextID++
+}
+
+func (r *fakeRegistry) fail(w http.ResponseWriter, status int, code int) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"error_code": code, "message": "not found"})
+}
+
+func (r *fakeRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	request := schemaRequest{}
+	json.NewDecoder(req.Body).Decode(&request)
+	parts := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	if parts[0] == "compatibility" {
+		parts = parts[1:]
+	}
+	versions := r.subjects[parts[1]]
+	switch {
+	case strings.HasPrefix(req.URL.Path, "/compatibility/"):
+		if strings.Contains(request.Schema, `"required"`) {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"is_compatible": false,
+				"messages":      []string{"READER_FIELD_MISSING_DEFAULT_VALUE: required"},
+			})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"is_compatible": true})
+	case len(versions) == 0 && req.Method == http.MethodGet:
+		r.fail(w, http.StatusNotFound, registrySubjectNotFound)
+	case req.Method == http.MethodGet:
+		json.NewEncoder(w).Encode(versions[len(versions)-1])
+	case len(parts) == 3:
+		r.add(parts[1], request.Schema)
+		r.registered = append(r.registered, fmt.Sprintf("%s:%d", parts[1], len(r.subjects[parts[1]])))
+		json.NewEncoder(w).Encode(map[string]int{"id": r.nextID - 1})
+	default:
+		for _, version := range versions {
+			if canonicalSchema(version.Schema) == canonicalSchema(request.Schema) {
+				json.NewEncoder(w).Encode(version)
+				return
+			}
+		}
+		status := registrySchemaNotFound
+		if len(versions) == 0 {
+			status = registrySubjectNotFound
+		}
+		r.fail(w, http.StatusNotFound, status)
+	}
+}
+
+const userSchema = `{"type": "record", "name": "User", "namespace": "com.example", "fields": [{"name": "id", "type": "string"}]}`
+
+// writeSchemas writes the schemas, keyed by file name, to a directory and
+// loads them.
+func writeSchemas(t *testing.T, files map[string]string) []SchemaFile {
+	dir := t.TempDir()
+	for name, schema := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(schema), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	schemas, err := LoadSchemas(dir, TopicNameStrategy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schemas
+}
+
+func TestCheckSchemas(t *testing.T) {
+	registry, compose := newFakeRegistry(t)
+	registry.add("users-value", userSchema)
+	registry.add("orders-value", `{"type": "record", "name": "Order", "fields": [{"name": "id", "type": "string"}]}`)
+	registry.add("invoices-value", `{"type": "record", "name": "Invoice", "fields": [{"name": "id", "type": "string"}]}`)
+	schemas := writeSchemas(t, map[string]string{
+		// reformatted, but the same schema
+		"users.avsc":    strings.ReplaceAll(userSchema, " ", ""),
+		"orders.avsc":   `{"type": "record", "name": "Order", "fields": [{"name": "id", "type": "string"}, {"name": "note", "type": ["null", "string"], "default": null}]}`,
+		"invoices.avsc": `{"type": "record", "name": "Invoice", "fields": [{"name": "id", "type": "string"}, {"name": "required", "type": "string"}]}`,
+		"stores.avsc":   `{"type": "record", "name": "Store", "fields": []}`,
+	})
+
+	checks, err := CheckSchemas(context.Background(), compose, schemas)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	statuses := map[string]string{}
+	for _, check := range checks {
+		statuses[check.Subject] = check.Status
+	}
+	want := map[string]string{
+		"users-value":    SchemaUnchanged,
+		"orders-value":   SchemaCompatible,
+		"invoices-value": SchemaIncompatible,
+		"stores-value":   SchemaNew,
+	}
+	for subject, status := range want {
+		if statuses[subject] != status {
+			t.Errorf("%s is %s, want %s", subject, statuses[subject], status)
+		}
+	}
+
+	out := bytes.Buffer{}
+	PrintSchemaChecks(&out, checks)
+	for _, line := range []string{
+		"~ orders-value (",
+		"): version 1 -> 2, compatible",
+		`+    {`,
+		"! invoices-value (",
+		"    READER_FIELD_MISSING_DEFAULT_VALUE: required",
+		"+ stores-value (",
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("output is missing %q:\n%s", line, out.String())
+		}
+	}
+
+	var incompatible *IncompatibleSchemasError
+	err = PushSchemas(context.Background(), compose, checks)
+	if !errors.As(err, &incompatible) || strings.Join(incompatible.Subjects, ",") != "invoices-value" {
+		t.Fatalf("expected invoices-value to be incompatible, got %v", err)
+	}
+	if len(registry.registered) != 0 {
+		t.Errorf("registered %v although a schema is incompatible", registry.registered)
+	}
+}
+
+func TestPushSchemas(t *testing.T) {
+	registry, compose := newFakeRegistry(t)
+	registry.add("users-value", userSchema)
+	schemas := writeSchemas(t, map[string]string{
+		"users.avsc":      `{"type": "record", "name": "User", "namespace": "com.example", "fields": [{"name": "id", "type": "string"}, {"name": "email", "type": ["null", "string"], "default": null}]}`,
+		"stores-key.avsc": `{"type": "record", "name": "StoreKey", "fields": []}`,
+	})
+	checks, err := CheckSchemas(context.Background(), compose, schemas)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err = PushSchemas(context.Background(), compose, checks); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := strings.Join(registry.registered, " "); got != "stores-key:1 users-value:2" {
+		t.Errorf("registered %s", got)
+	}
+	for _, check := range checks {
+		if !check.Registered || check.ID == 0 {
+			t.Errorf("check %+v was not updated with the registered version", check)
+		}
+	}
+
+	// pushing again changes nothing
+	checks, err = CheckSchemas(context.Background(), compose, schemas)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err = PushSchemas(context.Background(), compose, checks); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(registry.registered) != 2 {
+		t.Errorf("registered %v again", registry.registered[2:])
+	}
+}
+
+func TestPushSchemasDryRun(t *testing.T) {
+	registry, compose := newFakeRegistry(t)
+	schemas := writeSchemas(t, map[string]string{"stores.avsc": `{"type": "record", "name": "Store", "fields": []}`})
+	checks, err := CheckSchemas(context.Background(), compose, schemas)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	plan := &Plan{}
+	compose.Runner = plan
+	if err = PushSchemas(context.Background(), compose, checks); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(registry.registered) != 0 {
+		t.Errorf("dry run registered %v", registry.registered)
+	}
+	if len(plan.Steps) != 1 || !strings.HasSuffix(plan.Steps[0].Request, "stores.avsc as stores-value") {
+		t.Errorf("plan = %+v", plan.Steps)
+	}
+	if checks[0].Registered {
+		t.Error("dry run marked the schema registered")
+	}
+}
@@ -0,0 +1,325 @@
+package gdc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+)
+
+// SearchQuery is a query to run against OpenSearch: query DSL against an
+// index, SQL, PPL or one of the _cat APIs. Projects can keep named queries
+// under opensearch_queries in .gdc.yml:
+//
+//	opensearch_queries:
+//	  top-flyers:
+//	    index: flyers
+//	    dsl: {query: {match_all: {}}, sort: [{views: desc}]}
+//	  flyer-counts:
+//	    sql: SELECT merchant, COUNT(*) FROM flyers GROUP BY merchant
+type SearchQuery struct {
+	Index string `yaml:"index,omitempty" json:"index,omitempty"`
+	// the search request body, as an object or a JSON string; match_all if
+	// only an index is given
+	DSL interface{} `yaml:"dsl,omitempty" json:"dsl,omitempty"`
+	SQL string      `yaml:"sql,omitempty" json:"sql,omitempty"`
+	PPL string      `yaml:"ppl,omitempty" json:"ppl,omitempty"`
+	// the _cat API to call, e.g. indices, shards or health
+	Cat string `yaml:"cat,omitempty" json:"cat,omitempty"`
+	// hits to return from a DSL query that doesn't give a size
+	Size int `yaml:"size,omitempty" json:"size,omitempty"`
+}
+
+// SearchResult is the response to a query, and the rows it holds as a table.
+type SearchResult struct {
+	Columns []string
+	Rows    [][]string
+	// e.g. "10 of 1234 hits", if there is one
+	Summary string
+	// aggregations in a DSL query's response
+	Aggregations json.RawMessage
+	// the response as OpenSearch returned it
+	Response json.RawMessage
+}
+
+var catName = regexp.MustCompile(`^[a-z_]+(/[a-z_]+)?$`)
+
+// jsonKeys converts the maps YAML decodes objects into, which can have keys
+// of any type, into maps JSON can encode.
+func jsonKeys(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[interface{}]interface{}:
+		result := map[string]interface{}{}
+		for key, v := range value {
+			result[fmt.Sprint(key)] = jsonKeys(v)
+		}
+		return result
+	case map[string]interface{}:
+		result := map[string]interface{}{}
+		for key, v := range value {
+			result[key] = jsonKeys(v)
+		}
+		return result
+	case []interface{}:
+		result := []interface{}{}
+		for _, v := range value {
+			result = append(result, jsonKeys(v))
+		}
+		return result
+	}
+	return value
+}
+
+// searchBody is the request body of a DSL query.
+func searchBody(query SearchQuery) (map[string]interface{}, error) {
+	body := map[string]interface{}{}
+	switch dsl := query.DSL.(type) {
+	case nil:
+		body["query"] = map[string]interface{}{"match_all": map[string]interface{}{}}
+	case string:
+		if err := json.Unmarshal([]byte(dsl), &body); err != nil {
+			return nil, fmt.Errorf("query DSL is not a JSON object: %w", err)
+		}
+	default:
+		object, ok := jsonKeys(dsl).(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("query DSL is not an object")
+		}
+		body = object
+	}
+	if _, found := body["size"]; !found && query.Size > 0 {
+		body["size"] = query.Size
+	}
+	return body, nil
+}
+
+// objectKeys is the keys of a JSON object in the order they appear.
+func objectKeys(data json.RawMessage) []string {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return nil
+	}
+	keys := []string{}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return keys
+		}
+		keys = append(keys, token.(string))
+		value := json.RawMessage{}
+		if err := decoder.Decode(&value); err != nil {
+			return keys
+		}
+	}
+	return keys
+}
+
+// cell is a JSON value as it is shown in a table: strings as they are,
+// nothing for null and anything else as compact JSON.
+func cell(value json.RawMessage) string {
+	var str string
+	if err := json.Unmarshal(value, &str); err == nil {
+		return str
+	}
+	if len(value) == 0 || string(value) == "null" {
+		return ""
+	}
+	buf := bytes.Buffer{}
+	if err := json.Compact(&buf, value); err != nil {
+		return string(value)
+	}
+	return buf.String()
+}
+
+// objectRows turns JSON objects into rows, with a column for each key in the
+// order they are first seen, after the leading columns.
+func objectRows(objects []map[string]json.RawMessage, raw []json.RawMessage, leading []string) ([]string, [][]string) {
+	columns := append([]string{}, leading...)
+	for _, object := range raw {
+		for _, key := range objectKeys(object) {
+			if !contains(columns, key) {
+				columns = append(columns, key)
+			}
+		}
+	}
+	rows := [][]string{}
+	for _, object := range objects {
+		row := []string{}
+		for _, column := range columns {
+			row = append(row, cell(object[column]))
+		}
+		rows = append(rows, row)
+	}
+	return columns, rows
+}
+
+// hitsResult tabulates the hits of a DSL query, with a column for each field
+// of their sources.
+func hitsResult(data json.RawMessage) (SearchResult, error) {
+	result := SearchResult{Response: data}
+	response := struct {
+		Hits struct {
+			Total struct {
+				Value    int    `json:"value"`
+				Relation string `json:"relation"`
+			} `json:"total"`
+			Hits []struct {
+				Index  string          `json:"_index"`
+				ID     string          `json:"_id"`
+				Score  *float64        `json:"_score"`
+				Source json.RawMessage `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+		Aggregations json.RawMessage `json:"aggregations"`
+	}{}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return result, err
+	}
+	indices := map[string]bool{}
+	for _, hit := range response.Hits.Hits {
+		indices[hit.Index] = true
+	}
+	leading := []string{"_id", "_score"}
+	if len(indices) > 1 {
+		leading = append([]string{"_index"}, leading...)
+	}
+	objects := []map[string]json.RawMessage{}
+	sources := []json.RawMessage{}
+	for _, hit := range response.Hits.Hits {
+		object := map[string]json.RawMessage{}
+		json.Unmarshal(hit.Source, &object)
+		object["_index"], _ = json.Marshal(hit.Index)
+		object["_id"], _ = json.Marshal(hit.ID)
+		if hit.Score != nil {
+			object["_score"], _ = json.Marshal(*hit.Score)
+		}
+		objects = append(objects, object)
+		sources = append(sources, hit.Source)
+	}
+	result.Columns, result.Rows = objectRows(objects, sources, leading)
+	total := strconv.Itoa(response.Hits.Total.Value)
+	if response.Hits.Total.Relation == "gte" {
+		total += "+"
+	}
+	result.Summary = fmt.Sprintf("%d of %s hits", len(response.Hits.Hits), total)
+	result.Aggregations = response.Aggregations
+	return result, nil
+}
+
+// rowsResult tabulates the response of a SQL or PPL query.
+func rowsResult(data json.RawMessage) (SearchResult, error) {
+	result := SearchResult{Response: data}
+	response := struct {
+		Schema []struct {
+			Name  string `json:"name"`
+			Alias string `json:"alias"`
+		} `json:"schema"`
+		Rows  [][]json.RawMessage `json:"datarows"`
+		Total int                 `json:"total"`
+	}{}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return result, err
+	}
+	for _, column := range response.Schema {
+		if column.Alias != "" {
+			result.Columns = append(result.Columns, column.Alias)
+		} else {
+			result.Columns = append(result.Columns, column.Name)
+		}
+	}
+	for _, values := range response.Rows {
+		row := []string{}
+		for _, value := range values {
+			row = append(row, cell(value))
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	result.Summary = fmt.Sprintf("%d rows", len(result.Rows))
+	if response.Total > len(result.Rows) {
+		result.Summary = fmt.Sprintf("%d of %d rows", len(result.Rows), response.Total)
+	}
+	return result, nil
+}
+
+// catResult tabulates the response of a _cat API.
+func catResult(data json.RawMessage) (SearchResult, error) {
+	result := SearchResult{Response: data}
+	raw := []json.RawMessage{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return result, err
+	}
+	objects := []map[string]json.RawMessage{}
+	for _, item := range raw {
+		object := map[string]json.RawMessage{}
+		if err := json.Unmarshal(item, &object); err != nil {
+			return result, err
+		}
+		objects = append(objects, object)
+	}
+	result.Columns, result.Rows = objectRows(objects, raw, nil)
+	return result, nil
+}
+
+// RunSearchQuery sends the query to the requested opensearch service.
+func RunSearchQuery(ctx context.Context, compose ComposeInfo, query SearchQuery) (SearchResult, error) {
+	kinds := 0
+	for _, set := range []bool{query.DSL != nil, query.SQL != "", query.PPL != "", query.Cat != ""} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds > 1 {
+		return SearchResult{}, errors.New("a query can only be one of DSL, SQL, PPL or _cat")
+	}
+	if kinds == 0 && query.Index == "" {
+		return SearchResult{}, errors.New("nothing to query - give an index and query DSL, SQL, PPL or a _cat API")
+	}
+	if query.Index != "" && (query.SQL != "" || query.PPL != "" || query.Cat != "") {
+		return SearchResult{}, errors.New("an index can only be given with query DSL - SQL and PPL name it in the query")
+	}
+	if query.Cat != "" && !catName.MatchString(query.Cat) {
+		return SearchResult{}, fmt.Errorf("invalid _cat API %s - expected e.g. indices, shards or health", query.Cat)
+	}
+	base, err := opensearchURL(compose, "opensearch")
+	if err != nil {
+		return SearchResult{}, err
+	}
+
+	data := json.RawMessage{}
+	var tabulate func(json.RawMessage) (SearchResult, error)
+	switch {
+	case query.SQL != "":
+		err = apiRequest(ctx, http.MethodPost, base+"/_plugins/_sql", "application/json", map[string]string{"query": query.SQL}, &data)
+		tabulate = rowsResult
+	case query.PPL != "":
+		err = apiRequest(ctx, http.MethodPost, base+"/_plugins/_ppl", "application/json", map[string]string{"query": query.PPL}, &data)
+		tabulate = rowsResult
+	case query.Cat != "":
+		err = apiRequest(ctx, http.MethodGet, base+"/_cat/"+query.Cat+"?format=json", "application/json", nil, &data)
+		tabulate = catResult
+	default:
+		body, bodyErr := searchBody(query)
+		if bodyErr != nil {
+			return SearchResult{}, bodyErr
+		}
+		path := "/_search"
+		if query.Index != "" {
+			path = "/" + url.PathEscape(query.Index) + path
+		}
+		err = apiRequest(ctx, http.MethodPost, base+path, "application/json", body, &data)
+		tabulate = hitsResult
+	}
+	if err != nil {
+		return SearchResult{}, fmt.Errorf("error running query: %s", opensearchMessage(err))
+	}
+	result, err := tabulate(data)
+	if err != nil {
+		return result, fmt.Errorf("error reading query response: %w", err)
+	}
+	return result, nil
+}
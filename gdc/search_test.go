@@ -0,0 +1,232 @@
+package gdc
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestSearchBody(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		body  string
+		err   string
+	}{
+		{
+			name:  "index only",
+			query: "index: flyers",
+			body:  `{"query":{"match_all":{}}}`,
+		},
+		{
+			name:  "index and size",
+			query: "index: flyers\nsize: 5",
+			body:  `{"query":{"match_all":{}},"size":5}`,
+		},
+		{
+			name:  "yaml dsl",
+			query: "dsl: {query: {term: {merchant: 12}}, sort: [{views: desc}]}\nsize: 5",
+			body:  `{"query":{"term":{"merchant":12}},"size":5,"sort":[{"views":"desc"}]}`,
+		},
+		{
+			name:  "json string dsl",
+			query: `dsl: '{"query": {"match": {"title": "milk"}}}'` + "\nsize: 5",
+			body:  `{"query":{"match":{"title":"milk"}},"size":5}`,
+		},
+		{
+			name:  "dsl with its own size",
+			query: "dsl: {size: 2, query: {match_all: {}}}\nsize: 5",
+			body:  `{"query":{"match_all":{}},"size":2}`,
+		},
+		{
+			name:  "json string dsl with its own size",
+			query: `dsl: '{"size": 0, "aggs": {"m": {"terms": {"field": "merchant"}}}}'` + "\nsize: 5",
+			body:  `{"aggs":{"m":{"terms":{"field":"merchant"}}},"size":0}`,
+		},
+		{
+			name:  "string dsl that isn't json",
+			query: "dsl: match everything",
+			err:   "query DSL is not a JSON object",
+		},
+		{
+			name:  "dsl that isn't an object",
+			query: "dsl: [1, 2]",
+			err:   "query DSL is not an object",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			query := SearchQuery{}
+			if err := yaml.Unmarshal([]byte(test.query), &query); err != nil {
+				t.Fatal(err)
+			}
+			body, err := searchBody(query)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected an error containing %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := json.Marshal(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != test.body {
+				t.Errorf("body = %s, want %s", data, test.body)
+			}
+		})
+	}
+}
+
+func TestJSONKeys(t *testing.T) {
+	// yaml.v2 and some config loaders decode objects with keys of any type
+	dsl := map[interface{}]interface{}{"query": map[interface{}]interface{}{"term": map[interface{}]interface{}{1: "x"}}}
+	body, err := searchBody(SearchQuery{DSL: dsl})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := json.Marshal(body); string(data) != `{"query":{"term":{"1":"x"}}}` {
+		t.Errorf("body = %s", data)
+	}
+}
+
+// searchResultTest is a table a result should hold.
+type searchResultTest struct {
+	name     string
+	response string
+	columns  []string
+	rows     [][]string
+	summary  string
+}
+
+func checkSearchResult(t *testing.T, test searchResultTest, tabulate func(json.RawMessage) (SearchResult, error)) {
+	t.Helper()
+	result, err := tabulate(json.RawMessage(test.response))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result.Columns, test.columns) {
+		t.Errorf("columns = %q, want %q", result.Columns, test.columns)
+	}
+	if !reflect.DeepEqual(result.Rows, test.rows) {
+		t.Errorf("rows = %q, want %q", result.Rows, test.rows)
+	}
+	if result.Summary != test.summary {
+		t.Errorf("summary = %q, want %q", result.Summary, test.summary)
+	}
+	if string(result.Response) != test.response {
+		t.Errorf("expected the response to be kept")
+	}
+}
+
+func TestHitsResult(t *testing.T) {
+	tests := []searchResultTest{
+		{
+			name: "columns in source order",
+			response: `{"hits": {"total": {"value": 2, "relation": "eq"}, "hits": [
+				{"_index": "flyers", "_id": "1", "_score": 1.5, "_source": {"title": "Milk", "views": 10, "tags": ["dairy"]}},
+				{"_index": "flyers", "_id": "2", "_score": 1, "_source": {"title": "Eggs", "merchant": {"id": 3}, "sale": null}}
+			]}}`,
+			columns: []string{"_id", "_score", "title", "views", "tags", "merchant", "sale"},
+			rows: [][]string{
+				{"1", "1.5", "Milk", "10", `["dairy"]`, "", ""},
+				{"2", "1", "Eggs", "", "", `{"id":3}`, ""},
+			},
+			summary: "2 of 2 hits",
+		},
+		{
+			name: "several indices",
+			response: `{"hits": {"total": {"value": 2, "relation": "eq"}, "hits": [
+				{"_index": "flyers-1", "_id": "1", "_score": null, "_source": {"title": "Milk"}},
+				{"_index": "flyers-2", "_id": "1", "_score": null, "_source": {"title": "Eggs"}}
+			]}}`,
+			columns: []string{"_index", "_id", "_score", "title"},
+			rows: [][]string{
+				{"flyers-1", "1", "", "Milk"},
+				{"flyers-2", "1", "", "Eggs"},
+			},
+			summary: "2 of 2 hits",
+		},
+		{
+			name: "lower bound on the total",
+			response: `{"hits": {"total": {"value": 10000, "relation": "gte"}, "hits": [
+				{"_index": "flyers", "_id": "1", "_score": 1, "_source": {"title": "Milk"}}
+			]}}`,
+			columns: []string{"_id", "_score", "title"},
+			rows:    [][]string{{"1", "1", "Milk"}},
+			summary: "1 of 10000+ hits",
+		},
+		{
+			name:     "no hits",
+			response: `{"hits": {"total": {"value": 0, "relation": "eq"}, "hits": []}, "aggregations": {"m": {"buckets": []}}}`,
+			columns:  []string{"_id", "_score"},
+			rows:     [][]string{},
+			summary:  "0 of 0 hits",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			checkSearchResult(t, test, hitsResult)
+		})
+	}
+}
+
+func TestHitsResultAggregations(t *testing.T) {
+	result, err := hitsResult(json.RawMessage(`{"hits": {"hits": []}, "aggregations": {"m": {"buckets": []}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(result.Aggregations) != `{"m": {"buckets": []}}` {
+		t.Errorf("aggregations = %s", result.Aggregations)
+	}
+}
+
+func TestRowsResult(t *testing.T) {
+	tests := []searchResultTest{
+		{
+			name: "sql with aliases",
+			response: `{"schema": [{"name": "merchant", "type": "long"}, {"name": "COUNT(*)", "alias": "flyers", "type": "integer"}],
+				"datarows": [[3, 12], [4, null]], "total": 2, "size": 2, "status": 200}`,
+			columns: []string{"merchant", "flyers"},
+			rows:    [][]string{{"3", "12"}, {"4", ""}},
+			summary: "2 rows",
+		},
+		{
+			name: "more rows than returned",
+			response: `{"schema": [{"name": "title", "type": "text"}],
+				"datarows": [["Milk"]], "total": 200, "size": 1}`,
+			columns: []string{"title"},
+			rows:    [][]string{{"Milk"}},
+			summary: "1 of 200 rows",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			checkSearchResult(t, test, rowsResult)
+		})
+	}
+}
+
+func TestCatResult(t *testing.T) {
+	checkSearchResult(t, searchResultTest{
+		response: `[
+			{"health": "green", "status": "open", "index": "flyers", "docs.count": "12"},
+			{"health": "yellow", "status": "open", "index": "merchants", "docs.count": "3", "pri": "1"}
+		]`,
+		columns: []string{"health", "status", "index", "docs.count", "pri"},
+		rows: [][]string{
+			{"green", "open", "flyers", "12", ""},
+			{"yellow", "open", "merchants", "3", "1"},
+		},
+	}, catResult)
+
+	if _, err := catResult(json.RawMessage(`{"error": "not an array"}`)); err == nil {
+		t.Error("expected an error for a response that isn't an array")
+	}
+}
@@ -0,0 +1,499 @@
+package gdc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// image of the helper container volumes are archived and restored with
+var snapshotHelperImage = "alpine:3.20"
+
+// name of the metadata file in a snapshot's directory
+const snapshotMetadata = "snapshot.json"
+
+var snapshotName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+var imageMajorVersion = regexp.MustCompile(`^v?(\d+)`)
+
+// ImageIdentity is what is known about the image a service runs.
+type ImageIdentity struct {
+	Image string `json:"image"`
+	// Docker's ID of the image, if it could be inspected
+	ImageID string `json:"image_id,omitempty"`
+	// the version the image's environment gives, e.g. REDIS_VERSION=7.2.4
+	ImageVersion string `json:"image_version,omitempty"`
+}
+
+// Snapshot of the named volumes of a service.
+type Snapshot struct {
+	Service string `json:"service"`
+	Name    string `json:"name"`
+	// image the service ran when the snapshot was taken
+	ImageIdentity
+	GdcVersion string    `json:"gdc_version"`
+	Created    time.Time `json:"created"`
+	// size of the archives in bytes
+	Size int64 `json:"size"`
+	// the service's volumes, as named in the compose files
+	Volumes []string `json:"volumes"`
+}
+
+// SnapshotOptions control saving and restoring snapshots.
+type SnapshotOptions struct {
+	// for save, replace an existing snapshot of the same name; for restore,
+	// restore even if the snapshot was taken with an incompatible image
+	Force bool
+	// where to report progress, if anywhere
+	Progress io.Writer
+}
+
+func snapshotsDir() (string, error) {
+	dir, err := gdcDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "snapshots"), nil
+}
+
+func snapshotDir(service string, name string) (string, error) {
+	if !snapshotName.MatchString(service) {
+		return "", fmt.Errorf("invalid service name %s", service)
+	}
+	if !snapshotName.MatchString(name) {
+		return "", fmt.Errorf("invalid snapshot name %s - use letters, digits, dots, dashes and underscores", name)
+	}
+	dir, err := snapshotsDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, service, name), nil
+}
+
+// imageVersion splits an image reference into the image and the major
+// version of its tag, which is empty if the tag doesn't start with a version,
+// as with latest or no tag at all.
+func imageVersion(image string) (string, string) {
+	image = strings.SplitN(image, "@", 2)[0]
+	tag := ""
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image, tag = image[:i], image[i+1:]
+	}
+	if match := imageMajorVersion.FindStringSubmatch(tag); match != nil {
+		return image, match[1]
+	}
+	return image, ""
+}
+
+// majorVersion of the image, from its environment or else its tag, or empty
+// if neither tells.
+func (i ImageIdentity) majorVersion() string {
+	if match := imageMajorVersion.FindStringSubmatch(i.ImageVersion); match != nil {
+		return match[1]
+	}
+	_, version := imageVersion(i.Image)
+	return version
+}
+
+func (i ImageIdentity) String() string {
+	if i.ImageVersion == "" {
+		return i.Image
+	}
+	return fmt.Sprintf("%s (version %s)", i.Image, i.ImageVersion)
+}
+
+// compatibleImages is whether data written by one image can be read by the
+// other: they are the same image, or the same major version of it. Images
+// whose version can't be told, like an untagged redis that hasn't been
+// pulled, are not assumed to be compatible.
+func compatibleImages(a ImageIdentity, b ImageIdentity) bool {
+	imageA, _ := imageVersion(a.Image)
+	imageB, _ := imageVersion(b.Image)
+	if imageA != imageB {
+		return false
+	}
+	if a.ImageID != "" && a.ImageID == b.ImageID {
+		return true
+	}
+	version := a.majorVersion()
+	return version != "" && version == b.majorVersion()
+}
+
+// dockerInspection is the part of docker inspect's output that identifies an
+// image or the image of a container.
+type dockerInspection struct {
+	ID     string `json:"Id"`
+	Image  string `json:"Image"`
+	Config struct {
+		Image string   `json:"Image"`
+		Env   []string `json:"Env"`
+	} `json:"Config"`
+}
+
+// dockerInspect inspects a container or an image. It returns false if Docker
+// doesn't know it, e.g. an image that hasn't been pulled.
+func dockerInspect(ctx context.Context, compose ComposeInfo, kind string, name string) (dockerInspection, bool) {
+	inspection := dockerInspection{}
+	var out bytes.Buffer
+	cmd := NewCommand("docker", kind, "inspect", "--format", "{{json .}}", name)
+	cmd.Stdout = &out
+	cmd.Stderr = &bytes.Buffer{}
+	cmd.Quiet = true
+	if compose.runner().Run(ctx, cmd) != nil || json.Unmarshal(out.Bytes(), &inspection) != nil {
+		return inspection, false
+	}
+	return inspection, true
+}
+
+// identify an image from its inspection, finding its version in the variable
+// official images set, such as REDIS_VERSION for redis.
+func identify(image string, id string, env []string) ImageIdentity {
+	identity := ImageIdentity{Image: image, ImageID: id}
+	name, _ := imageVersion(image)
+	name = strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(name[strings.LastIndex(name, "/")+1:]))
+	for _, variable := range env {
+		key, value, _ := strings.Cut(variable, "=")
+		if (key == name+"_VERSION" || key == name+"_MAJOR") && imageMajorVersion.MatchString(value) {
+			identity.ImageVersion = value
+			if key == name+"_VERSION" {
+				break
+			}
+		}
+	}
+	return identity
+}
+
+// containerImage identifies the image the service's container runs, falling
+// back to the image in the compose files if it has no container.
+func containerImage(ctx context.Context, compose ComposeInfo, file *ComposeFile, service string) (ImageIdentity, error) {
+	var out bytes.Buffer
+	cmd := composeCommand(compose, "ps", "-a", "-q", service)
+	cmd.Stdout = &out
+	cmd.Quiet = true
+	err := run(ctx, compose, cmd)
+	if err != nil {
+		return ImageIdentity{}, err
+	}
+	containers := strings.Fields(out.String())
+	if len(containers) > 0 {
+		if inspection, found := dockerInspect(ctx, compose, "container", containers[0]); found {
+			return identify(inspection.Config.Image, inspection.Image, inspection.Config.Env), nil
+		}
+	}
+	return composeImage(ctx, compose, file, service), nil
+}
+
+// composeImage identifies the image the compose files give the service, which
+// it runs once it is brought up again.
+func composeImage(ctx context.Context, compose ComposeInfo, file *ComposeFile, service string) ImageIdentity {
+	image := os.ExpandEnv(file.Services[service].Image)
+	inspection, found := dockerInspect(ctx, compose, "image", image)
+	if !found {
+		return ImageIdentity{Image: image}
+	}
+	return identify(image, inspection.ID, inspection.Config.Env)
+}
+
+// serviceRunning checks whether the service's container is running.
+func serviceRunning(ctx context.Context, compose ComposeInfo, service string) (bool, error) {
+	var out bytes.Buffer
+	cmd := composeCommand(compose, "ps", "--format", "json", service)
+	cmd.Stdout = &out
+	cmd.Quiet = true
+	err := run(ctx, compose, cmd)
+	if err != nil {
+		return false, err
+	}
+	entries, err := parsePs(out.Bytes())
+	if err != nil {
+		return false, fmt.Errorf("error reading container status: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.Service == service && entry.State == "running" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// withServiceStopped stops the service while the function runs, starting it
+// again afterwards if it was running.
+func withServiceStopped(ctx context.Context, compose ComposeInfo, service string, f func() error) error {
+	unlock, err := lockProject(ctx, compose)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	running, err := serviceRunning(ctx, compose, service)
+	if err != nil {
+		return err
+	}
+	if running {
+		err = run(ctx, compose, composeCommand(compose, "stop", service))
+		if err != nil {
+			return err
+		}
+	}
+	err = f()
+	if running {
+		startErr := run(ctx, compose, composeCommand(compose, "start", service))
+		if err == nil {
+			err = startErr
+		}
+	}
+	return err
+}
+
+// SaveSnapshot stops the service and archives its named volumes into the
+// snapshot store in ~/.gdc/snapshots, starting it again afterwards.
+func SaveSnapshot(ctx context.Context, compose ComposeInfo, service string, name string, options SnapshotOptions) error {
+	file, err := compose.LoadComposeFile()
+	if err != nil {
+		return err
+	}
+	err = validateService(file, "snapshot save", service)
+	if err != nil {
+		return err
+	}
+	volumes := serviceVolumes(file, service)
+	if len(volumes) == 0 {
+		return fmt.Errorf("service %s has no named volumes to snapshot", service)
+	}
+	dir, err := snapshotDir(service, name)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(dir); err == nil && !options.Force {
+		return fmt.Errorf("snapshot %s of %s already exists - use --force to replace it", name, service)
+	}
+	_, dryRun := compose.Runner.(fileWriter)
+
+	snapshot := Snapshot{
+		Service:       service,
+		Name:          name,
+		ImageIdentity: ImageIdentity{Image: os.ExpandEnv(file.Services[service].Image)},
+		GdcVersion:    Version,
+		Created:       time.Now().UTC(),
+		Volumes:       sortedKeys(volumes),
+	}
+	if !dryRun {
+		snapshot.ImageIdentity, err = containerImage(ctx, compose, file, service)
+		if err != nil {
+			return err
+		}
+	}
+	// the snapshot is built next to its final place and only moved there once
+	// it is complete
+	var partial string
+	if !dryRun {
+		err = os.MkdirAll(filepath.Dir(dir), 0700)
+		if err != nil {
+			return err
+		}
+		partial, err = os.MkdirTemp(filepath.Dir(dir), "."+name+".*")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(partial)
+	}
+	err = withServiceStopped(ctx, compose, service, func() error {
+		for _, volume := range snapshot.Volumes {
+			cmd := NewCommand("docker", "run", "--rm", "-v", volumes[volume]+":/volume:ro", snapshotHelperImage,
+				"tar", "czf", "-", "-C", "/volume", ".")
+			if dryRun {
+				err := run(ctx, compose, cmd)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			archive, err := os.OpenFile(filepath.Join(partial, volume+".tar.gz"), os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0600)
+			if err != nil {
+				return err
+			}
+			progress := newProgress(options.Progress, "Saved "+volume, 0)
+			cmd.Stdout = progressWriter{archive, progress}
+			err = run(ctx, compose, cmd)
+			closeErr := archive.Close()
+			if err != nil {
+				return err
+			}
+			if closeErr != nil {
+				return closeErr
+			}
+			progress.finish()
+			snapshot.Size += progress.done
+		}
+		return nil
+	})
+	if err != nil || dryRun {
+		return err
+	}
+
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(filepath.Join(partial, snapshotMetadata), data, 0600)
+	if err != nil {
+		return err
+	}
+	err = os.RemoveAll(dir)
+	if err != nil {
+		return err
+	}
+	return os.Rename(partial, dir)
+}
+
+func readSnapshot(dir string) (Snapshot, error) {
+	snapshot := Snapshot{}
+	data, err := ioutil.ReadFile(filepath.Join(dir, snapshotMetadata))
+	if err != nil {
+		return snapshot, err
+	}
+	err = json.Unmarshal(data, &snapshot)
+	if err != nil {
+		return snapshot, fmt.Errorf("error reading %s: %w", filepath.Join(dir, snapshotMetadata), err)
+	}
+	return snapshot, nil
+}
+
+// loadSnapshot reads the metadata of an existing snapshot.
+func loadSnapshot(service string, name string) (Snapshot, string, error) {
+	dir, err := snapshotDir(service, name)
+	if err != nil {
+		return Snapshot{}, "", err
+	}
+	snapshot, err := readSnapshot(dir)
+	if os.IsNotExist(err) {
+		return snapshot, "", fmt.Errorf("no snapshot %s of %s - see snapshot list", name, service)
+	}
+	return snapshot, dir, err
+}
+
+// Snapshots in the store, of the given service or of all of them if it is
+// empty, sorted by service and then by when they were taken. Entries that
+// can't be read as snapshots are skipped with a warning to the writer.
+func Snapshots(service string, warnings io.Writer) ([]Snapshot, error) {
+	root, err := snapshotsDir()
+	if err != nil {
+		return nil, err
+	}
+	pattern := filepath.Join(root, "*", "*")
+	if service != "" {
+		if !snapshotName.MatchString(service) {
+			return nil, fmt.Errorf("invalid service name %s", service)
+		}
+		pattern = filepath.Join(root, service, "*")
+	}
+	dirs, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	snapshots := []Snapshot{}
+	for _, dir := range dirs {
+		if strings.HasPrefix(filepath.Base(dir), ".") {
+			// partially saved
+			continue
+		}
+		snapshot, err := readSnapshot(dir)
+		if err != nil {
+			fmt.Fprintf(warnings, "Skipping %s, which isn't a snapshot: %s\n", dir, err)
+			continue
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		if snapshots[i].Service != snapshots[j].Service {
+			return snapshots[i].Service < snapshots[j].Service
+		}
+		return snapshots[i].Created.Before(snapshots[j].Created)
+	})
+	return snapshots, nil
+}
+
+// RestoreSnapshot stops the service and replaces the contents of its volumes
+// with the snapshot's, starting it again afterwards. Snapshots taken with an
+// image of another major version are refused with a
+// SnapshotIncompatibleError unless forced.
+func RestoreSnapshot(ctx context.Context, compose ComposeInfo, service string, name string, options SnapshotOptions) error {
+	file, err := compose.LoadComposeFile()
+	if err != nil {
+		return err
+	}
+	err = validateService(file, "snapshot restore", service)
+	if err != nil {
+		return err
+	}
+	volumes := serviceVolumes(file, service)
+	if len(volumes) == 0 {
+		return fmt.Errorf("service %s has no named volumes to snapshot", service)
+	}
+	snapshot, dir, err := loadSnapshot(service, name)
+	if err != nil {
+		return err
+	}
+	_, dryRun := compose.Runner.(fileWriter)
+	if dryRun {
+		dryRunRequest(compose, service, fmt.Sprintf("check %s is compatible with snapshot %s", os.ExpandEnv(file.Services[service].Image), name))
+	} else if !options.Force {
+		image := composeImage(ctx, compose, file, service)
+		if !compatibleImages(snapshot.ImageIdentity, image) {
+			return &SnapshotIncompatibleError{Service: service, Snapshot: name, SnapshotImage: snapshot.ImageIdentity.String(), Image: image.String()}
+		}
+	}
+	for _, volume := range snapshot.Volumes {
+		if _, found := volumes[volume]; !found {
+			return fmt.Errorf("snapshot %s of %s contains volume %s, which the service no longer uses", name, service, volume)
+		}
+	}
+
+	return withServiceStopped(ctx, compose, service, func() error {
+		for _, volume := range snapshot.Volumes {
+			archive, err := os.Open(filepath.Join(dir, volume+".tar.gz"))
+			if err != nil {
+				return err
+			}
+			info, err := archive.Stat()
+			if err != nil {
+				archive.Close()
+				return err
+			}
+			progress := newProgress(options.Progress, "Restored "+volume, info.Size())
+			cmd := NewCommand("docker", "run", "--rm", "-i", "-v", volumes[volume]+":/volume", snapshotHelperImage,
+				"sh", "-c", "find /volume -mindepth 1 -delete && tar xzf - -C /volume")
+			cmd.Stdin = progressReader{archive, progress}
+			err = run(ctx, compose, cmd)
+			archive.Close()
+			if err != nil {
+				return err
+			}
+			if !dryRun {
+				progress.finish()
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteSnapshot removes a snapshot from the store.
+func DeleteSnapshot(compose ComposeInfo, service string, name string) error {
+	_, dir, err := loadSnapshot(service, name)
+	if err != nil {
+		return err
+	}
+	if plan, dryRun := compose.Runner.(*Plan); dryRun {
+		plan.remove(dir)
+		return nil
+	}
+	return os.RemoveAll(dir)
+}
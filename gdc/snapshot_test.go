@@ -0,0 +1,158 @@
+package gdc
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompatibleImages(t *testing.T) {
+	tests := []struct {
+		name string
+		a    ImageIdentity
+		b    ImageIdentity
+		want bool
+	}{
+		{"same tag", ImageIdentity{Image: "opensearch:2.11.0"}, ImageIdentity{Image: "opensearch:2.12.0"}, true},
+		{"other major tag", ImageIdentity{Image: "opensearch:1.3.0"}, ImageIdentity{Image: "opensearch:2.11.0"}, false},
+		{"other image", ImageIdentity{Image: "mysql:8"}, ImageIdentity{Image: "mariadb:8"}, false},
+		{"untagged, unknown versions", ImageIdentity{Image: "redis"}, ImageIdentity{Image: "redis"}, false},
+		{"latest, unknown versions", ImageIdentity{Image: "redis:latest"}, ImageIdentity{Image: "redis"}, false},
+		{"same image ID", ImageIdentity{Image: "redis", ImageID: "sha256:a"}, ImageIdentity{Image: "redis", ImageID: "sha256:a"}, true},
+		{"untagged, same major", ImageIdentity{Image: "redis", ImageID: "sha256:a", ImageVersion: "7.2.4"},
+			ImageIdentity{Image: "redis", ImageID: "sha256:b", ImageVersion: "7.4.0"}, true},
+		{"untagged, other major", ImageIdentity{Image: "redis", ImageID: "sha256:a", ImageVersion: "6.2.14"},
+			ImageIdentity{Image: "redis", ImageID: "sha256:b", ImageVersion: "7.2.4"}, false},
+		{"version against tag", ImageIdentity{Image: "redis", ImageVersion: "7.2.4"}, ImageIdentity{Image: "redis:7-alpine"}, true},
+		{"digest", ImageIdentity{Image: "redis:7@sha256:c"}, ImageIdentity{Image: "redis:7.2"}, true},
+	}
+	for _, test := range tests {
+		if got := compatibleImages(test.a, test.b); got != test.want {
+			t.Errorf("%s: compatibleImages(%+v, %+v) = %t, want %t", test.name, test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestIdentify(t *testing.T) {
+	tests := []struct {
+		image string
+		env   []string
+		want  string
+	}{
+		{"redis", []string{"GOSU_VERSION=1.17", "REDIS_VERSION=7.2.4"}, "7.2.4"},
+		{"mysql:8", []string{"MYSQL_MAJOR=8.0", "MYSQL_VERSION=8.0.36-1.el8"}, "8.0.36-1.el8"},
+		{"mysql:5.7", []string{"MYSQL_MAJOR=5.7"}, "5.7"},
+		{"docker.io/library/redis", []string{"REDIS_VERSION=6.2.14"}, "6.2.14"},
+		{"amazon/dynamodb-local", []string{"PATH=/usr/bin"}, ""},
+	}
+	for _, test := range tests {
+		if got := identify(test.image, "sha256:a", test.env).ImageVersion; got != test.want {
+			t.Errorf("identify(%s, %v) version = %s, want %s", test.image, test.env, got, test.want)
+		}
+	}
+}
+
+func TestDeleteSnapshotDryRun(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	dir := filepath.Join(home, ".gdc", "snapshots", "redis", "seeded")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, snapshotMetadata), []byte(`{"service": "redis", "name": "seeded"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	plan := &Plan{}
+	if err := DeleteSnapshot(ComposeInfo{Runner: plan}, "redis", "seeded"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := os.Stat(dir); err != nil {
+		t.Errorf("dry run deleted the snapshot: %s", err)
+	}
+	if len(plan.Steps) != 1 || plan.Steps[0].Action != "delete" || plan.Steps[0].Path != dir {
+		t.Errorf("plan = %+v, want the snapshot's deletion", plan.Steps)
+	}
+}
+
+// writeSnapshot writes a snapshot's metadata into the store in the home
+// directory.
+func writeSnapshot(t *testing.T, home string, service string, name string, metadata string) string {
+	t.Helper()
+	dir := filepath.Join(home, ".gdc", "snapshots", service, name)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if metadata != "" {
+		if err := os.WriteFile(filepath.Join(dir, snapshotMetadata), []byte(metadata), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestSnapshotServiceNames(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	outside := filepath.Join(home, "outside")
+	writeSnapshot(t, home, "redis", "seeded", `{"service": "redis", "name": "seeded"}`)
+	if err := os.MkdirAll(outside, 0700); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(outside, snapshotMetadata), []byte(`{"service": "x", "name": "outside"}`), 0600)
+
+	for _, service := range []string{"../..", "..", "redis/../..", "*", ""} {
+		err := DeleteSnapshot(ComposeInfo{}, service, "outside")
+		if err == nil || !strings.Contains(err.Error(), "invalid service name") {
+			t.Errorf("delete of %q: expected an invalid service name, got %v", service, err)
+		}
+	}
+	if _, err := os.Stat(outside); err != nil {
+		t.Errorf("expected the directory outside the store to be left alone: %s", err)
+	}
+	for _, service := range []string{"..", "*", "redis/seeded"} {
+		_, err := Snapshots(service, io.Discard)
+		if err == nil || !strings.Contains(err.Error(), "invalid service name") {
+			t.Errorf("list of %q: expected an invalid service name, got %v", service, err)
+		}
+	}
+}
+
+func TestSnapshotsSkipsUnreadable(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	writeSnapshot(t, home, "redis", "seeded", `{"service": "redis", "name": "seeded", "created": "2024-05-01T12:00:00Z"}`)
+	writeSnapshot(t, home, "redis", "empty", `{"service": "redis", "name": "empty", "created": "2024-04-01T12:00:00Z"}`)
+	writeSnapshot(t, home, "mysql57", "base", `{"service": "mysql57", "name": "base"}`)
+	stray := writeSnapshot(t, home, "redis", "stray", "")
+	broken := writeSnapshot(t, home, "mysql57", "broken", "{")
+	writeSnapshot(t, home, "redis", ".partial", "")
+
+	warnings := &bytes.Buffer{}
+	snapshots, err := Snapshots("", warnings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, snapshot := range snapshots {
+		names = append(names, snapshot.Service+"/"+snapshot.Name)
+	}
+	if strings.Join(names, " ") != "mysql57/base redis/empty redis/seeded" {
+		t.Errorf("snapshots = %v", names)
+	}
+	for _, dir := range []string{stray, broken} {
+		if !strings.Contains(warnings.String(), "Skipping "+dir) {
+			t.Errorf("expected a warning about %s, got %q", dir, warnings.String())
+		}
+	}
+	if strings.Contains(warnings.String(), "partial") {
+		t.Errorf("expected partially saved snapshots to be skipped quietly, got %q", warnings.String())
+	}
+
+	snapshots, err = Snapshots("redis", io.Discard)
+	if err != nil || len(snapshots) != 2 {
+		t.Errorf("expected the two redis snapshots, got %+v, %v", snapshots, err)
+	}
+}
@@ -0,0 +1,115 @@
+package gdc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// ServiceStatus of the container for a requested service or companion.
+type ServiceStatus struct {
+	Service string   `json:"service"`
+	State   string   `json:"state"`
+	Health  string   `json:"health,omitempty"`
+	Ports   []string `json:"ports"`
+	URL     string   `json:"url,omitempty"`
+	UI      string   `json:"ui,omitempty"`
+}
+
+// psEntry is a container as reported by docker compose ps --format json.
+type psEntry struct {
+	Service    string
+	State      string
+	Health     string
+	Publishers []struct {
+		URL           string
+		TargetPort    int
+		PublishedPort int
+		Protocol      string
+	}
+}
+
+// parsePs reads docker compose ps output. Older versions of Compose print a
+// JSON array, newer ones one JSON object per line.
+func parsePs(out []byte) ([]psEntry, error) {
+	out = bytes.TrimSpace(out)
+	entries := []psEntry{}
+	if len(out) == 0 {
+		return entries, nil
+	}
+	if out[0] == '[' {
+		err := json.Unmarshal(out, &entries)
+		return entries, err
+	}
+	for _, line := range bytes.Split(out, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		entry := psEntry{}
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// Status of the requested services and their companions.
+func Status(ctx context.Context, compose ComposeInfo) ([]ServiceStatus, error) {
+	file, services, err := requestedServices(compose, "status")
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	cmd := composeCommand(compose, append([]string{"ps", "--all", "--format", "json"}, services...)...)
+	cmd.Stdout = &out
+	cmd.Quiet = true
+	err = run(ctx, compose, cmd)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := parsePs(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("error reading container status: %w", err)
+	}
+
+	statuses := []ServiceStatus{}
+	for _, service := range services {
+		status := ServiceStatus{Service: service, State: "not created", Ports: []string{}}
+		for _, entry := range entries {
+			if entry.Service != service {
+				continue
+			}
+			status.State = entry.State
+			status.Health = entry.Health
+			seen := map[string]bool{}
+			for _, publisher := range entry.Publishers {
+				if publisher.PublishedPort == 0 {
+					continue
+				}
+				// Docker lists IPv4 and IPv6 bindings separately
+				port := fmt.Sprintf("%d->%d/%s", publisher.PublishedPort, publisher.TargetPort, publisher.Protocol)
+				if !seen[port] {
+					seen[port] = true
+					status.Ports = append(status.Ports, port)
+				}
+			}
+		}
+		extension := file.Services[service].Gdc
+		if extension.URL != "" {
+			status.URL, err = compose.hostURL(file, service, extension.URL)
+			if err != nil {
+				return nil, fmt.Errorf("error building URL for service %s: %w", service, err)
+			}
+		}
+		if extension.UI != "" {
+			status.UI, err = compose.hostURL(file, service, extension.UI)
+			if err != nil {
+				return nil, fmt.Errorf("error building UI link for service %s: %w", service, err)
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
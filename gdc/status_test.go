@@ -0,0 +1,85 @@
+package gdc
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePs(t *testing.T) {
+	want := []psEntry{{Service: "redis", State: "running"}, {Service: "kafka", State: "exited"}}
+	tests := []struct {
+		name string
+		out  string
+		want []psEntry
+	}{
+		{name: "empty", out: "\n", want: []psEntry{}},
+		{name: "array", out: `[{"Service":"redis","State":"running"},{"Service":"kafka","State":"exited"}]`, want: want},
+		{name: "lines", out: "{\"Service\":\"redis\",\"State\":\"running\"}\n\n{\"Service\":\"kafka\",\"State\":\"exited\"}\n", want: want},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entries, err := parsePs([]byte(test.out))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(entries, test.want) {
+				t.Errorf("got %+v, want %+v", entries, test.want)
+			}
+		})
+	}
+}
+
+const statusCompose = `
+services:
+  opensearch:
+    image: opensearchproject/opensearch:2
+    ports: ["9200:9200"]
+    x-gdc:
+      url: http://{{address 9200}}
+      companions: [dashboards]
+  dashboards:
+    image: opensearchproject/opensearch-dashboards:2
+    ports: ["5601:5601"]
+    x-gdc:
+      ui: http://{{host 5601}}:{{port 5601}}/app/home
+  redis:
+    image: redis:6
+`
+
+func TestStatus(t *testing.T) {
+	compose, runner := testComposeInfo(t, "opensearch", "redis")
+	compose.MainFile = []byte(statusCompose)
+	compose.PortOverrides = map[string]map[int]int{"dashboards": {5601: 15601}}
+	runner.Outputs = map[string]string{
+		composeLine(compose, "ps", "--all", "--format", "json", "opensearch", "dashboards", "redis"): `{"Service":"opensearch","State":"running","Health":"healthy","Publishers":[` +
+			`{"URL":"0.0.0.0","TargetPort":9200,"PublishedPort":9200,"Protocol":"tcp"},` +
+			`{"URL":"::","TargetPort":9200,"PublishedPort":9200,"Protocol":"tcp"},` +
+			`{"URL":"","TargetPort":9300,"PublishedPort":0,"Protocol":"tcp"}]}
+{"Service":"dashboards","State":"restarting","Publishers":[{"URL":"0.0.0.0","TargetPort":5601,"PublishedPort":15601,"Protocol":"tcp"}]}
+`,
+	}
+	statuses, err := Status(context.Background(), compose)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ServiceStatus{
+		{Service: "opensearch", State: "running", Health: "healthy", Ports: []string{"9200->9200/tcp"}, URL: "http://127.0.0.1:9200"},
+		{Service: "dashboards", State: "restarting", Ports: []string{"15601->5601/tcp"}, UI: "http://127.0.0.1:15601/app/home"},
+		{Service: "redis", State: "not created", Ports: []string{}},
+	}
+	if !reflect.DeepEqual(statuses, want) {
+		t.Errorf("got %+v, want %+v", statuses, want)
+	}
+}
+
+func TestStatusUnpublishedURLPort(t *testing.T) {
+	compose, _ := testComposeInfo(t, "redis")
+	compose.MainFile = []byte("services:\n  redis:\n    image: redis:6\n    x-gdc:\n      url: redis://{{address 6379}}\n")
+	_, err := Status(context.Background(), compose)
+	if err == nil || !strings.HasPrefix(err.Error(), "error building URL for service redis:") ||
+		!strings.HasSuffix(err.Error(), "port 6379 of service redis is not published") {
+		t.Errorf("expected an unpublished port error, got %v", err)
+	}
+}
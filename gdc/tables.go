@@ -0,0 +1,576 @@
+package gdc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TimeToLive is a table's TTL setting, as UpdateTimeToLive takes it.
+type TimeToLive struct {
+	AttributeName string `json:"AttributeName"`
+	Enabled       bool   `json:"Enabled"`
+}
+
+// TableSpec is a table as declared in a tables file: the CreateTable request
+// the AWS CLI's create-table takes as JSON, plus a TimeToLiveSpecification
+// and Items to seed the table with:
+//
+//	tables:
+//	  - TableName: orders
+//	    AttributeDefinitions:
+//	      - {AttributeName: id, AttributeType: S}
+//	    KeySchema:
+//	      - {AttributeName: id, KeyType: HASH}
+//	    TimeToLiveSpecification: {AttributeName: expires_at, Enabled: true}
+//	    Items:
+//	      - {id: order-1, total: 5}
+type TableSpec struct {
+	Name string `json:"name"`
+	// the CreateTable request
+	Create map[string]interface{} `json:"create"`
+	TTL    *TimeToLive            `json:"ttl,omitempty"`
+	// seed items, in DynamoDB JSON
+	Items    []map[string]interface{} `json:"items,omitempty"`
+	Location Location                 `json:"-"`
+
+	definition dynamoTable
+}
+
+// Actions in a table plan.
+const (
+	TableCreate = "create"
+	TableUpdate = "update"
+	// only seed items to put
+	TableSeed = "seed"
+)
+
+// TableChange is a change needed to make a table match its spec.
+type TableChange struct {
+	Table  string `json:"table"`
+	Action string `json:"action"`
+	// global secondary indexes to create, for update
+	Indexes []string `json:"indexes,omitempty"`
+	// the TTL setting to change to, if it changes
+	TTL *TimeToLive `json:"ttl,omitempty"`
+	// TTL attribute now, empty if disabled
+	CurrentTTL string `json:"current_ttl,omitempty"`
+	// seed items to put if they aren't there
+	Items int `json:"items,omitempty"`
+
+	spec TableSpec
+}
+
+var attributeTypes = map[string]bool{
+	"S": true, "N": true, "B": true, "BOOL": true, "NULL": true,
+	"M": true, "L": true, "SS": true, "NS": true, "BS": true,
+}
+
+// isAttributeValue is whether the value is in DynamoDB JSON, like {"S": "x"}.
+func isAttributeValue(value interface{}) bool {
+	typed, ok := value.(map[string]interface{})
+	if !ok || len(typed) != 1 {
+		return false
+	}
+	for key := range typed {
+		return attributeTypes[key]
+	}
+	return false
+}
+
+// attributeValue converts a plain value to DynamoDB JSON.
+func attributeValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case nil:
+		return map[string]interface{}{"NULL": true}, nil
+	case string:
+		return map[string]interface{}{"S": v}, nil
+	case bool:
+		return map[string]interface{}{"BOOL": v}, nil
+	case json.Number:
+		return map[string]interface{}{"N": v.String()}, nil
+	case []interface{}:
+		list := []interface{}{}
+		for _, item := range v {
+			converted, err := attributeValue(item)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, converted)
+		}
+		return map[string]interface{}{"L": list}, nil
+	case map[string]interface{}:
+		item, err := dynamoItem(v)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"M": item}, nil
+	}
+	number := reflect.ValueOf(value)
+	switch number.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"N": strconv.FormatInt(number.Int(), 10)}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"N": strconv.FormatUint(number.Uint(), 10)}, nil
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"N": strconv.FormatFloat(number.Float(), 'f', -1, number.Type().Bits())}, nil
+	}
+	return nil, fmt.Errorf("cannot store %v (%T) in DynamoDB", value, value)
+}
+
+var jsonNumber = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][-+]?[0-9]+)?$`)
+
+// seedValue decodes seed items from YAML, keeping numbers as they are
+// written: DynamoDB numbers have up to 38 digits, which an int64 or a
+// float64 can't hold.
+func seedValue(node *yaml.Node) (interface{}, error) {
+	switch node.Kind {
+	case yaml.AliasNode:
+		return seedValue(node.Alias)
+	case yaml.ScalarNode:
+		if (node.Tag == "!!int" || node.Tag == "!!float") && jsonNumber.MatchString(node.Value) {
+			return json.Number(node.Value), nil
+		}
+	case yaml.SequenceNode:
+		list := []interface{}{}
+		for _, child := range node.Content {
+			value, err := seedValue(child)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		return list, nil
+	case yaml.MappingNode:
+		fields := map[string]interface{}{}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Tag == "!!merge" {
+				// merged fields are rare enough in seed data to decode as usual
+				var value interface{}
+				err := node.Decode(&value)
+				return value, err
+			}
+			value, err := seedValue(node.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			fields[node.Content[i].Value] = value
+		}
+		return fields, nil
+	}
+	var value interface{}
+	err := node.Decode(&value)
+	return value, err
+}
+
+// dynamoItem converts an item to DynamoDB JSON. An item already in DynamoDB
+// JSON, with every attribute given as e.g. {"S": "x"}, is left as it is.
+func dynamoItem(item map[string]interface{}) (map[string]interface{}, error) {
+	typed := true
+	for _, value := range item {
+		if !isAttributeValue(value) {
+			typed = false
+		}
+	}
+	if typed {
+		return item, nil
+	}
+	result := map[string]interface{}{}
+	for name, value := range item {
+		converted, err := attributeValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("attribute %s: %w", name, err)
+		}
+		result[name] = converted
+	}
+	return result, nil
+}
+
+// convert one JSON-compatible value to another type through JSON.
+func convert(from interface{}, to interface{}) error {
+	data, err := json.Marshal(from)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, to)
+}
+
+func loadTableSpec(node *yaml.Node, location Location) (TableSpec, error) {
+	spec := TableSpec{Location: location}
+	create := map[string]interface{}{}
+	err := node.Decode(&create)
+	if err != nil {
+		return spec, composeError(location, "invalid table: %s", err)
+	}
+	spec.Name, _ = create["TableName"].(string)
+	if spec.Name == "" {
+		return spec, composeError(location, "table has no TableName")
+	}
+	if ttl, found := create["TimeToLiveSpecification"]; found {
+		spec.TTL = &TimeToLive{}
+		if err = convert(ttl, spec.TTL); err != nil || (spec.TTL.Enabled && spec.TTL.AttributeName == "") {
+			return spec, composeError(location, "TimeToLiveSpecification of table %s needs an AttributeName and Enabled", spec.Name)
+		}
+		delete(create, "TimeToLiveSpecification")
+	}
+	if _, found := create["Items"]; found {
+		items, err := seedValue(mappingValue(node, "Items"))
+		if err != nil {
+			return spec, composeError(location, "invalid Items of table %s: %s", spec.Name, err)
+		}
+		list, ok := items.([]interface{})
+		if !ok {
+			return spec, composeError(location, "Items of table %s must be a list", spec.Name)
+		}
+		for i, value := range list {
+			item, ok := value.(map[string]interface{})
+			if !ok {
+				return spec, composeError(location, "item %d of table %s is not a map", i+1, spec.Name)
+			}
+			item, err = dynamoItem(item)
+			if err != nil {
+				return spec, composeError(location, "item %d of table %s: %s", i+1, spec.Name, err)
+			}
+			spec.Items = append(spec.Items, item)
+		}
+		delete(create, "Items")
+	}
+	if create["BillingMode"] == nil && create["ProvisionedThroughput"] == nil {
+		create["BillingMode"] = "PAY_PER_REQUEST"
+	}
+	spec.Create = create
+	err = convert(create, &spec.definition)
+	if err != nil {
+		return spec, composeError(location, "invalid table %s: %s", spec.Name, err)
+	}
+	if len(spec.definition.KeySchema) == 0 {
+		return spec, composeError(location, "table %s has no KeySchema", spec.Name)
+	}
+	return spec, nil
+}
+
+// LoadTableSpecs reads a tables file: a list of tables under tables, a list
+// of tables, or a single table such as AWS CLI create-table JSON. Tables
+// without a BillingMode or ProvisionedThroughput are pay per request.
+func LoadTableSpecs(path string) ([]TableSpec, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	root := yaml.Node{}
+	err = yaml.Unmarshal(data, &root)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(root.Content) == 0 {
+		return nil, fmt.Errorf("%s: file is empty", path)
+	}
+	doc := root.Content[0]
+	nodes := []*yaml.Node{doc}
+	if tables := mappingValue(doc, "tables"); doc.Kind == yaml.MappingNode && tables != nil {
+		if tables.Kind != yaml.SequenceNode {
+			return nil, composeError(Location{path, tables.Line}, "expected a list of tables under tables")
+		}
+		nodes = tables.Content
+	} else if doc.Kind == yaml.SequenceNode {
+		nodes = doc.Content
+	}
+	specs := []TableSpec{}
+	seen := map[string]bool{}
+	for _, node := range nodes {
+		spec, err := loadTableSpec(node, Location{path, node.Line})
+		if err != nil {
+			return nil, err
+		}
+		if seen[spec.Name] {
+			return nil, composeError(spec.Location, "table %s is declared twice", spec.Name)
+		}
+		seen[spec.Name] = true
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+func sameKeys(a []dynamoKey, b []dynamoKey) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func describeKeys(keys []dynamoKey) string {
+	strs := []string{}
+	for _, key := range keys {
+		strs = append(strs, key.AttributeName+" "+key.KeyType)
+	}
+	return strings.Join(strs, ", ")
+}
+
+// PlanTables compares the specs with the tables in DynamoDB and works out
+// what has to be created or updated. Missing global secondary indexes are
+// added and TTL settings changed, but key schemas and local secondary indexes
+// can only be set when a table is created, so specs changing them are
+// reported as errors. Indexes that aren't declared are left alone.
+func PlanTables(ctx context.Context, compose ComposeInfo, specs []TableSpec) ([]TableChange, error) {
+	address, err := dynamodbAddress(compose)
+	if err != nil {
+		return nil, err
+	}
+	changes := []TableChange{}
+	problems := []string{}
+	for _, spec := range specs {
+		current, err := describeTable(ctx, address, spec.Name)
+		if err != nil {
+			return nil, err
+		}
+		if current == nil {
+			change := TableChange{Table: spec.Name, Action: TableCreate, Items: len(spec.Items), spec: spec}
+			if spec.TTL != nil && spec.TTL.Enabled {
+				change.TTL = spec.TTL
+			}
+			changes = append(changes, change)
+			continue
+		}
+
+		change := TableChange{Table: spec.Name, Action: TableUpdate, Items: len(spec.Items), spec: spec}
+		if !sameKeys(current.KeySchema, spec.definition.KeySchema) {
+			problems = append(problems, fmt.Sprintf("%s: table %s is keyed on %s, which cannot be changed to %s - delete and recreate it",
+				spec.Location, spec.Name, describeKeys(current.KeySchema), describeKeys(spec.definition.KeySchema)))
+		}
+		for _, index := range spec.definition.LocalSecondaryIndexes {
+			found := false
+			for _, existing := range current.LocalSecondaryIndexes {
+				found = found || existing.IndexName == index.IndexName
+			}
+			if !found {
+				problems = append(problems, fmt.Sprintf("%s: local secondary index %s cannot be added to existing table %s - delete and recreate it",
+					spec.Location, index.IndexName, spec.Name))
+			}
+		}
+		for _, index := range spec.definition.GlobalSecondaryIndexes {
+			var existing *dynamoIndex
+			for i := range current.GlobalSecondaryIndexes {
+				if current.GlobalSecondaryIndexes[i].IndexName == index.IndexName {
+					existing = &current.GlobalSecondaryIndexes[i]
+				}
+			}
+			if existing == nil {
+				change.Indexes = append(change.Indexes, index.IndexName)
+			} else if !sameKeys(existing.KeySchema, index.KeySchema) {
+				problems = append(problems, fmt.Sprintf("%s: index %s of table %s is keyed on %s, which cannot be changed to %s - delete and recreate the table",
+					spec.Location, index.IndexName, spec.Name, describeKeys(existing.KeySchema), describeKeys(index.KeySchema)))
+			}
+		}
+		if spec.TTL != nil {
+			ttl := struct {
+				Description struct {
+					Status        string `json:"TimeToLiveStatus"`
+					AttributeName string `json:"AttributeName"`
+				} `json:"TimeToLiveDescription"`
+			}{}
+			err = dynamodbRequest(ctx, address, "DescribeTimeToLive", map[string]string{"TableName": spec.Name}, &ttl)
+			if err != nil {
+				return nil, fmt.Errorf("error describing TTL of table %s: %s", spec.Name, dynamodbMessage(err))
+			}
+			enabled := ttl.Description.Status == "ENABLED" || ttl.Description.Status == "ENABLING"
+			if enabled {
+				change.CurrentTTL = ttl.Description.AttributeName
+			}
+			if enabled != spec.TTL.Enabled || (enabled && ttl.Description.AttributeName != spec.TTL.AttributeName) {
+				change.TTL = &TimeToLive{AttributeName: spec.TTL.AttributeName, Enabled: spec.TTL.Enabled}
+				if !spec.TTL.Enabled {
+					// disabling names the attribute TTL is on now
+					change.TTL.AttributeName = ttl.Description.AttributeName
+				}
+			}
+		}
+		if len(change.Indexes) == 0 && change.TTL == nil {
+			if change.Items == 0 {
+				continue
+			}
+			change.Action = TableSeed
+		}
+		changes = append(changes, change)
+	}
+	if len(problems) > 0 {
+		return nil, errors.New(strings.Join(problems, "\n"))
+	}
+	return changes, nil
+}
+
+// PrintTablePlan describes the changes.
+func PrintTablePlan(w io.Writer, changes []TableChange) {
+	if len(changes) == 0 {
+		fmt.Fprintln(w, "Tables are up to date.")
+		return
+	}
+	creates, updates, items := 0, 0, 0
+	for _, change := range changes {
+		items += change.Items
+		switch change.Action {
+		case TableCreate:
+			creates++
+			fmt.Fprintf(w, "+ create %s (%s)\n", change.Table, describeKeys(change.spec.definition.KeySchema))
+			for _, index := range change.spec.definition.GlobalSecondaryIndexes {
+				fmt.Fprintf(w, "    index %s (%s)\n", index.IndexName, describeKeys(index.KeySchema))
+			}
+			for _, index := range change.spec.definition.LocalSecondaryIndexes {
+				fmt.Fprintf(w, "    local index %s (%s)\n", index.IndexName, describeKeys(index.KeySchema))
+			}
+		case TableUpdate:
+			updates++
+			fmt.Fprintf(w, "~ update %s\n", change.Table)
+			for _, name := range change.Indexes {
+				fmt.Fprintf(w, "    + index %s\n", name)
+			}
+		case TableSeed:
+			fmt.Fprintf(w, "  seed %s\n", change.Table)
+		}
+		if change.TTL != nil {
+			from, to := change.CurrentTTL, change.TTL.AttributeName
+			if from == "" {
+				from = "disabled"
+			}
+			if !change.TTL.Enabled {
+				to = "disabled"
+			}
+			fmt.Fprintf(w, "    TTL: %s -> %s\n", from, to)
+		}
+		if change.Items > 0 {
+			fmt.Fprintf(w, "    %d seed items, kept if already there\n", change.Items)
+		}
+	}
+	fmt.Fprintf(w, "Plan: %d to create, %d to update, %d items to seed.\n", creates, updates, items)
+}
+
+// indexRequest is the spec's CreateTable entry for a global secondary index.
+func (spec TableSpec) indexRequest(name string) interface{} {
+	indexes, _ := spec.Create["GlobalSecondaryIndexes"].([]interface{})
+	for _, index := range indexes {
+		if fields, ok := index.(map[string]interface{}); ok && fields["IndexName"] == name {
+			return fields
+		}
+	}
+	return nil
+}
+
+// seedItems puts the items that aren't in the table yet, returning how many
+// were put.
+func seedItems(ctx context.Context, address string, spec TableSpec) (int, error) {
+	hashKey := ""
+	for _, key := range spec.definition.KeySchema {
+		if key.KeyType == "HASH" {
+			hashKey = key.AttributeName
+		}
+	}
+	put := 0
+	for i, item := range spec.Items {
+		err := dynamodbRequest(ctx, address, "PutItem", map[string]interface{}{
+			"TableName":                spec.Name,
+			"Item":                     item,
+			"ConditionExpression":      "attribute_not_exists(#key)",
+			"ExpressionAttributeNames": map[string]string{"#key": hashKey},
+		}, nil)
+		if dynamodbErrorType(err) == "ConditionalCheckFailedException" {
+			continue
+		}
+		if err != nil {
+			return put, fmt.Errorf("%s: error seeding item %d of table %s: %s", spec.Location, i+1, spec.Name, dynamodbMessage(err))
+		}
+		put++
+	}
+	return put, nil
+}
+
+// ApplyTables makes the changes in DynamoDB, reporting the items seeded to
+// the writer.
+func ApplyTables(ctx context.Context, compose ComposeInfo, changes []TableChange, w io.Writer) error {
+	if _, dryRun := compose.Runner.(*Plan); dryRun {
+		for _, change := range changes {
+			dryRunRequest(compose, "dynamodb", fmt.Sprintf("%s table %s", change.Action, change.Table))
+		}
+		return nil
+	}
+	address, err := dynamodbAddress(compose)
+	if err != nil {
+		return err
+	}
+	for _, change := range changes {
+		spec := change.spec
+		switch change.Action {
+		case TableCreate:
+			err = dynamodbRequest(ctx, address, "CreateTable", spec.Create, nil)
+			if err != nil {
+				return fmt.Errorf("%s: error creating table %s: %s", spec.Location, spec.Name, dynamodbMessage(err))
+			}
+		case TableUpdate:
+			// DynamoDB creates one index per update
+			for _, name := range change.Indexes {
+				err = dynamodbRequest(ctx, address, "UpdateTable", map[string]interface{}{
+					"TableName":                   spec.Name,
+					"AttributeDefinitions":        spec.Create["AttributeDefinitions"],
+					"GlobalSecondaryIndexUpdates": []interface{}{map[string]interface{}{"Create": spec.indexRequest(name)}},
+				}, nil)
+				if err != nil {
+					return fmt.Errorf("%s: error adding index %s to table %s: %s", spec.Location, name, spec.Name, dynamodbMessage(err))
+				}
+				err = waitForTable(ctx, address, spec.Name)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		if change.Action == TableCreate {
+			err = waitForTable(ctx, address, spec.Name)
+			if err != nil {
+				return err
+			}
+		}
+		if change.TTL != nil {
+			err = dynamodbRequest(ctx, address, "UpdateTimeToLive", map[string]interface{}{
+				"TableName":               spec.Name,
+				"TimeToLiveSpecification": change.TTL,
+			}, nil)
+			if err != nil {
+				return fmt.Errorf("%s: error setting TTL of table %s: %s", spec.Location, spec.Name, dynamodbMessage(err))
+			}
+		}
+		if len(spec.Items) > 0 {
+			put, err := seedItems(ctx, address, spec)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "Seeded %s with %d of %d items.\n", spec.Name, put, len(spec.Items))
+		}
+	}
+	return nil
+}
+
+// ApplyTablesFile plans the changes the tables file needs, prints them and
+// applies them.
+func ApplyTablesFile(ctx context.Context, compose ComposeInfo, path string, w io.Writer) error {
+	specs, err := LoadTableSpecs(path)
+	if err != nil {
+		return err
+	}
+	changes, err := PlanTables(ctx, compose, specs)
+	if err != nil {
+		return err
+	}
+	PrintTablePlan(w, changes)
+	return ApplyTables(ctx, compose, changes, w)
+}
@@ -0,0 +1,414 @@
+package gdc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDynamodb is enough of the DynamoDB API for applying tables files and
+// exporting and importing items. Items are keyed by their id attribute.
+type fakeDynamodb struct {
+	mutex      sync.Mutex
+	tables     map[string]*dynamoTable
+	ttl        map[string]string
+	items      map[string]map[string]map[string]interface{}
+	operations []string
+	requests   map[string][]map[string]interface{}
+	// most items a Scan returns at once, if more than 0
+	scanLimit int
+	// how many BatchWriteItem calls to throttle, and how many to leave half
+	// of the items of unprocessed
+	throttle    int
+	unprocessed int
+	// the BatchWriteItem call to reject, counting from 1
+	rejectBatch int
+	batches     int
+}
+
+func newFakeDynamodb(t *testing.T) (*fakeDynamodb, string) {
+	fake := &fakeDynamodb{
+		tables:   map[string]*dynamoTable{},
+		ttl:      map[string]string{},
+		items:    map[string]map[string]map[string]interface{}{},
+		requests: map[string][]map[string]interface{}{},
+	}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return fake, server.Listener.Addr().String()
+}
+
+func (f *fakeDynamodb) fail(w http.ResponseWriter, kind string, message string) {
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{"__type": "com.amazonaws.dynamodb.v20120810#" + kind, "message": message})
+}
+
+func (f *fakeDynamodb) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	operation := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "DynamoDB_20120810.")
+	body := map[string]interface{}{}
+	json.NewDecoder(r.Body).Decode(&body)
+	f.operations = append(f.operations, operation)
+	f.requests[operation] = append(f.requests[operation], body)
+	name, _ := body["TableName"].(string)
+	if operation == "BatchWriteItem" {
+		f.batchWrite(w, body)
+		return
+	}
+	table := f.tables[name]
+	if table == nil && operation != "CreateTable" {
+		f.fail(w, "ResourceNotFoundException", "Cannot do operations on a non-existent table")
+		return
+	}
+	switch operation {
+	case "DescribeTable":
+		json.NewEncoder(w).Encode(map[string]interface{}{"Table": table})
+	case "CreateTable":
+		table = &dynamoTable{}
+		convert(body, table)
+		table.TableStatus = "ACTIVE"
+		f.tables[name] = table
+		json.NewEncoder(w).Encode(map[string]interface{}{"TableDescription": table})
+	case "UpdateTable":
+		updates := []struct {
+			Create dynamoIndex `json:"Create"`
+		}{}
+		convert(body["GlobalSecondaryIndexUpdates"], &updates)
+		for _, update := range updates {
+			table.GlobalSecondaryIndexes = append(table.GlobalSecondaryIndexes, update.Create)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{})
+	case "DescribeTimeToLive":
+		description := map[string]string{"TimeToLiveStatus": "DISABLED"}
+		if attribute := f.ttl[name]; attribute != "" {
+			description = map[string]string{"TimeToLiveStatus": "ENABLED", "AttributeName": attribute}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"TimeToLiveDescription": description})
+	case "UpdateTimeToLive":
+		ttl := TimeToLive{}
+		convert(body["TimeToLiveSpecification"], &ttl)
+		f.ttl[name] = ""
+		if ttl.Enabled {
+			f.ttl[name] = ttl.AttributeName
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{})
+	case "PutItem":
+		item := body["Item"].(map[string]interface{})
+		if f.items[name][itemKey(item)] != nil {
+			f.fail(w, "ConditionalCheckFailedException", "The conditional request failed")
+			return
+		}
+		f.put(name, item)
+		json.NewEncoder(w).Encode(map[string]interface{}{})
+	case "Scan":
+		f.scan(w, name, body)
+	default:
+		f.fail(w, "UnknownOperationException", operation)
+	}
+}
+
+// itemKey is the item's id attribute as JSON.
+func itemKey(item map[string]interface{}) string {
+	data, _ := json.Marshal(item["id"])
+	return string(data)
+}
+
+func (f *fakeDynamodb) put(table string, item map[string]interface{}) {
+	if f.items[table] == nil {
+		f.items[table] = map[string]map[string]interface{}{}
+	}
+	f.items[table][itemKey(item)] = item
+}
+
+// scan returns the segment's items in key order, a page at a time.
+func (f *fakeDynamodb) scan(w http.ResponseWriter, table string, body map[string]interface{}) {
+	keys := []string{}
+	for key := range f.items[table] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	segment, _ := body["Segment"].(float64)
+	segments, _ := body["TotalSegments"].(float64)
+	start := ""
+	if key, ok := body["ExclusiveStartKey"].(map[string]interface{}); ok {
+		start = itemKey(key)
+	}
+	items := []map[string]interface{}{}
+	var last map[string]interface{}
+	for i, key := range keys {
+		if segments > 0 && i%int(segments) != int(segment) || key <= start {
+			continue
+		}
+		if f.scanLimit > 0 && len(items) == f.scanLimit {
+			last = map[string]interface{}{"id": items[len(items)-1]["id"]}
+			break
+		}
+		items = append(items, f.items[table][key])
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"Items": items, "Count": len(items), "LastEvaluatedKey": last})
+}
+
+// batchWrite puts the items, throttling or leaving some unprocessed as set up.
+func (f *fakeDynamodb) batchWrite(w http.ResponseWriter, body map[string]interface{}) {
+	f.batches++
+	if f.batches == f.rejectBatch {
+		f.fail(w, "ValidationException", "One or more parameter values were invalid")
+		return
+	}
+	if f.throttle > 0 {
+		f.throttle--
+		f.fail(w, "ProvisionedThroughputExceededException", "The level of configured provisioned throughput for the table was exceeded")
+		return
+	}
+	unprocessed := map[string][]interface{}{}
+	for table, requests := range body["RequestItems"].(map[string]interface{}) {
+		if f.tables[table] == nil {
+			f.fail(w, "ResourceNotFoundException", "Requested resource not found")
+			return
+		}
+		requests := requests.([]interface{})
+		if f.unprocessed > 0 {
+			f.unprocessed--
+			unprocessed[table] = requests[len(requests)/2:]
+			requests = requests[:len(requests)/2]
+		}
+		for _, request := range requests {
+			put := request.(map[string]interface{})["PutRequest"].(map[string]interface{})
+			f.put(table, put["Item"].(map[string]interface{}))
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"UnprocessedItems": unprocessed})
+}
+
+// dynamodbCompose is a compose file with dynamodb published on the address.
+func dynamodbCompose(t *testing.T, address string) ComposeInfo {
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ComposeInfo{
+		MainFile:          []byte(fmt.Sprintf("services:\n  dynamodb:\n    image: amazon/dynamodb-local\n    ports: [\"%s:8000\"]\n", port)),
+		RequestedServices: []string{"dynamodb"},
+		Runner:            &RecordingRunner{},
+	}
+}
+
+func writeTablesFile(t *testing.T, contents string) string {
+	path := filepath.Join(t.TempDir(), "tables.yml")
+	if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestAttributeValue(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  string
+	}{
+		{"x", `{"S":"x"}`},
+		{true, `{"BOOL":true}`},
+		{nil, `{"NULL":true}`},
+		{5, `{"N":"5"}`},
+		{int64(-9007199254740993), `{"N":"-9007199254740993"}`},
+		{uint64(12345678901234567890), `{"N":"12345678901234567890"}`},
+		{1.5, `{"N":"1.5"}`},
+		{float32(0.25), `{"N":"0.25"}`},
+		{json.Number("12345678901234567890123456789012345678"), `{"N":"12345678901234567890123456789012345678"}`},
+		{[]interface{}{1, "a"}, `{"L":[{"N":"1"},{"S":"a"}]}`},
+		{map[string]interface{}{"a": 1}, `{"M":{"a":{"N":"1"}}}`},
+	}
+	for _, test := range tests {
+		value, err := attributeValue(test.value)
+		if err != nil {
+			t.Errorf("attributeValue(%v): %s", test.value, err)
+			continue
+		}
+		got, _ := json.Marshal(value)
+		if string(got) != test.want {
+			t.Errorf("attributeValue(%v) = %s, want %s", test.value, got, test.want)
+		}
+	}
+	if _, err := attributeValue(struct{}{}); err == nil {
+		t.Error("expected an error for a struct")
+	}
+}
+
+func TestLoadTableSpecsKeepsNumbers(t *testing.T) {
+	path := writeTablesFile(t, `
+tables:
+  - TableName: counters
+    AttributeDefinitions: [{AttributeName: id, AttributeType: S}]
+    KeySchema: [{AttributeName: id, KeyType: HASH}]
+    Items:
+      - {id: a, big: 12345678901234567890, huge: 12345678901234567890123456789012345678, small: 3, ratio: 0.1, tags: [1, x]}
+`)
+	specs, err := LoadTableSpecs(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	got, _ := json.Marshal(specs[0].Items[0])
+	want := `{"big":{"N":"12345678901234567890"},"huge":{"N":"12345678901234567890123456789012345678"},"id":{"S":"a"},` +
+		`"ratio":{"N":"0.1"},"small":{"N":"3"},"tags":{"L":[{"N":"1"},{"S":"x"}]}}`
+	if string(got) != want {
+		t.Errorf("item = %s, want %s", got, want)
+	}
+}
+
+func TestImportItemKeepsNumbers(t *testing.T) {
+	item, err := importItem([]byte(`{"id": "a", "big": 12345678901234567890123}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	got, _ := json.Marshal(item)
+	if want := `{"big":{"N":"12345678901234567890123"},"id":{"S":"a"}}`; string(got) != want {
+		t.Errorf("item = %s, want %s", got, want)
+	}
+}
+
+const testTables = `
+tables:
+  - TableName: orders
+    AttributeDefinitions:
+      - {AttributeName: id, AttributeType: S}
+      - {AttributeName: customer, AttributeType: S}
+    KeySchema: [{AttributeName: id, KeyType: HASH}]
+    GlobalSecondaryIndexes:
+      - IndexName: by-customer
+        KeySchema: [{AttributeName: customer, KeyType: HASH}]
+        Projection: {ProjectionType: ALL}
+    TimeToLiveSpecification: {AttributeName: expires_at, Enabled: true}
+    Items:
+      - {id: order-1, customer: c1, total: 5}
+      - {id: order-2, customer: c2, total: 12345678901234567890}
+  - TableName: users
+    AttributeDefinitions:
+      - {AttributeName: id, AttributeType: S}
+      - {AttributeName: email, AttributeType: S}
+    KeySchema: [{AttributeName: id, KeyType: HASH}]
+    GlobalSecondaryIndexes:
+      - IndexName: by-email
+        KeySchema: [{AttributeName: email, KeyType: HASH}]
+        Projection: {ProjectionType: ALL}
+    TimeToLiveSpecification: {AttributeName: ttl, Enabled: true}
+`
+
+func TestPlanAndApplyTables(t *testing.T) {
+	dynamodbPollInterval = time.Millisecond
+	fake, address := newFakeDynamodb(t)
+	fake.tables["users"] = &dynamoTable{TableName: "users", TableStatus: "ACTIVE", KeySchema: []dynamoKey{{"id", "HASH"}}}
+	compose := dynamodbCompose(t, address)
+	specs, err := LoadTableSpecs(writeTablesFile(t, testTables))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := PlanTables(context.Background(), compose, specs)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	out := bytes.Buffer{}
+	PrintTablePlan(&out, changes)
+	want := `+ create orders (id HASH)
+    index by-customer (customer HASH)
+    TTL: disabled -> expires_at
+    2 seed items, kept if already there
+~ update users
+    + index by-email
+    TTL: disabled -> ttl
+Plan: 1 to create, 1 to update, 2 items to seed.
+`
+	if out.String() != want {
+		t.Errorf("plan =\n%s\nwant\n%s", out.String(), want)
+	}
+
+	out.Reset()
+	err = ApplyTables(context.Background(), compose, changes, &out)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if out.String() != "Seeded orders with 2 of 2 items.\n" {
+		t.Errorf("output = %q", out.String())
+	}
+	if fake.ttl["orders"] != "expires_at" || fake.ttl["users"] != "ttl" {
+		t.Errorf("TTL = %v, want orders on expires_at and users on ttl", fake.ttl)
+	}
+	if len(fake.tables["users"].GlobalSecondaryIndexes) != 1 {
+		t.Errorf("users indexes = %+v, want by-email added", fake.tables["users"].GlobalSecondaryIndexes)
+	}
+	put := fake.requests["PutItem"][1]
+	if got := put["Item"].(map[string]interface{})["total"]; !reflect.DeepEqual(got, map[string]interface{}{"N": "12345678901234567890"}) {
+		t.Errorf("total = %v, want the number as written", got)
+	}
+	if put["ConditionExpression"] != "attribute_not_exists(#key)" {
+		t.Errorf("PutItem condition = %v", put["ConditionExpression"])
+	}
+
+	// applying again only re-seeds, which keeps the items already there
+	changes, err = PlanTables(context.Background(), compose, specs)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(changes) != 1 || changes[0].Action != TableSeed {
+		t.Fatalf("changes = %+v, want only seeding orders", changes)
+	}
+	out.Reset()
+	if err = ApplyTables(context.Background(), compose, changes, &out); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if out.String() != "Seeded orders with 0 of 2 items.\n" {
+		t.Errorf("output = %q", out.String())
+	}
+}
+
+func TestPlanTablesKeyChange(t *testing.T) {
+	fake, address := newFakeDynamodb(t)
+	fake.tables["users"] = &dynamoTable{TableName: "users", TableStatus: "ACTIVE", KeySchema: []dynamoKey{{"email", "HASH"}}}
+	specs, err := LoadTableSpecs(writeTablesFile(t, testTables))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = PlanTables(context.Background(), dynamodbCompose(t, address), specs)
+	if err == nil || !strings.Contains(err.Error(), "table users is keyed on email HASH, which cannot be changed to id HASH") {
+		t.Errorf("expected key schema error, got %v", err)
+	}
+}
+
+func TestApplyTablesDryRun(t *testing.T) {
+	fake, address := newFakeDynamodb(t)
+	compose := dynamodbCompose(t, address)
+	specs, err := LoadTableSpecs(writeTablesFile(t, testTables))
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes, err := PlanTables(context.Background(), compose, specs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := &Plan{}
+	compose.Runner = plan
+	if err = ApplyTables(context.Background(), compose, changes, &bytes.Buffer{}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, operation := range fake.operations {
+		if operation != "DescribeTable" && operation != "DescribeTimeToLive" {
+			t.Errorf("dry run called %s", operation)
+		}
+	}
+	if len(plan.Steps) != 2 || plan.Steps[0].Request != "create table orders" {
+		t.Errorf("plan = %+v", plan.Steps)
+	}
+}
@@ -0,0 +1,462 @@
+package gdc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kmsg"
+	"gopkg.in/yaml.v3"
+)
+
+// TopicSpec is a topic as declared in a topics file:
+//
+//	topics:
+//	  - name: orders
+//	    partitions: 3
+//	    config:
+//	      cleanup.policy: compact
+type TopicSpec struct {
+	Name              string `yaml:"name" json:"name"`
+	Partitions        int32  `yaml:"partitions" json:"partitions"`
+	ReplicationFactor int16  `yaml:"replication_factor" json:"replication_factor"`
+	// topic configs to set; any others are left as they are
+	Config   map[string]string `yaml:"config" json:"config,omitempty"`
+	Location Location          `yaml:"-" json:"-"`
+}
+
+// Actions in a topic plan.
+const (
+	TopicCreate = "create"
+	TopicAlter  = "alter"
+)
+
+// TopicChange is a change needed to make a topic match its spec.
+type TopicChange struct {
+	Topic  string `json:"topic"`
+	Action string `json:"action"`
+	// for create, the partitions to create the topic with; for alter, the new
+	// number of partitions, or 0 if it stays the same
+	Partitions        int32 `json:"partitions,omitempty"`
+	CurrentPartitions int32 `json:"current_partitions,omitempty"`
+	ReplicationFactor int16 `json:"replication_factor,omitempty"`
+	// configs to set, sorted by name
+	Config []TopicConfigChange `json:"config,omitempty"`
+}
+
+// TopicConfigChange is a topic config to set.
+type TopicConfigChange struct {
+	Name string `json:"name"`
+	// the value in effect now, empty for a new topic
+	From string `json:"from,omitempty"`
+	To   string `json:"to"`
+}
+
+// TopicInfo is a topic on the broker.
+type TopicInfo struct {
+	Name              string `json:"name"`
+	Partitions        int    `json:"partitions"`
+	ReplicationFactor int    `json:"replication_factor"`
+}
+
+// TopicPartition is a partition of a topic on the broker.
+type TopicPartition struct {
+	Partition int32   `json:"partition"`
+	Leader    int32   `json:"leader"`
+	Replicas  []int32 `json:"replicas"`
+	ISR       []int32 `json:"isr"`
+	// offsets of the first and the next message
+	StartOffset int64 `json:"start_offset"`
+	EndOffset   int64 `json:"end_offset"`
+}
+
+// TopicDescription is the partitions and configs of a topic.
+type TopicDescription struct {
+	TopicInfo
+	// configs set on the topic itself rather than inherited from the broker
+	Config     map[string]string `json:"config"`
+	Partitions []TopicPartition  `json:"partitions"`
+}
+
+// LoadTopicSpecs reads a topics file. Partitions and the replication factor
+// default to 1.
+func LoadTopicSpecs(path string) ([]TopicSpec, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	root := yaml.Node{}
+	err = yaml.Unmarshal(data, &root)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(root.Content) == 0 {
+		return nil, fmt.Errorf("%s: file is empty", path)
+	}
+	doc := root.Content[0]
+	topics := mappingValue(doc, "topics")
+	if doc.Kind != yaml.MappingNode || topics == nil || topics.Kind != yaml.SequenceNode {
+		return nil, composeError(Location{path, doc.Line}, "expected a list of topics under topics")
+	}
+	specs := []TopicSpec{}
+	seen := map[string]bool{}
+	for _, item := range topics.Content {
+		location := Location{path, item.Line}
+		spec := TopicSpec{}
+		err = item.Decode(&spec)
+		if err != nil {
+			return nil, composeError(location, "invalid topic: %s", err)
+		}
+		spec.Location = location
+		if spec.Name == "" {
+			return nil, composeError(location, "topic has no name")
+		}
+		if seen[spec.Name] {
+			return nil, composeError(location, "topic %s is declared twice", spec.Name)
+		}
+		seen[spec.Name] = true
+		if spec.Partitions == 0 {
+			spec.Partitions = 1
+		}
+		if spec.ReplicationFactor == 0 {
+			spec.ReplicationFactor = 1
+		}
+		if spec.Partitions < 0 || spec.ReplicationFactor < 0 {
+			return nil, composeError(location, "partitions and replication_factor of topic %s must be positive", spec.Name)
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// PlanTopics compares the specs with the topics on the broker and works out
+// what has to be created or altered. Partitions can only be added and the
+// replication factor cannot be changed, so specs asking for either are
+// reported as errors.
+func PlanTopics(ctx context.Context, compose ComposeInfo, specs []TopicSpec) ([]TopicChange, error) {
+	admin, err := kafkaAdmin(compose)
+	if err != nil {
+		return nil, err
+	}
+	defer admin.Close()
+	names := []string{}
+	for _, spec := range specs {
+		names = append(names, spec.Name)
+	}
+	details, err := admin.ListTopics(ctx, names...)
+	if err != nil {
+		return nil, fmt.Errorf("error listing topics: %w", err)
+	}
+	existing := []string{}
+	for _, name := range names {
+		detail, found := details[name]
+		switch {
+		case !found || errors.Is(detail.Err, kerr.UnknownTopicOrPartition):
+		case detail.Err != nil:
+			return nil, fmt.Errorf("error describing topic %s: %w", name, detail.Err)
+		default:
+			existing = append(existing, name)
+		}
+	}
+	configs, err := admin.DescribeTopicConfigs(ctx, existing...)
+	if err != nil {
+		return nil, fmt.Errorf("error reading topic configs: %w", err)
+	}
+
+	existingTopics := map[string]existingTopic{}
+	for _, name := range existing {
+		detail := details[name]
+		topic := existingTopic{
+			partitions: int32(len(detail.Partitions)),
+			replicas:   detail.Partitions.NumReplicas(),
+			config:     map[string]string{},
+		}
+		if config, err := configs.On(name, nil); err == nil {
+			for _, c := range config.Configs {
+				if c.Value != nil {
+					topic.config[c.Key] = *c.Value
+				}
+			}
+		}
+		existingTopics[name] = topic
+	}
+	return diffTopics(specs, existingTopics)
+}
+
+// existingTopic is what PlanTopics compares a spec with.
+type existingTopic struct {
+	partitions int32
+	replicas   int
+	config     map[string]string
+}
+
+// diffTopics works out the changes that make the existing topics match the
+// specs.
+func diffTopics(specs []TopicSpec, existing map[string]existingTopic) ([]TopicChange, error) {
+	changes := []TopicChange{}
+	problems := []string{}
+	for _, spec := range specs {
+		topic, found := existing[spec.Name]
+		if !found {
+			change := TopicChange{Topic: spec.Name, Action: TopicCreate, Partitions: spec.Partitions, ReplicationFactor: spec.ReplicationFactor}
+			for _, name := range sortedKeys(spec.Config) {
+				change.Config = append(change.Config, TopicConfigChange{Name: name, To: spec.Config[name]})
+			}
+			changes = append(changes, change)
+			continue
+		}
+		change := TopicChange{Topic: spec.Name, Action: TopicAlter}
+		if spec.Partitions < topic.partitions {
+			problems = append(problems, fmt.Sprintf("%s: topic %s has %d partitions, which cannot be reduced to %d - delete and recreate it",
+				spec.Location, spec.Name, topic.partitions, spec.Partitions))
+		} else if spec.Partitions > topic.partitions {
+			change.Partitions = spec.Partitions
+			change.CurrentPartitions = topic.partitions
+		}
+		if topic.replicas != int(spec.ReplicationFactor) {
+			problems = append(problems, fmt.Sprintf("%s: topic %s has a replication factor of %d, which cannot be changed to %d - delete and recreate it",
+				spec.Location, spec.Name, topic.replicas, spec.ReplicationFactor))
+		}
+		for _, name := range sortedKeys(spec.Config) {
+			if value, found := topic.config[name]; !found || value != spec.Config[name] {
+				change.Config = append(change.Config, TopicConfigChange{Name: name, From: topic.config[name], To: spec.Config[name]})
+			}
+		}
+		if change.Partitions != 0 || len(change.Config) > 0 {
+			changes = append(changes, change)
+		}
+	}
+	if len(problems) > 0 {
+		return nil, errors.New(strings.Join(problems, "\n"))
+	}
+	return changes, nil
+}
+
+// PrintTopicPlan describes the changes.
+func PrintTopicPlan(w io.Writer, changes []TopicChange) {
+	if len(changes) == 0 {
+		fmt.Fprintln(w, "Topics are up to date.")
+		return
+	}
+	creates := 0
+	for _, change := range changes {
+		if change.Action == TopicCreate {
+			creates++
+			partitions := "partitions"
+			if change.Partitions == 1 {
+				partitions = "partition"
+			}
+			fmt.Fprintf(w, "+ create %s (%d %s, replication factor %d)\n", change.Topic, change.Partitions, partitions, change.ReplicationFactor)
+			for _, config := range change.Config {
+				fmt.Fprintf(w, "    %s = %s\n", config.Name, config.To)
+			}
+			continue
+		}
+		fmt.Fprintf(w, "~ alter %s\n", change.Topic)
+		if change.Partitions != 0 {
+			fmt.Fprintf(w, "    partitions: %d -> %d\n", change.CurrentPartitions, change.Partitions)
+		}
+		for _, config := range change.Config {
+			from := config.From
+			if from == "" {
+				from = "(default)"
+			}
+			fmt.Fprintf(w, "    %s: %s -> %s\n", config.Name, from, config.To)
+		}
+	}
+	fmt.Fprintf(w, "Plan: %d to create, %d to alter.\n", creates, len(changes)-creates)
+}
+
+// ApplyTopics makes the changes on the broker.
+func ApplyTopics(ctx context.Context, compose ComposeInfo, changes []TopicChange) error {
+	if _, dryRun := compose.Runner.(*Plan); dryRun {
+		for _, change := range changes {
+			dryRunRequest(compose, "kafka", fmt.Sprintf("%s topic %s", change.Action, change.Topic))
+		}
+		return nil
+	}
+	admin, err := kafkaAdmin(compose)
+	if err != nil {
+		return err
+	}
+	defer admin.Close()
+	for _, change := range changes {
+		if change.Action == TopicCreate {
+			configs := map[string]*string{}
+			for _, config := range change.Config {
+				configs[config.Name] = kadm.StringPtr(config.To)
+			}
+			_, err = admin.CreateTopic(ctx, change.Partitions, change.ReplicationFactor, configs, change.Topic)
+			if err != nil {
+				return fmt.Errorf("error creating topic %s: %w", change.Topic, err)
+			}
+			continue
+		}
+		if change.Partitions != 0 {
+			responses, err := admin.UpdatePartitions(ctx, int(change.Partitions), change.Topic)
+			if err == nil {
+				_, err = responses.On(change.Topic, nil)
+			}
+			if err != nil {
+				return fmt.Errorf("error adding partitions to topic %s: %w", change.Topic, err)
+			}
+		}
+		if len(change.Config) > 0 {
+			alters := []kadm.AlterConfig{}
+			for _, config := range change.Config {
+				alters = append(alters, kadm.AlterConfig{Op: kadm.SetConfig, Name: config.Name, Value: kadm.StringPtr(config.To)})
+			}
+			responses, err := admin.AlterTopicConfigs(ctx, alters, change.Topic)
+			if err == nil {
+				_, err = responses.On(change.Topic, nil)
+			}
+			if err != nil {
+				return fmt.Errorf("error altering configs of topic %s: %w", change.Topic, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ApplyTopicsFile plans the changes the topics file needs, prints them and
+// applies them.
+func ApplyTopicsFile(ctx context.Context, compose ComposeInfo, path string, w io.Writer) error {
+	specs, err := LoadTopicSpecs(path)
+	if err != nil {
+		return err
+	}
+	changes, err := PlanTopics(ctx, compose, specs)
+	if err != nil {
+		return err
+	}
+	PrintTopicPlan(w, changes)
+	return ApplyTopics(ctx, compose, changes)
+}
+
+// Topics on the broker, sorted by name. Internal topics, and those whose
+// names start with an underscore such as _schemas, are only included with
+// internal.
+func Topics(ctx context.Context, compose ComposeInfo, internal bool) ([]TopicInfo, error) {
+	admin, err := kafkaAdmin(compose)
+	if err != nil {
+		return nil, err
+	}
+	defer admin.Close()
+	details, err := admin.ListTopicsWithInternal(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing topics: %w", err)
+	}
+	topics := []TopicInfo{}
+	for _, detail := range details.Sorted() {
+		if !internal && (detail.IsInternal || strings.HasPrefix(detail.Topic, "_")) {
+			continue
+		}
+		topics = append(topics, TopicInfo{
+			Name:              detail.Topic,
+			Partitions:        len(detail.Partitions),
+			ReplicationFactor: detail.Partitions.NumReplicas(),
+		})
+	}
+	return topics, nil
+}
+
+// DescribeTopic returns the topic's partitions with their offsets, and the
+// configs set on it.
+func DescribeTopic(ctx context.Context, compose ComposeInfo, topic string) (TopicDescription, error) {
+	description := TopicDescription{Config: map[string]string{}, Partitions: []TopicPartition{}}
+	admin, err := kafkaAdmin(compose)
+	if err != nil {
+		return description, err
+	}
+	defer admin.Close()
+	details, err := admin.ListTopicsWithInternal(ctx, topic)
+	if err != nil {
+		return description, fmt.Errorf("error describing topic %s: %w", topic, err)
+	}
+	detail, found := details[topic]
+	if !found || errors.Is(detail.Err, kerr.UnknownTopicOrPartition) {
+		return description, fmt.Errorf("no topic %s - see kafka topics list", topic)
+	}
+	if detail.Err != nil {
+		return description, fmt.Errorf("error describing topic %s: %w", topic, detail.Err)
+	}
+	description.TopicInfo = TopicInfo{Name: topic, Partitions: len(detail.Partitions), ReplicationFactor: detail.Partitions.NumReplicas()}
+
+	starts, err := admin.ListStartOffsets(ctx, topic)
+	if err == nil {
+		err = starts.Error()
+	}
+	if err != nil {
+		return description, fmt.Errorf("error listing offsets of topic %s: %w", topic, err)
+	}
+	ends, err := admin.ListEndOffsets(ctx, topic)
+	if err == nil {
+		err = ends.Error()
+	}
+	if err != nil {
+		return description, fmt.Errorf("error listing offsets of topic %s: %w", topic, err)
+	}
+	for _, partition := range detail.Partitions.Sorted() {
+		start, _ := starts.Lookup(topic, partition.Partition)
+		end, _ := ends.Lookup(topic, partition.Partition)
+		description.Partitions = append(description.Partitions, TopicPartition{
+			Partition:   partition.Partition,
+			Leader:      partition.Leader,
+			Replicas:    partition.Replicas,
+			ISR:         partition.ISR,
+			StartOffset: start.Offset,
+			EndOffset:   end.Offset,
+		})
+	}
+
+	configs, err := admin.DescribeTopicConfigs(ctx, topic)
+	if err != nil {
+		return description, fmt.Errorf("error reading configs of topic %s: %w", topic, err)
+	}
+	config, err := configs.On(topic, nil)
+	if err != nil {
+		return description, fmt.Errorf("error reading configs of topic %s: %w", topic, err)
+	}
+	for _, c := range config.Configs {
+		if c.Source == kmsg.ConfigSourceDynamicTopicConfig && c.Value != nil {
+			description.Config[c.Key] = *c.Value
+		}
+	}
+	return description, nil
+}
+
+// DeleteTopics deletes the topics from the broker.
+func DeleteTopics(ctx context.Context, compose ComposeInfo, topics []string) error {
+	if _, dryRun := compose.Runner.(*Plan); dryRun {
+		for _, topic := range topics {
+			dryRunRequest(compose, "kafka", "delete topic "+topic)
+		}
+		return nil
+	}
+	admin, err := kafkaAdmin(compose)
+	if err != nil {
+		return err
+	}
+	defer admin.Close()
+	responses, err := admin.DeleteTopics(ctx, topics...)
+	if err != nil {
+		return fmt.Errorf("error deleting topics: %w", err)
+	}
+	problems := []string{}
+	for _, response := range responses.Sorted() {
+		if response.Err != nil {
+			problems = append(problems, fmt.Sprintf("cannot delete topic %s: %s", response.Topic, response.Err))
+		}
+	}
+	sort.Strings(problems)
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "\n"))
+	}
+	return nil
+}
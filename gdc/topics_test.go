@@ -0,0 +1,177 @@
+package gdc
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffTopics(t *testing.T) {
+	existing := map[string]existingTopic{
+		"orders":   {partitions: 3, replicas: 1, config: map[string]string{"cleanup.policy": "delete", "retention.ms": "604800000"}},
+		"payments": {partitions: 1, replicas: 1, config: map[string]string{"cleanup.policy": "compact"}},
+	}
+	tests := []struct {
+		name  string
+		specs []TopicSpec
+		want  []TopicChange
+		err   string
+	}{
+		{
+			name:  "up to date",
+			specs: []TopicSpec{{Name: "orders", Partitions: 3, ReplicationFactor: 1, Config: map[string]string{"cleanup.policy": "delete"}}},
+			want:  []TopicChange{},
+		},
+		{
+			name:  "create",
+			specs: []TopicSpec{{Name: "invoices", Partitions: 2, ReplicationFactor: 1, Config: map[string]string{"retention.ms": "-1", "cleanup.policy": "compact"}}},
+			want: []TopicChange{{
+				Topic: "invoices", Action: TopicCreate, Partitions: 2, ReplicationFactor: 1,
+				Config: []TopicConfigChange{{Name: "cleanup.policy", To: "compact"}, {Name: "retention.ms", To: "-1"}},
+			}},
+		},
+		{
+			name:  "add partitions",
+			specs: []TopicSpec{{Name: "orders", Partitions: 6, ReplicationFactor: 1}},
+			want:  []TopicChange{{Topic: "orders", Action: TopicAlter, Partitions: 6, CurrentPartitions: 3}},
+		},
+		{
+			name: "change and add configs",
+			specs: []TopicSpec{{Name: "orders", Partitions: 3, ReplicationFactor: 1, Config: map[string]string{
+				"cleanup.policy": "compact", "retention.ms": "604800000", "segment.ms": "3600000",
+			}}},
+			want: []TopicChange{{Topic: "orders", Action: TopicAlter, Config: []TopicConfigChange{
+				{Name: "cleanup.policy", From: "delete", To: "compact"},
+				{Name: "segment.ms", To: "3600000"},
+			}}},
+		},
+		{
+			name: "in spec order",
+			specs: []TopicSpec{
+				{Name: "payments", Partitions: 2, ReplicationFactor: 1},
+				{Name: "orders", Partitions: 3, ReplicationFactor: 1},
+				{Name: "invoices", Partitions: 1, ReplicationFactor: 1},
+			},
+			want: []TopicChange{
+				{Topic: "payments", Action: TopicAlter, Partitions: 2, CurrentPartitions: 1},
+				{Topic: "invoices", Action: TopicCreate, Partitions: 1, ReplicationFactor: 1},
+			},
+		},
+		{
+			name: "fewer partitions and another replication factor",
+			specs: []TopicSpec{
+				{Name: "orders", Partitions: 1, ReplicationFactor: 1, Location: Location{"topics.yml", 2}},
+				{Name: "payments", Partitions: 1, ReplicationFactor: 3, Location: Location{"topics.yml", 5}},
+			},
+			err: "topics.yml:2: topic orders has 3 partitions, which cannot be reduced to 1 - delete and recreate it\n" +
+				"topics.yml:5: topic payments has a replication factor of 1, which cannot be changed to 3 - delete and recreate it",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			changes, err := diffTopics(test.specs, existing)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("expected error %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(changes, test.want) {
+				t.Errorf("got %+v, want %+v", changes, test.want)
+			}
+		})
+	}
+}
+
+func TestPrintTopicPlan(t *testing.T) {
+	tests := []struct {
+		name    string
+		changes []TopicChange
+		want    string
+	}{
+		{name: "nothing", changes: []TopicChange{}, want: "Topics are up to date.\n"},
+		{
+			name: "create and alter",
+			changes: []TopicChange{
+				{Topic: "invoices", Action: TopicCreate, Partitions: 1, ReplicationFactor: 1, Config: []TopicConfigChange{{Name: "cleanup.policy", To: "compact"}}},
+				{Topic: "orders", Action: TopicAlter, Partitions: 6, CurrentPartitions: 3, Config: []TopicConfigChange{
+					{Name: "cleanup.policy", From: "delete", To: "compact"},
+					{Name: "segment.ms", To: "3600000"},
+				}},
+			},
+			want: `+ create invoices (1 partition, replication factor 1)
+    cleanup.policy = compact
+~ alter orders
+    partitions: 3 -> 6
+    cleanup.policy: delete -> compact
+    segment.ms: (default) -> 3600000
+Plan: 1 to create, 1 to alter.
+`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var out strings.Builder
+			PrintTopicPlan(&out, test.changes)
+			if out.String() != test.want {
+				t.Errorf("got\n%s\nwant\n%s", out.String(), test.want)
+			}
+		})
+	}
+}
+
+func TestLoadTopicSpecs(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want []TopicSpec
+		err  string
+	}{
+		{
+			name: "defaults",
+			yaml: "topics:\n  - name: orders\n  - name: payments\n    partitions: 3\n    config:\n      cleanup.policy: compact\n",
+			want: []TopicSpec{
+				{Name: "orders", Partitions: 1, ReplicationFactor: 1, Location: Location{"topics.yml", 2}},
+				{Name: "payments", Partitions: 3, ReplicationFactor: 1, Config: map[string]string{"cleanup.policy": "compact"}, Location: Location{"topics.yml", 3}},
+			},
+		},
+		{name: "no topics", yaml: "orders: {}\n", err: "topics.yml:1: expected a list of topics under topics"},
+		{name: "no name", yaml: "topics:\n  - partitions: 2\n", err: "topics.yml:2: topic has no name"},
+		{name: "twice", yaml: "topics:\n  - name: orders\n  - name: orders\n", err: "topics.yml:3: topic orders is declared twice"},
+		{
+			name: "negative partitions",
+			yaml: "topics:\n  - name: orders\n    partitions: -1\n",
+			err:  "topics.yml:2: partitions and replication_factor of topic orders must be positive",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "topics.yml")
+			if err := os.WriteFile(path, []byte(test.yaml), 0644); err != nil {
+				t.Fatal(err)
+			}
+			specs, err := LoadTopicSpecs(path)
+			if test.err != "" {
+				if err == nil || err.Error() != filepath.Join(dir, test.err) {
+					t.Fatalf("expected error %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range test.want {
+				test.want[i].Location.File = path
+			}
+			if !reflect.DeepEqual(specs, test.want) {
+				t.Errorf("got %+v, want %+v", specs, test.want)
+			}
+		})
+	}
+}
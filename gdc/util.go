@@ -0,0 +1,13 @@
+package gdc
+
+import "sort"
+
+// sortedKeys of a map, so output generated from it is stable
+func sortedKeys[V any](m map[string]V) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
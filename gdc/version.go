@@ -0,0 +1,4 @@
+package gdc
+
+// Version of gdc, recorded in snapshots.
+const Version = "0.12.0"
@@ -0,0 +1,93 @@
+package gdc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// The compose files gdc generates are written to a private directory that
+// belongs to this process alone, so concurrent invocations never share them
+// and a stale copy left behind by another version is never picked up.
+var (
+	workDirOnce sync.Once
+	workDirPath string
+	// set once this process has created the directory, so that Cleanup never
+	// removes one a dry run only pretended to write to
+	workDirCreated bool
+	// sha256 of every file written, keyed by path
+	generated      = map[string][sha256.Size]byte{}
+	generatedMutex sync.Mutex
+)
+
+// workDir is the path of this process's private directory. It is only
+// created when the first file is written into it.
+func workDir() string {
+	workDirOnce.Do(func() {
+		suffix := make([]byte, 8)
+		rand.Read(suffix)
+		workDirPath = filepath.Join(os.TempDir(), fmt.Sprintf("gdc-%d-%s", os.Getpid(), hex.EncodeToString(suffix)))
+	})
+	return workDirPath
+}
+
+// generatedPath of a file gdc writes.
+func generatedPath(name string) string {
+	return filepath.Join(workDir(), name)
+}
+
+// materialize writes the file into the private directory, or leaves it if it
+// is already there with the expected contents. The file is read back and its
+// hash checked, so a truncated or tampered file is never handed to Compose.
+func materialize(path string, data []byte) error {
+	generatedMutex.Lock()
+	defer generatedMutex.Unlock()
+	sum := sha256.Sum256(data)
+	if !workDirCreated {
+		// Mkdir fails if something is already there, so nobody else can have
+		// prepared the directory for us
+		err := os.Mkdir(workDir(), 0700)
+		if err != nil {
+			return fmt.Errorf("error creating directory for generated compose files: %w", err)
+		}
+		workDirCreated = true
+	}
+	if existing, found := generated[path]; found && existing == sum && hashFile(path) == sum {
+		return nil
+	}
+	err := ioutil.WriteFile(path, data, 0600)
+	if err != nil {
+		return err
+	}
+	if hashFile(path) != sum {
+		return fmt.Errorf("generated file %s does not have the expected contents", path)
+	}
+	generated[path] = sum
+	return nil
+}
+
+// hashFile returns the sha256 of the file, or all zeroes if it can't be read.
+func hashFile(path string) [sha256.Size]byte {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return [sha256.Size]byte{}
+	}
+	return sha256.Sum256(data)
+}
+
+// Cleanup the generated files. Call it once gdc is done, including when
+// exiting on a signal.
+func Cleanup() {
+	generatedMutex.Lock()
+	defer generatedMutex.Unlock()
+	if workDirCreated {
+		os.RemoveAll(workDir())
+		workDirCreated = false
+		generated = map[string][sha256.Size]byte{}
+	}
+}
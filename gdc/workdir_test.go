@@ -0,0 +1,129 @@
+package gdc
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMaterialize(t *testing.T) {
+	Cleanup()
+	defer Cleanup()
+	path := generatedPath("test.yml")
+	if filepath.Dir(path) != workDir() || !strings.HasPrefix(filepath.Base(workDir()), "gdc-"+strconv.Itoa(os.Getpid())+"-") {
+		t.Fatalf("unexpected generated path %s", path)
+	}
+	if _, err := os.Stat(workDir()); !os.IsNotExist(err) {
+		t.Fatalf("expected the directory to be created on the first write, got %v", err)
+	}
+
+	err := materialize(path, []byte("services: {}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := os.Stat(workDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dir.Mode().Perm() != 0700 {
+		t.Errorf("directory mode = %s, want 0700", dir.Mode().Perm())
+	}
+	file, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Mode().Perm() != 0600 {
+		t.Errorf("file mode = %s, want 0600", file.Mode().Perm())
+	}
+
+	// a tampered file is written again
+	if err := os.WriteFile(path, []byte("services: {evil: {}}\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := materialize(path, []byte("services: {}\n")); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "services: {}\n" {
+		t.Errorf("expected the file to be rewritten, got %q", data)
+	}
+
+	Cleanup()
+	if _, err := os.Stat(workDir()); !os.IsNotExist(err) {
+		t.Errorf("expected Cleanup to remove the directory, got %v", err)
+	}
+}
+
+func TestMaterializeRefusesExistingDirectory(t *testing.T) {
+	Cleanup()
+	defer Cleanup()
+	// someone else prepared the directory before this process wrote anything
+	if err := os.Mkdir(workDir(), 0777); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(workDir())
+	err := materialize(generatedPath("test.yml"), []byte("services: {}\n"))
+	if err == nil || !strings.Contains(err.Error(), "error creating directory for generated compose files") {
+		t.Errorf("expected the directory to be refused, got %v", err)
+	}
+}
+
+func TestLockProject(t *testing.T) {
+	interval := lockRetryInterval
+	lockRetryInterval = 10 * time.Millisecond
+	defer func() { lockRetryInterval = interval }()
+	compose, _ := testComposeInfo(t)
+
+	release, err := lockProject(context.Background(), compose)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(os.Getenv("HOME"), ".gdc", "global.lock")
+	if data, _ := os.ReadFile(path); strings.TrimSpace(string(data)) != strconv.Itoa(os.Getpid()) {
+		t.Errorf("expected the lock to record this process, got %q", data)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := lockProject(ctx, compose); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected to wait for the lock until the context is done, got %v", err)
+	}
+
+	acquired := make(chan func())
+	go func() {
+		release, err := lockProject(context.Background(), compose)
+		if err != nil {
+			t.Error(err)
+		}
+		acquired <- release
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("lock was taken twice")
+	case <-time.After(50 * time.Millisecond):
+	}
+	release()
+	select {
+	case release := <-acquired:
+		release()
+	case <-time.After(5 * time.Second):
+		t.Fatal("lock was not taken once released")
+	}
+}
+
+func TestLockProjectDryRun(t *testing.T) {
+	compose, _ := testComposeInfo(t)
+	compose.Runner = &Plan{}
+	release, err := lockProject(context.Background(), compose)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	if _, err := os.Stat(filepath.Join(os.Getenv("HOME"), ".gdc")); !os.IsNotExist(err) {
+		t.Errorf("expected a dry run to leave the home directory alone, got %v", err)
+	}
+}